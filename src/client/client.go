@@ -0,0 +1,538 @@
+// Package client is a typed Go client for the Draftsmith REST API.
+//
+// Its types mirror the schemas of the OpenAPI document served at
+// /openapi.json and every endpoint it calls is listed in Endpoints.
+// `draftsmith openapi --check` fails if either drifts from the server.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a running Draftsmith server
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Timezone is sent as the X-Timezone header if set
+	Timezone string
+}
+
+// New returns a client for the server at baseURL, e.g. http://localhost:37238
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int
+	APIError
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s (%d %s)", e.Message, e.StatusCode, e.Code)
+	for _, d := range e.Details {
+		msg += fmt.Sprintf("\n  %s: %s", d.Field, d.Message)
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a 404 from the server
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// request builds a request for an endpoint such as "GET /notes/{id}", the
+// path parameters are filled in from params in order
+func (c *Client) request(ctx context.Context, endpoint string, params []interface{}, query url.Values, body io.Reader) (*http.Request, error) {
+	method, path, ok := strings.Cut(endpoint, " ")
+	if !ok {
+		return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	for _, p := range params {
+		start := strings.Index(path, "{")
+		end := strings.Index(path, "}")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("too many parameters for %s", endpoint)
+		}
+		path = path[:start] + url.PathEscape(fmt.Sprint(p)) + path[end+1:]
+	}
+	if strings.Contains(path, "{") {
+		return nil, fmt.Errorf("missing parameters for %s", endpoint)
+	}
+
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Timezone != "" {
+		req.Header.Set("X-Timezone", c.Timezone)
+	}
+	return req, nil
+}
+
+// send performs the request and turns error responses into *Error
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		data, _ := io.ReadAll(resp.Body)
+		var envelope struct {
+			Error APIError `json:"error"`
+		}
+		if json.Unmarshal(data, &envelope) == nil && envelope.Error.Message != "" {
+			apiErr.APIError = envelope.Error
+		} else {
+			apiErr.Message = strings.TrimSpace(string(data))
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do sends in as JSON, if not nil, and decodes the response into out, if
+// not nil
+func (c *Client) do(ctx context.Context, endpoint string, params []interface{}, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("error encoding request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := c.request(ctx, endpoint, params, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding response: %w", err)
+	}
+	return nil
+}
+
+// Notes
+
+func (c *Client) ListNotes(ctx context.Context) ([]Note, error) {
+	var notes []Note
+	err := c.do(ctx, EndpointListNotes, nil, nil, nil, &notes)
+	return notes, err
+}
+
+func (c *Client) GetNote(ctx context.Context, id int) (*Note, error) {
+	var note Note
+	if err := c.do(ctx, EndpointGetNote, []interface{}{id}, nil, nil, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+func (c *Client) ListNoteSummaries(ctx context.Context) ([]NoteSummary, error) {
+	var notes []NoteSummary
+	err := c.do(ctx, EndpointListNoteSummaries, nil, nil, nil, &notes)
+	return notes, err
+}
+
+func (c *Client) SearchNotes(ctx context.Context, q string) ([]NoteInfo, error) {
+	var notes []NoteInfo
+	err := c.do(ctx, EndpointSearchNotes, nil, url.Values{"q": {q}}, nil, &notes)
+	return notes, err
+}
+
+// CreateNote returns the ID of the new note
+func (c *Client) CreateNote(ctx context.Context, note NewNote) (int, error) {
+	var resp MessageResponse
+	err := c.do(ctx, EndpointCreateNote, nil, nil, note, &resp)
+	return resp.ID, err
+}
+
+func (c *Client) UpdateNote(ctx context.Context, id int, update NoteUpdate) error {
+	return c.do(ctx, EndpointUpdateNote, []interface{}{id}, nil, update, nil)
+}
+
+func (c *Client) DeleteNote(ctx context.Context, id int) error {
+	return c.do(ctx, EndpointDeleteNote, []interface{}{id}, nil, nil, nil)
+}
+
+func (c *Client) NoteTree(ctx context.Context) ([]*NoteTree, error) {
+	var tree []*NoteTree
+	err := c.do(ctx, EndpointNoteTree, nil, nil, nil, &tree)
+	return tree, err
+}
+
+func (c *Client) AddNoteHierarchyEntry(ctx context.Context, entry NoteHierarchyEntry) error {
+	return c.do(ctx, EndpointAddNoteHierarchyEntry, nil, nil, entry, nil)
+}
+
+func (c *Client) UpdateNoteHierarchyEntry(ctx context.Context, childID int, entry NoteHierarchyEntry) error {
+	return c.do(ctx, EndpointUpdateNoteHierarchyEntry, []interface{}{childID}, nil, entry, nil)
+}
+
+func (c *Client) DeleteNoteHierarchyEntry(ctx context.Context, childID int) error {
+	return c.do(ctx, EndpointDeleteNoteHierarchyEntry, []interface{}{childID}, nil, nil, nil)
+}
+
+func (c *Client) TagNote(ctx context.Context, noteID, tagID int) error {
+	return c.do(ctx, EndpointTagNote, []interface{}{noteID}, nil, AddTagToNote{TagID: tagID}, nil)
+}
+
+// Tags
+
+func (c *Client) ListTags(ctx context.Context) ([]Tag, error) {
+	var tags []Tag
+	err := c.do(ctx, EndpointListTags, nil, nil, nil, &tags)
+	return tags, err
+}
+
+// CreateTag returns the ID of the new tag
+func (c *Client) CreateTag(ctx context.Context, name string) (int, error) {
+	var resp MessageResponse
+	err := c.do(ctx, EndpointCreateTag, nil, nil, NewTag{Name: name}, &resp)
+	return resp.ID, err
+}
+
+func (c *Client) RenameTag(ctx context.Context, id int, name string) error {
+	return c.do(ctx, EndpointRenameTag, []interface{}{id}, nil, UpdateTagRequest{Name: name}, nil)
+}
+
+func (c *Client) DeleteTag(ctx context.Context, id int) error {
+	return c.do(ctx, EndpointDeleteTag, []interface{}{id}, nil, nil, nil)
+}
+
+func (c *Client) TagTree(ctx context.Context) ([]*TagTree, error) {
+	var tree []*TagTree
+	err := c.do(ctx, EndpointTagTree, nil, nil, nil, &tree)
+	return tree, err
+}
+
+func (c *Client) AddTagHierarchyEntry(ctx context.Context, parentID, childID int) error {
+	return c.do(ctx, EndpointAddTagHierarchyEntry, nil, nil, TagHierarchyEntry{ParentTagID: parentID, ChildTagID: childID}, nil)
+}
+
+func (c *Client) UpdateTagHierarchyEntry(ctx context.Context, childID, parentID int) error {
+	return c.do(ctx, EndpointUpdateTagHierarchyEntry, []interface{}{childID}, nil, UpdateTagHierarchyEntry{ParentTagID: parentID}, nil)
+}
+
+func (c *Client) DeleteTagHierarchyEntry(ctx context.Context, childID int) error {
+	return c.do(ctx, EndpointDeleteTagHierarchyEntry, []interface{}{childID}, nil, nil, nil)
+}
+
+// Tasks
+
+func (c *Client) ListTasks(ctx context.Context) ([]TaskWithDetails, error) {
+	var tasks []TaskWithDetails
+	err := c.do(ctx, EndpointListTasks, nil, nil, nil, &tasks)
+	return tasks, err
+}
+
+func (c *Client) ActionableTasks(ctx context.Context) ([]TaskWithDetails, error) {
+	var tasks []TaskWithDetails
+	err := c.do(ctx, EndpointActionableTasks, nil, nil, nil, &tasks)
+	return tasks, err
+}
+
+// NextTasks ranks the next actions, query takes the parameters of
+// GET /tasks/next such as minutes, tags and limit
+func (c *Client) NextTasks(ctx context.Context, query url.Values) ([]NextTask, error) {
+	var tasks []NextTask
+	err := c.do(ctx, EndpointNextTasks, nil, query, nil, &tasks)
+	return tasks, err
+}
+
+// CreateTask returns the ID of the new task
+func (c *Client) CreateTask(ctx context.Context, task NewTask) (int, error) {
+	var resp MessageResponse
+	err := c.do(ctx, EndpointCreateTask, nil, nil, task, &resp)
+	return resp.ID, err
+}
+
+func (c *Client) UpdateTask(ctx context.Context, id int, update UpdateTask) (*TaskUpdateResponse, error) {
+	var resp TaskUpdateResponse
+	if err := c.do(ctx, EndpointUpdateTask, []interface{}{id}, nil, update, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) DeleteTask(ctx context.Context, id int) error {
+	return c.do(ctx, EndpointDeleteTask, []interface{}{id}, nil, nil, nil)
+}
+
+func (c *Client) TaskCompletions(ctx context.Context, id int) ([]TaskCompletion, error) {
+	var completions []TaskCompletion
+	err := c.do(ctx, EndpointTaskCompletions, []interface{}{id}, nil, nil, &completions)
+	return completions, err
+}
+
+func (c *Client) TaskStatusChanges(ctx context.Context, id int) ([]TaskStatusChange, error) {
+	var changes []TaskStatusChange
+	err := c.do(ctx, EndpointTaskStatusChanges, []interface{}{id}, nil, nil, &changes)
+	return changes, err
+}
+
+// TaskHistory lists the changes to a task, or to one field if field is not
+// empty
+func (c *Client) TaskHistory(ctx context.Context, id int, field string) ([]TaskHistoryEntry, error) {
+	var query url.Values
+	if field != "" {
+		query = url.Values{"field": {field}}
+	}
+	var history []TaskHistoryEntry
+	err := c.do(ctx, EndpointTaskHistory, []interface{}{id}, query, nil, &history)
+	return history, err
+}
+
+func (c *Client) TaskDependencies(ctx context.Context, id int) ([]TaskDependency, error) {
+	var deps []TaskDependency
+	err := c.do(ctx, EndpointTaskDependencies, []interface{}{id}, nil, nil, &deps)
+	return deps, err
+}
+
+func (c *Client) AddTaskDependency(ctx context.Context, id, dependsOn int) error {
+	return c.do(ctx, EndpointAddTaskDependency, []interface{}{id}, nil, NewTaskDependency{DependsOn: dependsOn}, nil)
+}
+
+func (c *Client) RemoveTaskDependency(ctx context.Context, id, dependsOn int) error {
+	return c.do(ctx, EndpointRemoveTaskDependency, []interface{}{id, dependsOn}, nil, nil, nil)
+}
+
+func (c *Client) ListTaskStatuses(ctx context.Context) ([]TaskStatus, error) {
+	var statuses []TaskStatus
+	err := c.do(ctx, EndpointListTaskStatuses, nil, nil, nil, &statuses)
+	return statuses, err
+}
+
+// Schedules and clocks
+
+// CreateSchedule returns the ID of the new schedule
+func (c *Client) CreateSchedule(ctx context.Context, schedule NewTaskSchedule) (int, error) {
+	var resp MessageResponse
+	err := c.do(ctx, EndpointCreateSchedule, nil, nil, schedule, &resp)
+	return resp.ID, err
+}
+
+func (c *Client) UpdateSchedule(ctx context.Context, id int, update UpdateTaskSchedule) error {
+	return c.do(ctx, EndpointUpdateSchedule, []interface{}{id}, nil, update, nil)
+}
+
+func (c *Client) DeleteSchedule(ctx context.Context, id int) error {
+	return c.do(ctx, EndpointDeleteSchedule, []interface{}{id}, nil, nil, nil)
+}
+
+// CreateClock returns the ID of the new clock entry
+func (c *Client) CreateClock(ctx context.Context, clock NewTaskClock) (int, error) {
+	var resp MessageResponse
+	err := c.do(ctx, EndpointCreateClock, nil, nil, clock, &resp)
+	return resp.ID, err
+}
+
+func (c *Client) UpdateClock(ctx context.Context, id int, update UpdateTaskClock) error {
+	return c.do(ctx, EndpointUpdateClock, []interface{}{id}, nil, update, nil)
+}
+
+func (c *Client) DeleteClock(ctx context.Context, id int) error {
+	return c.do(ctx, EndpointDeleteClock, []interface{}{id}, nil, nil, nil)
+}
+
+// StartClock starts the clock on a task, stopping any running clock
+func (c *Client) StartClock(ctx context.Context, taskID int) (*ClockResponse, error) {
+	var resp ClockResponse
+	if err := c.do(ctx, EndpointStartClock, []interface{}{taskID}, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) StopClock(ctx context.Context, taskID int) (*ClockResponse, error) {
+	var resp ClockResponse
+	if err := c.do(ctx, EndpointStopClock, []interface{}{taskID}, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CurrentClock(ctx context.Context) (*RunningClock, error) {
+	var clock RunningClock
+	if err := c.do(ctx, EndpointCurrentClock, nil, nil, nil, &clock); err != nil {
+		return nil, err
+	}
+	return &clock, nil
+}
+
+// Planning
+
+// Agenda returns the agenda for the dates from to to inclusive (YYYY-MM-DD),
+// the server defaults to the 7 days starting today when they are empty
+func (c *Client) Agenda(ctx context.Context, from, to string) (*Agenda, error) {
+	query := url.Values{}
+	if from != "" {
+		query.Set("from", from)
+	}
+	if to != "" {
+		query.Set("to", to)
+	}
+	var agenda Agenda
+	if err := c.do(ctx, EndpointAgenda, nil, query, nil, &agenda); err != nil {
+		return nil, err
+	}
+	return &agenda, nil
+}
+
+// Assets
+
+func (c *Client) ListAssets(ctx context.Context) ([]FileInfo, error) {
+	var files []FileInfo
+	err := c.do(ctx, EndpointListAssets, nil, nil, nil, &files)
+	return files, err
+}
+
+// AssetID finds an asset by its file name
+func (c *Client) AssetID(ctx context.Context, filename string) (int, error) {
+	var resp AssetIDResponse
+	err := c.do(ctx, EndpointAssetID, nil, url.Values{"filename": {filename}}, nil, &resp)
+	return resp.ID, err
+}
+
+// UploadAsset uploads the contents of r as filename, the server may rename
+// the file to avoid a clash
+func (c *Client) UploadAsset(ctx context.Context, filename string, r io.Reader, assetType, description string) (*UploadResponse, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filename, err)
+	}
+	if assetType != "" {
+		mw.WriteField("asset_type", assetType)
+	}
+	if description != "" {
+		mw.WriteField("description", description)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.request(ctx, EndpointUploadAsset, nil, nil, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var upload UploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return &upload, nil
+}
+
+// DownloadAsset writes the contents of an asset to w
+func (c *Client) DownloadAsset(ctx context.Context, id int, w io.Writer) error {
+	req, err := c.request(ctx, EndpointDownloadAsset, []interface{}{id}, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *Client) DeleteAsset(ctx context.Context, id int) error {
+	return c.do(ctx, EndpointDeleteAsset, []interface{}{id}, nil, nil, nil)
+}
+
+// Org mode
+
+// ExportOrg returns the notes as an org document, or only the subtree of
+// root if it is not zero
+func (c *Client) ExportOrg(ctx context.Context, root int) (string, error) {
+	var query url.Values
+	if root != 0 {
+		query = url.Values{"root": {strconv.Itoa(root)}}
+	}
+	req, err := c.request(ctx, EndpointExportOrg, nil, query, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// ImportOrg imports an org document under parent, or at the top level if
+// parent is zero, and returns the IDs of the top-level notes created
+func (c *Client) ImportOrg(ctx context.Context, parent int, r io.Reader) ([]int, error) {
+	var query url.Values
+	if parent != 0 {
+		query = url.Values{"parent": {strconv.Itoa(parent)}}
+	}
+	req, err := c.request(ctx, EndpointImportOrg, nil, query, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result OrgImportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return result.IDs, nil
+}
@@ -0,0 +1,88 @@
+package client
+
+// Endpoints called by the client, as "METHOD /path" with the path as it
+// appears in the OpenAPI document
+const (
+	EndpointListNotes                = "GET /notes"
+	EndpointGetNote                  = "GET /notes/{id}"
+	EndpointListNoteSummaries        = "GET /notes/no-content"
+	EndpointSearchNotes              = "GET /notes/search"
+	EndpointCreateNote               = "POST /notes"
+	EndpointUpdateNote               = "PUT /notes/{id}"
+	EndpointDeleteNote               = "DELETE /notes/{id}"
+	EndpointNoteTree                 = "GET /notes/tree"
+	EndpointAddNoteHierarchyEntry    = "POST /notes/hierarchy"
+	EndpointUpdateNoteHierarchyEntry = "PUT /notes/hierarchy/{childId}"
+	EndpointDeleteNoteHierarchyEntry = "DELETE /notes/hierarchy/{childId}"
+	EndpointTagNote                  = "POST /notes/{id}/tags"
+
+	EndpointListTags                = "GET /tags"
+	EndpointCreateTag               = "POST /tags"
+	EndpointRenameTag               = "PUT /tags/{id}"
+	EndpointDeleteTag               = "DELETE /tags/{id}"
+	EndpointTagTree                 = "GET /tags/tree"
+	EndpointAddTagHierarchyEntry    = "POST /tags/hierarchy"
+	EndpointUpdateTagHierarchyEntry = "PUT /tags/hierarchy/{childId}"
+	EndpointDeleteTagHierarchyEntry = "DELETE /tags/hierarchy/{childId}"
+
+	EndpointListTasks            = "GET /tasks/details"
+	EndpointActionableTasks      = "GET /tasks/actionable"
+	EndpointNextTasks            = "GET /tasks/next"
+	EndpointCreateTask           = "POST /tasks"
+	EndpointUpdateTask           = "PUT /tasks/{id}"
+	EndpointDeleteTask           = "DELETE /tasks/{id}"
+	EndpointTaskCompletions      = "GET /tasks/{id}/completions"
+	EndpointTaskStatusChanges    = "GET /tasks/{id}/status_changes"
+	EndpointTaskHistory          = "GET /tasks/{id}/history"
+	EndpointTaskDependencies     = "GET /tasks/{id}/dependencies"
+	EndpointAddTaskDependency    = "POST /tasks/{id}/dependencies"
+	EndpointRemoveTaskDependency = "DELETE /tasks/{id}/dependencies/{dependsOn}"
+	EndpointListTaskStatuses     = "GET /task_statuses"
+
+	EndpointCreateSchedule = "POST /task_schedules"
+	EndpointUpdateSchedule = "PUT /task_schedules/{id}"
+	EndpointDeleteSchedule = "DELETE /task_schedules/{id}"
+	EndpointCreateClock    = "POST /task_clocks"
+	EndpointUpdateClock    = "PUT /task_clocks/{id}"
+	EndpointDeleteClock    = "DELETE /task_clocks/{id}"
+	EndpointStartClock     = "POST /tasks/{id}/clock/start"
+	EndpointStopClock      = "POST /tasks/{id}/clock/stop"
+	EndpointCurrentClock   = "GET /clock/current"
+
+	EndpointAgenda = "GET /agenda"
+
+	EndpointListAssets    = "GET /assets"
+	EndpointAssetID       = "GET /assets/id"
+	EndpointUploadAsset   = "POST /upload"
+	EndpointDownloadAsset = "GET /assets/{id}/download"
+	EndpointDeleteAsset   = "DELETE /assets/{id}"
+
+	EndpointExportOrg = "GET /export/org"
+	EndpointImportOrg = "POST /import/org"
+)
+
+// Endpoints lists every endpoint the client calls
+var Endpoints = []string{
+	EndpointListNotes, EndpointGetNote, EndpointListNoteSummaries, EndpointSearchNotes, EndpointCreateNote,
+	EndpointUpdateNote, EndpointDeleteNote, EndpointNoteTree, EndpointAddNoteHierarchyEntry,
+	EndpointUpdateNoteHierarchyEntry, EndpointDeleteNoteHierarchyEntry, EndpointTagNote,
+
+	EndpointListTags, EndpointCreateTag, EndpointRenameTag, EndpointDeleteTag, EndpointTagTree,
+	EndpointAddTagHierarchyEntry, EndpointUpdateTagHierarchyEntry, EndpointDeleteTagHierarchyEntry,
+
+	EndpointListTasks, EndpointActionableTasks, EndpointNextTasks, EndpointCreateTask,
+	EndpointUpdateTask, EndpointDeleteTask, EndpointTaskCompletions, EndpointTaskStatusChanges,
+	EndpointTaskHistory, EndpointTaskDependencies, EndpointAddTaskDependency,
+	EndpointRemoveTaskDependency, EndpointListTaskStatuses,
+
+	EndpointCreateSchedule, EndpointUpdateSchedule, EndpointDeleteSchedule, EndpointCreateClock,
+	EndpointUpdateClock, EndpointDeleteClock, EndpointStartClock, EndpointStopClock,
+	EndpointCurrentClock,
+
+	EndpointAgenda,
+
+	EndpointListAssets, EndpointAssetID, EndpointUploadAsset, EndpointDownloadAsset,
+	EndpointDeleteAsset,
+
+	EndpointExportOrg, EndpointImportOrg,
+}
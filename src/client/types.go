@@ -0,0 +1,413 @@
+package client
+
+import "encoding/json"
+
+// Types of the request and response bodies. Each type has the name of the
+// schema it mirrors in the OpenAPI document and is listed in Schemas.
+
+// Schemas maps schema names to the types mirroring them
+var Schemas = map[string]interface{}{
+	"APIError":                APIError{},
+	"ErrorDetail":             ErrorDetail{},
+	"MessageResponse":         MessageResponse{},
+	"Note":                    Note{},
+	"NoteSummary":             NoteSummary{},
+	"NoteInfo":                NoteInfo{},
+	"NewNote":                 NewNote{},
+	"NoteUpdate":              NoteUpdate{},
+	"NoteTree":                NoteTree{},
+	"NoteHierarchyEntry":      NoteHierarchyEntry{},
+	"AddTagToNote":            AddTagToNote{},
+	"Tag":                     Tag{},
+	"NewTag":                  NewTag{},
+	"UpdateTagRequest":        UpdateTagRequest{},
+	"TagTree":                 TagTree{},
+	"TagHierarchyEntry":       TagHierarchyEntry{},
+	"UpdateTagHierarchyEntry": UpdateTagHierarchyEntry{},
+	"TaskWithDetails":         TaskWithDetails{},
+	"TaskSchedule":            TaskSchedule{},
+	"TaskClock":               TaskClock{},
+	"NewTask":                 NewTask{},
+	"UpdateTask":              UpdateTask{},
+	"TaskUpdateResponse":      TaskUpdateResponse{},
+	"NextTask":                NextTask{},
+	"ScoreFactor":             ScoreFactor{},
+	"TaskStatus":              TaskStatus{},
+	"TaskStatusChange":        TaskStatusChange{},
+	"TaskCompletion":          TaskCompletion{},
+	"TaskHistoryEntry":        TaskHistoryEntry{},
+	"TaskDependency":          TaskDependency{},
+	"NewTaskDependency":       NewTaskDependency{},
+	"NewTaskSchedule":         NewTaskSchedule{},
+	"UpdateTaskSchedule":      UpdateTaskSchedule{},
+	"NewTaskClock":            NewTaskClock{},
+	"UpdateTaskClock":         UpdateTaskClock{},
+	"ClockResponse":           ClockResponse{},
+	"RunningClock":            RunningClock{},
+	"Agenda":                  Agenda{},
+	"AgendaDay":               AgendaDay{},
+	"AgendaItem":              AgendaItem{},
+	"AgendaJournalEntry":      AgendaJournalEntry{},
+	"AgendaClock":             AgendaClock{},
+	"FileInfo":                FileInfo{},
+	"UploadResponse":          UploadResponse{},
+	"AssetIDResponse":         AssetIDResponse{},
+	"OrgImportResponse":       OrgImportResponse{},
+}
+
+// ErrorDetail describes what is wrong with one field of a request
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is the body of an error response
+type APIError struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// MessageResponse is the body of a successful change, ID or Name is set
+// when something was created
+type MessageResponse struct {
+	Message string `json:"message"`
+	ID      int    `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// Note is a note with its content
+type Note struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Content    string `json:"content"`
+	CreatedAt  string `json:"created_at"`
+	ModifiedAt string `json:"modified_at"`
+}
+
+// NoteSummary is a note without its content
+type NoteSummary struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	CreatedAt  string `json:"created_at"`
+	ModifiedAt string `json:"modified_at"`
+}
+
+// NoteInfo is the ID and title of a note
+type NoteInfo struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+type NewNote struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// NoteUpdate changes the fields that are not nil
+type NoteUpdate struct {
+	Title   *string `json:"title,omitempty"`
+	Content *string `json:"content,omitempty"`
+}
+
+// NoteTree is a note and its children
+type NoteTree struct {
+	ID       int         `json:"id"`
+	Title    string      `json:"title"`
+	Type     string      `json:"type"`
+	Children []*NoteTree `json:"children,omitempty"`
+}
+
+// NoteHierarchyEntry places a note under a parent, HierarchyType is page,
+// block or subpage
+type NoteHierarchyEntry struct {
+	ParentNoteID  int    `json:"parent_note_id"`
+	HierarchyType string `json:"hierarchy_type"`
+	ChildNoteID   int    `json:"child_note_id"`
+}
+
+type AddTagToNote struct {
+	TagID int `json:"tag_id"`
+}
+
+type Tag struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type NewTag struct {
+	Name string `json:"name"`
+}
+
+type UpdateTagRequest struct {
+	Name string `json:"name"`
+}
+
+// TagTree is a tag with its notes and child tags
+type TagTree struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	Notes    []NoteInfo `json:"notes"`
+	Children []*TagTree `json:"children,omitempty"`
+}
+
+type TagHierarchyEntry struct {
+	ParentTagID int `json:"parent_tag_id"`
+	ChildTagID  int `json:"child_tag_id"`
+}
+
+type UpdateTagHierarchyEntry struct {
+	ParentTagID int `json:"parent_tag_id"`
+}
+
+// TaskWithDetails is a task with its schedules and clocks
+type TaskWithDetails struct {
+	ID                   int            `json:"id"`
+	NoteID               int            `json:"note_id"`
+	Status               string         `json:"status"`
+	EffortEstimate       float64        `json:"effort_estimate"`
+	ActualEffort         float64        `json:"actual_effort"`
+	ClockedEffort        float64        `json:"clocked_effort"`
+	ActualEffortOverride *float64       `json:"actual_effort_override"`
+	EffortVariance       *float64       `json:"effort_variance"`
+	Deadline             string         `json:"deadline"`
+	Priority             int            `json:"priority"`
+	AllDay               bool           `json:"all_day"`
+	GoalRelationship     int            `json:"goal_relationship"`
+	RepeatRule           string         `json:"repeat_rule"`
+	CreatedAt            string         `json:"created_at"`
+	ModifiedAt           string         `json:"modified_at"`
+	Schedules            []TaskSchedule `json:"schedules"`
+	Clocks               []TaskClock    `json:"clocks"`
+	DependsOn            []int          `json:"depends_on"`
+	BlockedBy            []int          `json:"blocked_by"`
+}
+
+type TaskSchedule struct {
+	ID            int    `json:"id"`
+	StartDatetime string `json:"start_datetime"`
+	EndDatetime   string `json:"end_datetime"`
+}
+
+type TaskClock struct {
+	ID       int    `json:"id"`
+	ClockIn  string `json:"clock_in"`
+	ClockOut string `json:"clock_out"`
+}
+
+type NewTask struct {
+	NoteID               int      `json:"note_id"`
+	Status               string   `json:"status"`
+	EffortEstimate       float64  `json:"effort_estimate"`
+	ActualEffortOverride *float64 `json:"actual_effort_override,omitempty"`
+	Deadline             string   `json:"deadline"`
+	Priority             int      `json:"priority"`
+	AllDay               bool     `json:"all_day"`
+	GoalRelationship     int      `json:"goal_relationship"`
+	RepeatRule           string   `json:"repeat_rule,omitempty"`
+}
+
+// UpdateTask changes the fields that are not nil. ActualEffortOverride is
+// left alone when nil and removed when it points to a nil *float64.
+type UpdateTask struct {
+	Status               *string   `json:"status,omitempty"`
+	EffortEstimate       *float64  `json:"effort_estimate,omitempty"`
+	ActualEffortOverride **float64 `json:"actual_effort_override,omitempty"`
+	Deadline             *string   `json:"deadline,omitempty"`
+	Priority             *int      `json:"priority,omitempty"`
+	AllDay               *bool     `json:"all_day,omitempty"`
+	GoalRelationship     *int      `json:"goal_relationship,omitempty"`
+	RepeatRule           *string   `json:"repeat_rule,omitempty"`
+}
+
+// TaskUpdateResponse is returned when a task is updated or moved,
+// NextDeadline is set when a recurring task was completed
+type TaskUpdateResponse struct {
+	Message      string `json:"message"`
+	NextDeadline string `json:"next_deadline,omitempty"`
+}
+
+// NextTask is a ranked task with the breakdown of its score
+type NextTask struct {
+	ID               int                    `json:"id"`
+	NoteID           int                    `json:"note_id"`
+	Title            string                 `json:"title"`
+	Status           string                 `json:"status"`
+	Tags             []string               `json:"tags"`
+	Priority         int                    `json:"priority,omitempty"`
+	GoalRelationship int                    `json:"goal_relationship,omitempty"`
+	Deadline         string                 `json:"deadline,omitempty"`
+	RemainingHours   *float64               `json:"remaining_hours"`
+	Score            float64                `json:"score"`
+	Breakdown        map[string]ScoreFactor `json:"breakdown"`
+}
+
+type ScoreFactor struct {
+	Value  float64 `json:"value"`
+	Weight float64 `json:"weight"`
+	Score  float64 `json:"score"`
+}
+
+// TaskStatus is a task state along with the states it may move to
+type TaskStatus struct {
+	Name        string   `json:"name"`
+	Category    string   `json:"category"`
+	Position    int      `json:"position"`
+	Description string   `json:"description"`
+	Initial     bool     `json:"initial"`
+	Transitions []string `json:"transitions"`
+}
+
+type TaskStatusChange struct {
+	ID         int     `json:"id"`
+	FromStatus *string `json:"from_status"`
+	ToStatus   string  `json:"to_status"`
+	ChangedAt  string  `json:"changed_at"`
+}
+
+type TaskCompletion struct {
+	ID          int    `json:"id"`
+	CompletedAt string `json:"completed_at"`
+	Deadline    string `json:"deadline"`
+}
+
+// TaskHistoryEntry is a change to one field of a task, the values are
+// JSON as stored
+type TaskHistoryEntry struct {
+	ID        int             `json:"id"`
+	Field     string          `json:"field"`
+	OldValue  json.RawMessage `json:"old_value"`
+	NewValue  json.RawMessage `json:"new_value"`
+	Reason    *string         `json:"reason"`
+	ChangedAt string          `json:"changed_at"`
+}
+
+type TaskDependency struct {
+	ID          int    `json:"id"`
+	TaskID      int    `json:"task_id"`
+	DependsOnID int    `json:"depends_on"`
+	NoteID      int    `json:"note_id"`
+	Title       string `json:"title"`
+	Status      string `json:"status"`
+	Blocking    bool   `json:"blocking"`
+}
+
+type NewTaskDependency struct {
+	DependsOn int `json:"depends_on"`
+}
+
+type NewTaskSchedule struct {
+	TaskID        int    `json:"task_id"`
+	StartDatetime string `json:"start_datetime"`
+	EndDatetime   string `json:"end_datetime"`
+}
+
+type UpdateTaskSchedule struct {
+	StartDatetime string `json:"start_datetime,omitempty"`
+	EndDatetime   string `json:"end_datetime,omitempty"`
+}
+
+type NewTaskClock struct {
+	TaskID   int    `json:"task_id"`
+	ClockIn  string `json:"clock_in"`
+	ClockOut string `json:"clock_out,omitempty"`
+}
+
+type UpdateTaskClock struct {
+	ClockIn  string `json:"clock_in,omitempty"`
+	ClockOut string `json:"clock_out,omitempty"`
+}
+
+// ClockResponse is returned when a clock is started or stopped, StoppedID
+// is the clock that starting this one stopped
+type ClockResponse struct {
+	Message   string `json:"message"`
+	ID        int    `json:"id"`
+	ClockIn   string `json:"clock_in"`
+	ClockOut  string `json:"clock_out,omitempty"`
+	StoppedID int    `json:"stopped_id,omitempty"`
+}
+
+// RunningClock is the clock that is currently running, if any
+type RunningClock struct {
+	Running        bool   `json:"running"`
+	ID             int    `json:"id,omitempty"`
+	TaskID         int    `json:"task_id,omitempty"`
+	NoteID         int    `json:"note_id,omitempty"`
+	Title          string `json:"title,omitempty"`
+	ClockIn        string `json:"clock_in,omitempty"`
+	ElapsedSeconds int64  `json:"elapsed_seconds,omitempty"`
+}
+
+// Agenda is the scheduled tasks, deadlines, journal entries and clocked
+// time of each day in a range
+type Agenda struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Timezone string       `json:"timezone"`
+	Days     []*AgendaDay `json:"days"`
+}
+
+type AgendaDay struct {
+	Date           string               `json:"date"`
+	Weekday        string               `json:"weekday"`
+	Scheduled      []AgendaItem         `json:"scheduled"`
+	Deadlines      []AgendaItem         `json:"deadlines"`
+	Overdue        []AgendaItem         `json:"overdue"`
+	Journal        []AgendaJournalEntry `json:"journal"`
+	Clocked        []AgendaClock        `json:"clocked"`
+	ClockedSeconds int64                `json:"clocked_seconds"`
+}
+
+type AgendaItem struct {
+	TaskID      int      `json:"task_id"`
+	NoteID      int      `json:"note_id"`
+	Title       string   `json:"title"`
+	Tags        []string `json:"tags"`
+	Status      string   `json:"status"`
+	Priority    int      `json:"priority,omitempty"`
+	ScheduleID  int      `json:"schedule_id,omitempty"`
+	Start       string   `json:"start,omitempty"`
+	End         string   `json:"end,omitempty"`
+	Deadline    string   `json:"deadline,omitempty"`
+	AllDay      bool     `json:"all_day"`
+	Recurring   bool     `json:"recurring"`
+	DaysOverdue int      `json:"days_overdue,omitempty"`
+}
+
+type AgendaJournalEntry struct {
+	NoteID int      `json:"note_id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+}
+
+type AgendaClock struct {
+	NoteID  int    `json:"note_id"`
+	Title   string `json:"title"`
+	Seconds int64  `json:"seconds"`
+}
+
+// FileInfo is an uploaded asset
+type FileInfo struct {
+	ID          int    `json:"id"`
+	FileName    string `json:"file_name"`
+	AssetType   string `json:"asset_type"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+}
+
+type UploadResponse struct {
+	Message  string `json:"message"`
+	Filename string `json:"filename"`
+	ID       int    `json:"id"`
+}
+
+type AssetIDResponse struct {
+	ID int `json:"id"`
+}
+
+type OrgImportResponse struct {
+	Message string `json:"message"`
+	IDs     []int  `json:"ids"`
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Agenda
+//
+// A day by day view of scheduled blocks, deadlines, overdue tasks, journal
+// entries and clocked time. Days are calendar days in the requested
+// timezone, all-day deadlines keep their date whatever the timezone.
+// Recurring tasks also show their future occurrences within the range.
+
+// AgendaItem is a task appearing on a day of the agenda
+type AgendaItem struct {
+	TaskID      int      `json:"task_id"`
+	NoteID      int      `json:"note_id"`
+	Title       string   `json:"title"`
+	Tags        []string `json:"tags"`
+	Status      string   `json:"status"`
+	Priority    int      `json:"priority,omitempty"`
+	ScheduleID  int      `json:"schedule_id,omitempty"`
+	Start       string   `json:"start,omitempty"`
+	End         string   `json:"end,omitempty"`
+	Deadline    string   `json:"deadline,omitempty"`
+	AllDay      bool     `json:"all_day"`
+	Recurring   bool     `json:"recurring"` // A future occurrence of a recurring task
+	DaysOverdue int      `json:"days_overdue,omitempty"`
+}
+
+// AgendaJournalEntry is a journal entry for a day of the agenda
+type AgendaJournalEntry struct {
+	NoteID int      `json:"note_id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+}
+
+// AgendaClock is the time clocked on a note's task during a day
+type AgendaClock struct {
+	NoteID  int    `json:"note_id"`
+	Title   string `json:"title"`
+	Seconds int64  `json:"seconds"`
+}
+
+// AgendaDay is a single day of the agenda
+type AgendaDay struct {
+	Date           string               `json:"date"`
+	Weekday        string               `json:"weekday"`
+	Scheduled      []AgendaItem         `json:"scheduled"`
+	Deadlines      []AgendaItem         `json:"deadlines"`
+	Overdue        []AgendaItem         `json:"overdue"`
+	Journal        []AgendaJournalEntry `json:"journal"`
+	Clocked        []AgendaClock        `json:"clocked"`
+	ClockedSeconds int64                `json:"clocked_seconds"`
+
+	start, end time.Time
+}
+
+// Agenda is the response of GET /agenda
+type Agenda struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Timezone string       `json:"timezone"`
+	Days     []*AgendaDay `json:"days"`
+}
+
+// parseAgendaRange reads the from and to dates (inclusive) in loc.
+// The agenda defaults to the 7 days starting today.
+func parseAgendaRange(r *http.Request, loc *time.Location) (from, to time.Time, err error) {
+	q := r.URL.Query()
+
+	now := time.Now().In(loc)
+	from = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if s := q.Get("from"); s != "" {
+		from, err = time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+	}
+
+	to = from.AddDate(0, 0, 7)
+	if s := q.Get("to"); s != "" {
+		to, err = time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return from, to, fmt.Errorf("the agenda may span at most a year")
+	}
+	return from, to, nil
+}
+
+// floatingDate returns the date of an all-day timestamp as midnight in loc
+func floatingDate(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+func formatAgendaTime(t time.Time, allDay bool, loc *time.Location) string {
+	if allDay {
+		return t.Format("2006-01-02")
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
+
+// buildAgenda lays out the tasks, journal entries and clock intervals over
+// the days between from and to
+func buildAgenda(tasks []*CalendarTask, statuses taskStatusSet, journal map[string][]AgendaJournalEntry, clocks []clockInterval, g *noteGraph, from, to time.Time, loc *time.Location) []*AgendaDay {
+	var days []*AgendaDay
+	byDate := make(map[string]*AgendaDay)
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		day := &AgendaDay{
+			Date:      d.Format("2006-01-02"),
+			Weekday:   d.Weekday().String(),
+			Scheduled: []AgendaItem{},
+			Deadlines: []AgendaItem{},
+			Overdue:   []AgendaItem{},
+			Journal:   []AgendaJournalEntry{},
+			Clocked:   []AgendaClock{},
+			start:     d,
+			end:       d.AddDate(0, 0, 1),
+		}
+		if entries, ok := journal[day.Date]; ok {
+			day.Journal = entries
+		}
+		days = append(days, day)
+		byDate[day.Date] = day
+	}
+
+	now := time.Now().In(loc)
+	today := byDate[now.Format("2006-01-02")]
+
+	for _, t := range tasks {
+		item := AgendaItem{
+			TaskID:   t.ID,
+			NoteID:   t.NoteID,
+			Title:    t.Title,
+			Tags:     t.Tags,
+			Status:   t.Status,
+			Priority: t.Priority,
+			AllDay:   t.AllDay,
+		}
+		if item.Tags == nil {
+			item.Tags = []string{}
+		}
+
+		var rule *RepeatRule
+		if t.RepeatRule != "" {
+			rule, _ = parseRepeatRule(t.RepeatRule)
+		}
+
+		// Scheduled blocks appear on every day they overlap, recurring ones
+		// repeat at the same local time
+		for _, s := range t.Schedules {
+			starts := []time.Time{s.Start}
+			if rule != nil {
+				starts = rule.Occurrences(s.Start.In(loc), from.Add(-s.End.Sub(s.Start)), to)
+			}
+			for _, start := range starts {
+				end := start.Add(s.End.Sub(s.Start))
+				for _, day := range days {
+					// Blocks without a duration still show on the day they start
+					overlaps := start.Before(day.end) && (end.After(day.start) || (end.Equal(start) && !start.Before(day.start)))
+					if overlaps {
+						scheduled := item
+						scheduled.ScheduleID = s.ID
+						scheduled.Start = formatAgendaTime(start, false, loc)
+						scheduled.End = formatAgendaTime(end, false, loc)
+						scheduled.AllDay = false
+						scheduled.Recurring = !start.Equal(s.Start)
+						day.Scheduled = append(day.Scheduled, scheduled)
+					}
+				}
+			}
+		}
+
+		if !t.Deadline.Valid || !statuses.IsOpen(t.Status) {
+			continue
+		}
+
+		// All-day deadlines are dates rather than instants
+		deadline := t.Deadline.Time.In(loc)
+		rangeFrom, rangeTo := from, to
+		if t.AllDay {
+			deadline = floatingDate(deadline, time.UTC)
+			rangeFrom = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+			rangeTo = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+		}
+		dateOf := func(d time.Time) string {
+			if t.AllDay {
+				return d.Format("2006-01-02")
+			}
+			return d.In(loc).Format("2006-01-02")
+		}
+
+		occurrences := []time.Time{deadline}
+		if rule != nil {
+			occurrences = rule.Occurrences(deadline, rangeFrom, rangeTo)
+		}
+		for _, occurrence := range occurrences {
+			if day, ok := byDate[dateOf(occurrence)]; ok {
+				due := item
+				due.Deadline = formatAgendaTime(occurrence, t.AllDay, loc)
+				due.Recurring = !occurrence.Equal(deadline)
+				day.Deadlines = append(day.Deadlines, due)
+			}
+		}
+
+		// Overdue tasks are listed on today, as in an Org agenda
+		if today != nil {
+			dueDate, _ := time.ParseInLocation("2006-01-02", dateOf(deadline), loc)
+			if dueDate.Before(today.start) {
+				overdue := item
+				overdue.Deadline = formatAgendaTime(deadline, t.AllDay, loc)
+				overdue.DaysOverdue = int(today.start.Sub(dueDate).Hours()/24 + 0.5)
+				today.Overdue = append(today.Overdue, overdue)
+			}
+		}
+	}
+
+	for _, c := range clocks {
+		for _, part := range splitByDay(c, loc) {
+			day, ok := byDate[part.Start.In(loc).Format("2006-01-02")]
+			if !ok {
+				continue
+			}
+			seconds := int64(part.End.Sub(part.Start).Seconds())
+			day.ClockedSeconds += seconds
+			found := false
+			for i := range day.Clocked {
+				if day.Clocked[i].NoteID == c.NoteID {
+					day.Clocked[i].Seconds += seconds
+					found = true
+					break
+				}
+			}
+			if !found {
+				day.Clocked = append(day.Clocked, AgendaClock{NoteID: c.NoteID, Title: g.Titles[c.NoteID], Seconds: seconds})
+			}
+		}
+	}
+
+	for _, day := range days {
+		sort.SliceStable(day.Scheduled, func(i, j int) bool { return day.Scheduled[i].Start < day.Scheduled[j].Start })
+		sort.SliceStable(day.Deadlines, func(i, j int) bool { return day.Deadlines[i].Deadline < day.Deadlines[j].Deadline })
+		sort.SliceStable(day.Overdue, func(i, j int) bool { return day.Overdue[i].Deadline < day.Overdue[j].Deadline })
+	}
+	return days
+}
+
+// loadJournalEntries returns the journal entries between from and to keyed by date
+func loadJournalEntries(g *noteGraph, from, to time.Time) (map[string][]AgendaJournalEntry, error) {
+	rows, err := db.Query(`
+        SELECT note_id, entry_date
+        FROM journal_entries
+        WHERE entry_date >= $1 AND entry_date < $2
+        ORDER BY entry_date, note_id
+    `, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("error querying journal entries: %w", err)
+	}
+	defer rows.Close()
+
+	journal := make(map[string][]AgendaJournalEntry)
+	for rows.Next() {
+		var noteID int
+		var date time.Time
+		if err := rows.Scan(&noteID, &date); err != nil {
+			return nil, fmt.Errorf("error scanning journal entry row: %w", err)
+		}
+		tags := g.Tags[noteID]
+		if tags == nil {
+			tags = []string{}
+		}
+		key := date.Format("2006-01-02")
+		journal[key] = append(journal[key], AgendaJournalEntry{NoteID: noteID, Title: g.Titles[noteID], Tags: tags})
+	}
+	return journal, rows.Err()
+}
+
+func getAgenda(w http.ResponseWriter, r *http.Request) {
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	from, to, err := parseAgendaRange(r, loc)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	filter, err := parseCalendarFilter(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	tasks, err := loadCalendarTasks(db, filter)
+	if err != nil {
+		writeServerError(w, "Error loading tasks for agenda", err)
+		return
+	}
+	statuses, _, err := loadTaskStatuses(db)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses for agenda", err)
+		return
+	}
+	graph, err := loadNoteGraph(db)
+	if err != nil {
+		writeServerError(w, "Error loading notes for agenda", err)
+		return
+	}
+	journal, err := loadJournalEntries(graph, from, to)
+	if err != nil {
+		writeServerError(w, "Error loading journal for agenda", err)
+		return
+	}
+	clocks, err := loadClockIntervals(db, from.UTC(), to.UTC())
+	if err != nil {
+		writeServerError(w, "Error loading clocks for agenda", err)
+		return
+	}
+
+	agenda := Agenda{
+		From:     from.Format("2006-01-02"),
+		To:       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Timezone: loc.String(),
+		Days:     buildAgenda(tasks, statuses, journal, clocks, graph, from, to, loc),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agenda)
+}
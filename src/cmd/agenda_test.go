@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAgendaInLocation(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		// Daily at 09:00 in Berlin, scheduled from 08:00 to 09:00
+		id := api.createTask("Take the medicine")
+		api.do("PUT", fmt.Sprintf("/tasks/%d", id), map[string]interface{}{
+			"deadline": "2026-03-28T08:00:00Z", "repeat_rule": "FREQ=DAILY",
+		}, http.StatusOK, nil)
+		api.do("POST", "/task_schedules", NewTaskSchedule{
+			TaskID: id, StartDatetime: "2026-03-28T07:00:00Z", EndDatetime: "2026-03-28T08:00:00Z",
+		}, http.StatusCreated, nil)
+
+		// Daylight saving time starts in Berlin on 2026-03-29, the
+		// occurrences stay at the same local time
+		var agenda Agenda
+		api.do("GET", "/agenda?from=2026-03-28&to=2026-03-30&tz=Europe/Berlin", nil, http.StatusOK, &agenda)
+		want := map[string][2]string{
+			"2026-03-28": {"2026-03-28T08:00:00+01:00", "2026-03-28T09:00:00+01:00"},
+			"2026-03-29": {"2026-03-29T08:00:00+02:00", "2026-03-29T09:00:00+02:00"},
+			"2026-03-30": {"2026-03-30T08:00:00+02:00", "2026-03-30T09:00:00+02:00"},
+		}
+		if len(agenda.Days) != len(want) {
+			t.Fatalf("got %d days, want %d", len(agenda.Days), len(want))
+		}
+		for _, day := range agenda.Days {
+			var start, deadline string
+			for _, item := range day.Scheduled {
+				if item.TaskID == id {
+					start = item.Start
+				}
+			}
+			for _, item := range day.Deadlines {
+				if item.TaskID == id {
+					deadline = item.Deadline
+				}
+			}
+			if w := want[day.Date]; start != w[0] || deadline != w[1] {
+				t.Errorf("%s: scheduled %q, due %q, want %q, %q", day.Date, start, deadline, w[0], w[1])
+			}
+		}
+	})
+}
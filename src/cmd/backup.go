@@ -0,0 +1,1137 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	utils "draftsmith/src/utils"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Backup and restore
+//
+// A backup is a gzipped tar archive of every table as JSON Lines (one
+// row_to_json object per line) under tables/, the files in uploads/ under
+// uploads/ and, last, manifest.json with the SHA-256 of every entry. Rows
+// are restored by column name with json_populate_record, so an archive
+// keeps working after columns are added or removed, and renamed columns
+// are listed in backupRenamedColumns.
+//
+// Restoring into a database that doesn't exist, or has no schema yet,
+// creates it and the rows keep their IDs. Tables that already have rows
+// get new IDs for the restored ones and the columns referencing them are
+// remapped.
+//
+// On SQLite the archive holds a VACUUM INTO snapshot of the database,
+// database.sqlite, rather than the tables. It is restored by copying it to
+// a new database file and migrating that to the current schema, so rows
+// can't be added to an existing SQLite database and archives don't move
+// between drivers.
+
+// backupFormat is the version of the archive layout, 2 added archives of
+// SQLite databases
+const backupFormat = 2
+
+// backupSQLiteEntry is the snapshot of a SQLite database in an archive
+const backupSQLiteEntry = "database.sqlite"
+
+// backupRenamedColumns maps old column names found in archives to their
+// current names, by table
+var backupRenamedColumns = map[string]map[string]string{
+	"tasks": {"actual_effort": "actual_effort_override"},
+}
+
+// backupImplicitForeignKeys are columns holding IDs of another table
+// without a constraint, they are remapped like foreign keys
+var backupImplicitForeignKeys = map[string][]backupForeignKey{
+	"task_history": {{Column: "task_id", Table: "tasks", RefColumn: "id"}},
+}
+
+// backupDisabledTriggers are disabled while restoring, they record history
+// that the archive already holds
+var backupDisabledTriggers = map[string][]string{
+	"tasks": {"task_history_update"},
+}
+
+// backupManifest describes an archive
+type backupManifest struct {
+	Format    int                            `json:"format"`
+	CreatedAt time.Time                      `json:"created_at"`
+	Database  string                         `json:"database"`
+	Driver    string                         `json:"driver,omitempty"`
+	Tables    map[string]backupManifestTable `json:"tables"`
+	Entries   map[string]backupManifestEntry `json:"entries"`
+}
+
+type backupManifestTable struct {
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+}
+
+type backupManifestEntry struct {
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup [FILE]",
+	Short: "Write every table and the uploads to an archive",
+	Long: `Write every table of the database and the files in uploads/ to a gzipped
+tar archive with a SHA-256 checksum of each entry.
+
+FILE defaults to draftsmith-<date>.tar.gz, - writes to stdout. Like the
+server, uploads/ is read from the current directory. The database is read
+in a single transaction so the archive is consistent.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := "draftsmith-" + time.Now().Format("2006-01-02T150405") + ".tar.gz"
+		if len(args) == 1 {
+			file = args[0]
+		}
+
+		target, err := utils.Get_db(viper.GetString("db_name"))
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+
+		var out io.Writer = cmd.OutOrStdout()
+		if file != "-" {
+			f, err := os.Create(file)
+			if err != nil {
+				return fmt.Errorf("error creating %s: %w", file, err)
+			}
+			defer f.Close()
+			out = f
+		}
+		manifest, err := writeBackup(cliContext(cmd), target, out)
+		if err != nil {
+			if file != "-" {
+				os.Remove(file)
+			}
+			return err
+		}
+		if file != "-" {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Backed up %s to %s\n", manifest.summary(), file)
+		}
+		return nil
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore FILE",
+	Short: "Restore a backup archive into the database",
+	Long: `Restore an archive written by backup, - reads from stdin.
+
+The checksums of the archive are verified before anything is written. If
+the database (--db_name) doesn't exist, or has no tables, it is created and
+the archive is restored as it was. Otherwise the rows are added to it, rows of tables that
+already have rows get new IDs and the references to them follow. On SQLite
+the database file (--db_path) must not exist yet.
+
+Files are restored to uploads/ in the current directory, a file whose name
+is taken by a different file is renamed.
+
+With --dry-run only the archive is verified.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		var in io.Reader = cmd.InOrStdin()
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		dir, err := os.MkdirTemp("", "draftsmith-restore-")
+		if err != nil {
+			return fmt.Errorf("error creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		manifest, err := readBackup(in, dir)
+		if err != nil {
+			return fmt.Errorf("invalid archive: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Archive of %s from %s is intact: %s\n",
+			manifest.Database, manifest.CreatedAt.Local().Format(time.RFC3339), manifest.summary())
+		if dryRun {
+			return nil
+		}
+		if manifest.driver() != utils.Db_driver() {
+			return fmt.Errorf("the archive is of a %s database, restore it with --db_driver %s", manifest.driver(), manifest.driver())
+		}
+		if usingSQLite() {
+			report, err := restoreSQLiteBackup(manifest, dir)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), report)
+			return nil
+		}
+
+		target, created, err := openRestoreTarget(viper.GetString("db_name"))
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+		report, err := restoreBackup(cliContext(cmd), target, manifest, dir, created)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), report)
+		return nil
+	},
+}
+
+func init() {
+	cliCmd.AddCommand(backupCmd, restoreCmd)
+
+	restoreCmd.Flags().Bool("dry-run", false, "Only verify the archive")
+}
+
+// driver is the database driver the archive was written with, archives
+// before format 2 are all of Postgres databases
+func (m *backupManifest) driver() string {
+	if m.Driver == "" {
+		return utils.Postgres
+	}
+	return m.Driver
+}
+
+func (m *backupManifest) summary() string {
+	rows, files := 0, 0
+	var size int64
+	for _, t := range m.Tables {
+		rows += t.Rows
+	}
+	for name, e := range m.Entries {
+		if strings.HasPrefix(name, uploadsDir+"/") {
+			files++
+			size += e.Size
+		}
+	}
+	return fmt.Sprintf("%d rows in %d tables and %d files (%d bytes)", rows, len(m.Tables), files, size)
+}
+
+// backupTables lists the tables of the public schema, apart from
+// schema_version which belongs to the schema rather than the data
+func backupTables(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}) (map[string][]string, error) {
+	query := `
+        SELECT c.table_name, c.column_name
+        FROM information_schema.columns c
+        JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+        WHERE c.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+          AND c.table_name <> 'schema_version'
+        ORDER BY c.table_name, c.ordinal_position
+    `
+	if usingSQLite() {
+		// Leaving out the FTS5 indexes and their shadow tables
+		query = `
+            SELECT m.name, c.name
+            FROM sqlite_master m, pragma_table_info(m.name) c
+            WHERE m.type = 'table' AND m.name <> 'schema_version' AND m.name NOT LIKE 'sqlite_%'
+              AND NOT EXISTS (SELECT 1 FROM sqlite_master v
+                  WHERE v.sql LIKE 'CREATE VIRTUAL TABLE%' AND m.name LIKE v.name || '%')
+            ORDER BY m.name, c.cid
+        `
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables: %w", err)
+	}
+	defer rows.Close()
+	tables := make(map[string][]string)
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return nil, fmt.Errorf("error scanning table row: %w", err)
+		}
+		tables[table] = append(tables[table], column)
+	}
+	return tables, rows.Err()
+}
+
+// backupWriter adds entries to an archive and records their checksums
+type backupWriter struct {
+	tw      *tar.Writer
+	entries map[string]backupManifestEntry
+}
+
+// add copies size bytes of r to the entry name
+func (w *backupWriter) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	err := w.tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w.tw, h), r); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	w.entries[name] = backupManifestEntry{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+	return nil
+}
+
+// addFile adds a file, dumped tables are spooled to temporary files as tar
+// needs the size up front
+func (w *backupWriter) addFile(name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return w.add(name, info.Size(), info.ModTime(), f)
+}
+
+func writeBackup(ctx context.Context, source *sql.DB, out io.Writer) (*backupManifest, error) {
+	manifest := &backupManifest{
+		Format:    backupFormat,
+		CreatedAt: time.Now().UTC(),
+		Database:  viper.GetString("db_name"),
+		Driver:    utils.Db_driver(),
+		Tables:    make(map[string]backupManifestTable),
+		Entries:   make(map[string]backupManifestEntry),
+	}
+	if usingSQLite() {
+		manifest.Database = utils.Sqlite_path(manifest.Database)
+	}
+
+	gz := gzip.NewWriter(out)
+	w := &backupWriter{tw: tar.NewWriter(gz), entries: manifest.Entries}
+
+	spool, err := os.MkdirTemp("", "draftsmith-backup-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(spool)
+
+	if usingSQLite() {
+		err = snapshotSQLite(ctx, source, w, manifest, spool)
+	} else {
+		err = dumpTables(ctx, source, w, manifest, spool)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(uploadsDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && file == uploadsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return w.addFile(filepath.ToSlash(file), file)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error archiving uploads: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = w.tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0o644, Size: int64(len(data)), ModTime: manifest.CreatedAt, Typeflag: tar.TypeReg})
+	if err == nil {
+		_, err = w.tw.Write(data)
+	}
+	if err == nil {
+		err = w.tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error writing archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// dumpTables adds every table to the archive, read in one transaction
+func dumpTables(ctx context.Context, source *sql.DB, w *backupWriter, manifest *backupManifest, spool string) error {
+	tx, err := source.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	tables, err := backupTables(ctx, tx)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := filepath.Join(spool, name+".jsonl")
+		n, err := dumpTable(ctx, tx, name, file)
+		if err != nil {
+			return err
+		}
+		if err := w.addFile("tables/"+name+".jsonl", file); err != nil {
+			return err
+		}
+		manifest.Tables[name] = backupManifestTable{Columns: tables[name], Rows: n}
+	}
+	return nil
+}
+
+// snapshotSQLite adds a copy of a SQLite database to the archive, the
+// tables are listed in the manifest for the summary
+func snapshotSQLite(ctx context.Context, source *sql.DB, w *backupWriter, manifest *backupManifest, spool string) error {
+	file := filepath.Join(spool, backupSQLiteEntry)
+	if _, err := source.ExecContext(ctx, "VACUUM INTO $1", file); err != nil {
+		return fmt.Errorf("error copying the database: %w", err)
+	}
+
+	snapshot, err := utils.Open_sqlite(file)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	tables, err := backupTables(ctx, snapshot)
+	if err != nil {
+		return err
+	}
+	for name, columns := range tables {
+		var n int
+		if err := snapshot.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+pq.QuoteIdentifier(name)).Scan(&n); err != nil {
+			return fmt.Errorf("error counting the rows of %s: %w", name, err)
+		}
+		manifest.Tables[name] = backupManifestTable{Columns: columns, Rows: n}
+	}
+	if err := snapshot.Close(); err != nil {
+		return err
+	}
+	return w.addFile(backupSQLiteEntry, file)
+}
+
+// dumpTable writes the rows of a table to file as JSON Lines
+func dumpTable(ctx context.Context, tx *sql.Tx, table, file string) (int, error) {
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT row_to_json(t)::text FROM %s t", pq.QuoteIdentifier(table)))
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", table, err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			return 0, fmt.Errorf("error reading %s: %w", table, err)
+		}
+		if _, err := io.WriteString(f, row+"\n"); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", table, err)
+	}
+	return n, f.Close()
+}
+
+// readBackup extracts an archive into dir and checks it against its
+// manifest
+func readBackup(in io.Reader, dir string) (*backupManifest, error) {
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	found := make(map[string]backupManifestEntry)
+	var manifest *backupManifest
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(hdr.Name)
+		if name != hdr.Name || path.IsAbs(name) || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("unexpected entry %q", hdr.Name)
+		}
+
+		if name == "manifest.json" {
+			manifest = &backupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return nil, err
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			return nil, err
+		}
+		h := sha256.New()
+		size, err := io.Copy(io.MultiWriter(f, h), tr)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", name, err)
+		}
+		found[name] = backupManifestEntry{Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+
+	if manifest == nil {
+		return nil, errors.New("manifest.json is missing")
+	}
+	if manifest.Format > backupFormat {
+		return nil, fmt.Errorf("archive format %d is newer than this version supports (%d)", manifest.Format, backupFormat)
+	}
+	for name, want := range manifest.Entries {
+		got, ok := found[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is missing", name)
+		}
+		if got != want {
+			return nil, fmt.Errorf("checksum mismatch for %s", name)
+		}
+		delete(found, name)
+	}
+	for name := range found {
+		return nil, fmt.Errorf("%s is not in the manifest", name)
+	}
+	if manifest.driver() == utils.SQLite {
+		if _, ok := manifest.Entries[backupSQLiteEntry]; !ok {
+			return nil, fmt.Errorf("%s is missing", backupSQLiteEntry)
+		}
+		return manifest, nil
+	}
+	for table := range manifest.Tables {
+		if _, ok := manifest.Entries["tables/"+table+".jsonl"]; !ok {
+			return nil, fmt.Errorf("rows of %s are missing", table)
+		}
+	}
+	return manifest, nil
+}
+
+// openRestoreTarget connects to the database, creating it with an empty
+// schema if it doesn't exist or has no schema yet. It reports whether the
+// database is new.
+func openRestoreTarget(name string) (*sql.DB, bool, error) {
+	if _, err := utils.Create_db(name); err != nil {
+		return nil, false, err
+	}
+	target, err := utils.Get_db(name)
+	if err != nil {
+		return nil, false, err
+	}
+	created, err := initRestoreTarget(target, name)
+	if err != nil {
+		target.Close()
+		return nil, false, err
+	}
+	return target, created, nil
+}
+
+// initRestoreTarget creates the schema, without its sample rows, if the
+// database has none yet and reports whether it did
+func initRestoreTarget(target *sql.DB, name string) (bool, error) {
+	applied, err := initSchema(target)
+	if err == nil && !applied {
+		err = checkSchemaVersion(target)
+	}
+	if err != nil || !applied {
+		return false, err
+	}
+
+	// The schema comes with sample rows, the archive has its own
+	tables, err := backupTables(context.Background(), target)
+	if err != nil {
+		return false, err
+	}
+	var quoted []string
+	for table := range tables {
+		quoted = append(quoted, pq.QuoteIdentifier(table))
+	}
+	if _, err := target.Exec("TRUNCATE " + strings.Join(quoted, ", ") + " RESTART IDENTITY CASCADE"); err != nil {
+		return false, fmt.Errorf("error emptying %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// backupForeignKey is a column referencing a column of another table
+type backupForeignKey struct {
+	Column    string
+	Table     string
+	RefColumn string
+}
+
+// restoreSchema is what restoring needs to know about the target tables
+type restoreSchema struct {
+	columns     map[string][]string
+	serial      map[string]bool // Tables with a generated integer id
+	foreignKeys map[string][]backupForeignKey
+	unique      map[string][]string // Single column unique constraints
+}
+
+func loadRestoreSchema(ctx context.Context, tx *sql.Tx) (*restoreSchema, error) {
+	columns, err := backupTables(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	s := &restoreSchema{
+		columns:     columns,
+		serial:      make(map[string]bool),
+		foreignKeys: make(map[string][]backupForeignKey),
+		unique:      make(map[string][]string),
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+        SELECT table_name FROM information_schema.columns
+        WHERE table_schema = 'public' AND column_name = 'id' AND column_default LIKE 'nextval(%'
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error listing serial columns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		s.serial[table] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+        SELECT con.contype, cl.relname, att.attname, COALESCE(rcl.relname, ''), COALESCE(ratt.attname, '')
+        FROM pg_constraint con
+        JOIN pg_class cl ON cl.oid = con.conrelid
+        JOIN pg_attribute att ON att.attrelid = con.conrelid AND att.attnum = con.conkey[1]
+        LEFT JOIN pg_class rcl ON rcl.oid = con.confrelid
+        LEFT JOIN pg_attribute ratt ON ratt.attrelid = con.confrelid AND ratt.attnum = con.confkey[1]
+        WHERE con.contype IN ('f', 'u') AND array_length(con.conkey, 1) = 1
+          AND cl.relnamespace = 'public'::regnamespace
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error listing constraints: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind, table, column, refTable, refColumn string
+		if err := rows.Scan(&kind, &table, &column, &refTable, &refColumn); err != nil {
+			return nil, err
+		}
+		if kind == "u" {
+			s.unique[table] = append(s.unique[table], column)
+		} else {
+			s.foreignKeys[table] = append(s.foreignKeys[table], backupForeignKey{column, refTable, refColumn})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for table, fks := range backupImplicitForeignKeys {
+		if _, ok := s.columns[table]; ok {
+			s.foreignKeys[table] = append(s.foreignKeys[table], fks...)
+		}
+	}
+	return s, nil
+}
+
+// order sorts tables so referenced tables come first
+func (s *restoreSchema) order(tables []string) []string {
+	sort.Strings(tables)
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var ordered []string
+	var visit func(table string)
+	visit = func(table string) {
+		if done[table] || visiting[table] {
+			return
+		}
+		visiting[table] = true
+		for _, fk := range s.foreignKeys[table] {
+			if fk.Table != table {
+				visit(fk.Table)
+			}
+		}
+		visiting[table] = false
+		done[table] = true
+		ordered = append(ordered, table)
+	}
+	for _, table := range tables {
+		visit(table)
+	}
+	// Only tables of the archive
+	wanted := make(map[string]bool)
+	for _, table := range tables {
+		wanted[table] = true
+	}
+	result := ordered[:0]
+	for _, table := range ordered {
+		if wanted[table] {
+			result = append(result, table)
+		}
+	}
+	return result
+}
+
+// restoreBackup loads an extracted archive into target in one transaction,
+// the uploads are copied before it commits so no row refers to a missing
+// file
+func restoreBackup(ctx context.Context, target *sql.DB, manifest *backupManifest, dir string, created bool) (string, error) {
+	tx, err := target.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	schema, err := loadRestoreSchema(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+
+	// Uploads whose names are taken get new ones, assets.location follows
+	files, locations, err := placeRestoredFiles(manifest, dir)
+	if err != nil {
+		return "", err
+	}
+
+	var report []string
+	var tables []string
+	for table := range manifest.Tables {
+		if _, ok := schema.columns[table]; ok {
+			tables = append(tables, table)
+		} else {
+			report = append(report, fmt.Sprintf("Skipped %s, the table no longer exists", table))
+		}
+	}
+	tables = schema.order(tables)
+
+	for table, triggers := range backupDisabledTriggers {
+		for _, trigger := range triggers {
+			if _, ok := schema.columns[table]; !ok {
+				continue
+			}
+			stmt := fmt.Sprintf("ALTER TABLE %s DISABLE TRIGGER %s", pq.QuoteIdentifier(table), pq.QuoteIdentifier(trigger))
+			// Rolled back with the transaction on failure
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return "", fmt.Errorf("error disabling trigger %s: %w", trigger, err)
+			}
+		}
+	}
+
+	ids := make(map[string]map[int64]int64)
+	for _, table := range tables {
+		r := &tableRestorer{tx: tx, schema: schema, table: table, ids: ids, locations: locations}
+		restored, skipped, err := r.restore(ctx, filepath.Join(dir, "tables", table+".jsonl"))
+		if err != nil {
+			return "", fmt.Errorf("error restoring %s: %w", table, err)
+		}
+		line := fmt.Sprintf("%s: %d rows", table, restored)
+		if r.remap {
+			line += " with new IDs"
+		}
+		if skipped > 0 {
+			line += fmt.Sprintf(", %d already present", skipped)
+		}
+		report = append(report, line)
+	}
+
+	for table := range schema.serial {
+		quoted := pq.QuoteIdentifier(table)
+		stmt := fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM %s",
+			pq.QuoteLiteral(quoted), quoted)
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return "", fmt.Errorf("error resetting the id sequence of %s: %w", table, err)
+		}
+	}
+	for table, triggers := range backupDisabledTriggers {
+		for _, trigger := range triggers {
+			if _, ok := schema.columns[table]; !ok {
+				continue
+			}
+			stmt := fmt.Sprintf("ALTER TABLE %s ENABLE TRIGGER %s", pq.QuoteIdentifier(table), pq.QuoteIdentifier(trigger))
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return "", fmt.Errorf("error enabling trigger %s: %w", trigger, err)
+			}
+		}
+	}
+
+	remove, err := copyRestoredFiles(files)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		remove()
+		return "", fmt.Errorf("error committing transaction: %w", err)
+	}
+	report = append(report, fmt.Sprintf("%s: %d files", uploadsDir, len(files)))
+
+	what := "Restored into the existing database " + viper.GetString("db_name")
+	if created {
+		what = "Created the database " + viper.GetString("db_name")
+	}
+	return what + "\n  " + strings.Join(report, "\n  "), nil
+}
+
+// restoreSQLiteBackup copies the snapshot of an archive to the SQLite
+// database file, which must not exist yet or be empty, migrates it to the
+// current schema and copies the uploads. The database is dropped again if
+// any of it fails.
+func restoreSQLiteBackup(manifest *backupManifest, dir string) (string, error) {
+	file := utils.Sqlite_path(viper.GetString("db_name"))
+	if info, err := os.Stat(file); err == nil && info.Size() > 0 {
+		return "", fmt.Errorf("%s already exists, a SQLite archive can only be restored into a new database (--db_path)", file)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	// Renamed in place once complete, so a failed copy leaves nothing behind
+	tmp := file + ".restore"
+	if err := copyRestoredFile(filepath.Join(dir, backupSQLiteEntry), tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("error restoring %s: %w", file, err)
+	}
+	target, err := utils.Get_db(viper.GetString("db_name"))
+	if err != nil {
+		utils.Drop_db(viper.GetString("db_name"))
+		return "", err
+	}
+	defer target.Close()
+
+	var report []string
+	from, to, err := migrateSchema(target)
+	if err == nil && from != to {
+		report = append(report, fmt.Sprintf("Migrated the schema from version %d to %d", from, to))
+	}
+
+	// Uploads whose names are taken get new ones, assets.location follows
+	var files, locations map[string]string
+	if err == nil {
+		files, locations, err = placeRestoredFiles(manifest, dir)
+	}
+	for name, renamed := range locations {
+		if err != nil {
+			break
+		}
+		_, err = target.Exec("UPDATE assets SET location = $1 WHERE location = $2", renamed, name)
+	}
+	if err == nil {
+		_, err = copyRestoredFiles(files)
+	}
+	if err != nil {
+		target.Close()
+		utils.Drop_db(viper.GetString("db_name"))
+		return "", err
+	}
+
+	tables := make([]string, 0, len(manifest.Tables))
+	for table := range manifest.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		report = append(report, fmt.Sprintf("%s: %d rows", table, manifest.Tables[table].Rows))
+	}
+	report = append(report, fmt.Sprintf("%s: %d files", uploadsDir, len(files)))
+	return "Created the database " + file + "\n  " + strings.Join(report, "\n  "), nil
+}
+
+// placeRestoredFiles decides where the uploads of an archive go. It returns
+// the files to copy, from the extracted archive to uploads/, and the new
+// locations of renamed files.
+func placeRestoredFiles(manifest *backupManifest, dir string) (map[string]string, map[string]string, error) {
+	files := make(map[string]string)
+	locations := make(map[string]string)
+	names := make([]string, 0, len(manifest.Entries))
+	for name := range manifest.Entries {
+		if strings.HasPrefix(name, uploadsDir+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// Names taken on disk, or by an earlier file of the archive
+	claimed := make(map[string]bool)
+	free := func(file string) bool {
+		_, err := os.Lstat(file)
+		return !claimed[file] && errors.Is(err, fs.ErrNotExist)
+	}
+	for _, name := range names {
+		src := filepath.Join(dir, filepath.FromSlash(name))
+		dst := filepath.FromSlash(name)
+		if !free(dst) {
+			if !claimed[dst] && fileSHA256(dst) == manifest.Entries[name].SHA256 {
+				continue // Already there
+			}
+			ext := filepath.Ext(dst)
+			stem := strings.TrimSuffix(dst, ext)
+			for i := 1; !free(dst); i++ {
+				dst = fmt.Sprintf("%s_%d%s", stem, i, ext)
+			}
+			locations[name] = filepath.ToSlash(dst)
+		}
+		claimed[dst] = true
+		files[src] = dst
+	}
+	return files, locations, nil
+}
+
+// fileSHA256 is the checksum of a file, "" if it can't be read
+func fileSHA256(file string) string {
+	f, err := os.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// copyRestoredFiles copies the uploads of an archive, from the extracted
+// archive to uploads/. If one can't be copied those already copied are
+// removed, remove does the same once they are all copied.
+func copyRestoredFiles(files map[string]string) (remove func(), err error) {
+	var copied []string
+	remove = func() {
+		for _, dst := range copied {
+			os.Remove(dst)
+		}
+	}
+	for src, dst := range files {
+		if err := copyRestoredFile(src, dst); err != nil {
+			remove()
+			return nil, err
+		}
+		copied = append(copied, dst)
+	}
+	return remove, nil
+}
+
+// copyRestoredFile copies an upload, dst must not exist yet and is removed
+// again if the copy fails
+func copyRestoredFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating upload directory: %w", err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("error restoring %s: %w", dst, err)
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("error restoring %s: %w", dst, err)
+	}
+	return nil
+}
+
+// tableRestorer inserts the rows of one table
+type tableRestorer struct {
+	tx        *sql.Tx
+	schema    *restoreSchema
+	table     string
+	ids       map[string]map[int64]int64 // Old to new IDs of remapped tables
+	locations map[string]string          // Renamed uploads
+	remap     bool
+}
+
+func (r *tableRestorer) restore(ctx context.Context, file string) (restored, skipped int, err error) {
+	quoted := pq.QuoteIdentifier(r.table)
+	if r.schema.serial[r.table] {
+		var existing bool
+		if err := r.tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM "+quoted+")").Scan(&existing); err != nil {
+			return 0, 0, err
+		}
+		r.remap = existing
+		if r.remap {
+			r.ids[r.table] = make(map[int64]int64)
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var row map[string]json.RawMessage
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			return restored, skipped, fmt.Errorf("invalid row: %w", err)
+		}
+
+		inserted, err := r.insert(ctx, quoted, row)
+		if err != nil {
+			return restored, skipped, err
+		}
+		if inserted {
+			restored++
+		} else {
+			skipped++
+		}
+	}
+	return restored, skipped, nil
+}
+
+// insert adds one row, reporting false if it was already present
+func (r *tableRestorer) insert(ctx context.Context, quoted string, row map[string]json.RawMessage) (bool, error) {
+	for from, to := range backupRenamedColumns[r.table] {
+		if v, ok := row[from]; ok {
+			if _, ok := row[to]; !ok {
+				row[to] = v
+			}
+			delete(row, from)
+		}
+	}
+	for _, fk := range r.schema.foreignKeys[r.table] {
+		ids, ok := r.ids[fk.Table]
+		if !ok || fk.RefColumn != "id" {
+			continue
+		}
+		var old int64
+		if json.Unmarshal(row[fk.Column], &old) != nil {
+			continue // NULL
+		}
+		if id, ok := ids[old]; ok {
+			row[fk.Column], _ = json.Marshal(id)
+		}
+	}
+	if r.table == "assets" {
+		var location string
+		if json.Unmarshal(row["location"], &location) == nil {
+			if renamed, ok := r.locations[location]; ok {
+				row["location"], _ = json.Marshal(renamed)
+			}
+		}
+	}
+
+	var columns []string
+	for _, column := range r.schema.columns[r.table] {
+		if _, ok := row[column]; ok && !(r.remap && column == "id") {
+			columns = append(columns, pq.QuoteIdentifier(column))
+		}
+	}
+	if len(columns) == 0 {
+		return false, nil
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return false, err
+	}
+	list := strings.Join(columns, ", ")
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM json_populate_record(NULL::%s, $1::json) ON CONFLICT DO NOTHING",
+		quoted, list, list, quoted)
+
+	if !r.remap {
+		result, err := r.tx.ExecContext(ctx, stmt, string(data))
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		return n > 0, err
+	}
+
+	var old, id int64
+	if err := json.Unmarshal(row["id"], &old); err != nil {
+		return false, fmt.Errorf("row without an id: %s", data)
+	}
+	err = r.tx.QueryRowContext(ctx, stmt+" RETURNING id", string(data)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Clashes with a unique column, e.g. a category of the same name,
+		// refer to the existing row
+		id, err = r.existingID(ctx, quoted, row)
+		if err == nil {
+			r.ids[r.table][old] = id
+		}
+		return false, err
+	}
+	if err != nil {
+		return false, err
+	}
+	r.ids[r.table][old] = id
+	return true, nil
+}
+
+func (r *tableRestorer) existingID(ctx context.Context, quoted string, row map[string]json.RawMessage) (int64, error) {
+	data, _ := json.Marshal(row)
+	for _, column := range r.schema.unique[r.table] {
+		if _, ok := row[column]; !ok {
+			continue
+		}
+		c := pq.QuoteIdentifier(column)
+		var id int64
+		err := r.tx.QueryRowContext(ctx, fmt.Sprintf(
+			"SELECT t.id FROM %[1]s t, json_populate_record(NULL::%[1]s, $1::json) r WHERE t.%[2]s = r.%[2]s", quoted, c),
+			string(data)).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return 0, err
+		}
+	}
+	return 0, fmt.Errorf("row conflicts with an existing row: %s", data)
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	utils "draftsmith/src/utils"
+
+	"github.com/spf13/viper"
+)
+
+// writeTestBackup returns an archive of the test database and uploads
+func writeTestBackup(t *testing.T) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	if _, err := writeBackup(context.Background(), db, &out); err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+	return out.Bytes()
+}
+
+// restoreTestBackup restores an archive into a new database, which db then
+// points at, and returns the report. On Postgres the test database is
+// emptied and restored into.
+func restoreTestBackup(t *testing.T, archive []byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	manifest, err := readBackup(bytes.NewReader(archive), dir)
+	if err != nil {
+		t.Fatalf("readBackup: %v", err)
+	}
+
+	var report string
+	if usingSQLite() {
+		file := filepath.Join(t.TempDir(), "restored.db")
+		viper.Set("db_path", file)
+		defer viper.Set("db_path", "")
+		if report, err = restoreSQLiteBackup(manifest, dir); err != nil {
+			t.Fatalf("restoreSQLiteBackup: %v", err)
+		}
+		restored, err := utils.Open_sqlite(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+		db = restored
+		return report
+	}
+
+	if _, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public"); err != nil {
+		t.Fatal(err)
+	}
+	created, err := initRestoreTarget(db, "test")
+	if err != nil {
+		t.Fatalf("initRestoreTarget: %v", err)
+	}
+	if report, err = restoreBackup(context.Background(), db, manifest, dir, created); err != nil {
+		t.Fatalf("restoreBackup: %v", err)
+	}
+	return report
+}
+
+// rewriteArchive passes every entry but the manifest through edit, which
+// returns the new content or nil to leave the entry out
+func rewriteArchive(t *testing.T, archive []byte, edit func(name string, data []byte) []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var out bytes.Buffer
+	gw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != "manifest.json" {
+			if data = edit(hdr.Name, data); data == nil {
+				continue
+			}
+		}
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// uploadTestAsset uploads a file with the given content and returns the
+// ID of the asset and where it is stored
+func uploadTestAsset(api *testAPI, name, content string) (int, string) {
+	api.t.Helper()
+	src := filepath.Join(api.t.TempDir(), name)
+	if err := os.WriteFile(src, []byte(content), 0o644); err != nil {
+		api.t.Fatal(err)
+	}
+	var upload UploadResponse
+	if err := json.Unmarshal([]byte(api.cli("assets", "upload", src, "--json")), &upload); err != nil {
+		api.t.Fatal(err)
+	}
+	return upload.ID, filepath.Join(uploadsDir, upload.Filename)
+}
+
+// sameRows reports whether two JSON arrays have the same elements, in any
+// order as not every list is sorted
+func sameRows(t *testing.T, a, b string) bool {
+	t.Helper()
+	var rows [2][]json.RawMessage
+	for i, s := range []string{a, b} {
+		if err := json.Unmarshal([]byte(s), &rows[i]); err != nil {
+			t.Fatalf("decoding %s: %v", s, err)
+		}
+	}
+	count := make(map[string]int)
+	for _, row := range rows[0] {
+		count[string(row)]++
+	}
+	for _, row := range rows[1] {
+		count[string(row)]--
+	}
+	for _, n := range count {
+		if n != 0 {
+			return false
+		}
+	}
+	return len(rows[0]) == len(rows[1])
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		chdirTemp(t)
+		id := api.createTask("File the taxes")
+		api.do("PUT", fmt.Sprintf("/tasks/%d", id), map[string]string{"status": "done"}, http.StatusOK, nil)
+		asset, location := uploadTestAsset(api, "receipt.txt", "42 EUR")
+
+		paths := []string{"/notes", "/tags/with-notes", "/tasks/details", fmt.Sprintf("/tasks/%d/history", id)}
+		before := make(map[string]string)
+		for _, path := range paths {
+			before[path] = api.text("GET", path, nil, http.StatusOK)
+		}
+		archive := writeTestBackup(t)
+
+		// The name of the upload is taken by a different file, the restored
+		// one is renamed and the asset follows it
+		if err := os.WriteFile(location, []byte("replaced"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		report := restoreTestBackup(t, archive)
+		if !strings.Contains(report, "uploads: 1 files") {
+			t.Errorf("report:\n%s\nwant one file restored", report)
+		}
+		for _, path := range paths {
+			if got := api.text("GET", path, nil, http.StatusOK); !sameRows(t, got, before[path]) {
+				t.Errorf("GET %s after restoring:\n got %s\nwant %s", path, got, before[path])
+			}
+		}
+		if got := api.text("GET", fmt.Sprintf("/assets/%d/download", asset), nil, http.StatusOK); got != "42 EUR" {
+			t.Errorf("restored asset: got %q", got)
+		}
+		if data, err := os.ReadFile(location); err != nil || string(data) != "replaced" {
+			t.Errorf("file that took the name: got %q, %v", data, err)
+		}
+	})
+}
+
+func TestRestoreChecksArchive(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		chdirTemp(t)
+		uploadTestAsset(api, "receipt.txt", "42 EUR")
+		archive := writeTestBackup(t)
+		dbPath := filepath.Join(t.TempDir(), "restored.db")
+		viper.Set("db_path", dbPath)
+		defer viper.Set("db_path", "")
+
+		restore := func(archive []byte, args ...string) (string, error) {
+			t.Helper()
+			file := filepath.Join(t.TempDir(), "backup.tar.gz")
+			if err := os.WriteFile(file, archive, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			return api.cliError(append([]string{"restore", file}, args...)...)
+		}
+		// Nothing is written unless the archive is restored
+		unchanged := func(what string) {
+			t.Helper()
+			if _, err := os.Stat(dbPath); err == nil {
+				t.Errorf("%s: created %s", what, dbPath)
+			}
+			if entries, _ := os.ReadDir(uploadsDir); len(entries) != 1 {
+				t.Errorf("%s: got %d uploads, want 1", what, len(entries))
+			}
+		}
+
+		out, err := restore(archive, "--dry-run")
+		if err != nil || !strings.Contains(out, "is intact") || !strings.Contains(out, "and 1 files (6 bytes)") {
+			t.Errorf("dry run: got %v\n%s", err, out)
+		}
+		unchanged("dry run")
+
+		tampered := map[string]struct {
+			edit func(name string, data []byte) []byte
+			want string
+		}{
+			"changed upload": {
+				edit: func(name string, data []byte) []byte {
+					if strings.HasPrefix(name, uploadsDir+"/") {
+						return []byte("99 EUR")
+					}
+					return data
+				},
+				want: "checksum mismatch for " + uploadsDir + "/",
+			},
+			"missing upload": {
+				edit: func(name string, data []byte) []byte {
+					if strings.HasPrefix(name, uploadsDir+"/") {
+						return nil
+					}
+					return data
+				},
+				want: " is missing",
+			},
+		}
+		for name, tc := range tampered {
+			for _, args := range [][]string{{"--dry-run"}, nil} {
+				_, err := restore(rewriteArchive(t, archive, tc.edit), args...)
+				if err == nil || !strings.HasPrefix(err.Error(), "invalid archive: ") || !strings.Contains(err.Error(), tc.want) {
+					t.Errorf("%s %v: got error %v, want %q", name, args, err, tc.want)
+				}
+				unchanged(name)
+			}
+		}
+
+		// Archives don't move between drivers
+		other := utils.Postgres
+		if !usingSQLite() {
+			other = utils.SQLite
+		}
+		driver := utils.Db_driver()
+		viper.Set("db_driver", other)
+		defer viper.Set("db_driver", driver)
+		_, err = restore(archive)
+		if want := "restore it with --db_driver " + driver; err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("restoring with %s: got error %v, want %q", other, err, want)
+		}
+		unchanged("other driver")
+	})
+}
+
+func TestCopyRestoredFilesRemovesOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "receipt.txt")
+	if err := os.WriteFile(src, []byte("42 EUR"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(dir, uploadsDir, "receipt.txt")
+	files := map[string]string{
+		src:                          copied,
+		filepath.Join(dir, "gone"):   filepath.Join(dir, uploadsDir, "gone"),
+		filepath.Join(dir, "gone 2"): filepath.Join(dir, uploadsDir, "gone 2"),
+	}
+	if _, err := copyRestoredFiles(files); err == nil {
+		t.Fatal("copying missing files: want an error")
+	}
+	if _, err := os.Stat(copied); err == nil {
+		t.Errorf("%s is left behind", copied)
+	}
+
+	delete(files, filepath.Join(dir, "gone"))
+	delete(files, filepath.Join(dir, "gone 2"))
+	remove, err := copyRestoredFiles(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove()
+	if _, err := os.Stat(copied); err == nil {
+		t.Errorf("%s is left behind after remove", copied)
+	}
+}
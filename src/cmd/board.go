@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kanban board
+//
+// The board has a column for every task status in task_statuses order.
+// Within a column tasks are ordered by tasks.board_position, tasks that
+// have never been moved on the board come last in order of creation.
+// Moving a task renumbers its target column so positions stay dense.
+// Positions count from 0, like task status positions, both in
+// board_position and in the response.
+
+// BoardTask is a card on the board
+type BoardTask struct {
+	ID        int        `json:"id"`
+	NoteID    int        `json:"note_id"`
+	Title     string     `json:"title"`
+	Priority  int        `json:"priority,omitempty"`
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	Tags      []string   `json:"tags"`
+	BlockedBy []int      `json:"blocked_by"`
+	Position  int        `json:"position"`
+}
+
+// BoardColumn is the tasks in one status, Count is the number of tasks in
+// the column
+type BoardColumn struct {
+	Status   string       `json:"status"`
+	Category string       `json:"category"`
+	Count    int          `json:"count"`
+	Tasks    []*BoardTask `json:"tasks"`
+}
+
+// Board is the tasks grouped by status. WIP is the number of tasks in
+// open columns.
+type Board struct {
+	WIP     int            `json:"wip"`
+	Columns []*BoardColumn `json:"columns"`
+}
+
+// BoardMove is the request body for moving a task on the board. The task
+// is placed before the task Before in the Status column, or at the end of
+// the column if Before is not given.
+type BoardMove struct {
+	TaskID int    `json:"task_id"`
+	Status string `json:"status"`
+	Before *int   `json:"before"`
+}
+
+// boardTask is a task row along with its status
+type boardTask struct {
+	*BoardTask
+	Status string
+}
+
+// loadBoardTasks returns the tasks in the note subtree (if rootID is non-zero)
+// tagged with any of the tags (if given), in board order
+func loadBoardTasks(db *sql.DB, rootID int, tags []string) ([]boardTask, error) {
+	args := []interface{}{rootID}
+	tagFilter := ""
+	if len(tags) > 0 {
+		var in string
+		args, in = appendInArgs(args, tags)
+		tagFilter = `AND EXISTS (
+                SELECT 1 FROM note_tags nt JOIN tags tg ON tg.id = nt.tag_id
+                WHERE nt.note_id = t.note_id AND tg.name IN (` + in + `))`
+	}
+
+	rows, err := db.Query(`
+        WITH RECURSIVE subtree AS (
+            SELECT CAST($1 AS INTEGER) AS id
+            UNION
+            SELECT nh.child_note_id FROM note_hierarchy nh JOIN subtree s ON nh.parent_note_id = s.id
+        )
+        SELECT t.id, t.note_id, n.title, t.status, COALESCE(t.priority, 0), t.deadline
+        FROM tasks t
+        JOIN notes n ON n.id = t.note_id
+        WHERE ($1 = 0 OR t.note_id IN (SELECT id FROM subtree))
+          `+tagFilter+`
+        ORDER BY t.board_position NULLS LAST, t.id
+    `, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying board tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []boardTask
+	byNote := make(map[int]*BoardTask)
+	for rows.Next() {
+		t := boardTask{BoardTask: &BoardTask{Tags: []string{}}}
+		var deadline sql.NullTime
+		if err := rows.Scan(&t.ID, &t.NoteID, &t.Title, &t.Status, &t.Priority, &deadline); err != nil {
+			return nil, fmt.Errorf("error scanning board task row: %w", err)
+		}
+		if deadline.Valid {
+			t.Deadline = &deadline.Time
+		}
+		tasks = append(tasks, t)
+		byNote[t.NoteID] = t.BoardTask
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning board task rows: %w", err)
+	}
+
+	rows, err = db.Query(`
+        SELECT nt.note_id, tg.name
+        FROM note_tags nt
+        JOIN tags tg ON tg.id = nt.tag_id
+        ORDER BY tg.name
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error querying note tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noteID int
+		var name string
+		if err := rows.Scan(&noteID, &name); err != nil {
+			return nil, fmt.Errorf("error scanning note tag row: %w", err)
+		}
+		if t, ok := byNote[noteID]; ok {
+			t.Tags = append(t.Tags, name)
+		}
+	}
+	return tasks, rows.Err()
+}
+
+// appendInArgs appends the values to the query arguments, returning the
+// placeholders for an IN list
+func appendInArgs(args []interface{}, values []string) ([]interface{}, string) {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		args = append(args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	return args, strings.Join(placeholders, ", ")
+}
+
+// buildBoard groups the tasks, which must be in board order, into a column
+// per status
+func buildBoard(statuses []*TaskStatus, tasks []boardTask, blockedBy map[int][]int) *Board {
+	board := &Board{Columns: []*BoardColumn{}}
+	columns := make(map[string]*BoardColumn)
+	for _, s := range statuses {
+		column := &BoardColumn{Status: s.Name, Category: s.Category, Tasks: []*BoardTask{}}
+		columns[s.Name] = column
+		board.Columns = append(board.Columns, column)
+	}
+
+	for _, t := range tasks {
+		column, ok := columns[t.Status]
+		if !ok {
+			continue
+		}
+		t.Position = len(column.Tasks)
+		t.BlockedBy = blockedBy[t.ID]
+		if t.BlockedBy == nil {
+			t.BlockedBy = []int{}
+		}
+		column.Tasks = append(column.Tasks, t.BoardTask)
+		column.Count++
+		if column.Category == statusOpen {
+			board.WIP++
+		}
+	}
+	return board
+}
+
+func getBoard(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	rootID := 0
+	if root := q.Get("root"); root != "" {
+		var err error
+		rootID, err = strconv.Atoi(root)
+		if err != nil {
+			writeError(w, "Invalid root note ID", http.StatusBadRequest)
+			return
+		}
+	}
+	var tags []string
+	if s := q.Get("tags"); s != "" {
+		tags = strings.Split(s, ",")
+	}
+
+	_, statuses, err := loadTaskStatuses(db)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	tasks, err := loadBoardTasks(db, rootID, tags)
+	if err != nil {
+		writeServerError(w, "Error loading board tasks", err)
+		return
+	}
+	_, blockedBy, err := loadTaskDependencies(db)
+	if err != nil {
+		writeServerError(w, "Error loading task dependencies", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildBoard(statuses, tasks, blockedBy))
+}
+
+// placeTask returns the column order with the task inserted before the
+// task before, or appended if before is zero or not in the column
+func placeTask(column []int, taskID, before int) []int {
+	placed := make([]int, 0, len(column)+1)
+	inserted := false
+	for _, id := range column {
+		if id == taskID {
+			continue
+		}
+		if id == before && !inserted {
+			placed = append(placed, taskID)
+			inserted = true
+		}
+		placed = append(placed, id)
+	}
+	if !inserted {
+		placed = append(placed, taskID)
+	}
+	return placed
+}
+
+// moveBoardTask changes the status and position of a task in a single
+// transaction, the status change is validated like in updateTask
+func moveBoardTask(w http.ResponseWriter, r *http.Request) {
+	var move BoardMove
+	if err := json.NewDecoder(r.Body).Decode(&move); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if move.TaskID == 0 || move.Status == "" {
+		writeError(w, "Task ID and status are required", http.StatusBadRequest)
+		return
+	}
+	taskID := strconv.Itoa(move.TaskID)
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var previousStatus string
+	err = tx.QueryRow("SELECT status FROM tasks WHERE id = $1"+forUpdate(), move.TaskID).Scan(&previousStatus)
+	if err == sql.ErrNoRows {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeServerError(w, "Error querying task", err)
+		return
+	}
+
+	statuses, _, err := loadTaskStatuses(tx)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	if err := statuses.checkStatusChange(previousStatus, move.Status); err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	// Lock the target column so concurrent moves don't interleave
+	rows, err := tx.Query(`
+        SELECT id FROM tasks
+        WHERE status = $1
+        ORDER BY board_position NULLS LAST, id
+    `+forUpdate(), move.Status)
+	if err != nil {
+		writeServerError(w, "Error querying board column", err)
+		return
+	}
+	var column []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			writeServerError(w, "Error scanning board column row", err)
+			return
+		}
+		column = append(column, id)
+	}
+	rows.Close()
+
+	before := 0
+	if move.Before != nil {
+		before = *move.Before
+		if before == move.TaskID || !containsInt(column, before) {
+			writeError(w, fmt.Sprintf("Task %d is not in the %s column", before, move.Status), http.StatusBadRequest)
+			return
+		}
+	}
+
+	_, err = tx.Exec("UPDATE tasks SET status = $1, modified_at = CURRENT_TIMESTAMP WHERE id = $2", move.Status, move.TaskID)
+	if err != nil {
+		writeServerError(w, "Error moving task", err)
+		return
+	}
+
+	column = placeTask(column, move.TaskID, before)
+	for i, id := range column {
+		_, err = tx.Exec(`
+            UPDATE tasks SET board_position = $1
+            WHERE id = $2 AND board_position IS DISTINCT FROM $1
+        `, i, id)
+		if err != nil {
+			writeServerError(w, "Error updating board positions", err)
+			return
+		}
+	}
+
+	nextDeadline, err := finishStatusChange(tx, statuses, taskID, previousStatus, move.Status, loc)
+	if err != nil {
+		writeServerError(w, "Error completing task", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
+		return
+	}
+
+	response := TaskUpdateResponse{Message: "Task moved successfully"}
+	if nextDeadline != nil {
+		response.NextDeadline = formatTimestamp(*nextDeadline)
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func containsInt(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
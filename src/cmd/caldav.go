@@ -0,0 +1,818 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CalDAV (RFC 4791) collection for two-way task sync
+//
+// A single calendar is served at /caldav/tasks/. Every task (other than
+// events) is a VTODO resource and every task schedule is a VEVENT resource.
+// Resources are named task-<id>.ics and schedule-<id>.ics unless a client
+// created them under a different name, in which case the name is kept in
+// calendar_uids.href.
+
+const (
+	caldavRoot     = "/caldav/"
+	caldavCalendar = "/caldav/tasks/"
+
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// CalDAVResource is a single calendar object in the collection
+type CalDAVResource struct {
+	Name       string
+	UID        string
+	Kind       string
+	TaskID     int
+	ScheduleID int
+	Data       []byte
+	ETag       string
+}
+
+// caldavDefaultNameRe matches the names of resources no client has renamed
+var caldavDefaultNameRe = regexp.MustCompile(`^(task|schedule)-(\d+)\.ics$`)
+
+// loadCalDAVResources renders the tasks and schedules as calendar objects,
+// only those of a single task if taskID is non-zero
+func loadCalDAVResources(q queryer, taskID int) ([]*CalDAVResource, error) {
+	tasks, err := loadCalendarTasks(q, CalendarFilter{TaskID: taskID})
+	if err != nil {
+		return nil, err
+	}
+
+	// Names and UIDs chosen by clients or previous imports
+	type mapping struct{ uid, href string }
+	todoMap := make(map[int]mapping)
+	eventMap := make(map[int]mapping)
+	rows, err := q.Query(`
+        SELECT uid, COALESCE(href, ''), COALESCE(component, ''), task_id, schedule_id
+        FROM calendar_uids
+        WHERE $1 = 0 OR task_id = $1
+    `, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying calendar UIDs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var uid, href, component string
+		var taskID, scheduleID sql.NullInt64
+		if err := rows.Scan(&uid, &href, &component, &taskID, &scheduleID); err != nil {
+			return nil, fmt.Errorf("error scanning calendar UID row: %w", err)
+		}
+		switch {
+		case component == "VEVENT" && scheduleID.Valid:
+			eventMap[int(scheduleID.Int64)] = mapping{uid, href}
+		case component != "VEVENT" && taskID.Valid:
+			todoMap[int(taskID.Int64)] = mapping{uid, href}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning calendar UID rows: %w", err)
+	}
+
+	var resources []*CalDAVResource
+	add := func(res *CalDAVResource, comp *ICalComponent, m mapping) {
+		if m.uid != "" {
+			res.UID = m.uid
+		}
+		if m.href != "" {
+			res.Name = m.href
+		}
+		comp.Properties[0].Value = res.UID
+		cal := newICalendar()
+		cal.Components = append(cal.Components, comp)
+		var buf bytes.Buffer
+		cal.Encode(&buf)
+		res.Data = buf.Bytes()
+		sum := sha1.Sum(res.Data)
+		res.ETag = `"` + hex.EncodeToString(sum[:]) + `"`
+		resources = append(resources, res)
+	}
+
+	for _, t := range tasks {
+		if t.Status != "event" {
+			add(&CalDAVResource{
+				Name:   fmt.Sprintf("task-%d.ics", t.ID),
+				UID:    taskUID(t.ID),
+				Kind:   "VTODO",
+				TaskID: t.ID,
+			}, taskToVTODO(t), todoMap[t.ID])
+		}
+		for _, s := range t.Schedules {
+			add(&CalDAVResource{
+				Name:       fmt.Sprintf("schedule-%d.ics", s.ID),
+				UID:        scheduleUID(s.ID),
+				Kind:       "VEVENT",
+				TaskID:     t.ID,
+				ScheduleID: s.ID,
+			}, scheduleToVEVENT(t, s), eventMap[s.ID])
+		}
+	}
+
+	return resources, nil
+}
+
+// findCalDAVResource returns the resource with the given name, or nil.
+// Only the resources of the task it belongs to are rendered.
+func findCalDAVResource(q queryer, name string) (*CalDAVResource, error) {
+	taskID, err := caldavResourceTask(q, name)
+	if err != nil || taskID == 0 {
+		return nil, err
+	}
+	resources, err := loadCalDAVResources(q, taskID)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range resources {
+		if res.Name == name {
+			return res, nil
+		}
+	}
+	return nil, nil
+}
+
+// caldavResourceTask returns the ID of the task a resource name belongs
+// to, or 0 if there is none
+func caldavResourceTask(q queryer, name string) (int, error) {
+	// A name chosen by a client
+	var taskID sql.NullInt64
+	err := q.QueryRow("SELECT task_id FROM calendar_uids WHERE href = $1", name).Scan(&taskID)
+	if err == nil {
+		return int(taskID.Int64), nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error looking up CalDAV resource name: %w", err)
+	}
+
+	m := caldavDefaultNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return 0, nil
+	}
+	id, _ := strconv.Atoi(m[2])
+	if m[1] == "task" {
+		return id, nil
+	}
+	err = q.QueryRow("SELECT task_id FROM task_schedules WHERE id = $1", id).Scan(&taskID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error looking up task schedule: %w", err)
+	}
+	return int(taskID.Int64), nil
+}
+
+// calendarCTag changes whenever any resource in the collection changes
+func calendarCTag(resources []*CalDAVResource) string {
+	h := sha1.New()
+	for _, res := range resources {
+		io.WriteString(h, res.Name+res.ETag)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+}
+
+func caldavWellKnown(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, caldavRoot, http.StatusMovedPermanently)
+}
+
+func caldavHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		caldavPropfind(w, r)
+	case "REPORT":
+		caldavReport(w, r)
+	case "GET", "HEAD":
+		caldavGet(w, r)
+	case "PUT":
+		caldavPut(w, r)
+	case "DELETE":
+		caldavDelete(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// caldavResourceName returns the resource name for a path inside the
+// calendar collection, or "" if the path is not a resource
+func caldavResourceName(p string) string {
+	if !strings.HasPrefix(p, caldavCalendar) {
+		return ""
+	}
+	name := strings.TrimPrefix(p, caldavCalendar)
+	if name == "" || strings.Contains(name, "/") {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	return name
+}
+
+func caldavResourceHref(name string) string {
+	return caldavCalendar + url.PathEscape(name)
+}
+
+// davRequest is the subset of a PROPFIND or REPORT body that we act on
+type davRequest struct {
+	Root        xml.Name
+	Props       []xml.Name
+	AllProp     bool
+	Hrefs       []string
+	CompFilters []string
+	Start, End  time.Time
+}
+
+// parseDAVRequest collects the requested properties, hrefs, component
+// filters and time range from a PROPFIND or REPORT body
+func parseDAVRequest(r io.Reader) (*davRequest, error) {
+	req := &davRequest{}
+	dec := xml.NewDecoder(r)
+	var stack []xml.Name
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) == 0 {
+				req.Root = t.Name
+			} else {
+				parent := stack[len(stack)-1]
+				if parent.Space == nsDAV && parent.Local == "prop" && len(stack) == 2 {
+					req.Props = append(req.Props, t.Name)
+				}
+			}
+			switch {
+			case t.Name.Space == nsDAV && t.Name.Local == "allprop":
+				req.AllProp = true
+			case t.Name.Space == nsCalDAV && t.Name.Local == "comp-filter":
+				for _, a := range t.Attr {
+					// Every query is wrapped in a VCALENDAR filter
+					if a.Name.Local == "name" && !strings.EqualFold(a.Value, "VCALENDAR") {
+						req.CompFilters = append(req.CompFilters, strings.ToUpper(a.Value))
+					}
+				}
+			case t.Name.Space == nsCalDAV && t.Name.Local == "time-range":
+				for _, a := range t.Attr {
+					v, err := time.Parse("20060102T150405Z", a.Value)
+					if err != nil {
+						continue
+					}
+					switch a.Name.Local {
+					case "start":
+						req.Start = v
+					case "end":
+						req.End = v
+					}
+				}
+			case t.Name.Space == nsDAV && t.Name.Local == "href":
+				var href string
+				if err := dec.DecodeElement(&href, &t); err != nil {
+					return nil, err
+				}
+				req.Hrefs = append(req.Hrefs, strings.TrimSpace(href))
+				continue
+			}
+			stack = append(stack, t.Name)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if req.Root.Local == "" {
+		req.AllProp = true
+	}
+	return req, nil
+}
+
+// davPropWriter writes a DAV multistatus response
+type davPropWriter struct {
+	buf bytes.Buffer
+}
+
+func newDAVPropWriter() *davPropWriter {
+	w := &davPropWriter{}
+	w.buf.WriteString(xml.Header)
+	fmt.Fprintf(&w.buf, `<d:multistatus xmlns:d="%s" xmlns:c="%s" xmlns:cs="%s">`, nsDAV, nsCalDAV, nsCS)
+	return w
+}
+
+func davEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// davElement renders an element with the given inner XML, using the
+// prefixes declared on the multistatus element where possible
+func davElement(name xml.Name, inner string) string {
+	var open, close string
+	switch name.Space {
+	case nsDAV:
+		open, close = "d:"+name.Local, "d:"+name.Local
+	case nsCalDAV:
+		open, close = "c:"+name.Local, "c:"+name.Local
+	case nsCS:
+		open, close = "cs:"+name.Local, "cs:"+name.Local
+	default:
+		open = fmt.Sprintf(`x:%s xmlns:x="%s"`, name.Local, davEscape(name.Space))
+		close = "x:" + name.Local
+	}
+	if inner == "" {
+		return "<" + open + "/>"
+	}
+	return "<" + open + ">" + inner + "</" + close + ">"
+}
+
+// Response writes a response for href, props maps each requested property
+// to its inner XML and any requested property missing from props is
+// reported as not found
+func (w *davPropWriter) Response(href string, requested []xml.Name, props map[xml.Name]string) {
+	fmt.Fprintf(&w.buf, "<d:response><d:href>%s</d:href>", davEscape(href))
+
+	var found, missing []string
+	if requested == nil {
+		for name := range props {
+			requested = append(requested, name)
+		}
+		sort.Slice(requested, func(i, j int) bool { return requested[i].Local < requested[j].Local })
+	}
+	for _, name := range requested {
+		if inner, ok := props[name]; ok {
+			found = append(found, davElement(name, inner))
+		} else {
+			missing = append(missing, davElement(name, ""))
+		}
+	}
+	if len(found) > 0 {
+		fmt.Fprintf(&w.buf, "<d:propstat><d:prop>%s</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>",
+			strings.Join(found, ""))
+	}
+	if len(missing) > 0 {
+		fmt.Fprintf(&w.buf, "<d:propstat><d:prop>%s</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>",
+			strings.Join(missing, ""))
+	}
+	w.buf.WriteString("</d:response>")
+}
+
+// NotFound writes a 404 response for href
+func (w *davPropWriter) NotFound(href string) {
+	fmt.Fprintf(&w.buf, "<d:response><d:href>%s</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>",
+		davEscape(href))
+}
+
+func (w *davPropWriter) Flush(rw http.ResponseWriter) {
+	w.buf.WriteString("</d:multistatus>")
+	rw.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	rw.WriteHeader(http.StatusMultiStatus)
+	rw.Write(w.buf.Bytes())
+}
+
+func davName(space, local string) xml.Name {
+	return xml.Name{Space: space, Local: local}
+}
+
+// principalProps are the properties of /caldav/, which serves as both the
+// principal and the calendar home
+func principalProps() map[xml.Name]string {
+	href := "<d:href>" + caldavRoot + "</d:href>"
+	return map[xml.Name]string{
+		davName(nsDAV, "resourcetype"):                 "<d:collection/><d:principal/>",
+		davName(nsDAV, "displayname"):                  "Draftsmith",
+		davName(nsDAV, "current-user-principal"):       href,
+		davName(nsDAV, "principal-URL"):                href,
+		davName(nsDAV, "owner"):                        href,
+		davName(nsCalDAV, "calendar-home-set"):         href,
+		davName(nsCalDAV, "calendar-user-address-set"): href,
+	}
+}
+
+func calendarProps(resources []*CalDAVResource) map[xml.Name]string {
+	return map[xml.Name]string{
+		davName(nsDAV, "resourcetype"):           "<d:collection/><c:calendar/>",
+		davName(nsDAV, "displayname"):            "Draftsmith",
+		davName(nsDAV, "current-user-principal"): "<d:href>" + caldavRoot + "</d:href>",
+		davName(nsDAV, "owner"):                  "<d:href>" + caldavRoot + "</d:href>",
+		davName(nsDAV, "current-user-privilege-set"): "<d:privilege><d:read/></d:privilege>" +
+			"<d:privilege><d:write/></d:privilege><d:privilege><d:write-content/></d:privilege>" +
+			"<d:privilege><d:bind/></d:privilege><d:privilege><d:unbind/></d:privilege>",
+		davName(nsDAV, "supported-report-set"): "<d:supported-report><d:report><c:calendar-query/></d:report></d:supported-report>" +
+			"<d:supported-report><d:report><c:calendar-multiget/></d:report></d:supported-report>",
+		davName(nsCalDAV, "supported-calendar-component-set"): `<c:comp name="VTODO"/><c:comp name="VEVENT"/>`,
+		davName(nsCS, "getctag"):                              davEscape(calendarCTag(resources)),
+		davName(nsDAV, "getetag"):                             davEscape(calendarCTag(resources)),
+	}
+}
+
+func resourceProps(res *CalDAVResource, withData bool) map[xml.Name]string {
+	props := map[xml.Name]string{
+		davName(nsDAV, "resourcetype"):     "",
+		davName(nsDAV, "getetag"):          davEscape(res.ETag),
+		davName(nsDAV, "getcontenttype"):   "text/calendar; charset=utf-8; component=" + strings.ToLower(res.Kind),
+		davName(nsDAV, "getcontentlength"): strconv.Itoa(len(res.Data)),
+	}
+	if withData {
+		props[davName(nsCalDAV, "calendar-data")] = davEscape(string(res.Data))
+	}
+	return props
+}
+
+func caldavPropfind(w http.ResponseWriter, r *http.Request) {
+	req, err := parseDAVRequest(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	requested := req.Props
+	if req.AllProp {
+		requested = nil
+	}
+	depth := r.Header.Get("Depth")
+
+	// A single resource is looked up on its own, the collection needs them all
+	name := caldavResourceName(r.URL.Path)
+	var resources []*CalDAVResource
+	var found *CalDAVResource
+	if name == "" {
+		resources, err = loadCalDAVResources(db, 0)
+	} else {
+		found, err = findCalDAVResource(db, name)
+	}
+	if err != nil {
+		log.Printf("Error loading CalDAV resources: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	out := newDAVPropWriter()
+	switch p := r.URL.Path; {
+	case p == caldavRoot || p == strings.TrimSuffix(caldavRoot, "/"):
+		out.Response(caldavRoot, requested, principalProps())
+		if depth == "1" {
+			out.Response(caldavCalendar, requested, calendarProps(resources))
+		}
+	case p == caldavCalendar || p == strings.TrimSuffix(caldavCalendar, "/"):
+		out.Response(caldavCalendar, requested, calendarProps(resources))
+		if depth == "1" {
+			for _, res := range resources {
+				out.Response(caldavResourceHref(res.Name), requested, resourceProps(res, false))
+			}
+		}
+	default:
+		if found == nil {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		out.Response(caldavResourceHref(found.Name), requested, resourceProps(found, false))
+	}
+	out.Flush(w)
+}
+
+// matchesCalendarQuery applies the component and time-range filters of a
+// calendar-query report
+func matchesCalendarQuery(req *davRequest, res *CalDAVResource) bool {
+	if len(req.CompFilters) > 0 {
+		matched := false
+		for _, name := range req.CompFilters {
+			if name == res.Kind {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if req.Start.IsZero() && req.End.IsZero() {
+		return true
+	}
+
+	cals, err := parseICal(bytes.NewReader(res.Data))
+	if err != nil || len(cals) == 0 || len(cals[0].Components) == 0 {
+		return false
+	}
+	comp := cals[0].Components[0]
+	var start, end time.Time
+	switch res.Kind {
+	case "VEVENT":
+		start, _, _, _ = comp.Time("DTSTART")
+		end, _, _, _ = comp.Time("DTEND")
+	case "VTODO":
+		due, _, ok, _ := comp.Time("DUE")
+		if !ok {
+			// Undated todos match any time range
+			return true
+		}
+		start, end = due, due
+	}
+	if !req.End.IsZero() && !start.Before(req.End) {
+		return false
+	}
+	if !req.Start.IsZero() && end.Before(req.Start) {
+		return false
+	}
+	return true
+}
+
+func caldavReport(w http.ResponseWriter, r *http.Request) {
+	req, err := parseDAVRequest(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid REPORT body", http.StatusBadRequest)
+		return
+	}
+
+	resources, err := loadCalDAVResources(db, 0)
+	if err != nil {
+		log.Printf("Error loading CalDAV resources: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	requested := req.Props
+	if req.AllProp {
+		requested = nil
+	}
+
+	out := newDAVPropWriter()
+	switch req.Root {
+	case davName(nsCalDAV, "calendar-multiget"):
+		byName := make(map[string]*CalDAVResource)
+		for _, res := range resources {
+			byName[res.Name] = res
+		}
+		for _, href := range req.Hrefs {
+			u, err := url.Parse(href)
+			if err != nil {
+				out.NotFound(href)
+				continue
+			}
+			res, ok := byName[caldavResourceName(u.Path)]
+			if !ok {
+				out.NotFound(href)
+				continue
+			}
+			out.Response(href, requested, resourceProps(res, true))
+		}
+	case davName(nsCalDAV, "calendar-query"):
+		for _, res := range resources {
+			if matchesCalendarQuery(req, res) {
+				out.Response(caldavResourceHref(res.Name), requested, resourceProps(res, true))
+			}
+		}
+	default:
+		http.Error(w, "Unsupported report", http.StatusForbidden)
+		return
+	}
+	out.Flush(w)
+}
+
+func caldavGet(w http.ResponseWriter, r *http.Request) {
+	name := caldavResourceName(r.URL.Path)
+	if name == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	res, err := findCalDAVResource(db, name)
+	if err != nil {
+		log.Printf("Error loading CalDAV resource: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if res == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("ETag", res.ETag)
+	w.Header().Set("Content-Length", strconv.Itoa(len(res.Data)))
+	if r.Method == "HEAD" {
+		return
+	}
+	w.Write(res.Data)
+}
+
+// checkPreconditions applies If-Match and If-None-Match against the current
+// resource (nil if it does not exist), returning false if the request
+// must fail with 412 Precondition Failed
+func checkPreconditions(r *http.Request, res *CalDAVResource) bool {
+	if res == nil {
+		return checkETagPreconditions(r, "")
+	}
+	return checkETagPreconditions(r, res.ETag)
+}
+
+// checkETagPreconditions is checkPreconditions for a resource with the
+// given ETag, "" if it does not exist
+func checkETagPreconditions(r *http.Request, etag string) bool {
+	if match := r.Header.Get("If-Match"); match != "" {
+		if etag == "" {
+			return false
+		}
+		if match != "*" && match != etag {
+			return false
+		}
+	}
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" && etag != "" {
+		if noneMatch == "*" || noneMatch == etag {
+			return false
+		}
+	}
+	return true
+}
+
+func caldavPut(w http.ResponseWriter, r *http.Request) {
+	name := caldavResourceName(r.URL.Path)
+	if name == "" || path.Ext(name) != ".ics" {
+		http.Error(w, "Calendar objects must be created inside "+caldavCalendar+" with an .ics extension", http.StatusForbidden)
+		return
+	}
+
+	cals, err := parseICal(r.Body)
+	if err != nil || len(cals) != 1 {
+		http.Error(w, "Invalid calendar object", http.StatusBadRequest)
+		return
+	}
+	var comp *ICalComponent
+	for _, c := range cals[0].Components {
+		if c.Name == "VTODO" || c.Name == "VEVENT" {
+			comp = c
+			break
+		}
+	}
+	if comp == nil {
+		http.Error(w, "Calendar object must contain a VTODO or VEVENT", http.StatusForbidden)
+		return
+	}
+	uid := comp.Value("UID")
+	if uid == "" {
+		http.Error(w, "Calendar object must have a UID", http.StatusBadRequest)
+		return
+	}
+	loc, err := requestLocation(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The lookup, the preconditions and the write happen in one
+	// transaction, with the task locked so a concurrent PUT waits for it
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	taskID, err := caldavResourceTask(tx, name)
+	if err == nil && taskID != 0 {
+		err = tx.QueryRow("SELECT id FROM tasks WHERE id = $1"+forUpdate(), taskID).Scan(&taskID)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	}
+	var existing *CalDAVResource
+	if err == nil {
+		existing, err = findCalDAVResource(tx, name)
+	}
+	if err != nil {
+		log.Printf("Error loading CalDAV resource: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !checkPreconditions(r, existing) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+	if existing != nil && (existing.UID != uid || existing.Kind != comp.Name) {
+		http.Error(w, "UID or component type does not match the existing resource", http.StatusConflict)
+		return
+	}
+
+	if existing == nil {
+		// A new UID must not collide with a resource stored under another name
+		if e, err := lookupCalendarUID(tx, uid); err != nil {
+			log.Printf("Error looking up calendar UID: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		} else if e != nil {
+			http.Error(w, "UID already exists in this calendar", http.StatusConflict)
+			return
+		}
+	}
+
+	statuses, _, err := loadTaskStatuses(tx)
+	if err != nil {
+		log.Printf("Error loading task statuses: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// A PUT replaces the whole object, as the import does for a VTODO
+	_, err = importICalComponent(tx, statuses, comp, loc)
+	var fe *fieldError
+	var ie *icalError
+	switch {
+	case errors.As(err, &fe):
+		http.Error(w, fe.Message, http.StatusConflict)
+		return
+	case errors.As(err, &ie):
+		http.Error(w, "Invalid calendar object: "+ie.Message, http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("Error storing calendar object: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Remember the client's name for the resource
+	_, err = tx.Exec("UPDATE calendar_uids SET href = $1 WHERE uid = $2", name, uid)
+	if err != nil {
+		log.Printf("Error recording CalDAV resource name: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing transaction: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := findCalDAVResource(db, name)
+	if err == nil && res != nil {
+		w.Header().Set("ETag", res.ETag)
+	}
+	if existing == nil {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func caldavDelete(w http.ResponseWriter, r *http.Request) {
+	name := caldavResourceName(r.URL.Path)
+	if name == "" {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	res, err := findCalDAVResource(db, name)
+	if err != nil {
+		log.Printf("Error loading CalDAV resource: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if res == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if !checkPreconditions(r, res) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	// Deleting a VTODO removes the task but keeps the note,
+	// deleting a VEVENT removes the schedule
+	if res.Kind == "VTODO" {
+		_, err = db.Exec("DELETE FROM tasks WHERE id = $1", res.TaskID)
+	} else {
+		_, err = db.Exec("DELETE FROM task_schedules WHERE id = $1", res.ScheduleID)
+	}
+	if err != nil {
+		log.Printf("Error deleting calendar object: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
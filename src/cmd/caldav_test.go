@@ -0,0 +1,223 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// davTestClient is the HTTP client of the CalDAV client, which can't send
+// If-Match itself. It adds ifMatch, an ETag unquoted as the CalDAV client
+// reports it, to PUT requests and records the status of the last response.
+type davTestClient struct {
+	ifMatch string
+	status  int
+}
+
+func (c *davTestClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPut && c.ifMatch != "" {
+		req.Header.Set("If-Match", strconv.Quote(c.ifMatch))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		c.status = resp.StatusCode
+	}
+	return resp, err
+}
+
+// calendarTodo returns the VTODO of a calendar object
+func calendarTodo(t *testing.T, cal *ical.Calendar) *ical.Component {
+	t.Helper()
+	for _, child := range cal.Children {
+		if child.Name == ical.CompToDo {
+			return child
+		}
+	}
+	t.Fatal("calendar object without a VTODO")
+	return nil
+}
+
+func TestCalDAVClient(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		ctx := context.Background()
+		httpClient := &davTestClient{}
+		client, err := caldav.NewClient(httpClient, api.url+caldavRoot)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Discovery as a client does it
+		principal, err := client.FindCurrentUserPrincipal(ctx)
+		if err != nil {
+			t.Fatalf("FindCurrentUserPrincipal: %v", err)
+		}
+		home, err := client.FindCalendarHomeSet(ctx, principal)
+		if err != nil {
+			t.Fatalf("FindCalendarHomeSet: %v", err)
+		}
+		calendars, err := client.FindCalendars(ctx, home)
+		if err != nil {
+			t.Fatalf("FindCalendars: %v", err)
+		}
+		if len(calendars) != 1 || calendars[0].Path != caldavCalendar {
+			t.Fatalf("FindCalendars: got %+v, want %s", calendars, caldavCalendar)
+		}
+
+		id := api.createTask("Renew passport")
+		path := fmt.Sprintf("%stask-%d.ics", caldavCalendar, id)
+		objects, err := client.QueryCalendar(ctx, caldavCalendar, &caldav.CalendarQuery{
+			CompRequest: caldav.CalendarCompRequest{Name: ical.CompCalendar, AllProps: true, AllComps: true},
+			CompFilter:  caldav.CompFilter{Name: ical.CompCalendar, Comps: []caldav.CompFilter{{Name: ical.CompToDo}}},
+		})
+		if err != nil {
+			t.Fatalf("QueryCalendar: %v", err)
+		}
+		found := false
+		for _, obj := range objects {
+			found = found || obj.Path == path
+		}
+		if !found {
+			t.Fatalf("QueryCalendar: %s is missing from %d objects", path, len(objects))
+		}
+
+		// Completing the task from the client closes it
+		obj, err := client.GetCalendarObject(ctx, path)
+		if err != nil {
+			t.Fatalf("GetCalendarObject: %v", err)
+		}
+		if summary, _ := calendarTodo(t, obj.Data).Props.Text(ical.PropSummary); summary != "Renew passport" {
+			t.Errorf("SUMMARY: got %q", summary)
+		}
+		calendarTodo(t, obj.Data).Props.SetText(ical.PropStatus, "COMPLETED")
+		httpClient.ifMatch = obj.ETag
+		updated, err := client.PutCalendarObject(ctx, path, obj.Data)
+		if err != nil {
+			t.Fatalf("PutCalendarObject: %v", err)
+		}
+		if updated.ETag == "" || updated.ETag == obj.ETag {
+			t.Errorf("ETag after the update: got %q, was %q", updated.ETag, obj.ETag)
+		}
+		if task := api.taskDetails(id); task.Status != "done" {
+			t.Errorf("status after COMPLETED: got %q, want done", task.Status)
+		}
+
+		// A client that missed the update gets 412 and changes nothing
+		calendarTodo(t, obj.Data).Props.SetText(ical.PropStatus, "NEEDS-ACTION")
+		if _, err := client.PutCalendarObject(ctx, path, obj.Data); err == nil || httpClient.status != http.StatusPreconditionFailed {
+			t.Errorf("PUT with a stale ETag: got %d, %v, want %d", httpClient.status, err, http.StatusPreconditionFailed)
+		}
+		if task := api.taskDetails(id); task.Status != "done" {
+			t.Errorf("status after a stale PUT: got %q, want done", task.Status)
+		}
+
+		// Completing a recurring task from the client, which also gives it
+		// a start, reopens it with its deadline and schedules a week later
+		recurring := api.createTask("Water the plants")
+		api.do("PUT", fmt.Sprintf("/tasks/%d", recurring), map[string]interface{}{
+			"deadline": "2026-03-02T09:00:00Z", "repeat_rule": "FREQ=WEEKLY",
+		}, http.StatusOK, nil)
+		api.do("POST", "/task_schedules", NewTaskSchedule{
+			TaskID: recurring, StartDatetime: "2026-03-01T10:00:00Z", EndDatetime: "2026-03-01T11:00:00Z",
+		}, http.StatusCreated, nil)
+		path = fmt.Sprintf("%stask-%d.ics", caldavCalendar, recurring)
+		obj, err = client.GetCalendarObject(ctx, path)
+		if err != nil {
+			t.Fatalf("GetCalendarObject of the recurring task: %v", err)
+		}
+		calendarTodo(t, obj.Data).Props.SetText(ical.PropStatus, "COMPLETED")
+		calendarTodo(t, obj.Data).Props.SetDateTime(ical.PropDateTimeStart, time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC))
+		httpClient.ifMatch = obj.ETag
+		if _, err := client.PutCalendarObject(ctx, path, obj.Data); err != nil {
+			t.Fatalf("PutCalendarObject of the recurring task: %v", err)
+		}
+		task := api.taskDetails(recurring)
+		if task.Status != "todo" || !sameTime(t, task.Deadline, "2026-03-09T09:00:00Z") {
+			t.Errorf("recurring task after COMPLETED: status %q, deadline %q, want todo, 2026-03-09T09:00:00Z", task.Status, task.Deadline)
+		}
+		if len(task.Schedules) != 2 || !sameTime(t, task.Schedules[0].StartDatetime, "2026-03-08T10:00:00Z") ||
+			!sameTime(t, task.Schedules[1].StartDatetime, "2026-03-09T08:00:00Z") {
+			t.Errorf("recurring task schedules after COMPLETED: got %+v, want 2026-03-08T10:00:00Z and 2026-03-09T08:00:00Z", task.Schedules)
+		}
+
+		// A VTODO created by the client becomes a task
+		todo := ical.NewComponent(ical.CompToDo)
+		todo.Props.SetText(ical.PropUID, "groceries@example.com")
+		todo.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+		todo.Props.SetText(ical.PropSummary, "Buy groceries")
+		cal := ical.NewCalendar()
+		cal.Props.SetText(ical.PropVersion, "2.0")
+		cal.Props.SetText(ical.PropProductID, "-//draftsmith//tests//EN")
+		cal.Children = append(cal.Children, todo)
+		httpClient.ifMatch = ""
+		created, err := client.PutCalendarObject(ctx, caldavCalendar+"groceries.ics", cal)
+		if err != nil {
+			t.Fatalf("PutCalendarObject of a new VTODO: %v", err)
+		}
+		obj, err = client.GetCalendarObject(ctx, created.Path)
+		if err != nil {
+			t.Fatalf("GetCalendarObject of the new VTODO: %v", err)
+		}
+		if summary, _ := calendarTodo(t, obj.Data).Props.Text(ical.PropSummary); summary != "Buy groceries" || obj.ETag != created.ETag {
+			t.Errorf("new VTODO: got SUMMARY %q and ETag %q, want ETag %q", summary, obj.ETag, created.ETag)
+		}
+	})
+}
+
+// sameTime reports whether two RFC 3339 timestamps are the same instant
+func sameTime(t *testing.T, got, want string) bool {
+	t.Helper()
+	g, err := time.Parse(time.RFC3339, got)
+	if err != nil {
+		t.Errorf("parsing %q: %v", got, err)
+		return false
+	}
+	w, err := time.Parse(time.RFC3339, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g.Equal(w)
+}
+
+func TestCalDAVConcurrentPut(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Renew passport")
+		path := fmt.Sprintf("%stask-%d.ics", caldavCalendar, id)
+		resp := api.request("GET", path, nil, nil)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+		if resp.StatusCode != http.StatusOK || etag == "" {
+			t.Fatalf("GET %s: got %d with ETag %q", path, resp.StatusCode, etag)
+		}
+
+		// Clients send updates based on the same ETag at once, only one of
+		// them may win
+		const clients = 8
+		header := http.Header{"If-Match": {etag}, "Content-Type": {"text/calendar"}}
+		statuses := make(chan int, clients)
+		for i := 0; i < clients; i++ {
+			update := strings.Replace(string(body), "SUMMARY:Renew passport", fmt.Sprintf("SUMMARY:Renew passport %d", i), 1)
+			go func() {
+				resp := api.request("PUT", path, update, header)
+				resp.Body.Close()
+				statuses <- resp.StatusCode
+			}()
+		}
+		counts := map[int]int{}
+		for i := 0; i < clients; i++ {
+			counts[<-statuses]++
+		}
+		if counts[http.StatusNoContent] != 1 || counts[http.StatusPreconditionFailed] != clients-1 {
+			t.Errorf("%d PUTs with the same ETag: got %v, want one %d and the others %d",
+				clients, counts, http.StatusNoContent, http.StatusPreconditionFailed)
+		}
+	})
+}
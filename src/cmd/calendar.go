@@ -0,0 +1,687 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar feed and import
+//
+// Tasks with a deadline are exported as VTODO components and each task
+// schedule is exported as a VEVENT. Imported components are tracked by UID
+// in calendar_uids so that importing the same calendar twice updates the
+// existing notes rather than creating duplicates.
+
+// CalendarTask is a task along with the note and schedule details needed
+// to render it as calendar components
+type CalendarTask struct {
+	ID         int
+	NoteID     int
+	Title      string
+	Content    string
+	Status     string
+	Category   string
+	Priority   int
+	Deadline   sql.NullTime
+	AllDay     bool
+	RepeatRule string
+	ModifiedAt time.Time
+	Tags       []string
+	Schedules  []CalendarSchedule
+}
+
+// CalendarSchedule is a single task_schedules row
+type CalendarSchedule struct {
+	ID    int
+	Start time.Time
+	End   time.Time
+}
+
+// CalendarFilter restricts which tasks are included in a calendar
+type CalendarFilter struct {
+	Statuses []string
+	Tag      string
+	RootID   int
+	TaskID   int // A single task, for CalDAV lookups
+}
+
+var draftsmithUIDRe = regexp.MustCompile(`^(task|schedule)-(\d+)@draftsmith$`)
+
+func taskUID(taskID int) string {
+	return fmt.Sprintf("task-%d@draftsmith", taskID)
+}
+
+func scheduleUID(scheduleID int) string {
+	return fmt.Sprintf("schedule-%d@draftsmith", scheduleID)
+}
+
+// parseCalendarFilter reads the status, tag and root query parameters
+func parseCalendarFilter(r *http.Request) (CalendarFilter, error) {
+	var filter CalendarFilter
+	q := r.URL.Query()
+
+	if s := q.Get("status"); s != "" {
+		filter.Statuses = strings.Split(s, ",")
+	}
+	filter.Tag = q.Get("tag")
+	if root := q.Get("root"); root != "" {
+		id, err := strconv.Atoi(root)
+		if err != nil {
+			return filter, fmt.Errorf("invalid root note ID")
+		}
+		filter.RootID = id
+	}
+	return filter, nil
+}
+
+// loadCalendarTasks returns the tasks matching the filter along with
+// their note, tags and schedules
+func loadCalendarTasks(q queryer, filter CalendarFilter) ([]*CalendarTask, error) {
+	args := []interface{}{filter.Tag, filter.RootID, filter.TaskID}
+	statusFilter := ""
+	if len(filter.Statuses) > 0 {
+		var in string
+		args, in = appendInArgs(args, filter.Statuses)
+		statusFilter = "AND t.status IN (" + in + ")"
+	}
+
+	rows, err := q.Query(`
+        WITH RECURSIVE subtree AS (
+            SELECT CAST($2 AS INTEGER) AS id
+            UNION
+            SELECT nh.child_note_id FROM note_hierarchy nh JOIN subtree s ON nh.parent_note_id = s.id
+        )
+        SELECT t.id, t.note_id, n.title, n.content, t.status, COALESCE(ts.category, 'open'), COALESCE(t.priority, 0),
+               t.deadline, COALESCE(t.all_day, FALSE), COALESCE(t.repeat_rule, ''), t.modified_at
+        FROM tasks t
+        JOIN notes n ON n.id = t.note_id
+        LEFT JOIN task_statuses ts ON ts.name = t.status
+        WHERE ($1 = '' OR EXISTS (
+                SELECT 1 FROM note_tags nt JOIN tags tg ON tg.id = nt.tag_id
+                WHERE nt.note_id = t.note_id AND tg.name = $1))
+          AND ($2 = 0 OR t.note_id IN (SELECT id FROM subtree))
+          AND ($3 = 0 OR t.id = $3)
+          `+statusFilter+`
+        ORDER BY t.id
+    `, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*CalendarTask
+	byID := make(map[int]*CalendarTask)
+	byNote := make(map[int]*CalendarTask)
+	for rows.Next() {
+		t := &CalendarTask{}
+		if err := rows.Scan(&t.ID, &t.NoteID, &t.Title, &t.Content, &t.Status, &t.Category, &t.Priority,
+			&t.Deadline, &t.AllDay, &t.RepeatRule, &t.ModifiedAt); err != nil {
+			return nil, fmt.Errorf("error scanning task row: %w", err)
+		}
+		tasks = append(tasks, t)
+		byID[t.ID] = t
+		byNote[t.NoteID] = t
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning task rows: %w", err)
+	}
+
+	rows, err = q.Query(`
+        SELECT id, task_id, start_datetime, end_datetime
+        FROM task_schedules
+        WHERE start_datetime IS NOT NULL AND ($1 = 0 OR task_id = $1)
+        ORDER BY id
+    `, filter.TaskID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying task schedules: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s CalendarSchedule
+		var taskID int
+		var end sql.NullTime
+		if err := rows.Scan(&s.ID, &taskID, &s.Start, &end); err != nil {
+			return nil, fmt.Errorf("error scanning task schedule row: %w", err)
+		}
+		s.End = s.Start
+		if end.Valid {
+			s.End = end.Time
+		}
+		if t, ok := byID[taskID]; ok {
+			t.Schedules = append(t.Schedules, s)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning task schedule rows: %w", err)
+	}
+
+	rows, err = q.Query(`
+        SELECT nt.note_id, tg.name
+        FROM note_tags nt
+        JOIN tags tg ON tg.id = nt.tag_id
+        WHERE $1 = 0 OR nt.note_id IN (SELECT note_id FROM tasks WHERE id = $1)
+        ORDER BY tg.name
+    `, filter.TaskID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying note tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noteID int
+		var name string
+		if err := rows.Scan(&noteID, &name); err != nil {
+			return nil, fmt.Errorf("error scanning note tag row: %w", err)
+		}
+		if t, ok := byNote[noteID]; ok {
+			t.Tags = append(t.Tags, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning note tag rows: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// taskToVTODO renders a task as a VTODO component
+func taskToVTODO(t *CalendarTask) *ICalComponent {
+	todo := &ICalComponent{Name: "VTODO"}
+	todo.Add("UID", taskUID(t.ID), nil)
+	todo.AddTime("DTSTAMP", t.ModifiedAt, false)
+	todo.AddTime("LAST-MODIFIED", t.ModifiedAt, false)
+	todo.AddText("SUMMARY", t.Title)
+	if t.Content != "" {
+		todo.AddText("DESCRIPTION", t.Content)
+	}
+	todo.Add("STATUS", icalTodoStatus(t.Category), nil)
+	if p := icalPriority(t.Priority); p != 0 {
+		todo.Add("PRIORITY", strconv.Itoa(p), nil)
+	}
+	if t.Deadline.Valid {
+		todo.AddTime("DUE", t.Deadline.Time, t.AllDay)
+		// RFC 5545 requires DTSTART on a recurring VTODO, the import
+		// doesn't take it for a schedule
+		if rrule := taskRRULE(t); rrule != "" {
+			todo.AddTime("DTSTART", t.Deadline.Time, t.AllDay)
+			todo.Add("RRULE", rrule, nil)
+		}
+	}
+	if len(t.Tags) > 0 {
+		tags := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			tags[i] = icalEscape(tag)
+		}
+		todo.Add("CATEGORIES", strings.Join(tags, ","), nil)
+	}
+	todo.Add("X-DRAFTSMITH-NOTE-ID", strconv.Itoa(t.NoteID), nil)
+	return todo
+}
+
+// scheduleToVEVENT renders a task schedule as a VEVENT component
+func scheduleToVEVENT(t *CalendarTask, s CalendarSchedule) *ICalComponent {
+	event := &ICalComponent{Name: "VEVENT"}
+	event.Add("UID", scheduleUID(s.ID), nil)
+	event.AddTime("DTSTAMP", t.ModifiedAt, false)
+	event.AddText("SUMMARY", t.Title)
+	if t.Content != "" {
+		event.AddText("DESCRIPTION", t.Content)
+	}
+	// all_day is about the deadline, a schedule is written as DATE values if
+	// it spans whole days (DTEND is exclusive for DATE values)
+	allDay := spansWholeDays(s.Start, s.End)
+	event.AddTime("DTSTART", s.Start, allDay)
+	event.AddTime("DTEND", s.End, allDay)
+	if rrule := taskRRULE(t); rrule != "" {
+		event.Add("RRULE", rrule, nil)
+	}
+	event.Add("RELATED-TO", taskUID(t.ID), nil)
+	event.Add("X-DRAFTSMITH-NOTE-ID", strconv.Itoa(t.NoteID), nil)
+	return event
+}
+
+// spansWholeDays reports whether a schedule runs from midnight to midnight,
+// which is how DATE values are imported
+func spansWholeDays(start, end time.Time) bool {
+	start, end = start.UTC(), end.UTC()
+	return end.After(start) && start.Format("15:04:05") == "00:00:00" && end.Format("15:04:05") == "00:00:00"
+}
+
+// taskRRULE returns the task's repeat rule as an RRULE, or ""
+func taskRRULE(t *CalendarTask) string {
+	if t.RepeatRule == "" {
+		return ""
+	}
+	rule, err := parseRepeatRule(t.RepeatRule)
+	if err != nil {
+		return ""
+	}
+	return rule.RRULE()
+}
+
+// buildCalendar renders the tasks as a VCALENDAR, tasks with a deadline
+// become VTODOs and every schedule becomes a VEVENT
+func buildCalendar(tasks []*CalendarTask) *ICalComponent {
+	cal := newICalendar()
+	cal.AddText("X-WR-CALNAME", "Draftsmith")
+	for _, t := range tasks {
+		if t.Deadline.Valid {
+			cal.Components = append(cal.Components, taskToVTODO(t))
+		}
+		for _, s := range t.Schedules {
+			cal.Components = append(cal.Components, scheduleToVEVENT(t, s))
+		}
+	}
+	return cal
+}
+
+func getCalendar(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseCalendarFilter(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	tasks, err := loadCalendarTasks(db, filter)
+	if err != nil {
+		writeServerError(w, "Error building calendar", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err := buildCalendar(tasks).Encode(w); err != nil {
+		log.Printf("Error writing calendar: %v", err)
+	}
+}
+
+// calendarUIDEntry is the calendar_uids row for an imported component
+type calendarUIDEntry struct {
+	NoteID     int
+	TaskID     int
+	ScheduleID sql.NullInt64
+}
+
+// lookupCalendarUID finds the note, task and schedule previously created
+// for a UID. UIDs produced by the Draftsmith feed itself refer directly
+// to a task or schedule.
+func lookupCalendarUID(tx *sql.Tx, uid string) (*calendarUIDEntry, error) {
+	var e calendarUIDEntry
+	err := tx.QueryRow(`
+        SELECT note_id, task_id, schedule_id FROM calendar_uids WHERE uid = $1
+    `, uid).Scan(&e.NoteID, &e.TaskID, &e.ScheduleID)
+	if err == nil {
+		return &e, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("error looking up calendar UID: %w", err)
+	}
+
+	m := draftsmithUIDRe.FindStringSubmatch(uid)
+	if m == nil {
+		return nil, nil
+	}
+	id, _ := strconv.Atoi(m[2])
+	switch m[1] {
+	case "task":
+		err = tx.QueryRow("SELECT note_id, id FROM tasks WHERE id = $1", id).Scan(&e.NoteID, &e.TaskID)
+	case "schedule":
+		e.ScheduleID = sql.NullInt64{Int64: int64(id), Valid: true}
+		err = tx.QueryRow(`
+            SELECT t.note_id, t.id FROM task_schedules ts JOIN tasks t ON t.id = ts.task_id
+            WHERE ts.id = $1
+        `, id).Scan(&e.NoteID, &e.TaskID)
+	}
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error looking up calendar UID: %w", err)
+	}
+	return &e, nil
+}
+
+// icalError is an error in the content of a calendar component
+type icalError struct {
+	Message string
+}
+
+func (e *icalError) Error() string { return e.Message }
+
+// importICalComponent creates or updates the note, task and schedule for
+// a single VTODO or VEVENT, returning true if anything was created.
+// Invalid content is an icalError and a status change the task's status
+// doesn't allow is a fieldError.
+//
+// A VTODO is imported as the inverse of taskToVTODO: its DUE, CATEGORIES
+// and STATUS replace the task's deadline, the note's tags and the status,
+// completing a recurring task advances it in loc. A VEVENT of an existing
+// task only updates the schedule, the task's fields belong to its VTODO.
+func importICalComponent(tx *sql.Tx, statuses taskStatusSet, comp *ICalComponent, loc *time.Location) (bool, error) {
+	uid := comp.Value("UID")
+	if uid == "" {
+		return false, &icalError{Message: fmt.Sprintf("%s without a UID", comp.Name)}
+	}
+
+	title := comp.Value("SUMMARY")
+	if title == "" {
+		title = "Untitled"
+	}
+	description := comp.Value("DESCRIPTION")
+
+	var priority interface{}
+	if p, err := strconv.Atoi(comp.Value("PRIORITY")); err == nil && taskPriority(p) != 0 {
+		priority = taskPriority(p)
+	}
+
+	var repeatRule interface{}
+	if rrule := comp.Value("RRULE"); rrule != "" {
+		if rule, err := parseRepeatRule(rrule); err == nil {
+			repeatRule = rule.String()
+		}
+	}
+
+	var status string
+	var err error
+	var deadline interface{}
+	allDay := false
+	var start, end time.Time
+	hasSchedule := false
+
+	switch comp.Name {
+	case "VTODO":
+		if status, err = taskStatusFromICal(statuses, comp.Value("STATUS"), ""); err != nil {
+			return false, err
+		}
+		due, dueAllDay, hasDue, err := comp.Time("DUE")
+		if err != nil {
+			return false, &icalError{Message: fmt.Sprintf("invalid DUE: %v", err)}
+		}
+		if hasDue {
+			deadline = due
+			allDay = dueAllDay
+		}
+		dtstart, startAllDay, ok, err := comp.Time("DTSTART")
+		if err != nil {
+			return false, &icalError{Message: fmt.Sprintf("invalid DTSTART: %v", err)}
+		}
+		// The DTSTART taskToVTODO adds to a recurring task is its deadline
+		if ok && comp.Value("RRULE") != "" && hasDue && dtstart.Equal(due) {
+			ok = false
+		}
+		if ok {
+			start, end, hasSchedule = dtstart, dtstart, true
+			if startAllDay {
+				end = start.AddDate(0, 0, 1)
+			}
+		}
+	case "VEVENT":
+		status = "event"
+		dtstart, startAllDay, ok, err := comp.Time("DTSTART")
+		if err != nil {
+			return false, &icalError{Message: fmt.Sprintf("invalid DTSTART: %v", err)}
+		}
+		if !ok {
+			return false, &icalError{Message: fmt.Sprintf("VEVENT %s without a DTSTART", uid)}
+		}
+		allDay = startAllDay
+		start, end, hasSchedule = dtstart, dtstart, true
+		if dtend, _, ok, err := comp.Time("DTEND"); err != nil {
+			return false, &icalError{Message: fmt.Sprintf("invalid DTEND: %v", err)}
+		} else if ok {
+			end = dtend
+		} else if startAllDay {
+			end = start.AddDate(0, 0, 1)
+		}
+	default:
+		return false, nil
+	}
+
+	existing, err := lookupCalendarUID(tx, uid)
+	if err != nil {
+		return false, err
+	}
+
+	if existing != nil {
+		var previousStatus string
+		if comp.Name == "VTODO" {
+			if previousStatus, status, err = updateTaskFromVTODO(tx, statuses, comp, existing, title, description, deadline, allDay, priority, repeatRule); err != nil {
+				return false, err
+			}
+		}
+
+		if hasSchedule {
+			if existing.ScheduleID.Valid {
+				_, err = tx.Exec("UPDATE task_schedules SET start_datetime = $1, end_datetime = $2 WHERE id = $3",
+					start, end, existing.ScheduleID.Int64)
+			} else {
+				var scheduleID int
+				err = tx.QueryRow(`
+                    INSERT INTO task_schedules (task_id, start_datetime, end_datetime)
+                    VALUES ($1, $2, $3) RETURNING id
+                `, existing.TaskID, start, end).Scan(&scheduleID)
+				if err == nil {
+					_, err = tx.Exec(`
+                        INSERT INTO calendar_uids (uid, note_id, task_id, schedule_id, component)
+                        VALUES ($1, $2, $3, $4, $5)
+                        ON CONFLICT (uid) DO UPDATE SET schedule_id = EXCLUDED.schedule_id
+                    `, uid, existing.NoteID, existing.TaskID, scheduleID, comp.Name)
+				}
+			}
+			if err != nil {
+				return false, fmt.Errorf("error updating task schedule: %w", err)
+			}
+		}
+
+		// The status change comes last, completing a recurring task
+		// advances the deadline and schedules that were just stored
+		if comp.Name == "VTODO" {
+			if _, err := finishStatusChange(tx, statuses, strconv.Itoa(existing.TaskID), previousStatus, status, loc); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	var noteID, taskID int
+	err = tx.QueryRow("INSERT INTO notes (title, content) VALUES ($1, $2) RETURNING id",
+		title, description).Scan(&noteID)
+	if err != nil {
+		return false, fmt.Errorf("error creating note: %w", err)
+	}
+
+	err = tx.QueryRow(`
+        INSERT INTO tasks (note_id, status, deadline, priority, all_day, repeat_rule)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id
+    `, noteID, status, deadline, priority, allDay, repeatRule).Scan(&taskID)
+	if err != nil {
+		return false, fmt.Errorf("error creating task: %w", err)
+	}
+	if err := recordStatusChange(tx, taskID, "", status); err != nil {
+		return false, err
+	}
+
+	var scheduleID sql.NullInt64
+	if hasSchedule {
+		var id int
+		err = tx.QueryRow(`
+            INSERT INTO task_schedules (task_id, start_datetime, end_datetime)
+            VALUES ($1, $2, $3) RETURNING id
+        `, taskID, start, end).Scan(&id)
+		if err != nil {
+			return false, fmt.Errorf("error creating task schedule: %w", err)
+		}
+		scheduleID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	if err := addNoteCategories(tx, noteID, comp); err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO calendar_uids (uid, note_id, task_id, schedule_id, component)
+        VALUES ($1, $2, $3, $4, $5)
+    `, uid, noteID, taskID, scheduleID, comp.Name)
+	if err != nil {
+		return false, fmt.Errorf("error recording calendar UID: %w", err)
+	}
+
+	return true, nil
+}
+
+// updateTaskFromVTODO updates the note and task of an existing VTODO, it
+// returns the previous and the new status for the caller to finish the
+// status change once everything else is stored
+func updateTaskFromVTODO(tx *sql.Tx, statuses taskStatusSet, comp *ICalComponent, existing *calendarUIDEntry,
+	title, description string, deadline interface{}, allDay bool, priority, repeatRule interface{}) (string, string, error) {
+	_, err := tx.Exec("UPDATE notes SET title = $1, content = $2, modified_at = CURRENT_TIMESTAMP WHERE id = $3",
+		title, description, existing.NoteID)
+	if err != nil {
+		return "", "", fmt.Errorf("error updating note: %w", err)
+	}
+
+	// Keep statuses that the calendar can't distinguish (e.g. wait and hold)
+	var currentStatus string
+	if err := tx.QueryRow("SELECT status FROM tasks WHERE id = $1", existing.TaskID).Scan(&currentStatus); err != nil {
+		return "", "", fmt.Errorf("error querying task: %w", err)
+	}
+	status, err := taskStatusFromICal(statuses, comp.Value("STATUS"), currentStatus)
+	if err != nil {
+		return "", "", err
+	}
+	if status != currentStatus {
+		if err := statuses.checkStatusChange(currentStatus, status); err != nil {
+			return "", "", err
+		}
+	}
+
+	// A VTODO without DUE has no deadline
+	_, err = tx.Exec(`
+        UPDATE tasks
+        SET status = $1, deadline = $2, priority = COALESCE($3, priority),
+            all_day = $4, repeat_rule = COALESCE($5, repeat_rule), modified_at = CURRENT_TIMESTAMP
+        WHERE id = $6
+    `, status, deadline, priority, allDay, repeatRule, existing.TaskID)
+	if err != nil {
+		return "", "", fmt.Errorf("error updating task: %w", err)
+	}
+
+	// The note's tags are the CATEGORIES
+	if _, err := tx.Exec("DELETE FROM note_tags WHERE note_id = $1", existing.NoteID); err != nil {
+		return "", "", fmt.Errorf("error removing tags from note: %w", err)
+	}
+	return currentStatus, status, addNoteCategories(tx, existing.NoteID, comp)
+}
+
+// addNoteCategories assigns the CATEGORIES of a component to the note as
+// tags, creating the tags that don't exist
+func addNoteCategories(tx *sql.Tx, noteID int, comp *ICalComponent) error {
+	categories := comp.Get("CATEGORIES")
+	if categories == nil {
+		return nil
+	}
+	tagIDs := make(map[string]int)
+	for _, name := range strings.Split(categories.Value, ",") {
+		name = strings.TrimSpace(icalUnescape(name))
+		if name == "" {
+			continue
+		}
+		tagID, err := orgTagID(tx, tagIDs, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", noteID, tagID)
+		if err != nil {
+			return fmt.Errorf("error adding tag to note: %w", err)
+		}
+	}
+	return nil
+}
+
+// CalendarImportResponse counts the calendar components that were created,
+// updated or skipped
+type CalendarImportResponse struct {
+	Message string `json:"message"`
+	Created int    `json:"created"`
+	Updated int    `json:"updated"`
+	Skipped int    `json:"skipped"`
+}
+
+func importICS(w http.ResponseWriter, r *http.Request) {
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	calendars, err := parseICal(r.Body)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Invalid calendar: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setChangeReason(tx, changeReasonImport); err != nil {
+		writeServerError(w, "Error starting import", err)
+		return
+	}
+	statuses, _, err := loadTaskStatuses(tx)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+
+	var created, updated, skipped int
+	for _, cal := range calendars {
+		for _, comp := range cal.Components {
+			if comp.Name != "VTODO" && comp.Name != "VEVENT" {
+				skipped++
+				continue
+			}
+			isNew, err := importICalComponent(tx, statuses, comp, loc)
+			var fe *fieldError
+			var ie *icalError
+			switch {
+			case errors.As(err, &fe):
+				writeValidationError(w, fe.Field, fmt.Sprintf("%s %s: %s", comp.Name, comp.Value("UID"), fe.Message))
+				return
+			case errors.As(err, &ie):
+				writeError(w, fmt.Sprintf("Invalid calendar: %s", ie.Message), http.StatusBadRequest)
+				return
+			case err != nil:
+				writeServerError(w, "Error importing calendar", err)
+				return
+			}
+			if isNew {
+				created++
+			} else {
+				updated++
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CalendarImportResponse{
+		Message: "Calendar imported successfully",
+		Created: created,
+		Updated: updated,
+		Skipped: skipped,
+	})
+}
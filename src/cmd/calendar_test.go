@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// noteTags returns the names of a note's tags
+func noteTags(t *testing.T, noteID int) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT tg.name FROM note_tags nt JOIN tags tg ON tg.id = nt.tag_id WHERE nt.note_id = $1 ORDER BY tg.name", noteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestCalendarRoundTrip(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Water the plants")
+		api.do("PUT", fmt.Sprintf("/tasks/%d", id), map[string]interface{}{
+			"deadline": "2026-03-02", "all_day": true, "repeat_rule": "FREQ=WEEKLY",
+		}, http.StatusOK, nil)
+		api.do("POST", "/task_schedules", NewTaskSchedule{
+			TaskID: id, StartDatetime: "2026-03-01T10:00:00Z", EndDatetime: "2026-03-01T11:00:00Z",
+		}, http.StatusCreated, nil)
+		var tag MessageResponse
+		api.do("POST", "/tags", NewTag{Name: "garden"}, http.StatusCreated, &tag)
+		before := api.taskDetails(id)
+		api.do("POST", fmt.Sprintf("/notes/%d/tags", before.NoteID), AddTagToNote{TagID: tag.ID}, http.StatusOK, nil)
+
+		// Importing the feed changes nothing, the DTSTART of the recurring
+		// VTODO is not a schedule and the VEVENT leaves all_day alone
+		feed := api.text("GET", "/calendar.ics", nil, http.StatusOK)
+		api.do("POST", "/import/ics", feed, http.StatusOK, nil)
+		after := api.taskDetails(id)
+		if len(after.Schedules) != 1 {
+			t.Errorf("schedules after the round trip: got %d, want 1", len(after.Schedules))
+		}
+		if after.Deadline != before.Deadline || !after.AllDay || after.RepeatRule != before.RepeatRule {
+			t.Errorf("after the round trip: deadline %q, all day %v, repeat %q, want %q, true, %q",
+				after.Deadline, after.AllDay, after.RepeatRule, before.Deadline, before.RepeatRule)
+		}
+		if tags := noteTags(t, after.NoteID); len(tags) != 1 || tags[0] != "garden" {
+			t.Errorf("tags after the round trip: got %v, want [garden]", tags)
+		}
+
+		// A VTODO without DUE or CATEGORIES has no deadline or tags
+		todo := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//draftsmith//tests//EN\r\n" +
+			"BEGIN:VTODO\r\nUID:" + taskUID(id) + "\r\nSUMMARY:Water the plants\r\nSTATUS:NEEDS-ACTION\r\nEND:VTODO\r\n" +
+			"END:VCALENDAR\r\n"
+		api.do("POST", "/import/ics", todo, http.StatusOK, nil)
+		if task := api.taskDetails(id); task.Deadline != "" {
+			t.Errorf("deadline after importing a VTODO without DUE: got %q", task.Deadline)
+		}
+		if tags := noteTags(t, before.NoteID); len(tags) != 0 {
+			t.Errorf("tags after importing a VTODO without CATEGORIES: got %v", tags)
+		}
+
+		// Only unreadable calendars are the client's fault
+		api.apiError("POST", "/import/ics", "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nDUE:tomorrow\r\nUID:x\r\nEND:VTODO\r\nEND:VCALENDAR\r\n", http.StatusBadRequest)
+	})
+}
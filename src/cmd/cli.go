@@ -4,35 +4,153 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"draftsmith/src/client"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// CLI client
+//
+// The cli subcommands talk to a running server over HTTP with the client
+// package. Results are printed as tables, or as the JSON returned by the
+// server with --json.
+
 // cliCmd represents the cli command
 var cliCmd = &cobra.Command{
 	Use:   "cli",
 	Short: "Interact with the Draftsmith API using the CLI",
 	Long: `A CLI for interacting with the Draftsmith API. Useful for scripting and automation.
 
-This Can be used to create, read, update, and delete drafts and notes, as well as to manage tags and categories.
+This can be used to create, read, update, and delete notes, tags, tasks and
+assets, and to clock in and out of tasks, on a running server.
 
-Use this as a reference for interacting with the API programmatically.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("cli called")
+Use --json to print the JSON returned by the API instead of a table.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Errors from the API are not usage errors
+		cmd.SilenceUsage = true
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(cliCmd)
 
-	// Here you will define your flags and configuration settings.
+	cliCmd.PersistentFlags().Bool("json", false, "Print JSON instead of a table")
+}
+
+// apiClient returns a client for the configured server
+func apiClient() *client.Client {
+	server := viper.GetString("server")
+	if server == "" {
+		server = fmt.Sprintf("http://localhost:%d", viper.GetInt("port"))
+	}
+	c := client.New(server)
+	if viper.IsSet("timezone") {
+		c.Timezone = viper.GetString("timezone")
+	}
+	return c
+}
+
+// jsonOutput reports whether --json was given
+func jsonOutput(cmd *cobra.Command) bool {
+	asJSON, _ := cmd.Flags().GetBool("json")
+	return asJSON
+}
+
+// printJSON prints v indented
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable prints rows under a header with aligned columns
+func printTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// cliCmd.PersistentFlags().String("foo", "", "A help for foo")
+// printResult prints v as JSON with --json and message otherwise
+func printResult(cmd *cobra.Command, v interface{}, message string) error {
+	if jsonOutput(cmd) {
+		return printJSON(cmd.OutOrStdout(), v)
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), message)
+	return nil
+}
+
+// parseID parses a positional ID argument
+func parseID(what, s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s ID %q", what, s)
+	}
+	return id, nil
+}
+
+// editText opens text in $VISUAL or $EDITOR (vi if neither is set) and
+// returns the edited text
+func editText(text, pattern string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return "", fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("error writing temporary file: %w", err)
+	}
+
+	// The editor may carry arguments, e.g. EDITOR="code --wait"
+	args := append(strings.Fields(editor), f.Name())
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("error running %s: %w", args[0], err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("error reading temporary file: %w", err)
+	}
+	return string(data), nil
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// cliCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// cliContext is the context of a CLI request
+func cliContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
 }
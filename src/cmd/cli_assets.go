@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var assetsCmd = &cobra.Command{
+	Use:   "assets",
+	Short: "List, upload, download and delete assets",
+}
+
+var assetsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List assets",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		files, err := apiClient().ListAssets(cliContext(cmd))
+		if err != nil {
+			return err
+		}
+		if jsonOutput(cmd) {
+			return printJSON(cmd.OutOrStdout(), files)
+		}
+		rows := make([][]string, len(files))
+		for i, f := range files {
+			rows[i] = []string{strconv.Itoa(f.ID), f.FileName, f.AssetType, f.Description}
+		}
+		return printTable(cmd.OutOrStdout(), []string{"ID", "FILE", "TYPE", "DESCRIPTION"}, rows)
+	},
+}
+
+var assetsUploadCmd = &cobra.Command{
+	Use:   "upload FILE",
+	Short: "Upload a file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		assetType, _ := cmd.Flags().GetString("type")
+		description, _ := cmd.Flags().GetString("description")
+		resp, err := apiClient().UploadAsset(cliContext(cmd), filepath.Base(args[0]), f, assetType, description)
+		if err != nil {
+			return err
+		}
+		return printResult(cmd, resp, fmt.Sprintf("%d\t%s", resp.ID, resp.Filename))
+	},
+}
+
+var assetsDownloadCmd = &cobra.Command{
+	Use:   "download ID",
+	Short: "Download an asset, - as the output writes to stdout",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID("asset", args[0])
+		if err != nil {
+			return err
+		}
+		c := apiClient()
+
+		output, _ := cmd.Flags().GetString("output")
+		if output == "" {
+			// Default to the name the asset was stored under
+			files, err := c.ListAssets(cliContext(cmd))
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				if f.ID == id {
+					output = filepath.Base(f.FileName)
+				}
+			}
+			if output == "" {
+				return fmt.Errorf("asset %d not found", id)
+			}
+		}
+
+		var w io.Writer = cmd.OutOrStdout()
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := c.DownloadAsset(cliContext(cmd), id, w); err != nil {
+			if output != "-" {
+				os.Remove(output)
+			}
+			return err
+		}
+		if output != "-" && !jsonOutput(cmd) {
+			fmt.Fprintln(cmd.ErrOrStderr(), "Saved", output)
+		}
+		return nil
+	},
+}
+
+var assetsRmCmd = &cobra.Command{
+	Use:     "rm ID...",
+	Aliases: []string{"delete"},
+	Short:   "Delete assets",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		for _, arg := range args {
+			id, err := parseID("asset", arg)
+			if err != nil {
+				return err
+			}
+			if err := c.DeleteAsset(cliContext(cmd), id); err != nil {
+				return fmt.Errorf("asset %d: %w", id, err)
+			}
+			if !jsonOutput(cmd) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted asset %d\n", id)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	cliCmd.AddCommand(assetsCmd)
+	assetsCmd.AddCommand(assetsListCmd, assetsUploadCmd, assetsDownloadCmd, assetsRmCmd)
+
+	assetsUploadCmd.Flags().String("type", "", "Asset type")
+	assetsUploadCmd.Flags().String("description", "", "Description")
+	assetsDownloadCmd.Flags().StringP("output", "o", "", "File to write, - for stdout (default the asset's file name)")
+}
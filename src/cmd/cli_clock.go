@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var clockCmd = &cobra.Command{
+	Use:   "clock",
+	Short: "Clock in and out of tasks",
+}
+
+var clockInCmd = &cobra.Command{
+	Use:   "in TASK_ID",
+	Short: "Start the clock on a task, stopping any running clock",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		taskID, err := parseID("task", args[0])
+		if err != nil {
+			return err
+		}
+		resp, err := apiClient().StartClock(cliContext(cmd), taskID)
+		if err != nil {
+			return err
+		}
+		message := fmt.Sprintf("Clocked in to task %d at %s", taskID, resp.ClockIn)
+		if resp.StoppedID != 0 {
+			message += fmt.Sprintf(" (stopped clock %d)", resp.StoppedID)
+		}
+		return printResult(cmd, resp, message)
+	},
+}
+
+var clockOutCmd = &cobra.Command{
+	Use:   "out [TASK_ID]",
+	Short: "Stop the clock on a task, by default the one running",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		var taskID int
+		if len(args) == 1 {
+			id, err := parseID("task", args[0])
+			if err != nil {
+				return err
+			}
+			taskID = id
+		} else {
+			current, err := c.CurrentClock(cliContext(cmd))
+			if err != nil {
+				return err
+			}
+			if !current.Running {
+				return fmt.Errorf("no clock is running")
+			}
+			taskID = current.TaskID
+		}
+
+		resp, err := c.StopClock(cliContext(cmd), taskID)
+		if err != nil {
+			return err
+		}
+		return printResult(cmd, resp, fmt.Sprintf("Clocked out of task %d at %s", taskID, resp.ClockOut))
+	},
+}
+
+var clockStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the running clock",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		current, err := apiClient().CurrentClock(cliContext(cmd))
+		if err != nil {
+			return err
+		}
+		if !current.Running {
+			return printResult(cmd, current, "No clock is running")
+		}
+		elapsed := time.Duration(current.ElapsedSeconds) * time.Second
+		return printResult(cmd, current, fmt.Sprintf("Task %d (%s) since %s, %s",
+			current.TaskID, current.Title, current.ClockIn, elapsed))
+	},
+}
+
+func init() {
+	cliCmd.AddCommand(clockCmd)
+	clockCmd.AddCommand(clockInCmd, clockOutCmd, clockStatusCmd)
+}
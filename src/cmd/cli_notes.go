@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"draftsmith/src/client"
+
+	"github.com/spf13/cobra"
+)
+
+var notesCmd = &cobra.Command{
+	Use:   "notes",
+	Short: "List, show, create, edit and delete notes",
+}
+
+var notesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List notes",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		if query, _ := cmd.Flags().GetString("search"); query != "" {
+			notes, err := c.SearchNotes(cliContext(cmd), query)
+			if err != nil {
+				return err
+			}
+			if jsonOutput(cmd) {
+				return printJSON(cmd.OutOrStdout(), notes)
+			}
+			rows := make([][]string, len(notes))
+			for i, n := range notes {
+				rows[i] = []string{strconv.Itoa(n.ID), n.Title}
+			}
+			return printTable(cmd.OutOrStdout(), []string{"ID", "TITLE"}, rows)
+		}
+
+		notes, err := c.ListNoteSummaries(cliContext(cmd))
+		if err != nil {
+			return err
+		}
+		if jsonOutput(cmd) {
+			return printJSON(cmd.OutOrStdout(), notes)
+		}
+		rows := make([][]string, len(notes))
+		for i, n := range notes {
+			rows[i] = []string{strconv.Itoa(n.ID), n.Title, n.ModifiedAt}
+		}
+		return printTable(cmd.OutOrStdout(), []string{"ID", "TITLE", "MODIFIED"}, rows)
+	},
+}
+
+var notesGetCmd = &cobra.Command{
+	Use:   "get ID",
+	Short: "Print a note",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID("note", args[0])
+		if err != nil {
+			return err
+		}
+		note, err := apiClient().GetNote(cliContext(cmd), id)
+		if err != nil {
+			return err
+		}
+		if jsonOutput(cmd) {
+			return printJSON(cmd.OutOrStdout(), note)
+		}
+		if contentOnly, _ := cmd.Flags().GetBool("content"); contentOnly {
+			fmt.Fprint(cmd.OutOrStdout(), note.Content)
+			return nil
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "# %s\n\n%s\n", note.Title, strings.TrimRight(note.Content, "\n"))
+		return nil
+	},
+}
+
+// noteContent reads the content of a new note from --file (- for stdin),
+// piped stdin or the editor
+func noteContent(cmd *cobra.Command) (string, error) {
+	if content, _ := cmd.Flags().GetString("content"); cmd.Flags().Changed("content") {
+		return content, nil
+	}
+	file, _ := cmd.Flags().GetString("file")
+	switch {
+	case file == "-" || file == "" && !isTerminal(os.Stdin):
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	case file != "":
+		data, err := os.ReadFile(file)
+		return string(data), err
+	}
+	return editText("", "draftsmith-*.md")
+}
+
+var notesCreateCmd = &cobra.Command{
+	Use:   "create TITLE",
+	Short: "Create a note",
+	Long: `Create a note. The content is taken from --content, from --file (- for
+stdin), from stdin if it is not a terminal, or otherwise written in $EDITOR.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		content, err := noteContent(cmd)
+		if err != nil {
+			return err
+		}
+		c := apiClient()
+		id, err := c.CreateNote(cliContext(cmd), client.NewNote{Title: args[0], Content: content})
+		if err != nil {
+			return err
+		}
+		if parent, _ := cmd.Flags().GetInt("parent"); parent != 0 {
+			hierarchyType, _ := cmd.Flags().GetString("type")
+			err := c.AddNoteHierarchyEntry(cliContext(cmd), client.NoteHierarchyEntry{
+				ParentNoteID: parent, ChildNoteID: id, HierarchyType: hierarchyType,
+			})
+			if err != nil {
+				return fmt.Errorf("note %d created but not placed under %d: %w", id, parent, err)
+			}
+		}
+		return printResult(cmd, client.MessageResponse{Message: "Note created successfully", ID: id}, strconv.Itoa(id))
+	},
+}
+
+var notesEditCmd = &cobra.Command{
+	Use:   "edit ID",
+	Short: "Edit a note in $EDITOR",
+	Long: `Edit the content of a note in $EDITOR, or set it from --file (- for stdin).
+Use --title to rename the note.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID("note", args[0])
+		if err != nil {
+			return err
+		}
+		c := apiClient()
+		note, err := c.GetNote(cliContext(cmd), id)
+		if err != nil {
+			return err
+		}
+
+		var update client.NoteUpdate
+		if cmd.Flags().Changed("title") {
+			title, _ := cmd.Flags().GetString("title")
+			update.Title = &title
+		}
+		var content string
+		file, _ := cmd.Flags().GetString("file")
+		switch {
+		case file == "-":
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			content = string(data)
+		case file != "":
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			content = string(data)
+		case update.Title != nil:
+			// Only renaming
+			content = note.Content
+		default:
+			if content, err = editText(note.Content, "draftsmith-*.md"); err != nil {
+				return err
+			}
+		}
+		if content != note.Content {
+			update.Content = &content
+		}
+
+		if update.Title == nil && update.Content == nil {
+			fmt.Fprintln(cmd.ErrOrStderr(), "No changes")
+			return nil
+		}
+		if err := c.UpdateNote(cliContext(cmd), id, update); err != nil {
+			return err
+		}
+		return printResult(cmd, client.MessageResponse{Message: "Note updated successfully"}, "Note updated")
+	},
+}
+
+var notesRmCmd = &cobra.Command{
+	Use:     "rm ID...",
+	Aliases: []string{"delete"},
+	Short:   "Delete notes",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		for _, arg := range args {
+			id, err := parseID("note", arg)
+			if err != nil {
+				return err
+			}
+			if err := c.DeleteNote(cliContext(cmd), id); err != nil {
+				return fmt.Errorf("note %d: %w", id, err)
+			}
+			if !jsonOutput(cmd) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted note %d\n", id)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	cliCmd.AddCommand(notesCmd)
+	notesCmd.AddCommand(notesListCmd, notesGetCmd, notesCreateCmd, notesEditCmd, notesRmCmd)
+
+	notesListCmd.Flags().StringP("search", "s", "", "Only notes matching this full text search")
+	notesGetCmd.Flags().Bool("content", false, "Print only the content")
+	notesCreateCmd.Flags().String("content", "", "Content of the note")
+	notesCreateCmd.Flags().StringP("file", "f", "", "Read the content from a file, - for stdin")
+	notesCreateCmd.Flags().Int("parent", 0, "Place the note under this note")
+	notesCreateCmd.Flags().String("type", "subpage", "Hierarchy type under the parent: page, block or subpage")
+	notesEditCmd.Flags().String("title", "", "New title")
+	notesEditCmd.Flags().StringP("file", "f", "", "Read the content from a file, - for stdin")
+}
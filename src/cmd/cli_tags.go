@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"draftsmith/src/client"
+
+	"github.com/spf13/cobra"
+)
+
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "List, create, rename, delete and assign tags",
+}
+
+// resolveTag finds a tag by ID or name
+func resolveTag(cmd *cobra.Command, c *client.Client, s string) (int, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return id, nil
+	}
+	tags, err := c.ListTags(cliContext(cmd))
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range tags {
+		if t.Name == s {
+			return t.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("no tag named %q", s)
+}
+
+var tagsListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List tags",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tags, err := apiClient().ListTags(cliContext(cmd))
+		if err != nil {
+			return err
+		}
+		if jsonOutput(cmd) {
+			return printJSON(cmd.OutOrStdout(), tags)
+		}
+		rows := make([][]string, len(tags))
+		for i, t := range tags {
+			rows[i] = []string{strconv.Itoa(t.ID), t.Name}
+		}
+		return printTable(cmd.OutOrStdout(), []string{"ID", "NAME"}, rows)
+	},
+}
+
+var tagsCreateCmd = &cobra.Command{
+	Use:   "create NAME",
+	Short: "Create a tag",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := apiClient().CreateTag(cliContext(cmd), args[0])
+		if err != nil {
+			return err
+		}
+		return printResult(cmd, client.MessageResponse{Message: "Tag created successfully", ID: id}, strconv.Itoa(id))
+	},
+}
+
+var tagsRenameCmd = &cobra.Command{
+	Use:   "rename TAG NAME",
+	Short: "Rename a tag, given by ID or name",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		id, err := resolveTag(cmd, c, args[0])
+		if err != nil {
+			return err
+		}
+		if err := c.RenameTag(cliContext(cmd), id, args[1]); err != nil {
+			return err
+		}
+		return printResult(cmd, client.MessageResponse{Message: "Tag updated successfully"}, "Tag renamed")
+	},
+}
+
+var tagsRmCmd = &cobra.Command{
+	Use:     "rm TAG...",
+	Aliases: []string{"delete"},
+	Short:   "Delete tags, given by ID or name",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		for _, arg := range args {
+			id, err := resolveTag(cmd, c, arg)
+			if err != nil {
+				return err
+			}
+			if err := c.DeleteTag(cliContext(cmd), id); err != nil {
+				return fmt.Errorf("tag %s: %w", arg, err)
+			}
+			if !jsonOutput(cmd) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted tag %s\n", arg)
+			}
+		}
+		return nil
+	},
+}
+
+var tagsAddCmd = &cobra.Command{
+	Use:   "add NOTE_ID TAG...",
+	Short: "Tag a note, tags are given by ID or name",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		noteID, err := parseID("note", args[0])
+		if err != nil {
+			return err
+		}
+		c := apiClient()
+		for _, arg := range args[1:] {
+			tagID, err := resolveTag(cmd, c, arg)
+			if err != nil {
+				return err
+			}
+			if err := c.TagNote(cliContext(cmd), noteID, tagID); err != nil {
+				return fmt.Errorf("tag %s: %w", arg, err)
+			}
+		}
+		return printResult(cmd, client.MessageResponse{Message: "Tag added to note successfully"}, "Note tagged")
+	},
+}
+
+func init() {
+	cliCmd.AddCommand(tagsCmd)
+	tagsCmd.AddCommand(tagsListCmd, tagsCreateCmd, tagsRenameCmd, tagsRmCmd, tagsAddCmd)
+}
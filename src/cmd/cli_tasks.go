@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"draftsmith/src/client"
+
+	"github.com/spf13/cobra"
+)
+
+var tasksCmd = &cobra.Command{
+	Use:   "tasks",
+	Short: "List, rank, create, update and delete tasks",
+}
+
+var tasksListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List tasks",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		var tasks []client.TaskWithDetails
+		var err error
+		if actionable, _ := cmd.Flags().GetBool("actionable"); actionable {
+			tasks, err = c.ActionableTasks(cliContext(cmd))
+		} else {
+			tasks, err = c.ListTasks(cliContext(cmd))
+		}
+		if err != nil {
+			return err
+		}
+		if statuses, _ := cmd.Flags().GetStringSlice("status"); len(statuses) > 0 {
+			filtered := tasks[:0]
+			for _, t := range tasks {
+				for _, s := range statuses {
+					if t.Status == s {
+						filtered = append(filtered, t)
+						break
+					}
+				}
+			}
+			tasks = filtered
+		}
+
+		if jsonOutput(cmd) {
+			return printJSON(cmd.OutOrStdout(), tasks)
+		}
+		rows := make([][]string, len(tasks))
+		for i, t := range tasks {
+			rows[i] = []string{
+				strconv.Itoa(t.ID), strconv.Itoa(t.NoteID), t.Status, strconv.Itoa(t.Priority),
+				t.Deadline, formatHours(t.EffortEstimate), formatHours(t.ClockedEffort),
+			}
+		}
+		return printTable(cmd.OutOrStdout(), []string{"ID", "NOTE", "STATUS", "PRIORITY", "DEADLINE", "ESTIMATE", "CLOCKED"}, rows)
+	},
+}
+
+var tasksNextCmd = &cobra.Command{
+	Use:   "next",
+	Short: "Rank the next actions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		if minutes, _ := cmd.Flags().GetFloat64("minutes"); minutes > 0 {
+			query.Set("minutes", strconv.FormatFloat(minutes, 'f', -1, 64))
+		}
+		if tags, _ := cmd.Flags().GetStringSlice("tags"); len(tags) > 0 {
+			query.Set("tags", strings.Join(tags, ","))
+		}
+		if cmd.Flags().Changed("limit") {
+			limit, _ := cmd.Flags().GetInt("limit")
+			query.Set("limit", strconv.Itoa(limit))
+		}
+		tasks, err := apiClient().NextTasks(cliContext(cmd), query)
+		if err != nil {
+			return err
+		}
+		if jsonOutput(cmd) {
+			return printJSON(cmd.OutOrStdout(), tasks)
+		}
+		rows := make([][]string, len(tasks))
+		for i, t := range tasks {
+			remaining := ""
+			if t.RemainingHours != nil {
+				remaining = formatHours(*t.RemainingHours)
+			}
+			rows[i] = []string{
+				strconv.Itoa(t.ID), strconv.FormatFloat(t.Score, 'f', 2, 64), t.Status,
+				t.Title, t.Deadline, remaining, strings.Join(t.Tags, ","),
+			}
+		}
+		return printTable(cmd.OutOrStdout(), []string{"ID", "SCORE", "STATUS", "TITLE", "DEADLINE", "REMAINING", "TAGS"}, rows)
+	},
+}
+
+var tasksCreateCmd = &cobra.Command{
+	Use:   "create NOTE_ID",
+	Short: "Make a note into a task",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		noteID, err := parseID("note", args[0])
+		if err != nil {
+			return err
+		}
+		f := cmd.Flags()
+		task := client.NewTask{NoteID: noteID}
+		task.Status, _ = f.GetString("status")
+		task.Deadline, _ = f.GetString("deadline")
+		task.Priority, _ = f.GetInt("priority")
+		task.EffortEstimate, _ = f.GetFloat64("estimate")
+		task.AllDay, _ = f.GetBool("all-day")
+		task.GoalRelationship, _ = f.GetInt("goal")
+		task.RepeatRule, _ = f.GetString("repeat")
+
+		id, err := apiClient().CreateTask(cliContext(cmd), task)
+		if err != nil {
+			return err
+		}
+		return printResult(cmd, client.MessageResponse{Message: "Task created successfully", ID: id}, strconv.Itoa(id))
+	},
+}
+
+var tasksUpdateCmd = &cobra.Command{
+	Use:   "update ID",
+	Short: "Change the fields of a task given as flags",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID("task", args[0])
+		if err != nil {
+			return err
+		}
+
+		// Only send what was given, so the rest of the task is left alone
+		f := cmd.Flags()
+		var update client.UpdateTask
+		if f.Changed("status") {
+			s, _ := f.GetString("status")
+			update.Status = &s
+		}
+		if f.Changed("deadline") {
+			s, _ := f.GetString("deadline")
+			update.Deadline = &s
+		}
+		if f.Changed("priority") {
+			n, _ := f.GetInt("priority")
+			update.Priority = &n
+		}
+		if f.Changed("estimate") {
+			x, _ := f.GetFloat64("estimate")
+			update.EffortEstimate = &x
+		}
+		if f.Changed("all-day") {
+			b, _ := f.GetBool("all-day")
+			update.AllDay = &b
+		}
+		if f.Changed("goal") {
+			n, _ := f.GetInt("goal")
+			update.GoalRelationship = &n
+		}
+		if f.Changed("repeat") {
+			s, _ := f.GetString("repeat")
+			update.RepeatRule = &s
+		}
+		if f.Changed("effort") {
+			x, _ := f.GetFloat64("effort")
+			override := &x
+			update.ActualEffortOverride = &override
+		}
+		if clearEffort, _ := f.GetBool("clear-effort"); clearEffort {
+			var override *float64
+			update.ActualEffortOverride = &override
+		}
+		if update == (client.UpdateTask{}) {
+			return fmt.Errorf("nothing to update, see --help for the fields that can be changed")
+		}
+
+		resp, err := apiClient().UpdateTask(cliContext(cmd), id, update)
+		if err != nil {
+			return err
+		}
+		message := "Task updated"
+		if resp.NextDeadline != "" {
+			message += ", next due " + resp.NextDeadline
+		}
+		return printResult(cmd, resp, message)
+	},
+}
+
+var tasksRmCmd = &cobra.Command{
+	Use:     "rm ID...",
+	Aliases: []string{"delete"},
+	Short:   "Delete tasks, leaving their notes",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c := apiClient()
+		for _, arg := range args {
+			id, err := parseID("task", arg)
+			if err != nil {
+				return err
+			}
+			if err := c.DeleteTask(cliContext(cmd), id); err != nil {
+				return fmt.Errorf("task %d: %w", id, err)
+			}
+			if !jsonOutput(cmd) {
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted task %d\n", id)
+			}
+		}
+		return nil
+	},
+}
+
+// formatHours prints a number of hours without trailing zeros
+func formatHours(h float64) string {
+	return strconv.FormatFloat(h, 'f', -1, 64)
+}
+
+// addTaskFlags adds the task fields shared by create and update
+func addTaskFlags(cmd *cobra.Command) {
+	cmd.Flags().String("status", "", "Status, see GET /task_statuses (default the initial status)")
+	cmd.Flags().String("deadline", "", "Deadline as RFC 3339 or a local date and time")
+	cmd.Flags().Int("priority", 0, "Priority")
+	cmd.Flags().Float64("estimate", 0, "Effort estimate in hours")
+	cmd.Flags().Bool("all-day", false, "The deadline is a whole day")
+	cmd.Flags().Int("goal", 0, "Goal relationship")
+	cmd.Flags().String("repeat", "", "Repeat rule such as FREQ=WEEKLY")
+}
+
+func init() {
+	cliCmd.AddCommand(tasksCmd)
+	tasksCmd.AddCommand(tasksListCmd, tasksNextCmd, tasksCreateCmd, tasksUpdateCmd, tasksRmCmd)
+
+	tasksListCmd.Flags().StringSlice("status", nil, "Only tasks with these statuses")
+	tasksListCmd.Flags().Bool("actionable", false, "Only tasks that are not blocked or done")
+	tasksNextCmd.Flags().Float64("minutes", 0, "Only tasks that fit in this many minutes")
+	tasksNextCmd.Flags().StringSlice("tags", nil, "Favour tasks with these tags")
+	tasksNextCmd.Flags().Int("limit", 10, "Number of tasks to show")
+	addTaskFlags(tasksCreateCmd)
+	addTaskFlags(tasksUpdateCmd)
+	tasksUpdateCmd.Flags().Float64("effort", 0, "Override the actual effort in hours")
+	tasksUpdateCmd.Flags().Bool("clear-effort", false, "Remove the actual effort override")
+}
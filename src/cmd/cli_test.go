@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// cli runs a cli subcommand against the test server and returns its
+// output, it fails the test if the command fails
+func (api *testAPI) cli(args ...string) string {
+	api.t.Helper()
+	out, err := api.cliError(args...)
+	if err != nil {
+		api.t.Fatalf("cli %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+// cliError runs a cli subcommand against the test server and returns its
+// output and error
+func (api *testAPI) cliError(args ...string) (string, error) {
+	viper.Set("server", api.url)
+	defer viper.Set("server", "")
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs(append([]string{"cli"}, args...))
+	defer func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+		resetFlags(rootCmd)
+	}()
+	_, err := rootCmd.ExecuteC()
+	return out.String(), err
+}
+
+// resetFlags sets the flags of cmd and its subcommands back to their
+// defaults, the commands are global and keep them between runs
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			s.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, c := range cmd.Commands() {
+		resetFlags(c)
+	}
+}
+
+// chdirTemp runs the rest of the test in a temporary directory, where the
+// server keeps its uploads
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestCLINotes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := strings.TrimSpace(api.cli("notes", "create", "Groceries", "--content", "Milk\n"))
+		if got := api.cli("notes", "get", id); got != "# Groceries\n\nMilk\n" {
+			t.Errorf("notes get: got %q", got)
+		}
+
+		// The editor appends a line to the note
+		editor := filepath.Join(t.TempDir(), "editor.sh")
+		if err := os.WriteFile(editor, []byte("#!/bin/sh\necho Eggs >> \"$1\"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("VISUAL", editor)
+		api.cli("notes", "edit", id)
+		api.cli("notes", "edit", id, "--title", "Shopping")
+		var note Note
+		if err := json.Unmarshal([]byte(api.cli("notes", "get", id, "--json")), &note); err != nil {
+			t.Fatal(err)
+		}
+		if note.Title != "Shopping" || note.Content != "Milk\nEggs\n" {
+			t.Errorf("edited note: got %q, %q", note.Title, note.Content)
+		}
+
+		if list := api.cli("notes", "list"); !strings.HasPrefix(list, "ID") || !strings.Contains(list, "Shopping") {
+			t.Errorf("notes list: got\n%s", list)
+		}
+		if list := api.cli("notes", "list", "--search", "eggs"); !strings.Contains(list, "Shopping") {
+			t.Errorf("notes list --search: got\n%s", list)
+		}
+
+		api.cli("notes", "rm", id)
+		if _, err := api.cliError("notes", "get", id); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("getting a deleted note: got error %v", err)
+		}
+	})
+}
+
+func TestCLITags(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		note := strings.TrimSpace(api.cli("notes", "create", "Report", "--content", ""))
+		api.cli("tags", "create", "work")
+		api.cli("tags", "add", note, "work")
+		api.cli("tags", "rename", "work", "office")
+		if list := api.cli("tags", "list"); !strings.Contains(list, "office") || strings.Contains(list, "work") {
+			t.Errorf("tags list: got\n%s", list)
+		}
+		api.cli("tags", "rm", "office")
+		if list := api.cli("tags", "list"); strings.Contains(list, "office") {
+			t.Errorf("tags list after rm: got\n%s", list)
+		}
+	})
+}
+
+func TestCLITasksAndClock(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		note := strings.TrimSpace(api.cli("notes", "create", "Write report", "--content", ""))
+		id := strings.TrimSpace(api.cli("tasks", "create", note, "--priority", "4", "--goal", "3", "--estimate", "2"))
+
+		// Only the flags given are changed
+		api.cli("tasks", "update", id, "--deadline", "2030-01-02T09:00:00Z")
+		var tasks []TaskWithDetails
+		if err := json.Unmarshal([]byte(api.cli("tasks", "list", "--json")), &tasks); err != nil {
+			t.Fatal(err)
+		}
+		var found bool
+		for _, task := range tasks {
+			if id == strconv.Itoa(task.ID) {
+				found = true
+				if task.Priority != 4 || task.EffortEstimate != 2 || task.Deadline != "2030-01-02T09:00:00Z" {
+					t.Errorf("updated task: got %+v", task)
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("task %s is not listed", id)
+		}
+		if _, err := api.cliError("tasks", "update", id); err == nil {
+			t.Error("update without flags: want an error")
+		}
+
+		if out := api.cli("clock", "in", id); !strings.HasPrefix(out, "Clocked in to task "+id) {
+			t.Errorf("clock in: got %q", out)
+		}
+		if out := api.cli("clock", "status"); !strings.HasPrefix(out, "Task "+id+" (Write report)") {
+			t.Errorf("clock status: got %q", out)
+		}
+		if out := api.cli("clock", "out"); !strings.HasPrefix(out, "Clocked out of task "+id) {
+			t.Errorf("clock out: got %q", out)
+		}
+		if _, err := api.cliError("clock", "out"); err == nil || err.Error() != "no clock is running" {
+			t.Errorf("clock out without a clock: got error %v", err)
+		}
+
+		api.cli("tasks", "rm", id)
+		if _, err := api.cliError("tasks", "rm", id); err == nil {
+			t.Error("deleting a deleted task: want an error")
+		}
+	})
+}
+
+func TestCLIAssets(t *testing.T) {
+	dir := chdirTemp(t)
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		src := filepath.Join(dir, "diagram.txt")
+		if err := os.WriteFile(src, []byte("boxes and arrows"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var upload UploadResponse
+		if err := json.Unmarshal([]byte(api.cli("assets", "upload", src, "--description", "Sketch", "--json")), &upload); err != nil {
+			t.Fatal(err)
+		}
+		if list := api.cli("assets", "list"); !strings.Contains(list, "Sketch") {
+			t.Errorf("assets list: got\n%s", list)
+		}
+
+		if got := api.cli("assets", "download", strconv.Itoa(upload.ID), "-o", "-"); got != "boxes and arrows" {
+			t.Errorf("download to stdout: got %q", got)
+		}
+		dst := filepath.Join(t.TempDir(), "copy.txt")
+		api.cli("assets", "download", strconv.Itoa(upload.ID), "-o", dst)
+		if data, err := os.ReadFile(dst); err != nil || string(data) != "boxes and arrows" {
+			t.Errorf("downloaded file: got %q, %v", data, err)
+		}
+
+		api.cli("assets", "rm", strconv.Itoa(upload.ID))
+		if _, err := api.cliError("assets", "download", strconv.Itoa(upload.ID), "-o", "-"); err == nil {
+			t.Error("downloading a deleted asset: want an error")
+		}
+	})
+}
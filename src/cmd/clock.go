@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Clocking in and out
+//
+// The server is the time source for these endpoints. Only a single clock
+// may run at a time, starting a clock stops any running clock, and the
+// task_clocks_no_overlap constraint rejects overlapping intervals however
+// they are created.
+
+// ClockResponse is the body returned when starting or stopping a clock,
+// StoppedID is the clock that starting this one stopped
+type ClockResponse struct {
+	Message   string `json:"message"`
+	ID        int    `json:"id"`
+	ClockIn   string `json:"clock_in"`
+	ClockOut  string `json:"clock_out,omitempty"`
+	StoppedID int    `json:"stopped_id,omitempty"`
+}
+
+// RunningClock describes the clock that is currently running
+type RunningClock struct {
+	Running        bool   `json:"running"`
+	ID             int    `json:"id,omitempty"`
+	TaskID         int    `json:"task_id,omitempty"`
+	NoteID         int    `json:"note_id,omitempty"`
+	Title          string `json:"title,omitempty"`
+	ClockIn        string `json:"clock_in,omitempty"`
+	ElapsedSeconds int64  `json:"elapsed_seconds,omitempty"`
+}
+
+// stopRunningClock closes the running clock (if any) at the current time,
+// returning its ID or 0 if no clock was running
+func stopRunningClock(tx *sql.Tx) (int, error) {
+	var clockID int
+	err := tx.QueryRow(`
+        UPDATE task_clocks SET clock_out = CURRENT_TIMESTAMP
+        WHERE clock_out IS NULL
+        RETURNING id
+    `).Scan(&clockID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return clockID, err
+}
+
+func startClock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var taskExists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", taskID).Scan(&taskExists)
+	if err != nil {
+		writeServerError(w, "Error checking task existence", err)
+		return
+	}
+	if !taskExists {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	// Only one clock may run at a time
+	stoppedID, err := stopRunningClock(tx)
+	if err != nil {
+		writeServerError(w, "Error stopping running clock", err)
+		return
+	}
+
+	var clockID int
+	var clockIn time.Time
+	err = tx.QueryRow(`
+        INSERT INTO task_clocks (task_id, clock_in)
+        VALUES ($1, CURRENT_TIMESTAMP)
+        RETURNING id, clock_in
+    `, taskID).Scan(&clockID, &clockIn)
+	if err != nil {
+		if isPGError(err, pgExclusionViolation) {
+			writeError(w, "Clock entry overlaps an existing entry", http.StatusConflict)
+			return
+		}
+		writeServerError(w, "Error starting clock", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
+		return
+	}
+
+	response := ClockResponse{
+		Message:   "Clock started successfully",
+		ID:        clockID,
+		ClockIn:   formatTimestamp(clockIn),
+		StoppedID: stoppedID,
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func stopClock(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var clockID int
+	var clockIn, clockOut time.Time
+	err = db.QueryRow(`
+        UPDATE task_clocks SET clock_out = CURRENT_TIMESTAMP
+        WHERE task_id = $1 AND clock_out IS NULL
+        RETURNING id, clock_in, clock_out
+    `, taskID).Scan(&clockID, &clockIn, &clockOut)
+	if err == sql.ErrNoRows {
+		writeError(w, "No clock is running for this task", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeServerError(w, "Error stopping clock", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ClockResponse{
+		Message:  "Clock stopped successfully",
+		ID:       clockID,
+		ClockIn:  formatTimestamp(clockIn),
+		ClockOut: formatTimestamp(clockOut),
+	})
+}
+
+func getCurrentClock(w http.ResponseWriter, r *http.Request) {
+	var clock RunningClock
+	var clockIn time.Time
+	var elapsed float64
+	elapsedSeconds := "EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - tc.clock_in))"
+	if usingSQLite() {
+		elapsedSeconds = "(julianday('now') - julianday(tc.clock_in)) * 86400"
+	}
+	err := db.QueryRow(`
+        SELECT tc.id, tc.task_id, t.note_id, n.title, tc.clock_in,
+               `+elapsedSeconds+`
+        FROM task_clocks tc
+        JOIN tasks t ON t.id = tc.task_id
+        JOIN notes n ON n.id = t.note_id
+        WHERE tc.clock_out IS NULL
+    `).Scan(&clock.ID, &clock.TaskID, &clock.NoteID, &clock.Title, &clockIn, &elapsed)
+	if err != nil && err != sql.ErrNoRows {
+		writeServerError(w, "Error querying running clock", err)
+		return
+	}
+	if err == nil {
+		clock.Running = true
+		clock.ClockIn = formatTimestamp(clockIn)
+		clock.ElapsedSeconds = int64(elapsed)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clock)
+}
@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Task dependencies
+//
+// A task may depend on other tasks (its prerequisites). A task is blocked
+// while any of its prerequisites is not in a closed status, and the
+// dependency graph is kept acyclic with detectCycle just like the note and
+// tag hierarchies.
+
+// NewTaskDependency is the request body for adding a prerequisite to a task
+type NewTaskDependency struct {
+	DependsOn int `json:"depends_on"`
+}
+
+// TaskDependency is a prerequisite of a task
+type TaskDependency struct {
+	ID          int    `json:"id"`
+	TaskID      int    `json:"task_id"`
+	DependsOnID int    `json:"depends_on"`
+	NoteID      int    `json:"note_id"`
+	Title       string `json:"title"`
+	Status      string `json:"status"`
+	Blocking    bool   `json:"blocking"`
+}
+
+// loadTaskDependencies returns the prerequisites of every task and the
+// subset of them that is not closed yet, keyed by task ID
+func loadTaskDependencies(db *sql.DB) (dependsOn, blockedBy map[int][]int, err error) {
+	rows, err := db.Query(`
+        SELECT d.task_id, d.depends_on_task_id, COALESCE(s.category = 'closed', FALSE)
+        FROM task_dependencies d
+        JOIN tasks p ON p.id = d.depends_on_task_id
+        LEFT JOIN task_statuses s ON s.name = p.status
+        ORDER BY d.task_id, d.depends_on_task_id
+    `)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying task dependencies: %w", err)
+	}
+	defer rows.Close()
+
+	dependsOn = make(map[int][]int)
+	blockedBy = make(map[int][]int)
+	for rows.Next() {
+		var taskID, prerequisiteID int
+		var closed bool
+		if err := rows.Scan(&taskID, &prerequisiteID, &closed); err != nil {
+			return nil, nil, fmt.Errorf("error scanning task dependency row: %w", err)
+		}
+		dependsOn[taskID] = append(dependsOn[taskID], prerequisiteID)
+		if !closed {
+			blockedBy[taskID] = append(blockedBy[taskID], prerequisiteID)
+		}
+	}
+	return dependsOn, blockedBy, rows.Err()
+}
+
+func addTaskDependency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var dependency NewTaskDependency
+	if err := json.NewDecoder(r.Body).Decode(&dependency); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if dependency.DependsOn == taskID {
+		writeValidationError(w, "depends_on", "A task cannot depend on itself")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM tasks WHERE id IN ($1, $2)", taskID, dependency.DependsOn).Scan(&count)
+	if err != nil {
+		writeServerError(w, "Error checking task existence", err)
+		return
+	}
+	if count != 2 {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	// Fetch all existing dependencies, edges run from the prerequisite to
+	// the dependent task
+	rows, err := tx.Query("SELECT depends_on_task_id, task_id FROM task_dependencies")
+	if err != nil {
+		writeServerError(w, "Error fetching task dependencies", err)
+		return
+	}
+	defer rows.Close()
+
+	var parents, children []int
+	for rows.Next() {
+		var parent, child int
+		if err := rows.Scan(&parent, &child); err != nil {
+			writeServerError(w, "Error scanning row", err)
+			return
+		}
+		parents = append(parents, parent)
+		children = append(children, child)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error after scanning rows", err)
+		return
+	}
+
+	// Add the new dependency to check
+	parents = append(parents, dependency.DependsOn)
+	children = append(children, taskID)
+
+	if detectCycle(parents, children) {
+		writeError(w, "Operation would create a cycle in the task dependencies", http.StatusBadRequest)
+		return
+	}
+
+	var dependencyID int
+	err = tx.QueryRow(`
+        INSERT INTO task_dependencies (task_id, depends_on_task_id)
+        VALUES ($1, $2)
+        RETURNING id
+    `, taskID, dependency.DependsOn).Scan(&dependencyID)
+	if err != nil {
+		if isPGError(err, pgUniqueViolation) {
+			writeError(w, "Dependency already exists", http.StatusConflict)
+			return
+		}
+		writeServerError(w, "Error adding task dependency", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Task dependency added successfully",
+		ID:      dependencyID,
+	})
+}
+
+func removeTaskDependency(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	dependsOn, err := strconv.Atoi(vars["dependsOn"])
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM task_dependencies WHERE task_id = $1 AND depends_on_task_id = $2", taskID, dependsOn)
+	if err != nil {
+		writeServerError(w, "Error removing task dependency", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		writeServerError(w, "Error getting rows affected", err)
+		return
+	}
+	if rowsAffected == 0 {
+		writeError(w, "Task dependency not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task dependency removed successfully"})
+}
+
+func getTaskDependencies(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	var taskExists bool
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", taskID).Scan(&taskExists)
+	if err != nil {
+		writeServerError(w, "Error checking task existence", err)
+		return
+	}
+	if !taskExists {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT d.id, d.task_id, d.depends_on_task_id, p.note_id, n.title, p.status,
+               NOT COALESCE(s.category = 'closed', FALSE)
+        FROM task_dependencies d
+        JOIN tasks p ON p.id = d.depends_on_task_id
+        JOIN notes n ON n.id = p.note_id
+        LEFT JOIN task_statuses s ON s.name = p.status
+        WHERE d.task_id = $1
+        ORDER BY d.depends_on_task_id
+    `, taskID)
+	if err != nil {
+		writeServerError(w, "Error querying task dependencies", err)
+		return
+	}
+	defer rows.Close()
+
+	dependencies := []TaskDependency{}
+	for rows.Next() {
+		var d TaskDependency
+		if err := rows.Scan(&d.ID, &d.TaskID, &d.DependsOnID, &d.NoteID, &d.Title, &d.Status, &d.Blocking); err != nil {
+			writeServerError(w, "Error scanning task dependency row", err)
+			return
+		}
+		dependencies = append(dependencies, d)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error after scanning rows", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dependencies)
+}
+
+// getActionableTasks returns the tasks in the initial status that are not
+// blocked by any unfinished prerequisite
+func getActionableTasks(w http.ResponseWriter, r *http.Request) {
+	statuses, _, err := loadTaskStatuses(db)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	tasks, err := buildTasksWithDetails(db)
+	if err != nil {
+		writeServerError(w, "Error building task list", err)
+		return
+	}
+
+	actionable := []*TaskWithDetails{}
+	for _, task := range tasks {
+		if task.Status == statuses.Initial() && len(task.BlockedBy) == 0 {
+			actionable = append(actionable, task)
+		}
+	}
+	sort.Slice(actionable, func(i, j int) bool { return actionable[i].ID < actionable[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actionable)
+}
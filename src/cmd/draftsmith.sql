@@ -11,8 +11,8 @@ CREATE TABLE notes (
     id SERIAL PRIMARY KEY,
     title TEXT NOT NULL,
     content TEXT NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    modified_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     fts tsvector
 );
 
@@ -26,7 +26,7 @@ FOR EACH ROW EXECUTE PROCEDURE tsvector_update_trigger(
 -- Table to store modified dates
 CREATE TABLE note_modifications (
     note_id INT REFERENCES notes(id),
-    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    modified_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Table for categories
@@ -71,7 +71,7 @@ CREATE TABLE assets (
  location TEXT NOT NULL UNIQUE,
  description TEXT,
  description_tsv tsvector,
- created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP  -- Add this line
+ created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP  -- Add this line
 );
 
 
@@ -137,20 +137,43 @@ CREATE TABLE journal_entries (
 
 -- Task Management
 
+-- Task states, each belongs to a category that the API uses to decide
+-- whether a task still needs doing (open), was finished (closed) or was
+-- abandoned (cancelled)
+CREATE TABLE task_statuses (
+    name TEXT PRIMARY KEY,
+    category TEXT NOT NULL CHECK (category IN ('open', 'closed', 'cancelled')),
+    position INT NOT NULL DEFAULT 0,      -- Display order, e.g. board columns
+    description TEXT,
+    initial BOOLEAN NOT NULL DEFAULT FALSE CHECK (NOT initial OR category = 'open') -- Given to new tasks and reopened recurring tasks
+);
+
+-- At most one status is initial, without one the first open status is used
+CREATE UNIQUE INDEX task_statuses_initial_idx ON task_statuses (initial) WHERE initial;
+
+-- Allowed status changes, a task may only move between statuses listed here
+CREATE TABLE task_status_transitions (
+    from_status TEXT REFERENCES task_statuses(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    to_status TEXT REFERENCES task_statuses(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (from_status, to_status)
+);
+
 -- Track notes as task objects
 
 CREATE TABLE tasks (
     id SERIAL PRIMARY KEY,                 -- Unique task identifier
     note_id INT REFERENCES notes(id) ON DELETE CASCADE, -- Link to notes
-    status TEXT CHECK (status IN ('todo', 'done', 'wait', 'hold', 'idea', 'kill', 'proj', 'event')), -- Status of the task
+    status TEXT REFERENCES task_statuses(name) ON UPDATE CASCADE, -- Status of the task
     effort_estimate NUMERIC,              -- Estimated effort in hours
-    actual_effort NUMERIC,                -- Actual effort in hours
-    deadline TIMESTAMP,                   -- Deadline for the task
+    actual_effort_override NUMERIC,       -- Manually recorded effort in hours, replaces the clocked time (see task_efforts)
+    deadline TIMESTAMPTZ,                 -- Deadline for the task
     priority INT CHECK (priority IS NULL OR priority BETWEEN 1 AND 5), -- Priority of the task
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    modified_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
     all_day BOOLEAN DEFAULT FALSE,  -- Flag for all-day events (e.g. Daylight Saving savings on this day)
     goal_relationship INT CHECK (goal_relationship IS NULL OR goal_relationship BETWEEN 1 AND 5), -- Relationship to goals
+    repeat_rule TEXT,                     -- Org repeater (+1w, .+1d, ++1m) or RRULE for recurring tasks
+    board_position INT,                   -- Order within the status column of the board, NULL until moved
     UNIQUE (note_id)  -- A note can only be a task once, otherwise conflicts arise with schedule etc.
 );
 
@@ -159,17 +182,143 @@ CREATE TABLE tasks (
 CREATE TABLE task_schedules (
     id SERIAL PRIMARY KEY,                 -- Unique schedule identifier
     task_id INT REFERENCES tasks(id) ON DELETE CASCADE, -- Link to tasks
-    start_datetime TIMESTAMP,              -- Scheduled start datetime
-    end_datetime TIMESTAMP                 -- Scheduled end datetime
+    start_datetime TIMESTAMPTZ,            -- Scheduled start datetime
+    end_datetime TIMESTAMPTZ,              -- Scheduled end datetime
+    CHECK (end_datetime IS NULL OR start_datetime IS NULL OR end_datetime >= start_datetime)
+);
+
+
+-- Status change log, from_status is NULL when the task was created
+CREATE TABLE task_status_changes (
+    id SERIAL PRIMARY KEY,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Field change history of tasks, written by the trigger below so that every
+-- insert and update is captured. Values are stored as JSON to keep their
+-- type and old_value is NULL when the task was created. The reason comes
+-- from the draftsmith.change_reason setting, e.g. 'recurrence' when a
+-- recurring task advances to its next occurrence.
+CREATE TABLE task_history (
+    id SERIAL PRIMARY KEY,
+    task_id INT NOT NULL,                  -- Not a foreign key, the history outlives the task
+    field TEXT NOT NULL,
+    old_value JSONB,
+    new_value JSONB,
+    reason TEXT,
+    changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX task_history_task_idx ON task_history (task_id, changed_at);
+
+CREATE FUNCTION task_history_trigger() RETURNS trigger AS $$
+DECLARE
+  old_row JSONB := '{}';
+  new_row JSONB := to_jsonb(NEW);
+  col TEXT;
+BEGIN
+  IF TG_OP = 'UPDATE' THEN
+    old_row := to_jsonb(OLD);
+  END IF;
+  FOR col IN SELECT jsonb_object_keys(new_row) LOOP
+    CONTINUE WHEN col IN ('id', 'created_at', 'modified_at');
+    CONTINUE WHEN TG_OP = 'INSERT' AND new_row->col = 'null'::jsonb;
+    IF old_row->col IS DISTINCT FROM new_row->col THEN
+      INSERT INTO task_history (task_id, field, old_value, new_value, reason)
+      VALUES (NEW.id, col, old_row->col, new_row->col,
+              NULLIF(current_setting('draftsmith.change_reason', true), ''));
+    END IF;
+  END LOOP;
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER task_history_update
+AFTER INSERT OR UPDATE ON tasks
+FOR EACH ROW EXECUTE FUNCTION task_history_trigger();
+
+-- Completion history, recurring tasks are reopened after each completion
+CREATE TABLE task_completions (
+    id SERIAL PRIMARY KEY,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    completed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deadline TIMESTAMPTZ                   -- The deadline of the occurrence that was completed
 );
 
+-- Prerequisites, a task is blocked until the tasks it depends on are done
+CREATE TABLE task_dependencies (
+    id SERIAL PRIMARY KEY,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,            -- The dependent task
+    depends_on_task_id INT REFERENCES tasks(id) ON DELETE CASCADE, -- The prerequisite
+    CHECK (task_id <> depends_on_task_id),
+    UNIQUE (task_id, depends_on_task_id)
+);
 
 -- Clock Table (consider generalizing this so that notes can have clock tables too)
 CREATE TABLE task_clocks (
     id SERIAL PRIMARY KEY,                 -- Unique clock identifier
     task_id INT REFERENCES tasks(id) ON DELETE CASCADE, -- Link to tasks
-    clock_in TIMESTAMP,                    -- Clock in time
-    clock_out TIMESTAMP                    -- Clock out time
+    clock_in TIMESTAMPTZ NOT NULL,         -- Clock in time
+    clock_out TIMESTAMPTZ,                 -- Clock out time, NULL while the clock is running
+    CHECK (clock_out IS NULL OR clock_out >= clock_in),
+    -- Clock intervals may not overlap, a running clock extends to infinity
+    -- so this also allows only a single running clock
+    CONSTRAINT task_clocks_no_overlap EXCLUDE USING gist (
+        tstzrange(clock_in, COALESCE(clock_out, 'infinity'::timestamptz)) WITH &&
+    )
+);
+
+-- Actual effort is derived from the closed clock intervals of a task unless
+-- it has been overridden manually
+CREATE VIEW task_efforts AS
+SELECT
+    t.id AS task_id,
+    t.effort_estimate,
+    COALESCE(SUM(EXTRACT(EPOCH FROM (tc.clock_out - tc.clock_in))) / 3600, 0) AS clocked_effort,
+    t.actual_effort_override,
+    COALESCE(t.actual_effort_override, SUM(EXTRACT(EPOCH FROM (tc.clock_out - tc.clock_in))) / 3600, 0) AS actual_effort
+FROM tasks t
+LEFT JOIN task_clocks tc ON tc.task_id = t.id AND tc.clock_out IS NOT NULL
+GROUP BY t.id;
+
+-- Reminder rules, a rule fires offset_minutes before the deadline or before
+-- the start of each schedule of an open task (negative offsets fire after).
+-- sinks names where reminders are delivered, all configured sinks if empty.
+CREATE TABLE reminder_rules (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    anchor TEXT NOT NULL CHECK (anchor IN ('deadline', 'schedule_start')),
+    offset_minutes INT NOT NULL DEFAULT 0,
+    sinks TEXT[] NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Reminders are claimed here before they are delivered, so each is sent at
+-- most once. due_at is the deadline or schedule start being reminded of.
+CREATE TABLE sent_reminders (
+    id SERIAL PRIMARY KEY,
+    rule_id INT REFERENCES reminder_rules(id) ON DELETE CASCADE,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    schedule_id INT REFERENCES task_schedules(id) ON DELETE SET NULL,
+    due_at TIMESTAMPTZ NOT NULL,
+    sent_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    delivered_to TEXT[] NOT NULL DEFAULT '{}',
+    error TEXT,                            -- Delivery failures, if any
+    UNIQUE (rule_id, task_id, due_at)
+);
+
+-- Calendar components imported from iCalendar files, keyed by UID so that
+-- re-importing a calendar updates the existing notes rather than duplicating them
+CREATE TABLE calendar_uids (
+    uid TEXT PRIMARY KEY,
+    note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    schedule_id INT REFERENCES task_schedules(id) ON DELETE SET NULL,
+    component TEXT CHECK (component IN ('VTODO', 'VEVENT')),
+    href TEXT UNIQUE  -- Resource name chosen by a CalDAV client, if any
 );
 
 
@@ -214,8 +363,34 @@ INSERT INTO note_hierarchy (parent_note_id, child_note_id, hierarchy_type) VALUE
     (1, 2, 'block'),
     (2, 3, 'block');
 
+-- Default task statuses, any status may move to any other
+INSERT INTO task_statuses (name, category, position, description, initial) VALUES
+    ('idea', 'open', 0, 'Something that might be done', FALSE),
+    ('todo', 'open', 1, 'To be done', TRUE),
+    ('proj', 'open', 2, 'A project made up of other tasks', FALSE),
+    ('wait', 'open', 3, 'Waiting on someone else', FALSE),
+    ('hold', 'open', 4, 'Put on hold', FALSE),
+    ('event', 'open', 5, 'Something happening at a scheduled time', FALSE),
+    ('done', 'closed', 6, 'Finished', FALSE),
+    ('kill', 'cancelled', 7, 'No longer going to be done', FALSE);
+
+INSERT INTO task_status_transitions (from_status, to_status)
+SELECT f.name, t.name FROM task_statuses f CROSS JOIN task_statuses t WHERE f.name <> t.name;
+
 -- Populate some task data
-INSERT INTO tasks (note_id, status, effort_estimate, actual_effort, deadline, priority, all_day, goal_relationship) VALUES
-    (1, 'todo', 1.5, 0, '2021-12-31 23:59:59', 3, FALSE, 3),
+INSERT INTO tasks (note_id, status, effort_estimate, actual_effort_override, deadline, priority, all_day, goal_relationship) VALUES
+    (1, 'todo', 1.5, NULL, '2021-12-31 23:59:59', 3, FALSE, 3),
     (2, 'done', 0.5, 0.5, '2021-12-31 23:59:59', 2, FALSE, 2),
-    (3, 'todo', 2, 0, '2021-12-31 23:59:59', 1, FALSE, 1);
+    (3, 'todo', 2, NULL, '2021-12-31 23:59:59', 1, FALSE, 1);
+
+INSERT INTO reminder_rules (name, anchor, offset_minutes) VALUES
+('1 day before the deadline', 'deadline', 1440),
+('At the schedule start', 'schedule_start', 0);
+
+-- Version of this schema, cli init migrates databases at an earlier version
+-- (see migrations.go)
+CREATE TABLE schema_version (
+    version INT NOT NULL
+);
+
+INSERT INTO schema_version (version) VALUES (4);
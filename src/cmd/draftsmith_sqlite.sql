@@ -0,0 +1,475 @@
+-- SQLite version of draftsmith.sql, keep the two in step.
+--
+-- Differences from Postgres:
+--   * SERIAL columns are INTEGER PRIMARY KEY AUTOINCREMENT, so IDs are not reused
+--   * Timestamps are TIMESTAMP columns holding UTC text, the driver parses them
+--   * Full-text search uses FTS5 tables kept in step by triggers, in place of
+--     tsvector columns, pg_trgm and unaccent
+--   * modified_at is kept up to date by triggers
+--   * TEXT[] columns hold Postgres array literals such as {a,b}
+--   * JSONB columns hold JSON text
+--   * The task_clocks exclusion constraint is a trigger
+
+-- Table to store notes with a full-text search
+CREATE TABLE notes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Full-text index of the notes, porter stems English words and diacritics
+-- are ignored
+CREATE VIRTUAL TABLE notes_fts USING fts5(
+    title, content,
+    content = 'notes', content_rowid = 'id',
+    tokenize = 'porter unicode61 remove_diacritics 2'
+);
+
+-- Triggers to update the full-text index
+CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes BEGIN
+    INSERT INTO notes_fts (rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+END;
+
+CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes BEGIN
+    INSERT INTO notes_fts (notes_fts, rowid, title, content) VALUES ('delete', OLD.id, OLD.title, OLD.content);
+END;
+
+CREATE TRIGGER notes_fts_update AFTER UPDATE OF title, content ON notes BEGIN
+    INSERT INTO notes_fts (notes_fts, rowid, title, content) VALUES ('delete', OLD.id, OLD.title, OLD.content);
+    INSERT INTO notes_fts (rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+END;
+
+-- Keep modified_at current when a note changes
+CREATE TRIGGER notes_modified_at AFTER UPDATE OF title, content ON notes
+WHEN NEW.modified_at IS OLD.modified_at
+BEGIN
+    UPDATE notes SET modified_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Table to store modified dates
+CREATE TABLE note_modifications (
+    note_id INT REFERENCES notes(id),
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table for categories
+CREATE TABLE categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL
+);
+
+-- Table for tags
+CREATE TABLE tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL
+);
+
+-- Many-to-many relationship tables for categories and tags
+CREATE TABLE note_categories (
+    note_id INT REFERENCES notes(id),
+    category_id INT REFERENCES categories(id),
+    PRIMARY KEY (note_id, category_id)
+);
+
+-- Tags have heirarchy
+CREATE TABLE tag_hierarchy (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parent_tag_id INT REFERENCES tags(id),
+    child_tag_id INT REFERENCES tags(id),
+    UNIQUE (child_tag_id)  -- Tags can only have one parent
+);
+
+
+CREATE TABLE note_tags (
+    note_id INT REFERENCES notes(id),
+    tag_id INT REFERENCES tags(id),
+    PRIMARY KEY (note_id, tag_id)
+);
+
+-- Table for assets
+CREATE TABLE assets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INT REFERENCES notes(id),
+    asset_type TEXT NOT NULL,
+    location TEXT NOT NULL UNIQUE,
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Full-text index of the asset descriptions
+CREATE VIRTUAL TABLE assets_fts USING fts5(
+    description,
+    content = 'assets', content_rowid = 'id',
+    tokenize = 'porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER assets_fts_insert AFTER INSERT ON assets BEGIN
+    INSERT INTO assets_fts (rowid, description) VALUES (NEW.id, NEW.description);
+END;
+
+CREATE TRIGGER assets_fts_delete AFTER DELETE ON assets BEGIN
+    INSERT INTO assets_fts (assets_fts, rowid, description) VALUES ('delete', OLD.id, OLD.description);
+END;
+
+CREATE TRIGGER assets_fts_update AFTER UPDATE OF description ON assets BEGIN
+    INSERT INTO assets_fts (assets_fts, rowid, description) VALUES ('delete', OLD.id, OLD.description);
+    INSERT INTO assets_fts (rowid, description) VALUES (NEW.id, NEW.description);
+END;
+
+-- Table for misc attributes
+CREATE TABLE attributes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT
+);
+
+CREATE TABLE note_attributes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INT REFERENCES notes(id),
+    attribute_id INT REFERENCES attributes(id),
+    VALUE TEXT NOT NULL
+);
+
+-- Table for note types
+CREATE TABLE note_types (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    description TEXT
+);
+
+CREATE TABLE note_type_mappings (
+    note_id INT REFERENCES notes(id),
+    type_id INT REFERENCES note_types(id),
+    PRIMARY KEY (note_id, type_id)
+);
+
+-- Table for handling note hierarchy
+CREATE TABLE note_hierarchy (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parent_note_id INT REFERENCES notes(id),
+    child_note_id INT REFERENCES notes(id),
+    hierarchy_type TEXT CHECK (hierarchy_type IN ('page', 'block', 'subpage')),
+    UNIQUE (child_note_id)  -- This enforces that each child note can only have one parent
+);
+
+-- Table for journal/calendar view (optional)
+CREATE TABLE journal_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    note_id INT REFERENCES notes(id),
+    entry_date DATE NOT NULL
+);
+
+
+-- Task Management
+
+-- Task states, each belongs to a category that the API uses to decide
+-- whether a task still needs doing (open), was finished (closed) or was
+-- abandoned (cancelled)
+CREATE TABLE task_statuses (
+    name TEXT PRIMARY KEY,
+    category TEXT NOT NULL CHECK (category IN ('open', 'closed', 'cancelled')),
+    position INT NOT NULL DEFAULT 0,      -- Display order, e.g. board columns
+    description TEXT,
+    initial BOOLEAN NOT NULL DEFAULT FALSE CHECK (NOT initial OR category = 'open') -- Given to new tasks and reopened recurring tasks
+);
+
+-- At most one status is initial, without one the first open status is used
+CREATE UNIQUE INDEX task_statuses_initial_idx ON task_statuses (initial) WHERE initial;
+
+-- Allowed status changes, a task may only move between statuses listed here
+CREATE TABLE task_status_transitions (
+    from_status TEXT REFERENCES task_statuses(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    to_status TEXT REFERENCES task_statuses(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (from_status, to_status)
+);
+
+-- Track notes as task objects
+
+CREATE TABLE tasks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique task identifier
+    note_id INT REFERENCES notes(id) ON DELETE CASCADE, -- Link to notes
+    status TEXT REFERENCES task_statuses(name) ON UPDATE CASCADE, -- Status of the task
+    effort_estimate NUMERIC,              -- Estimated effort in hours
+    actual_effort_override NUMERIC,       -- Manually recorded effort in hours, replaces the clocked time (see task_efforts)
+    deadline TIMESTAMP,                   -- Deadline for the task
+    priority INT CHECK (priority IS NULL OR priority BETWEEN 1 AND 5), -- Priority of the task
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    modified_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    all_day BOOLEAN DEFAULT FALSE,  -- Flag for all-day events (e.g. Daylight Saving savings on this day)
+    goal_relationship INT CHECK (goal_relationship IS NULL OR goal_relationship BETWEEN 1 AND 5), -- Relationship to goals
+    repeat_rule TEXT,                     -- Org repeater (+1w, .+1d, ++1m) or RRULE for recurring tasks
+    board_position INT,                   -- Order within the status column of the board, NULL until moved
+    UNIQUE (note_id)  -- A note can only be a task once, otherwise conflicts arise with schedule etc.
+);
+
+-- Keep modified_at current when a task changes
+CREATE TRIGGER tasks_modified_at
+AFTER UPDATE OF note_id, status, effort_estimate, actual_effort_override, deadline, priority, all_day, goal_relationship, repeat_rule ON tasks
+WHEN NEW.modified_at IS OLD.modified_at
+BEGIN
+    UPDATE tasks SET modified_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+-- Schedule tasks over certain days
+
+CREATE TABLE task_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique schedule identifier
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE, -- Link to tasks
+    start_datetime TIMESTAMP,              -- Scheduled start datetime
+    end_datetime TIMESTAMP,                -- Scheduled end datetime
+    CHECK (end_datetime IS NULL OR start_datetime IS NULL OR julianday(end_datetime) >= julianday(start_datetime))
+);
+
+
+-- Status change log, from_status is NULL when the task was created
+CREATE TABLE task_status_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Field change history of tasks, written by the triggers below so that every
+-- insert and update is captured. Values are stored as JSON to keep their
+-- type and old_value is NULL when the task was created. The reason comes
+-- from the draftsmith.change_reason transaction setting, e.g. 'recurrence'
+-- when a recurring task advances to its next occurrence.
+CREATE TABLE task_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INT NOT NULL,                  -- Not a foreign key, the history outlives the task
+    field TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    reason TEXT,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX task_history_task_idx ON task_history (task_id, changed_at);
+
+-- Transaction-local settings, see src/utils/sqlite.go
+CREATE TABLE IF NOT EXISTS transaction_settings (
+    name TEXT PRIMARY KEY,
+    value TEXT
+);
+
+-- Values are converted to JSON in the form to_jsonb gives on Postgres
+CREATE TRIGGER task_history_insert AFTER INSERT ON tasks BEGIN
+    INSERT INTO task_history (task_id, field, old_value, new_value, reason)
+    SELECT NEW.id, field, NULL, new_value, (SELECT NULLIF(value, '') FROM transaction_settings WHERE name = 'draftsmith.change_reason')
+    FROM (
+        SELECT 'note_id' AS field, json_quote(NEW.note_id) AS new_value
+        UNION ALL SELECT 'status', json_quote(NEW.status)
+        UNION ALL SELECT 'effort_estimate', json_quote(NEW.effort_estimate)
+        UNION ALL SELECT 'actual_effort_override', json_quote(NEW.actual_effort_override)
+        UNION ALL SELECT 'deadline', json_quote(strftime('%Y-%m-%dT%H:%M:%fZ', NEW.deadline))
+        UNION ALL SELECT 'priority', json_quote(NEW.priority)
+        UNION ALL SELECT 'all_day', CASE WHEN NEW.all_day IS NULL THEN 'null' WHEN NEW.all_day THEN 'true' ELSE 'false' END
+        UNION ALL SELECT 'goal_relationship', json_quote(NEW.goal_relationship)
+        UNION ALL SELECT 'repeat_rule', json_quote(NEW.repeat_rule)
+        UNION ALL SELECT 'board_position', json_quote(NEW.board_position)
+    )
+    WHERE new_value <> 'null';
+END;
+
+CREATE TRIGGER task_history_update AFTER UPDATE ON tasks BEGIN
+    INSERT INTO task_history (task_id, field, old_value, new_value, reason)
+    SELECT NEW.id, field, old_value, new_value, (SELECT NULLIF(value, '') FROM transaction_settings WHERE name = 'draftsmith.change_reason')
+    FROM (
+        SELECT 'note_id' AS field, json_quote(OLD.note_id) AS old_value, json_quote(NEW.note_id) AS new_value
+        UNION ALL SELECT 'status', json_quote(OLD.status), json_quote(NEW.status)
+        UNION ALL SELECT 'effort_estimate', json_quote(OLD.effort_estimate), json_quote(NEW.effort_estimate)
+        UNION ALL SELECT 'actual_effort_override', json_quote(OLD.actual_effort_override), json_quote(NEW.actual_effort_override)
+        UNION ALL SELECT 'deadline', json_quote(strftime('%Y-%m-%dT%H:%M:%fZ', OLD.deadline)), json_quote(strftime('%Y-%m-%dT%H:%M:%fZ', NEW.deadline))
+        UNION ALL SELECT 'priority', json_quote(OLD.priority), json_quote(NEW.priority)
+        UNION ALL SELECT 'all_day', CASE WHEN OLD.all_day IS NULL THEN 'null' WHEN OLD.all_day THEN 'true' ELSE 'false' END, CASE WHEN NEW.all_day IS NULL THEN 'null' WHEN NEW.all_day THEN 'true' ELSE 'false' END
+        UNION ALL SELECT 'goal_relationship', json_quote(OLD.goal_relationship), json_quote(NEW.goal_relationship)
+        UNION ALL SELECT 'repeat_rule', json_quote(OLD.repeat_rule), json_quote(NEW.repeat_rule)
+        UNION ALL SELECT 'board_position', json_quote(OLD.board_position), json_quote(NEW.board_position)
+    )
+    WHERE old_value IS NOT new_value;
+END;
+
+-- Completion history, recurring tasks are reopened after each completion
+CREATE TABLE task_completions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    completed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deadline TIMESTAMP                     -- The deadline of the occurrence that was completed
+);
+
+-- Prerequisites, a task is blocked until the tasks it depends on are done
+CREATE TABLE task_dependencies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,            -- The dependent task
+    depends_on_task_id INT REFERENCES tasks(id) ON DELETE CASCADE, -- The prerequisite
+    CHECK (task_id <> depends_on_task_id),
+    UNIQUE (task_id, depends_on_task_id)
+);
+
+-- Clock Table (consider generalizing this so that notes can have clock tables too)
+CREATE TABLE task_clocks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT, -- Unique clock identifier
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE, -- Link to tasks
+    clock_in TIMESTAMP NOT NULL,           -- Clock in time
+    clock_out TIMESTAMP,                   -- Clock out time, NULL while the clock is running
+    CHECK (clock_out IS NULL OR julianday(clock_out) >= julianday(clock_in))
+);
+
+-- Clock intervals may not overlap, a running clock extends to infinity
+-- so this also allows only a single running clock. Intervals are half
+-- open and empty ones overlap nothing, as with tstzrange on Postgres.
+CREATE VIEW task_clock_ranges AS
+SELECT id, julianday(clock_in) AS lower, COALESCE(julianday(clock_out), 1e9) AS upper
+FROM task_clocks;
+
+CREATE TRIGGER task_clocks_no_overlap_insert BEFORE INSERT ON task_clocks
+WHEN EXISTS (
+    SELECT 1 FROM task_clock_ranges r
+    WHERE r.lower < r.upper
+      AND julianday(NEW.clock_in) < COALESCE(julianday(NEW.clock_out), 1e9)
+      AND r.lower < COALESCE(julianday(NEW.clock_out), 1e9)
+      AND julianday(NEW.clock_in) < r.upper
+)
+BEGIN
+    SELECT RAISE(ABORT, 'task_clocks_no_overlap');
+END;
+
+CREATE TRIGGER task_clocks_no_overlap_update BEFORE UPDATE OF clock_in, clock_out ON task_clocks
+WHEN EXISTS (
+    SELECT 1 FROM task_clock_ranges r
+    WHERE r.id <> NEW.id
+      AND r.lower < r.upper
+      AND julianday(NEW.clock_in) < COALESCE(julianday(NEW.clock_out), 1e9)
+      AND r.lower < COALESCE(julianday(NEW.clock_out), 1e9)
+      AND julianday(NEW.clock_in) < r.upper
+)
+BEGIN
+    SELECT RAISE(ABORT, 'task_clocks_no_overlap');
+END;
+
+-- Actual effort is derived from the closed clock intervals of a task unless
+-- it has been overridden manually
+CREATE VIEW task_efforts AS
+SELECT
+    t.id AS task_id,
+    t.effort_estimate,
+    COALESCE(SUM(unixepoch(tc.clock_out) - unixepoch(tc.clock_in)) / 3600.0, 0) AS clocked_effort,
+    t.actual_effort_override,
+    COALESCE(t.actual_effort_override, SUM(unixepoch(tc.clock_out) - unixepoch(tc.clock_in)) / 3600.0, 0) AS actual_effort
+FROM tasks t
+LEFT JOIN task_clocks tc ON tc.task_id = t.id AND tc.clock_out IS NOT NULL
+GROUP BY t.id;
+
+-- Reminder rules, a rule fires offset_minutes before the deadline or before
+-- the start of each schedule of an open task (negative offsets fire after).
+-- sinks names where reminders are delivered, all configured sinks if empty.
+CREATE TABLE reminder_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    anchor TEXT NOT NULL CHECK (anchor IN ('deadline', 'schedule_start')),
+    offset_minutes INT NOT NULL DEFAULT 0,
+    sinks TEXT NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+-- Reminders are claimed here before they are delivered, so each is sent at
+-- most once. due_at is the deadline or schedule start being reminded of.
+CREATE TABLE sent_reminders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    rule_id INT REFERENCES reminder_rules(id) ON DELETE CASCADE,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    schedule_id INT REFERENCES task_schedules(id) ON DELETE SET NULL,
+    due_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    delivered_to TEXT NOT NULL DEFAULT '{}',
+    error TEXT,                            -- Delivery failures, if any
+    UNIQUE (rule_id, task_id, due_at)
+);
+
+-- Calendar components imported from iCalendar files, keyed by UID so that
+-- re-importing a calendar updates the existing notes rather than duplicating them
+CREATE TABLE calendar_uids (
+    uid TEXT PRIMARY KEY,
+    note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    schedule_id INT REFERENCES task_schedules(id) ON DELETE SET NULL,
+    component TEXT CHECK (component IN ('VTODO', 'VEVENT')),
+    href TEXT UNIQUE  -- Resource name chosen by a CalDAV client, if any
+);
+
+
+-- Populate initial data for note types
+INSERT INTO note_types (name, description) VALUES
+    ('asset', 'Asset related notes'),
+    ('bookmark', 'Bookmark related notes'),
+    ('contact', 'Contact information'),
+    ('page', 'A standalone page'),
+    ('block', 'A block of information within a page'),
+    ('subpage', 'A subpage within a note');
+
+-- Populate initial data for categories
+INSERT INTO categories (name) VALUES
+    ('Personal'),
+    ('Work'),
+    ('Ideas'),
+    ('Journal');
+
+-- Populate initial data for tags
+INSERT INTO tags (name) VALUES
+    ('important'),
+    ('urgent'),
+    ('todo'),
+    ('done');
+
+-- Populate initial data for attributes
+INSERT INTO attributes (name, description) VALUES
+    ('location', 'Location of the note'),
+    ('author', 'Author of the note'),
+    ('source', 'Source of the note');
+
+-- Populate initial data for notes
+INSERT INTO notes (title, content) VALUES
+    ('First note', 'This is the first note in the system.'),
+    ('Second note', 'This is the second note in the system.'),
+    ('Third note', 'Note Number Three.');
+
+
+-- Populate some hierarchy data
+INSERT INTO note_hierarchy (parent_note_id, child_note_id, hierarchy_type) VALUES
+    (1, 2, 'block'),
+    (2, 3, 'block');
+
+-- Default task statuses, any status may move to any other
+INSERT INTO task_statuses (name, category, position, description, initial) VALUES
+    ('idea', 'open', 0, 'Something that might be done', FALSE),
+    ('todo', 'open', 1, 'To be done', TRUE),
+    ('proj', 'open', 2, 'A project made up of other tasks', FALSE),
+    ('wait', 'open', 3, 'Waiting on someone else', FALSE),
+    ('hold', 'open', 4, 'Put on hold', FALSE),
+    ('event', 'open', 5, 'Something happening at a scheduled time', FALSE),
+    ('done', 'closed', 6, 'Finished', FALSE),
+    ('kill', 'cancelled', 7, 'No longer going to be done', FALSE);
+
+INSERT INTO task_status_transitions (from_status, to_status)
+SELECT f.name, t.name FROM task_statuses f CROSS JOIN task_statuses t WHERE f.name <> t.name;
+
+-- Populate some task data
+INSERT INTO tasks (note_id, status, effort_estimate, actual_effort_override, deadline, priority, all_day, goal_relationship) VALUES
+    (1, 'todo', 1.5, NULL, '2021-12-31 23:59:59', 3, FALSE, 3),
+    (2, 'done', 0.5, 0.5, '2021-12-31 23:59:59', 2, FALSE, 2),
+    (3, 'todo', 2, NULL, '2021-12-31 23:59:59', 1, FALSE, 1);
+
+INSERT INTO reminder_rules (name, anchor, offset_minutes) VALUES
+('1 day before the deadline', 'deadline', 1440),
+('At the schedule start', 'schedule_start', 0);
+
+-- Version of this schema, cli init migrates databases at an earlier version
+-- (see migrations.go)
+CREATE TABLE schema_version (
+    version INT NOT NULL
+);
+
+INSERT INTO schema_version (version) VALUES (4);
@@ -4,31 +4,47 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+
 	utils "draftsmith/src/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // dropCmd represents the drop command
 var dropCmd = &cobra.Command{
 	Use:   "drop",
 	Short: "Drop the database",
-	Long: `Drop the database and all of its contents. Use with caution.
-This is primarily for development purposes and should not be used in production.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		utils.Drop_db()
+	Long: `Drop the database (--db_name) and all of its contents. Use with caution.
+This is primarily for development purposes and should not be used in production.
+
+Asks for confirmation unless --yes is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbName := viper.GetString("db_name")
+
+		if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+			fmt.Fprintf(cmd.OutOrStdout(), "Drop database %s and all of its contents? [y/N] ", dbName)
+			answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer != "y" && answer != "yes" {
+				return errors.New("not dropped, pass --yes to drop without asking")
+			}
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "Dropping database %s...\n", dbName)
+		if err := utils.Drop_db(dbName); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "Database dropped successfully")
+		return nil
 	},
 }
 
 func init() {
 	cliCmd.AddCommand(dropCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// dropCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// dropCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	dropCmd.Flags().BoolP("yes", "y", false, "Drop without asking for confirmation")
 }
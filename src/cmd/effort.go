@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Effort estimates versus actual effort
+//
+// The actual effort of a task is the sum of its closed clock intervals
+// unless a manual override has been recorded (see the task_efforts view).
+// Variance is actual minus estimated effort, only tasks with an estimate
+// contribute to the variance of a subtree.
+
+// optionalFloat distinguishes a JSON null (Set with a nil Value) from an
+// absent field (not Set)
+type optionalFloat struct {
+	Set   bool
+	Value *float64
+}
+
+func (o *optionalFloat) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	var v float64
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	o.Value = &v
+	return nil
+}
+
+// EffortSummary totals the effort of one or more tasks, in hours
+type EffortSummary struct {
+	Tasks           int      `json:"tasks"`
+	EstimatedTasks  int      `json:"estimated_tasks"`
+	Estimate        float64  `json:"estimate"`
+	Clocked         float64  `json:"clocked"`
+	Actual          float64  `json:"actual"`
+	Variance        float64  `json:"variance"`
+	VariancePercent *float64 `json:"variance_percent"`
+}
+
+// add includes a task in the summary
+func (s *EffortSummary) add(t *EffortTask) {
+	s.Tasks++
+	s.Clocked += t.Clocked
+	s.Actual += t.Actual
+	if t.Estimate > 0 {
+		s.EstimatedTasks++
+		s.Estimate += t.Estimate
+		s.Variance += t.Actual - t.Estimate
+	}
+}
+
+// merge adds the totals of another summary
+func (s *EffortSummary) merge(o EffortSummary) {
+	s.Tasks += o.Tasks
+	s.EstimatedTasks += o.EstimatedTasks
+	s.Estimate += o.Estimate
+	s.Clocked += o.Clocked
+	s.Actual += o.Actual
+	s.Variance += o.Variance
+}
+
+func (s *EffortSummary) finish() {
+	if s.Estimate > 0 {
+		percent := s.Variance / s.Estimate * 100
+		s.VariancePercent = &percent
+	}
+}
+
+// EffortTask is the effort of a single task
+type EffortTask struct {
+	ID       int      `json:"id"`
+	Status   string   `json:"status"`
+	Estimate float64  `json:"estimate"`
+	Clocked  float64  `json:"clocked"`
+	Override *float64 `json:"override"`
+	Actual   float64  `json:"actual"`
+	// Variance is null if the task has no estimate
+	Variance *float64 `json:"variance"`
+}
+
+// EffortReportNote is a note with its own task (if any) and the effort of
+// all tasks in its subtree
+type EffortReportNote struct {
+	NoteID   int                 `json:"note_id"`
+	Title    string              `json:"title"`
+	Task     *EffortTask         `json:"task,omitempty"`
+	Subtree  EffortSummary       `json:"subtree"`
+	Children []*EffortReportNote `json:"children,omitempty"`
+}
+
+// EffortReport is the estimate versus actual effort across the note hierarchy
+type EffortReport struct {
+	Total EffortSummary       `json:"total"`
+	Notes []*EffortReportNote `json:"notes"`
+}
+
+// loadEffortTasks returns the effort of each task keyed by note ID,
+// optionally limited to the given statuses
+func loadEffortTasks(db *sql.DB, statuses []string) (map[int]*EffortTask, error) {
+	query := `
+        SELECT t.id, t.note_id, t.status, COALESCE(te.effort_estimate, 0),
+               te.clocked_effort, te.actual_effort_override, te.actual_effort
+        FROM tasks t
+        JOIN task_efforts te ON te.task_id = t.id
+    `
+	var args []interface{}
+	if len(statuses) > 0 {
+		placeholders := make([]string, len(statuses))
+		for i, status := range statuses {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+			args = append(args, status)
+		}
+		query += " WHERE t.status IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying task efforts: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := make(map[int]*EffortTask)
+	for rows.Next() {
+		var noteID int
+		var override sql.NullFloat64
+		t := &EffortTask{}
+		if err := rows.Scan(&t.ID, &noteID, &t.Status, &t.Estimate, &t.Clocked, &override, &t.Actual); err != nil {
+			return nil, fmt.Errorf("error scanning task effort row: %w", err)
+		}
+		if override.Valid {
+			t.Override = &override.Float64
+		}
+		if t.Estimate > 0 {
+			variance := t.Actual - t.Estimate
+			t.Variance = &variance
+		}
+		tasks[noteID] = t
+	}
+	return tasks, rows.Err()
+}
+
+// buildEffortReport arranges the tasks by note_hierarchy and totals each
+// subtree. Notes without a task in their subtree are left out. If rootID
+// is non-zero only that note's subtree is reported.
+func buildEffortReport(g *noteGraph, tasks map[int]*EffortTask, rootID int) (*EffortReport, error) {
+	nodes := make(map[int]*EffortReportNote)
+	roots := []*EffortReportNote{}
+	for noteID := range tasks {
+		path := g.ancestry(noteID)
+		if rootID != 0 {
+			// Cut the path at the root, skipping notes outside its subtree
+			cut := -1
+			for i, id := range path {
+				if id == rootID {
+					cut = i
+					break
+				}
+			}
+			if cut < 0 {
+				continue
+			}
+			path = path[:cut+1]
+		}
+
+		var child *EffortReportNote
+		for _, id := range path {
+			node, exists := nodes[id]
+			if !exists {
+				node = &EffortReportNote{NoteID: id, Title: g.Titles[id]}
+				nodes[id] = node
+			}
+			if child != nil {
+				node.Children = append(node.Children, child)
+			}
+			if exists {
+				child = nil
+				break
+			}
+			child = node
+		}
+		if child != nil {
+			roots = append(roots, child)
+		}
+		nodes[noteID].Task = tasks[noteID]
+	}
+
+	if rootID != 0 && len(roots) == 0 {
+		if _, ok := g.Titles[rootID]; !ok {
+			return nil, sql.ErrNoRows
+		}
+	}
+
+	var total func(n *EffortReportNote) EffortSummary
+	total = func(n *EffortReportNote) EffortSummary {
+		sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].NoteID < n.Children[j].NoteID })
+		if n.Task != nil {
+			n.Subtree.add(n.Task)
+		}
+		for _, c := range n.Children {
+			n.Subtree.merge(total(c))
+		}
+		n.Subtree.finish()
+		return n.Subtree
+	}
+
+	report := &EffortReport{Notes: roots}
+	sort.Slice(roots, func(i, j int) bool { return roots[i].NoteID < roots[j].NoteID })
+	for _, root := range roots {
+		report.Total.merge(total(root))
+	}
+	report.Total.finish()
+	return report, nil
+}
+
+func getEffortReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	rootID := 0
+	if p := q.Get("root"); p != "" {
+		var err error
+		rootID, err = strconv.Atoi(p)
+		if err != nil {
+			writeError(w, "Invalid root note ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var statuses []string
+	if s := q.Get("status"); s != "" {
+		statuses = strings.Split(s, ",")
+	}
+
+	graph, err := loadNoteGraph(db)
+	if err != nil {
+		writeServerError(w, "Error loading notes for effort report", err)
+		return
+	}
+	tasks, err := loadEffortTasks(db, statuses)
+	if err != nil {
+		writeServerError(w, "Error loading tasks for effort report", err)
+		return
+	}
+
+	report, err := buildEffortReport(graph, tasks, rootID)
+	if err == sql.ErrNoRows {
+		writeError(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeServerError(w, "Error building effort report", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	utils "draftsmith/src/utils"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// API errors
+//
+// Errors are returned as {"error": {...}} with a machine-readable code, a
+// message, field-level details for invalid input and the ID of the request,
+// which is also sent in the X-Request-ID header and logged with server
+// errors. Postgres constraint violations that get past the handlers' own
+// checks are mapped to 404, 409 or 422 rather than 500, as are their SQLite
+// equivalents. The CalDAV and WebDAV handlers keep plain-text errors as DAV
+// clients expect.
+
+const requestIDHeader = "X-Request-ID"
+
+// Error codes
+const (
+	errBadRequest         = "bad_request"
+	errValidationFailed   = "validation_failed"
+	errNotFound           = "not_found"
+	errConflict           = "conflict"
+	errMethodNotAllowed   = "method_not_allowed"
+	errPreconditionFailed = "precondition_failed"
+	errForbidden          = "forbidden"
+	errInternal           = "internal_error"
+)
+
+// Postgres error codes
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+	pgExclusionViolation  = "23P01"
+	pgDataExceptionClass  = "22"
+)
+
+// SQLite extended result codes of constraint violations
+const (
+	sqliteConstraintCheck      = 275
+	sqliteConstraintForeignKey = 787
+	sqliteConstraintNotNull    = 1299
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintTrigger    = 1811
+	sqliteConstraintUnique     = 2067
+)
+
+// sqliteErrorCodes gives the Postgres error code of each SQLite constraint
+// violation. The only trigger raising an error is the task_clocks overlap
+// check, which stands in for an exclusion constraint.
+var sqliteErrorCodes = map[int]string{
+	sqliteConstraintCheck:      pgCheckViolation,
+	sqliteConstraintForeignKey: pgForeignKeyViolation,
+	sqliteConstraintNotNull:    pgNotNullViolation,
+	sqliteConstraintPrimaryKey: pgUniqueViolation,
+	sqliteConstraintTrigger:    pgExclusionViolation,
+	sqliteConstraintUnique:     pgUniqueViolation,
+}
+
+// ErrorDetail describes what is wrong with one field of the request
+type ErrorDetail struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError is the body of every error response, wrapped in ErrorResponse
+type APIError struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// ErrorResponse is the error envelope
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// MessageResponse is the body of a successful change, ID (or Name for
+// resources identified by name) is set when something was created
+type MessageResponse struct {
+	Message string `json:"message"`
+	ID      int    `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// fieldError is an error caused by the value of a single request field
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *fieldError) Error() string { return e.Message }
+
+// isPGError reports whether err is, or wraps, a Postgres error with the
+// given code, or the SQLite equivalent
+func isPGError(err error, code string) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code) == code
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErrorCodes[sqliteErr.Code()] == code
+	}
+	return false
+}
+
+// errorCode returns the error code used for a status without a more
+// specific code
+func errorCode(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return errNotFound
+	case http.StatusConflict:
+		return errConflict
+	case http.StatusUnprocessableEntity:
+		return errValidationFailed
+	case http.StatusMethodNotAllowed:
+		return errMethodNotAllowed
+	case http.StatusPreconditionFailed:
+		return errPreconditionFailed
+	case http.StatusForbidden:
+		return errForbidden
+	}
+	if status >= 500 {
+		return errInternal
+	}
+	return errBadRequest
+}
+
+// writeAPIError writes the error envelope, the request ID is taken from the
+// response header set by requestIDMiddleware
+func writeAPIError(w http.ResponseWriter, status int, apiErr APIError) {
+	apiErr.RequestID = w.Header().Get(requestIDHeader)
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: apiErr})
+}
+
+// writeError replaces http.Error, the code is derived from the status
+func writeError(w http.ResponseWriter, message string, status int) {
+	writeAPIError(w, status, APIError{Code: errorCode(status), Message: message})
+}
+
+// writeValidationError rejects the value of a single field
+func writeValidationError(w http.ResponseWriter, field, message string) {
+	writeAPIError(w, http.StatusUnprocessableEntity, APIError{
+		Code:    errValidationFailed,
+		Message: message,
+		Details: []ErrorDetail{{Field: field, Message: message}},
+	})
+}
+
+// writeInputError reports an error parsing the request, errors caused by a
+// single field are validation errors
+func writeInputError(w http.ResponseWriter, err error) {
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		writeValidationError(w, fe.Field, fe.Message)
+		return
+	}
+	writeError(w, err.Error(), http.StatusBadRequest)
+}
+
+// pgKeyPattern extracts the columns from a constraint violation detail such
+// as `Key (note_id)=(42) is not present in table "notes".`
+var pgKeyPattern = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// sqliteMessagePattern extracts the message from an SQLite error such as
+// `constraint failed: UNIQUE constraint failed: tags.name (2067)`, and
+// sqliteColumnsPattern the columns from the message
+var (
+	sqliteMessagePattern = regexp.MustCompile(`^[^:]+: (.*) \(\d+\)$`)
+	sqliteColumnsPattern = regexp.MustCompile(`constraint failed: (\w+\.\w+(?:, \w+\.\w+)*)$`)
+)
+
+// writeServerError reports an unexpected error. Postgres constraint
+// violations are the client's fault and are mapped to a 4xx status, any
+// other error is logged with the request ID and reported as a 500.
+func writeServerError(w http.ResponseWriter, context string, err error) {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErrorCodes[sqliteErr.Code()] != "" {
+		writeSQLiteError(w, err, sqliteErr)
+		return
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		field := pqErr.Column
+		if m := pgKeyPattern.FindStringSubmatch(pqErr.Detail); m != nil {
+			field = m[1]
+		}
+		var details []ErrorDetail
+		if field != "" {
+			message := pqErr.Detail
+			if message == "" {
+				message = pqErr.Message
+			}
+			details = []ErrorDetail{{Field: field, Message: message}}
+		}
+
+		switch code := string(pqErr.Code); {
+		case code == pgForeignKeyViolation && strings.Contains(pqErr.Detail, "still referenced"):
+			writeAPIError(w, http.StatusConflict, APIError{Code: errConflict, Message: "Record is still referenced by other records", Details: details})
+			return
+		case code == pgForeignKeyViolation:
+			writeAPIError(w, http.StatusNotFound, APIError{Code: errNotFound, Message: "Referenced record not found", Details: details})
+			return
+		case code == pgUniqueViolation:
+			writeAPIError(w, http.StatusConflict, APIError{Code: errConflict, Message: "Record already exists", Details: details})
+			return
+		case code == pgExclusionViolation:
+			writeAPIError(w, http.StatusConflict, APIError{Code: errConflict, Message: "Record conflicts with an existing record", Details: details})
+			return
+		case code == pgCheckViolation, code == pgNotNullViolation:
+			writeAPIError(w, http.StatusUnprocessableEntity, APIError{Code: errValidationFailed, Message: pqErr.Message, Details: details})
+			return
+		case strings.HasPrefix(code, pgDataExceptionClass):
+			writeAPIError(w, http.StatusUnprocessableEntity, APIError{Code: errValidationFailed, Message: pqErr.Message, Details: details})
+			return
+		}
+	}
+
+	log.Printf("%s: %v (request %s)", context, err, w.Header().Get(requestIDHeader))
+	writeError(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// writeSQLiteError maps an SQLite constraint violation to a 4xx status
+// as writeServerError does for Postgres, err is the error wrapping it
+func writeSQLiteError(w http.ResponseWriter, err error, sqliteErr *sqlite.Error) {
+	message := sqliteErr.Error()
+	if m := sqliteMessagePattern.FindStringSubmatch(message); m != nil {
+		message = m[1]
+	}
+	var details []ErrorDetail
+	if m := sqliteColumnsPattern.FindStringSubmatch(message); m != nil {
+		var fields []string
+		for _, column := range strings.Split(m[1], ", ") {
+			fields = append(fields, column[strings.Index(column, ".")+1:])
+		}
+		details = []ErrorDetail{{Field: strings.Join(fields, ", "), Message: message}}
+	}
+
+	switch sqliteErrorCodes[sqliteErr.Code()] {
+	case pgForeignKeyViolation:
+		var referenced *utils.SQLiteReferencedError
+		if errors.As(err, &referenced) {
+			writeAPIError(w, http.StatusConflict, APIError{Code: errConflict, Message: "Record is still referenced by other records", Details: details})
+			return
+		}
+		writeAPIError(w, http.StatusNotFound, APIError{Code: errNotFound, Message: "Referenced record not found", Details: details})
+	case pgUniqueViolation:
+		writeAPIError(w, http.StatusConflict, APIError{Code: errConflict, Message: "Record already exists", Details: details})
+	case pgExclusionViolation:
+		writeAPIError(w, http.StatusConflict, APIError{Code: errConflict, Message: "Record conflicts with an existing record", Details: details})
+	default:
+		writeAPIError(w, http.StatusUnprocessableEntity, APIError{Code: errValidationFailed, Message: message, Details: details})
+	}
+}
+
+// requestIDPattern is what a client supplied X-Request-ID may look like
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDMiddleware gives every request an ID, a client supplied
+// X-Request-ID is kept if it looks reasonable
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// notFoundHandler and methodNotAllowedHandler replace the router's
+// plain-text responses
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, "Not found", http.StatusNotFound)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// File names
+//
+// mount and the WebDAV handler show notes as <title>.md files and assets
+// under their stored names. Both name things the same way so a path means
+// the same note in either.
+
+// fileName is the file name for a title
+func fileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == 0 {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if name == "" || name == "." || name == ".." {
+		name = "untitled"
+	}
+	return name
+}
+
+// fileNames gives each ID a unique name, the ID is appended when titles
+// clash, again if a title is literally the name that gives (e.g. "X (3)")
+func fileNames(ids []int, title func(int) string) map[string]int {
+	sorted := append([]int(nil), ids...)
+	sort.Ints(sorted)
+	names := map[string]int{}
+	for _, id := range sorted {
+		name := fileName(title(id))
+		for {
+			if _, taken := names[name]; !taken {
+				break
+			}
+			name = fmt.Sprintf("%s (%d)", name, id)
+		}
+		names[name] = id
+	}
+	return names
+}
+
+// isNoteFile reports whether name is the file name of a note
+func isNoteFile(name string) bool {
+	return strings.HasSuffix(name, ".md") && name != ".md"
+}
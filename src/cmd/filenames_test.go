@@ -0,0 +1,23 @@
+package cmd
+
+import "testing"
+
+func TestFileNames(t *testing.T) {
+	titles := map[int]string{1: "Plan", 2: "Plan (3)", 3: "Plan", 4: "Plan", 5: "a/b", 6: " "}
+	var ids []int
+	for id := range titles {
+		ids = append(ids, id)
+	}
+	got := fileNames(ids, func(id int) string { return titles[id] })
+
+	// Note 3 would be "Plan (3)", which note 2 is called
+	want := map[string]int{"Plan": 1, "Plan (3)": 2, "Plan (3) (3)": 3, "Plan (4)": 4, "a-b": 5, "untitled": 6}
+	if len(got) != len(want) {
+		t.Errorf("got %d names %v, want %d", len(got), got, len(want))
+	}
+	for name, id := range want {
+		if got[name] != id {
+			t.Errorf("%q: got note %d, want %d", name, got[name], id)
+		}
+	}
+}
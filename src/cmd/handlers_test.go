@@ -0,0 +1,512 @@
+package cmd
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	utils "draftsmith/src/utils"
+	"github.com/spf13/viper"
+)
+
+// testPostgresDSN names the environment variable holding the key/value
+// connection string of a Postgres database for the handler tests, which
+// drop and recreate its public schema. Without it they only run on SQLite.
+const testPostgresDSN = "DRAFTSMITH_TEST_POSTGRES_DSN"
+
+// testAPI is the API served on a fresh database
+type testAPI struct {
+	t   *testing.T
+	url string
+}
+
+// forEachDriver runs a test against the API on each database driver, the
+// handlers share the global db so the drivers take turns
+func forEachDriver(t *testing.T, test func(t *testing.T, api *testAPI)) {
+	drivers := []string{utils.SQLite}
+	if os.Getenv(testPostgresDSN) != "" {
+		drivers = append(drivers, utils.Postgres)
+	}
+	for _, driver := range drivers {
+		t.Run(driver, func(t *testing.T) {
+			openTestDB(t, driver)
+			server := httptest.NewServer(newRouter())
+			t.Cleanup(server.Close)
+			test(t, &testAPI{t: t, url: server.URL})
+		})
+	}
+}
+
+// openTestDB points db at a new database with the schema and its sample
+// rows, SQLite in a temporary file
+func openTestDB(t *testing.T, driver string) {
+	t.Helper()
+	viper.Set("db_driver", driver)
+	t.Cleanup(func() { viper.Set("db_driver", "") })
+
+	var err error
+	if driver == utils.SQLite {
+		db, err = utils.Open_sqlite(filepath.Join(t.TempDir(), "draftsmith.db"))
+	} else {
+		db, err = sql.Open("postgres", os.Getenv(testPostgresDSN)+" timezone=UTC")
+		if err == nil {
+			_, err = db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public")
+		}
+	}
+	if err != nil {
+		t.Fatalf("opening the %s database: %v", driver, err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		db = nil
+	})
+	if _, err := initSchema(db); err != nil {
+		t.Fatalf("initSchema: %v", err)
+	}
+}
+
+// request sends body as JSON, or as is if it is a string
+func (api *testAPI) request(method, path string, body interface{}, header http.Header) *http.Response {
+	api.t.Helper()
+	var data []byte
+	switch b := body.(type) {
+	case nil:
+	case string:
+		data = []byte(b)
+	default:
+		var err error
+		if data, err = json.Marshal(b); err != nil {
+			api.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, api.url+path, bytes.NewReader(data))
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		api.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+// do sends a request and decodes the response into out unless it is nil,
+// it fails the test unless the response has the wanted status
+func (api *testAPI) do(method, path string, body interface{}, want int, out interface{}) {
+	api.t.Helper()
+	resp := api.request(method, path, body, nil)
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		api.t.Fatalf("%s %s: got %d, want %d: %s", method, path, resp.StatusCode, want, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			api.t.Fatalf("%s %s: decoding %s: %v", method, path, data, err)
+		}
+	}
+}
+
+// text sends a request and returns the response body as text, it fails
+// the test unless the response has the wanted status
+func (api *testAPI) text(method, path string, body interface{}, want int) string {
+	api.t.Helper()
+	resp := api.request(method, path, body, nil)
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		api.t.Fatalf("%s %s: got %d, want %d: %s", method, path, resp.StatusCode, want, data)
+	}
+	return string(data)
+}
+
+// apiError sends a request expected to fail and returns the error envelope
+func (api *testAPI) apiError(method, path string, body interface{}, want int) APIError {
+	api.t.Helper()
+	var resp ErrorResponse
+	api.do(method, path, body, want, &resp)
+	if resp.Error.Code == "" || resp.Error.RequestID == "" {
+		api.t.Errorf("%s %s: incomplete error envelope %+v", method, path, resp.Error)
+	}
+	return resp.Error
+}
+
+// createTask adds a note with a task in the initial status
+func (api *testAPI) createTask(title string) int {
+	api.t.Helper()
+	var note, task MessageResponse
+	api.do("POST", "/notes", NewNote{Title: title, Content: "Notes on " + title}, http.StatusCreated, &note)
+	api.do("POST", "/tasks", NewTask{NoteID: note.ID, Priority: 3, GoalRelationship: 3}, http.StatusCreated, &task)
+	return task.ID
+}
+
+// taskDetails returns a task from /tasks/details
+func (api *testAPI) taskDetails(id int) TaskWithDetails {
+	api.t.Helper()
+	var tasks []TaskWithDetails
+	api.do("GET", "/tasks/details", nil, http.StatusOK, &tasks)
+	for _, task := range tasks {
+		if task.ID == id {
+			return task
+		}
+	}
+	api.t.Fatalf("task %d is not in /tasks/details", id)
+	return TaskWithDetails{}
+}
+
+func TestNoteRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		var created MessageResponse
+		api.do("POST", "/notes", NewNote{Title: "Groceries", Content: "Buy artichokes"}, http.StatusCreated, &created)
+		path := fmt.Sprintf("/notes/%d", created.ID)
+
+		title := "Shopping"
+		api.do("PUT", path, NoteUpdate{Title: &title}, http.StatusOK, nil)
+		var note Note
+		api.do("GET", path, nil, http.StatusOK, &note)
+		if note.Title != "Shopping" || note.Content != "Buy artichokes" {
+			t.Errorf("updated note: got %q, %q", note.Title, note.Content)
+		}
+
+		var found []NoteInfo
+		api.do("GET", "/notes/search?q=artichokes", nil, http.StatusOK, &found)
+		if len(found) != 1 || found[0].ID != created.ID {
+			t.Errorf("search for artichokes: got %+v, want note %d", found, created.ID)
+		}
+
+		api.do("DELETE", path, nil, http.StatusOK, nil)
+		api.apiError("GET", path, nil, http.StatusNotFound)
+		api.apiError("DELETE", path, nil, http.StatusNotFound)
+	})
+}
+
+func TestTaskRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Write report")
+		if task := api.taskDetails(id); task.Status != "todo" || task.Priority != 3 {
+			t.Errorf("new task: got status %q, priority %d", task.Status, task.Priority)
+		}
+
+		api.do("PUT", fmt.Sprintf("/tasks/%d", id), map[string]interface{}{"status": "done", "priority": 5}, http.StatusOK, nil)
+		if task := api.taskDetails(id); task.Status != "done" || task.Priority != 5 {
+			t.Errorf("updated task: got status %q, priority %d", task.Status, task.Priority)
+		}
+		var completions []TaskCompletion
+		api.do("GET", fmt.Sprintf("/tasks/%d/completions", id), nil, http.StatusOK, &completions)
+		if len(completions) != 1 {
+			t.Errorf("completions after closing the task: got %d, want 1", len(completions))
+		}
+
+		if e := api.apiError("POST", "/tasks", NewTask{NoteID: 1, Priority: 9, GoalRelationship: 3}, http.StatusUnprocessableEntity); len(e.Details) != 1 || e.Details[0].Field != "priority" {
+			t.Errorf("invalid priority: got details %+v", e.Details)
+		}
+		api.do("DELETE", fmt.Sprintf("/tasks/%d", id), nil, http.StatusOK, nil)
+		api.apiError("PUT", fmt.Sprintf("/tasks/%d", id), map[string]int{"priority": 1}, http.StatusNotFound)
+	})
+}
+
+func TestActualEffortAlias(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Write report")
+		path := fmt.Sprintf("/tasks/%d", id)
+
+		// Older clients send actual_effort, it sets the override
+		api.do("PUT", path, map[string]interface{}{"actual_effort": 2.5}, http.StatusOK, nil)
+		if task := api.taskDetails(id); task.ActualEffortOverride == nil || *task.ActualEffortOverride != 2.5 || task.ActualEffort != 2.5 {
+			t.Errorf("after actual_effort 2.5: got override %v, actual effort %v", task.ActualEffortOverride, task.ActualEffort)
+		}
+		api.do("PUT", path, map[string]interface{}{"actual_effort": 1, "actual_effort_override": nil}, http.StatusOK, nil)
+		if task := api.taskDetails(id); task.ActualEffortOverride != nil {
+			t.Errorf("actual_effort_override null with actual_effort: got override %v, want none", *task.ActualEffortOverride)
+		}
+
+		var note, created MessageResponse
+		api.do("POST", "/notes", NewNote{Title: "Plan"}, http.StatusCreated, &note)
+		api.do("POST", "/tasks", map[string]interface{}{"note_id": note.ID, "priority": 3, "goal_relationship": 3, "actual_effort": 4},
+			http.StatusCreated, &created)
+		if task := api.taskDetails(created.ID); task.ActualEffortOverride == nil || *task.ActualEffortOverride != 4 {
+			t.Errorf("created with actual_effort 4: got override %v", task.ActualEffortOverride)
+		}
+	})
+}
+
+func TestDependencyRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		report := api.createTask("Write report")
+		data := api.createTask("Collect data")
+		path := fmt.Sprintf("/tasks/%d/dependencies", report)
+		api.do("POST", path, NewTaskDependency{DependsOn: data}, http.StatusCreated, nil)
+		api.apiError("POST", path, NewTaskDependency{DependsOn: data}, http.StatusConflict)
+		api.apiError("POST", fmt.Sprintf("/tasks/%d/dependencies", data), NewTaskDependency{DependsOn: report}, http.StatusBadRequest)
+
+		var dependencies []TaskDependency
+		api.do("GET", path, nil, http.StatusOK, &dependencies)
+		if len(dependencies) != 1 || dependencies[0].DependsOnID != data || !dependencies[0].Blocking {
+			t.Errorf("dependencies: got %+v, want %d blocking", dependencies, data)
+		}
+		var actionable []TaskWithDetails
+		api.do("GET", "/tasks/actionable", nil, http.StatusOK, &actionable)
+		ids := map[int]bool{}
+		for _, task := range actionable {
+			ids[task.ID] = true
+		}
+		if !ids[data] || ids[report] {
+			t.Errorf("actionable tasks: got %v, want %d but not %d", ids, data, report)
+		}
+
+		api.do("PUT", fmt.Sprintf("/tasks/%d", data), map[string]string{"status": "done"}, http.StatusOK, nil)
+		api.do("GET", path, nil, http.StatusOK, &dependencies)
+		if len(dependencies) != 1 || dependencies[0].Blocking {
+			t.Errorf("dependencies after completing the prerequisite: got %+v, want it not blocking", dependencies)
+		}
+
+		api.do("DELETE", fmt.Sprintf("%s/%d", path, data), nil, http.StatusOK, nil)
+		api.apiError("DELETE", fmt.Sprintf("%s/%d", path, data), nil, http.StatusNotFound)
+		api.apiError("GET", "/tasks/999/dependencies", nil, http.StatusNotFound)
+	})
+}
+
+func TestTaskHistoryRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Write report")
+		path := fmt.Sprintf("/tasks/%d", id)
+		api.do("PUT", path, map[string]int{"priority": 5}, http.StatusOK, nil)
+
+		var history []TaskHistoryEntry
+		api.do("GET", path+"/history?field=priority", nil, http.StatusOK, &history)
+		if len(history) != 2 || string(history[0].OldValue) != "null" || string(history[1].NewValue) != "5" {
+			t.Fatalf("priority history: got %+v, want created with 3 then 5", history)
+		}
+
+		// The history outlives the task
+		api.do("DELETE", path, nil, http.StatusOK, nil)
+		var after []TaskHistoryEntry
+		api.do("GET", path+"/history?field=priority", nil, http.StatusOK, &after)
+		if len(after) != len(history) {
+			t.Errorf("priority history after deleting the task: got %d entries, want %d", len(after), len(history))
+		}
+		api.apiError("GET", "/tasks/999/history", nil, http.StatusNotFound)
+	})
+}
+
+func TestBoardRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		first := api.createTask("Write report")
+		second := api.createTask("Review draft")
+		api.do("POST", "/board/move", BoardMove{TaskID: first, Status: "wait"}, http.StatusOK, nil)
+		api.do("POST", "/board/move", BoardMove{TaskID: second, Status: "wait", Before: &first}, http.StatusOK, nil)
+
+		var board Board
+		api.do("GET", "/board", nil, http.StatusOK, &board)
+		var wait *BoardColumn
+		for _, column := range board.Columns {
+			if column.Status == "wait" {
+				wait = column
+			}
+		}
+		if wait == nil || wait.Count != 2 || wait.Tasks[0].ID != second || wait.Tasks[1].ID != first {
+			t.Fatalf("wait column: got %+v, want %d then %d", wait, second, first)
+		}
+		// The response and board_position both count from 0
+		for i, task := range wait.Tasks {
+			var stored int
+			if err := db.QueryRow("SELECT board_position FROM tasks WHERE id = $1", task.ID).Scan(&stored); err != nil {
+				t.Fatal(err)
+			}
+			if task.Position != i || stored != i {
+				t.Errorf("task %d: position %d, board_position %d, want %d", task.ID, task.Position, stored, i)
+			}
+		}
+
+		api.apiError("POST", "/board/move", BoardMove{TaskID: first, Status: "someday"}, http.StatusUnprocessableEntity)
+		api.apiError("POST", "/board/move", BoardMove{TaskID: 999, Status: "wait"}, http.StatusNotFound)
+	})
+}
+
+func TestNextTaskRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		urgent := api.createTask("Pay the invoice")
+		quick := api.createTask("Water the plants")
+		blocked := api.createTask("File the receipt")
+		closed := api.createTask("Book the flight")
+		api.do("PUT", fmt.Sprintf("/tasks/%d", urgent), map[string]interface{}{"priority": 1, "effort_estimate": 2}, http.StatusOK, nil)
+		api.do("PUT", fmt.Sprintf("/tasks/%d", quick), map[string]interface{}{"priority": 5, "effort_estimate": 0.5}, http.StatusOK, nil)
+		api.do("POST", fmt.Sprintf("/tasks/%d/dependencies", blocked), NewTaskDependency{DependsOn: urgent}, http.StatusCreated, nil)
+		api.do("PUT", fmt.Sprintf("/tasks/%d", closed), map[string]string{"status": "done"}, http.StatusOK, nil)
+
+		// The quick task is tagged through its parent note
+		var tag, parent MessageResponse
+		api.do("POST", "/tags", NewTag{Name: "garden"}, http.StatusCreated, &tag)
+		api.do("POST", "/notes", NewNote{Title: "Garden"}, http.StatusCreated, &parent)
+		api.do("POST", fmt.Sprintf("/notes/%d/tags", parent.ID), AddTagToNote{TagID: tag.ID}, http.StatusOK, nil)
+		api.do("POST", "/notes/hierarchy", NoteHierarchyEntry{
+			ParentNoteID: parent.ID, ChildNoteID: api.taskDetails(quick).NoteID, HierarchyType: "subpage",
+		}, http.StatusCreated, nil)
+
+		// The tasks created here in ranked order
+		next := func(query string) ([]int, map[int]NextTask) {
+			t.Helper()
+			var ranked []NextTask
+			api.do("GET", "/tasks/next?limit=100&"+query, nil, http.StatusOK, &ranked)
+			var ids []int
+			tasks := make(map[int]NextTask)
+			for _, task := range ranked {
+				if task.ID == urgent || task.ID == quick || task.ID == blocked || task.ID == closed {
+					ids = append(ids, task.ID)
+					tasks[task.ID] = task
+				}
+			}
+			return ids, tasks
+		}
+
+		ids, tasks := next("")
+		if fmt.Sprint(ids) != fmt.Sprint([]int{urgent, quick}) {
+			t.Fatalf("next tasks: got %v, want %d then %d", ids, urgent, quick)
+		}
+		if f := tasks[urgent].Breakdown["priority"]; f.Value != 1 || f.Weight != 2 || f.Score != 2 {
+			t.Errorf("priority of %d: got %+v", urgent, f)
+		}
+		if tags := tasks[quick].Tags; len(tags) != 1 || tags[0] != "garden" {
+			t.Errorf("tags of %d: got %v, want the inherited garden", quick, tags)
+		}
+
+		if ids, _ := next("weights=priority:0,effort:5"); fmt.Sprint(ids) != fmt.Sprint([]int{quick, urgent}) {
+			t.Errorf("weighted by effort: got %v, want %d then %d", ids, quick, urgent)
+		}
+		if ids, _ := next("minutes=45"); fmt.Sprint(ids) != fmt.Sprint([]int{quick}) {
+			t.Errorf("45 minutes available: got %v, want %d", ids, quick)
+		}
+		if ids, _ := next("tags=garden"); fmt.Sprint(ids) != fmt.Sprint([]int{quick}) {
+			t.Errorf("tagged garden: got %v, want %d", ids, quick)
+		}
+		if ids, _ := next("status=done"); fmt.Sprint(ids) != fmt.Sprint([]int{closed}) {
+			t.Errorf("done tasks: got %v, want %d", ids, closed)
+		}
+
+		// Closing the prerequisite unblocks the dependent task
+		api.do("PUT", fmt.Sprintf("/tasks/%d", urgent), map[string]string{"status": "done"}, http.StatusOK, nil)
+		if ids, _ := next(""); fmt.Sprint(ids) != fmt.Sprint([]int{blocked, quick}) {
+			t.Errorf("after closing %d: got %v, want %d then %d", urgent, ids, blocked, quick)
+		}
+
+		for _, query := range []string{"weights=speed:1", "weights=urgency", "horizon=0", "minutes=-5", "limit=0", "tz=Mars/Olympus"} {
+			api.apiError("GET", "/tasks/next?"+query, nil, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestClockRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Review")
+		clockPath := fmt.Sprintf("/tasks/%d/clock/", id)
+
+		api.do("POST", clockPath+"start", nil, http.StatusCreated, nil)
+		var current RunningClock
+		api.do("GET", "/clock/current", nil, http.StatusOK, &current)
+		if !current.Running || current.TaskID != id {
+			t.Errorf("current clock: got %+v, want task %d running", current, id)
+		}
+		api.do("POST", clockPath+"stop", nil, http.StatusOK, nil)
+		api.apiError("POST", clockPath+"stop", nil, http.StatusNotFound)
+
+		clock := NewTaskClock{TaskID: id, ClockIn: "2024-06-01T09:00:00Z", ClockOut: "2024-06-01T10:30:00Z"}
+		api.do("POST", "/task_clocks", clock, http.StatusCreated, nil)
+		overlapping := NewTaskClock{TaskID: id, ClockIn: "2024-06-01T10:00:00Z", ClockOut: "2024-06-01T11:00:00Z"}
+		api.apiError("POST", "/task_clocks", overlapping, http.StatusConflict)
+		backwards := NewTaskClock{TaskID: id, ClockIn: "2024-06-02T10:00:00Z", ClockOut: "2024-06-02T09:00:00Z"}
+		if e := api.apiError("POST", "/task_clocks", backwards, http.StatusUnprocessableEntity); len(e.Details) != 1 || e.Details[0].Field != "clock_out" {
+			t.Errorf("clock out before clock in: got details %+v", e.Details)
+		}
+
+		// Schedules and clocks are listed once each, however many of both there are
+		for _, day := range []string{"2024-06-03", "2024-06-04"} {
+			api.do("POST", "/task_schedules", NewTaskSchedule{
+				TaskID: id, StartDatetime: day + "T09:00:00Z", EndDatetime: day + "T10:00:00Z",
+			}, http.StatusCreated, nil)
+		}
+
+		// The started clock ran for a moment, the entry above for 1.5 hours
+		task := api.taskDetails(id)
+		if task.ClockedEffort < 1.5 || task.ClockedEffort > 1.6 || len(task.Clocks) != 2 {
+			t.Errorf("clocked effort: got %v over %d clocks, want 1.5 over 2", task.ClockedEffort, len(task.Clocks))
+		}
+		if len(task.Schedules) != 2 {
+			t.Errorf("schedules: got %+v, want two", task.Schedules)
+		}
+	})
+}
+
+func TestStatusTransitionRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Plan")
+		path := fmt.Sprintf("/tasks/%d", id)
+
+		api.do("DELETE", "/task_statuses/todo/transitions/done", nil, http.StatusOK, nil)
+		done := map[string]string{"status": "done"}
+		if e := api.apiError("PUT", path, done, http.StatusUnprocessableEntity); len(e.Details) != 1 || e.Details[0].Field != "status" {
+			t.Errorf("disallowed transition: got details %+v", e.Details)
+		}
+		if task := api.taskDetails(id); task.Status != "todo" {
+			t.Errorf("status after a disallowed transition: got %q, want todo", task.Status)
+		}
+
+		api.do("POST", "/task_statuses/todo/transitions", map[string]string{"to": "done"}, http.StatusCreated, nil)
+		api.do("PUT", path, done, http.StatusOK, nil)
+		var changes []map[string]interface{}
+		api.do("GET", path+"/status_changes", nil, http.StatusOK, &changes)
+		if len(changes) != 2 {
+			t.Errorf("status changes: got %d, want 2 (created and done)", len(changes))
+		}
+		api.apiError("GET", "/tasks/999/status_changes", nil, http.StatusNotFound)
+
+		api.apiError("PUT", path, map[string]string{"status": "someday"}, http.StatusUnprocessableEntity)
+	})
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		resp := api.request("GET", "/no/such/route", nil, http.Header{requestIDHeader: {"trace-42"}})
+		defer resp.Body.Close()
+		var body ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding the 404: %v", err)
+		}
+		if resp.StatusCode != http.StatusNotFound || body.Error.Code != errNotFound || body.Error.RequestID != "trace-42" ||
+			resp.Header.Get(requestIDHeader) != "trace-42" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			t.Errorf("unknown route: got %d %+v, %s %q", resp.StatusCode, body.Error, requestIDHeader, resp.Header.Get(requestIDHeader))
+		}
+
+		if e := api.apiError("PATCH", "/notes", nil, http.StatusMethodNotAllowed); e.Code != errMethodNotAllowed {
+			t.Errorf("wrong method: got code %q", e.Code)
+		}
+		if e := api.apiError("POST", "/notes", "{not json", http.StatusBadRequest); e.Code != errBadRequest {
+			t.Errorf("invalid body: got code %q", e.Code)
+		}
+
+		// Constraint violations get the same status on either driver
+		if e := api.apiError("POST", "/tasks", NewTask{NoteID: 9999, Priority: 3, GoalRelationship: 3}, http.StatusNotFound); e.Code != errNotFound {
+			t.Errorf("task of a missing note: got code %q", e.Code)
+		}
+		if _, err := db.Exec("INSERT INTO note_modifications (note_id) VALUES (1)"); err != nil {
+			t.Fatal(err)
+		}
+		if e := api.apiError("DELETE", "/notes/1", nil, http.StatusConflict); e.Code != errConflict {
+			t.Errorf("deleting a referenced note: got code %q", e.Code)
+		}
+		api.do("POST", "/categories", NewCategory{Name: "Errands"}, http.StatusCreated, nil)
+		if e := api.apiError("POST", "/categories", NewCategory{Name: "Errands"}, http.StatusConflict); e.Code != errConflict {
+			t.Errorf("duplicate category: got code %q", e.Code)
+		}
+	})
+}
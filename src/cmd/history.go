@@ -0,0 +1,488 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Task history
+//
+// Every insert into and update of tasks is recorded field by field in
+// task_history by the task_history_update trigger, so changes made by
+// imports and by recurring tasks advancing are captured along with those
+// made through updateTask. The history is kept when the task is deleted. Changes the server makes on its own are tagged
+// with a reason (see setChangeReason) so that reports can tell a recurring
+// task moving to its next occurrence from a deadline being pushed back.
+
+const (
+	changeReasonRecurrence = "recurrence"
+	changeReasonImport     = "import"
+)
+
+// TaskHistoryEntry is a change to a single field of a task. OldValue is
+// null when the task was created.
+type TaskHistoryEntry struct {
+	ID        int             `json:"id"`
+	Field     string          `json:"field"`
+	OldValue  json.RawMessage `json:"old_value"`
+	NewValue  json.RawMessage `json:"new_value"`
+	Reason    *string         `json:"reason"`
+	ChangedAt time.Time       `json:"changed_at"`
+}
+
+// setChangeReason tags the task changes made in the rest of the transaction
+func setChangeReason(q queryer, reason string) error {
+	query := "SELECT set_config('draftsmith.change_reason', $1, true)"
+	if usingSQLite() {
+		query = "INSERT OR REPLACE INTO transaction_settings (name, value) VALUES ('draftsmith.change_reason', $1)"
+	}
+	if _, err := q.Exec(query, reason); err != nil {
+		return fmt.Errorf("error setting change reason: %w", err)
+	}
+	return nil
+}
+
+func getTaskHistory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID := vars["id"]
+
+	// A deleted task still has its history
+	var taskExists bool
+	err := db.QueryRow(`
+        SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)
+            OR EXISTS(SELECT 1 FROM task_history WHERE task_id = $1)
+    `, taskID).Scan(&taskExists)
+	if err != nil {
+		writeServerError(w, "Error checking task existence", err)
+		return
+	}
+	if !taskExists {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	query := `
+        SELECT id, field, old_value, new_value, reason, changed_at
+        FROM task_history
+        WHERE task_id = $1
+    `
+	args := []interface{}{taskID}
+	if field := r.URL.Query().Get("field"); field != "" {
+		query += " AND field = $2"
+		args = append(args, field)
+	}
+	query += " ORDER BY changed_at, id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		writeServerError(w, "Error querying task history", err)
+		return
+	}
+	defer rows.Close()
+
+	history := []TaskHistoryEntry{}
+	for rows.Next() {
+		var e TaskHistoryEntry
+		var oldValue, newValue []byte
+		var reason sql.NullString
+		if err := rows.Scan(&e.ID, &e.Field, &oldValue, &newValue, &reason, &e.ChangedAt); err != nil {
+			writeServerError(w, "Error scanning task history row", err)
+			return
+		}
+		e.OldValue = jsonOrNull(oldValue)
+		e.NewValue = jsonOrNull(newValue)
+		if reason.Valid {
+			e.Reason = &reason.String
+		}
+		history = append(history, e)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error after scanning rows", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// jsonOrNull returns a JSONB column as raw JSON, SQL NULL becomes null
+func jsonOrNull(b []byte) json.RawMessage {
+	if b == nil {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(b)
+}
+
+// Cycle time
+
+// statusChange is an entry of task_status_changes
+type statusChange struct {
+	TaskID    int
+	To        string
+	ChangedAt time.Time
+}
+
+// TaskCycle is the time a task took from entering the start status to
+// entering the end status
+type TaskCycle struct {
+	TaskID     int       `json:"task_id"`
+	NoteID     int       `json:"note_id"`
+	Title      string    `json:"title"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Hours      float64   `json:"hours"`
+}
+
+// CycleTimeReport summarises the cycles finished within a range
+type CycleTimeReport struct {
+	FromStatus  string       `json:"from_status"`
+	ToStatus    string       `json:"to_status"`
+	Cycles      int          `json:"cycles"`
+	MeanHours   float64      `json:"mean_hours"`
+	MedianHours float64      `json:"median_hours"`
+	MinHours    float64      `json:"min_hours"`
+	MaxHours    float64      `json:"max_hours"`
+	Tasks       []*TaskCycle `json:"tasks"`
+}
+
+// findCycles walks the status changes of each task in order. A cycle
+// starts when the task enters fromStatus and ends the next time it enters
+// toStatus, so a recurring task that is reopened yields one cycle per
+// occurrence. Changes must be ordered by task and time.
+func findCycles(changes []statusChange, fromStatus, toStatus string) []*TaskCycle {
+	cycles := []*TaskCycle{}
+	var started *statusChange
+	for i := range changes {
+		c := &changes[i]
+		if started != nil && started.TaskID != c.TaskID {
+			started = nil
+		}
+		switch {
+		case started == nil && c.To == fromStatus:
+			started = c
+		case started != nil && c.To == toStatus:
+			cycles = append(cycles, &TaskCycle{
+				TaskID:     c.TaskID,
+				StartedAt:  started.ChangedAt,
+				FinishedAt: c.ChangedAt,
+				Hours:      roundHours(int64(c.ChangedAt.Sub(started.ChangedAt).Seconds())),
+			})
+			started = nil
+		}
+	}
+	return cycles
+}
+
+// buildCycleTimeReport keeps the cycles finished in [from, to), a zero
+// time leaves that end of the range open
+func buildCycleTimeReport(cycles []*TaskCycle, fromStatus, toStatus string, from, to time.Time) *CycleTimeReport {
+	report := &CycleTimeReport{FromStatus: fromStatus, ToStatus: toStatus, Tasks: []*TaskCycle{}}
+	var hours []float64
+	for _, c := range cycles {
+		if !from.IsZero() && c.FinishedAt.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !c.FinishedAt.Before(to) {
+			continue
+		}
+		report.Tasks = append(report.Tasks, c)
+		hours = append(hours, c.Hours)
+	}
+	sort.SliceStable(report.Tasks, func(i, j int) bool { return report.Tasks[i].FinishedAt.Before(report.Tasks[j].FinishedAt) })
+
+	report.Cycles = len(hours)
+	if len(hours) == 0 {
+		return report
+	}
+	sort.Float64s(hours)
+	var sum float64
+	for _, h := range hours {
+		sum += h
+	}
+	report.MeanHours = math.Round(sum/float64(len(hours))*100) / 100
+	if n := len(hours); n%2 == 1 {
+		report.MedianHours = hours[n/2]
+	} else {
+		report.MedianHours = math.Round((hours[n/2-1]+hours[n/2])/2*100) / 100
+	}
+	report.MinHours = hours[0]
+	report.MaxHours = hours[len(hours)-1]
+	return report
+}
+
+// parseOpenRange reads the optional from and to query parameters, unlike
+// parseReportRange the range is unbounded when they are missing
+func parseOpenRange(r *http.Request, loc *time.Location) (from, to time.Time, err error) {
+	q := r.URL.Query()
+	if s := q.Get("from"); s != "" {
+		if from, _, err = parseReportTime(s, loc); err != nil {
+			return from, to, fmt.Errorf("invalid from time, expected YYYY-MM-DD or RFC 3339")
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		var dateOnly bool
+		if to, dateOnly, err = parseReportTime(s, loc); err != nil {
+			return from, to, fmt.Errorf("invalid to time, expected YYYY-MM-DD or RFC 3339")
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// getCycleTimeReport reports how long tasks took to move from one status
+// to another, the initial status to the first closed status by default
+func getCycleTimeReport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	fromStatus, toStatus := q.Get("from_status"), q.Get("to_status")
+	if fromStatus == "" || toStatus == "" {
+		statuses, _, err := loadTaskStatuses(db)
+		if err != nil {
+			writeServerError(w, "Error loading task statuses", err)
+			return
+		}
+		if fromStatus == "" {
+			fromStatus = statuses.Initial()
+		}
+		if toStatus == "" {
+			toStatus = statuses.First(statusClosed)
+		}
+	}
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	from, to, err := parseOpenRange(r, loc)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT task_id, to_status, changed_at
+        FROM task_status_changes
+        ORDER BY task_id, changed_at, id
+    `)
+	if err != nil {
+		writeServerError(w, "Error querying status changes", err)
+		return
+	}
+	defer rows.Close()
+
+	var changes []statusChange
+	for rows.Next() {
+		var c statusChange
+		if err := rows.Scan(&c.TaskID, &c.To, &c.ChangedAt); err != nil {
+			writeServerError(w, "Error scanning status change row", err)
+			return
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error reading status changes", err)
+		return
+	}
+
+	report := buildCycleTimeReport(findCycles(changes, fromStatus, toStatus), fromStatus, toStatus, from, to)
+	if err := fillTaskTitles(report.Tasks); err != nil {
+		writeServerError(w, "Error loading task titles", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// fillTaskTitles sets the note of each cycle's task
+func fillTaskTitles(cycles []*TaskCycle) error {
+	rows, err := db.Query("SELECT t.id, t.note_id, n.title FROM tasks t JOIN notes n ON n.id = t.note_id")
+	if err != nil {
+		return fmt.Errorf("error querying tasks: %w", err)
+	}
+	defer rows.Close()
+
+	type taskNote struct {
+		noteID int
+		title  string
+	}
+	notes := make(map[int]taskNote)
+	for rows.Next() {
+		var id int
+		var n taskNote
+		if err := rows.Scan(&id, &n.noteID, &n.title); err != nil {
+			return fmt.Errorf("error scanning task row: %w", err)
+		}
+		notes[id] = n
+	}
+	for _, c := range cycles {
+		c.NoteID, c.Title = notes[c.TaskID].noteID, notes[c.TaskID].title
+	}
+	return rows.Err()
+}
+
+// Deadline pushbacks
+
+// deadlineChange is a change of a task's deadline from task_history
+type deadlineChange struct {
+	TaskID    int
+	Old, New  *time.Time
+	Reason    string
+	ChangedAt time.Time
+}
+
+// DeadlinePushbacks counts how often a task's deadline was moved later
+type DeadlinePushbacks struct {
+	TaskID           int        `json:"task_id"`
+	NoteID           int        `json:"note_id"`
+	Title            string     `json:"title"`
+	Status           string     `json:"status"`
+	Pushbacks        int        `json:"pushbacks"`
+	DaysPushed       float64    `json:"days_pushed"`
+	OriginalDeadline *time.Time `json:"original_deadline"`
+	Deadline         *time.Time `json:"deadline"`
+	LastPushedAt     time.Time  `json:"last_pushed_at"`
+}
+
+// countPushbacks counts the deadline changes made in [from, to) that moved
+// a deadline later, a zero time leaves that end of the range open.
+// Recurring tasks advancing to their next occurrence are not pushbacks and
+// reset the original deadline. Changes must be ordered by task and time.
+func countPushbacks(changes []deadlineChange, from, to time.Time) map[int]*DeadlinePushbacks {
+	pushbacks := make(map[int]*DeadlinePushbacks)
+	original := make(map[int]*time.Time)
+	for _, c := range changes {
+		if c.Reason == changeReasonRecurrence || c.Old == nil {
+			original[c.TaskID] = c.New
+			continue
+		}
+		if _, ok := original[c.TaskID]; !ok {
+			original[c.TaskID] = c.Old
+		}
+		if c.New == nil || !c.New.After(*c.Old) {
+			continue
+		}
+		if (!from.IsZero() && c.ChangedAt.Before(from)) || (!to.IsZero() && !c.ChangedAt.Before(to)) {
+			continue
+		}
+		p, ok := pushbacks[c.TaskID]
+		if !ok {
+			p = &DeadlinePushbacks{TaskID: c.TaskID}
+			pushbacks[c.TaskID] = p
+		}
+		p.Pushbacks++
+		p.DaysPushed += c.New.Sub(*c.Old).Hours() / 24
+		p.OriginalDeadline = original[c.TaskID]
+		p.LastPushedAt = c.ChangedAt
+	}
+	for _, p := range pushbacks {
+		p.DaysPushed = math.Round(p.DaysPushed*100) / 100
+	}
+	return pushbacks
+}
+
+// getDeadlinePushbackReport lists the tasks whose deadline was pushed back,
+// most often first. With from and to only pushbacks made in that range count.
+func getDeadlinePushbackReport(w http.ResponseWriter, r *http.Request) {
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	from, to, err := parseOpenRange(r, loc)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	deadlines := "(old_value #>> '{}')::timestamptz, (new_value #>> '{}')::timestamptz"
+	if usingSQLite() {
+		deadlines = "old_value ->> '$', new_value ->> '$'"
+	}
+	rows, err := db.Query(`
+        SELECT task_id, ` + deadlines + `,
+               COALESCE(reason, ''), changed_at
+        FROM task_history
+        WHERE field = 'deadline'
+        ORDER BY task_id, changed_at, id
+    `)
+	if err != nil {
+		writeServerError(w, "Error querying deadline changes", err)
+		return
+	}
+	defer rows.Close()
+
+	var changes []deadlineChange
+	for rows.Next() {
+		var c deadlineChange
+		var oldDeadline, newDeadline sql.NullTime
+		if err := rows.Scan(&c.TaskID, &oldDeadline, &newDeadline, &c.Reason, &c.ChangedAt); err != nil {
+			writeServerError(w, "Error scanning deadline change row", err)
+			return
+		}
+		if oldDeadline.Valid {
+			c.Old = &oldDeadline.Time
+		}
+		if newDeadline.Valid {
+			c.New = &newDeadline.Time
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error reading deadline changes", err)
+		return
+	}
+
+	pushbacks := countPushbacks(changes, from, to)
+
+	taskRows, err := db.Query(`
+        SELECT t.id, t.note_id, n.title, t.status, t.deadline
+        FROM tasks t
+        JOIN notes n ON n.id = t.note_id
+    `)
+	if err != nil {
+		writeServerError(w, "Error querying tasks", err)
+		return
+	}
+	defer taskRows.Close()
+
+	report := []*DeadlinePushbacks{}
+	for taskRows.Next() {
+		var id, noteID int
+		var title, status string
+		var deadline sql.NullTime
+		if err := taskRows.Scan(&id, &noteID, &title, &status, &deadline); err != nil {
+			writeServerError(w, "Error scanning task row", err)
+			return
+		}
+		p, ok := pushbacks[id]
+		if !ok {
+			continue
+		}
+		p.NoteID, p.Title, p.Status = noteID, title, status
+		if deadline.Valid {
+			p.Deadline = &deadline.Time
+		}
+		report = append(report, p)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Pushbacks != report[j].Pushbacks {
+			return report[i].Pushbacks > report[j].Pushbacks
+		}
+		return report[i].TaskID < report[j].TaskID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
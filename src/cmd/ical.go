@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Minimal iCalendar (RFC 5545) reading and writing, enough to exchange
+// VTODO and VEVENT components with calendar applications.
+
+const icalProdID = "-//Draftsmith//Draftsmith API//EN"
+
+// ICalProperty is a single content line, e.g. DTSTART;VALUE=DATE:20240105
+type ICalProperty struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// ICalComponent is a BEGIN/END block such as VCALENDAR, VEVENT or VTODO
+type ICalComponent struct {
+	Name       string
+	Properties []ICalProperty
+	Components []*ICalComponent
+}
+
+// Get returns the first property with the given name
+func (c *ICalComponent) Get(name string) *ICalProperty {
+	for i := range c.Properties {
+		if c.Properties[i].Name == name {
+			return &c.Properties[i]
+		}
+	}
+	return nil
+}
+
+// Value returns the unescaped text value of the first property with the given name
+func (c *ICalComponent) Value(name string) string {
+	if p := c.Get(name); p != nil {
+		return icalUnescape(p.Value)
+	}
+	return ""
+}
+
+// Add appends a property to the component
+func (c *ICalComponent) Add(name, value string, params map[string]string) {
+	c.Properties = append(c.Properties, ICalProperty{Name: name, Params: params, Value: value})
+}
+
+// AddText appends a property whose value is escaped as TEXT
+func (c *ICalComponent) AddText(name, value string) {
+	c.Add(name, icalEscape(value), nil)
+}
+
+// AddTime appends a DATE-TIME property in UTC, or a DATE property if allDay is set
+func (c *ICalComponent) AddTime(name string, t time.Time, allDay bool) {
+	if allDay {
+		c.Add(name, t.Format("20060102"), map[string]string{"VALUE": "DATE"})
+		return
+	}
+	c.Add(name, t.UTC().Format("20060102T150405Z"), nil)
+}
+
+// Time parses the first property with the given name as a DATE or
+// DATE-TIME, returning the time in UTC and whether it was a DATE
+func (c *ICalComponent) Time(name string) (t time.Time, allDay bool, ok bool, err error) {
+	p := c.Get(name)
+	if p == nil {
+		return time.Time{}, false, false, nil
+	}
+	t, allDay, err = parseICalTime(p)
+	return t, allDay, true, err
+}
+
+func parseICalTime(p *ICalProperty) (time.Time, bool, error) {
+	v := strings.TrimSpace(p.Value)
+	if p.Params["VALUE"] == "DATE" || len(v) == 8 {
+		t, err := time.Parse("20060102", v)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		return t, false, err
+	}
+
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(strings.Trim(tzid, `"`)); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", v, loc)
+	return t.UTC(), false, err
+}
+
+// parseICal reads an iCalendar stream and returns its top level components
+func parseICal(r io.Reader) ([]*ICalComponent, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	// Unfold continuation lines
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading calendar: %w", err)
+	}
+
+	var roots []*ICalComponent
+	var stack []*ICalComponent
+	for i, line := range lines {
+		prop, err := parseICalLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch prop.Name {
+		case "BEGIN":
+			comp := &ICalComponent{Name: strings.ToUpper(prop.Value)}
+			if len(stack) == 0 {
+				roots = append(roots, comp)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, comp)
+			}
+			stack = append(stack, comp)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(prop.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, prop.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside of a component", i+1)
+			}
+			comp := stack[len(stack)-1]
+			comp.Properties = append(comp.Properties, prop)
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unterminated %s component", stack[len(stack)-1].Name)
+	}
+
+	return roots, nil
+}
+
+// parseICalLine splits an unfolded content line into its name, parameters and value
+func parseICalLine(line string) (ICalProperty, error) {
+	prop := ICalProperty{Params: map[string]string{}}
+
+	// The value starts at the first colon that is not inside a quoted parameter
+	inQuotes := false
+	colon := -1
+	for i, ch := range line {
+		if ch == '"' {
+			inQuotes = !inQuotes
+		} else if ch == ':' && !inQuotes {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return prop, fmt.Errorf("invalid content line: %q", line)
+	}
+	prop.Value = line[colon+1:]
+
+	parts := strings.Split(line[:colon], ";")
+	prop.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		k, v, _ := strings.Cut(param, "=")
+		prop.Params[strings.ToUpper(k)] = v
+	}
+	return prop, nil
+}
+
+// Encode writes the component and its subcomponents with CRLF line
+// endings, folding lines longer than 75 octets
+func (c *ICalComponent) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.encode(bw)
+	return bw.Flush()
+}
+
+func (c *ICalComponent) encode(w *bufio.Writer) {
+	writeICalLine(w, "BEGIN:"+c.Name)
+	for _, p := range c.Properties {
+		line := p.Name
+		keys := make([]string, 0, len(p.Params))
+		for k := range p.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			line += ";" + k + "=" + p.Params[k]
+		}
+		writeICalLine(w, line+":"+p.Value)
+	}
+	for _, sub := range c.Components {
+		sub.encode(w)
+	}
+	writeICalLine(w, "END:"+c.Name)
+}
+
+func writeICalLine(w *bufio.Writer, line string) {
+	const limit = 75
+	for len(line) > limit {
+		// Don't split a multi-byte UTF-8 sequence
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+	}
+	w.WriteString(line + "\r\n")
+}
+
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func icalUnescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// newICalendar returns an empty VCALENDAR component
+func newICalendar() *ICalComponent {
+	cal := &ICalComponent{Name: "VCALENDAR"}
+	cal.Add("VERSION", "2.0", nil)
+	cal.Add("PRODID", icalProdID, nil)
+	cal.Add("CALSCALE", "GREGORIAN", nil)
+	return cal
+}
+
+// icalPriority maps a task priority (1-5) to an iCalendar priority (1-9)
+func icalPriority(priority int) int {
+	if priority < 1 || priority > 5 {
+		return 0
+	}
+	return priority*2 - 1
+}
+
+// taskPriority maps an iCalendar priority (1-9) to a task priority (1-5)
+func taskPriority(priority int) int {
+	if priority < 1 || priority > 9 {
+		return 0
+	}
+	return (priority + 1) / 2
+}
+
+// icalTodoStatus maps the category of a task status to a VTODO STATUS
+func icalTodoStatus(category string) string {
+	switch category {
+	case statusClosed:
+		return "COMPLETED"
+	case statusCancelled:
+		return "CANCELLED"
+	default:
+		return "NEEDS-ACTION"
+	}
+}
+
+// taskStatusFromICal maps a VTODO STATUS to a task status. The current
+// status is kept if it is in the category of the STATUS, otherwise an open
+// task gets the initial status and a completed or cancelled task the first
+// status of that category.
+func taskStatusFromICal(statuses taskStatusSet, status, current string) (string, error) {
+	category := statusOpen
+	switch strings.ToUpper(status) {
+	case "COMPLETED":
+		category = statusClosed
+	case "CANCELLED":
+		category = statusCancelled
+	}
+	if current != "" && statuses.Category(current) == category {
+		return current, nil
+	}
+
+	name := statuses.First(category)
+	if category == statusOpen {
+		name = statuses.Initial()
+	}
+	if name == "" {
+		return "", &fieldError{Field: "STATUS", Message: fmt.Sprintf("There is no %s task status for STATUS %s", category, status)}
+	}
+	return name, nil
+}
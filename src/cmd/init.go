@@ -4,48 +4,108 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"database/sql"
 	_ "embed"
 	"fmt"
-	"log"
 
 	utils "draftsmith/src/utils"
 	_ "github.com/lib/pq"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 //go:embed draftsmith.sql
 var sql_commands string
 
+//go:embed draftsmith_sqlite.sql
+var sqlite_commands string
+
 // initCmd represents the init command
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize the database",
-	Long: `This will initialize the database and create the necessary tables.
-
-This requires the database to be dropped first, use the drop command to do this.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Initializing database...")
+	Long: `This will create the database (--db_name) if it doesn't exist and create
+the necessary tables.
 
-		DB_NAME := "draftsmith"
+The schema is only applied to a database that doesn't have it yet, a
+database created by an earlier version is migrated to the current schema
+instead, so this is safe to run on every start.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbName := viper.GetString("db_name")
+		fmt.Printf("Initializing database %s...\n", dbName)
 
-		// Create the default Database
-		utils.Create_db()
+		// Create the database
+		created, err := utils.Create_db(dbName)
+		if err != nil {
+			return err
+		}
+		if created {
+			fmt.Printf("Created database %s.\n", dbName)
+		}
 
 		// Connect to the new database
-		db = utils.Get_db(DB_NAME)
+		db, err = utils.Get_db(dbName)
+		if err != nil {
+			return err
+		}
 		defer db.Close()
 
-		// Execute SQL commands
-		fmt.Println(sql_commands)
-		_, err := db.Exec(sql_commands)
+		applied, err := initSchema(db)
 		if err != nil {
-			log.Fatalf("Error executing SQL commands: %v", err)
+			return err
+		}
+		if !applied {
+			from, to, err := migrateSchema(db)
+			if err != nil {
+				return err
+			}
+			if from == to {
+				fmt.Println("Database already initialized.")
+			} else {
+				fmt.Printf("Migrated the schema from version %d to %d.\n", from, to)
+			}
+			return nil
 		}
 
 		fmt.Println("Database initialized successfully.")
+		return nil
 	},
 }
 
 func init() {
 	cliCmd.AddCommand(initCmd)
 }
+
+// initSchema applies the schema, with its sample rows, unless the notes
+// table already exists. It reports whether the schema was applied.
+func initSchema(db *sql.DB) (bool, error) {
+	commands := sql_commands
+	if usingSQLite() {
+		commands = sqlite_commands
+	}
+
+	exists, err := tableExists(db, "notes")
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	// A schema that fails half way must not leave the notes table behind,
+	// or the database would look initialized
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Execute SQL commands
+	if _, err := tx.Exec(commands); err != nil {
+		return false, fmt.Errorf("error executing SQL commands: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing the schema: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	utils "draftsmith/src/utils"
+)
+
+// Schema migrations
+//
+// draftsmith.sql and draftsmith_sqlite.sql create the latest schema and
+// record its version in schema_version, a database from before that table
+// is at version 0. cli init brings an older database up to date by running
+// migrations/<version>_<driver>.sql for each version after its own, every
+// migration in a transaction along with the version it reaches. A version
+// without a file for a driver has nothing to do for it, e.g. SQLite
+// databases have been versioned from the start.
+//
+// A change to the schema goes in both schema files and in a migration for
+// each driver, with schemaVersion raised.
+
+// schemaVersion is the version of the schema files
+const schemaVersion = 4
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// tableExists reports whether a table exists
+func tableExists(q queryer, name string) (bool, error) {
+	query := "SELECT to_regclass('public.' || $1) IS NOT NULL"
+	if usingSQLite() {
+		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = $1)"
+	}
+	var exists bool
+	if err := q.QueryRow(query, name).Scan(&exists); err != nil {
+		return false, fmt.Errorf("error checking for table %s: %w", name, err)
+	}
+	return exists, nil
+}
+
+// databaseSchemaVersion returns the schema version of the database
+func databaseSchemaVersion(q queryer) (int, error) {
+	exists, err := tableExists(q, "schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version int
+	if err := q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("error querying the schema version: %w", err)
+	}
+	return version, nil
+}
+
+// checkSchemaVersion returns an error unless the database has the schema
+// version of this build
+func checkSchemaVersion(q queryer) error {
+	version, err := databaseSchemaVersion(q)
+	if err != nil {
+		return err
+	}
+	if version < schemaVersion {
+		return fmt.Errorf("the database schema is at version %d, run cli init to migrate it to version %d", version, schemaVersion)
+	}
+	if version > schemaVersion {
+		return fmt.Errorf("the database schema is at version %d, newer than the version %d this build supports", version, schemaVersion)
+	}
+	return nil
+}
+
+// migrateSchema runs the migrations after the database's schema version,
+// it returns the version the database was at and the version it reached
+func migrateSchema(db *sql.DB) (int, int, error) {
+	from, err := databaseSchemaVersion(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > schemaVersion {
+		return from, from, checkSchemaVersion(db)
+	}
+	for version := from + 1; version <= schemaVersion; version++ {
+		name := fmt.Sprintf("migrations/%03d_%s.sql", version, utils.Db_driver())
+		commands, err := migrationFiles.ReadFile(name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return from, version - 1, err
+		}
+		if err := runMigration(db, version, string(commands)); err != nil {
+			return from, version - 1, fmt.Errorf("error migrating the schema to version %d: %w", version, err)
+		}
+	}
+	return from, schemaVersion, nil
+}
+
+// runMigration runs the commands of a migration and records its version
+func runMigration(db *sql.DB, version int, commands string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if commands != "" {
+		if _, err := tx.Exec(commands); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS schema_version (version INT NOT NULL)"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM schema_version"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_version (version) VALUES ($1)", version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,228 @@
+-- Migration 1: from the original schema to the first versioned one, adds
+-- task statuses, time zones, effort overrides, recurrence, history,
+-- dependencies, clock constraints, reminders and calendar imports.
+--
+-- TIMESTAMP columns become TIMESTAMPTZ. Their values are taken to be UTC,
+-- which is how the API has always written them.
+
+DROP VIEW IF EXISTS task_efforts;
+
+DO $$
+DECLARE
+  c RECORD;
+BEGIN
+  FOR c IN
+    SELECT col.table_name, col.column_name
+    FROM information_schema.columns col
+    JOIN information_schema.tables t ON t.table_schema = col.table_schema AND t.table_name = col.table_name
+    WHERE col.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+      AND col.data_type = 'timestamp without time zone'
+  LOOP
+    EXECUTE format('ALTER TABLE %I ALTER COLUMN %I TYPE TIMESTAMPTZ USING %I AT TIME ZONE ''UTC''',
+                   c.table_name, c.column_name, c.column_name);
+  END LOOP;
+END
+$$;
+
+-- Task statuses replace the CHECK constraint on tasks.status, the defaults
+-- are the statuses it allowed
+CREATE TABLE IF NOT EXISTS task_statuses (
+    name TEXT PRIMARY KEY,
+    category TEXT NOT NULL CHECK (category IN ('open', 'closed', 'cancelled')),
+    position INT NOT NULL DEFAULT 0,      -- Display order, e.g. board columns
+    description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS task_status_transitions (
+    from_status TEXT REFERENCES task_statuses(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    to_status TEXT REFERENCES task_statuses(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (from_status, to_status)
+);
+
+INSERT INTO task_statuses (name, category, position, description)
+SELECT * FROM (VALUES
+    ('idea', 'open', 0, 'Something that might be done'),
+    ('todo', 'open', 1, 'To be done'),
+    ('proj', 'open', 2, 'A project made up of other tasks'),
+    ('wait', 'open', 3, 'Waiting on someone else'),
+    ('hold', 'open', 4, 'Put on hold'),
+    ('event', 'open', 5, 'Something happening at a scheduled time'),
+    ('done', 'closed', 6, 'Finished'),
+    ('kill', 'cancelled', 7, 'No longer going to be done')
+) AS s (name, category, position, description)
+WHERE NOT EXISTS (SELECT 1 FROM task_statuses);
+
+INSERT INTO task_status_transitions (from_status, to_status)
+SELECT f.name, t.name FROM task_statuses f CROSS JOIN task_statuses t
+WHERE f.name <> t.name AND NOT EXISTS (SELECT 1 FROM task_status_transitions);
+
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_status_check;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS repeat_rule TEXT;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS board_position INT;
+
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'tasks'::regclass AND conname = 'tasks_status_fkey') THEN
+    ALTER TABLE tasks ADD CONSTRAINT tasks_status_fkey
+      FOREIGN KEY (status) REFERENCES task_statuses(name) ON UPDATE CASCADE;
+  END IF;
+
+  -- actual_effort is derived from the clocks unless overridden, tasks
+  -- created through the API were given an actual effort of 0
+  IF EXISTS (SELECT 1 FROM information_schema.columns
+             WHERE table_schema = 'public' AND table_name = 'tasks' AND column_name = 'actual_effort') THEN
+    ALTER TABLE tasks RENAME COLUMN actual_effort TO actual_effort_override;
+    UPDATE tasks SET actual_effort_override = NULL WHERE actual_effort_override = 0;
+  END IF;
+
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'task_schedules'::regclass AND conname = 'task_schedules_check') THEN
+    ALTER TABLE task_schedules ADD CONSTRAINT task_schedules_check
+      CHECK (end_datetime IS NULL OR start_datetime IS NULL OR end_datetime >= start_datetime);
+  END IF;
+END
+$$;
+
+-- Clocks must have started, may not end before they start and may not
+-- overlap. Rows breaking these rules have to be fixed by hand first.
+DO $$
+DECLARE
+  invalid TEXT;
+BEGIN
+  SELECT string_agg(c.id::text, ', ' ORDER BY c.id) INTO invalid
+  FROM task_clocks c
+  WHERE c.clock_in IS NULL OR c.clock_out < c.clock_in
+     OR EXISTS (
+       SELECT 1 FROM task_clocks o
+       WHERE o.id <> c.id
+         AND o.clock_in < COALESCE(o.clock_out, 'infinity')
+         AND c.clock_in < COALESCE(c.clock_out, 'infinity')
+         AND o.clock_in < COALESCE(c.clock_out, 'infinity')
+         AND c.clock_in < COALESCE(o.clock_out, 'infinity')
+     );
+  IF invalid IS NOT NULL THEN
+    RAISE EXCEPTION 'task_clocks % have no clock_in, end before they start or overlap another clock, correct them and run cli init again', invalid;
+  END IF;
+
+  ALTER TABLE task_clocks ALTER COLUMN clock_in SET NOT NULL;
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'task_clocks'::regclass AND conname = 'task_clocks_check') THEN
+    ALTER TABLE task_clocks ADD CONSTRAINT task_clocks_check
+      CHECK (clock_out IS NULL OR clock_out >= clock_in);
+  END IF;
+  IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'task_clocks'::regclass AND conname = 'task_clocks_no_overlap') THEN
+    ALTER TABLE task_clocks ADD CONSTRAINT task_clocks_no_overlap EXCLUDE USING gist (
+        tstzrange(clock_in, COALESCE(clock_out, 'infinity'::timestamptz)) WITH &&
+    );
+  END IF;
+END
+$$;
+
+CREATE TABLE IF NOT EXISTS task_status_changes (
+    id SERIAL PRIMARY KEY,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS task_history (
+    id SERIAL PRIMARY KEY,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    field TEXT NOT NULL,
+    old_value JSONB,
+    new_value JSONB,
+    reason TEXT,
+    changed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS task_history_task_idx ON task_history (task_id, changed_at);
+
+CREATE OR REPLACE FUNCTION task_history_trigger() RETURNS trigger AS $$
+DECLARE
+  old_row JSONB := '{}';
+  new_row JSONB := to_jsonb(NEW);
+  col TEXT;
+BEGIN
+  IF TG_OP = 'UPDATE' THEN
+    old_row := to_jsonb(OLD);
+  END IF;
+  FOR col IN SELECT jsonb_object_keys(new_row) LOOP
+    CONTINUE WHEN col IN ('id', 'created_at', 'modified_at');
+    CONTINUE WHEN TG_OP = 'INSERT' AND new_row->col = 'null'::jsonb;
+    IF old_row->col IS DISTINCT FROM new_row->col THEN
+      INSERT INTO task_history (task_id, field, old_value, new_value, reason)
+      VALUES (NEW.id, col, old_row->col, new_row->col,
+              NULLIF(current_setting('draftsmith.change_reason', true), ''));
+    END IF;
+  END LOOP;
+  RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS task_history_update ON tasks;
+CREATE TRIGGER task_history_update
+AFTER INSERT OR UPDATE ON tasks
+FOR EACH ROW EXECUTE FUNCTION task_history_trigger();
+
+CREATE TABLE IF NOT EXISTS task_completions (
+    id SERIAL PRIMARY KEY,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    completed_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    deadline TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    id SERIAL PRIMARY KEY,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    depends_on_task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    CHECK (task_id <> depends_on_task_id),
+    UNIQUE (task_id, depends_on_task_id)
+);
+
+CREATE VIEW task_efforts AS
+SELECT
+    t.id AS task_id,
+    t.effort_estimate,
+    COALESCE(SUM(EXTRACT(EPOCH FROM (tc.clock_out - tc.clock_in))) / 3600, 0) AS clocked_effort,
+    t.actual_effort_override,
+    COALESCE(t.actual_effort_override, SUM(EXTRACT(EPOCH FROM (tc.clock_out - tc.clock_in))) / 3600, 0) AS actual_effort
+FROM tasks t
+LEFT JOIN task_clocks tc ON tc.task_id = t.id AND tc.clock_out IS NOT NULL
+GROUP BY t.id;
+
+CREATE TABLE IF NOT EXISTS reminder_rules (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    anchor TEXT NOT NULL CHECK (anchor IN ('deadline', 'schedule_start')),
+    offset_minutes INT NOT NULL DEFAULT 0,
+    sinks TEXT[] NOT NULL DEFAULT '{}',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+INSERT INTO reminder_rules (name, anchor, offset_minutes)
+SELECT * FROM (VALUES
+    ('1 day before the deadline', 'deadline', 1440),
+    ('At the schedule start', 'schedule_start', 0)
+) AS r (name, anchor, offset_minutes)
+WHERE NOT EXISTS (SELECT 1 FROM reminder_rules);
+
+CREATE TABLE IF NOT EXISTS sent_reminders (
+    id SERIAL PRIMARY KEY,
+    rule_id INT REFERENCES reminder_rules(id) ON DELETE CASCADE,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    schedule_id INT REFERENCES task_schedules(id) ON DELETE SET NULL,
+    due_at TIMESTAMPTZ NOT NULL,
+    sent_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    delivered_to TEXT[] NOT NULL DEFAULT '{}',
+    error TEXT,
+    UNIQUE (rule_id, task_id, due_at)
+);
+
+CREATE TABLE IF NOT EXISTS calendar_uids (
+    uid TEXT PRIMARY KEY,
+    note_id INT REFERENCES notes(id) ON DELETE CASCADE,
+    task_id INT REFERENCES tasks(id) ON DELETE CASCADE,
+    schedule_id INT REFERENCES task_schedules(id) ON DELETE SET NULL,
+    component TEXT CHECK (component IN ('VTODO', 'VEVENT'))
+);
+
+ALTER TABLE calendar_uids ADD COLUMN IF NOT EXISTS href TEXT UNIQUE;
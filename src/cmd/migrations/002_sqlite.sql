@@ -0,0 +1,9 @@
+-- Migration 2: a task status can be flagged initial, new tasks and
+-- reopened recurring tasks are given it
+
+ALTER TABLE task_statuses ADD COLUMN initial BOOLEAN NOT NULL DEFAULT FALSE
+    CHECK (NOT initial OR category = 'open');
+
+CREATE UNIQUE INDEX task_statuses_initial_idx ON task_statuses (initial) WHERE initial;
+
+UPDATE task_statuses SET initial = TRUE WHERE name = 'todo' AND category = 'open';
@@ -0,0 +1,15 @@
+-- Migration 3: clocked effort is summed in whole seconds, julianday
+-- differences lose precision
+
+DROP VIEW task_efforts;
+
+CREATE VIEW task_efforts AS
+SELECT
+    t.id AS task_id,
+    t.effort_estimate,
+    COALESCE(SUM(unixepoch(tc.clock_out) - unixepoch(tc.clock_in)) / 3600.0, 0) AS clocked_effort,
+    t.actual_effort_override,
+    COALESCE(t.actual_effort_override, SUM(unixepoch(tc.clock_out) - unixepoch(tc.clock_in)) / 3600.0, 0) AS actual_effort
+FROM tasks t
+LEFT JOIN task_clocks tc ON tc.task_id = t.id AND tc.clock_out IS NOT NULL
+GROUP BY t.id;
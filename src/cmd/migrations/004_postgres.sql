@@ -0,0 +1,4 @@
+-- Migration 4: the history of a task is kept when the task is deleted
+
+ALTER TABLE task_history DROP CONSTRAINT IF EXISTS task_history_task_id_fkey;
+ALTER TABLE task_history ALTER COLUMN task_id SET NOT NULL;
@@ -0,0 +1,63 @@
+-- Migration 4: the history of a task is kept when the task is deleted,
+-- task_history.task_id no longer references tasks. SQLite can't drop the
+-- constraint so the table is rebuilt, along with the triggers writing it.
+
+DROP TRIGGER task_history_insert;
+DROP TRIGGER task_history_update;
+
+ALTER TABLE task_history RENAME TO task_history_old;
+DROP INDEX task_history_task_idx;
+
+CREATE TABLE task_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INT NOT NULL,                  -- Not a foreign key, the history outlives the task
+    field TEXT NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    reason TEXT,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX task_history_task_idx ON task_history (task_id, changed_at);
+
+INSERT INTO task_history (id, task_id, field, old_value, new_value, reason, changed_at)
+SELECT id, task_id, field, old_value, new_value, reason, changed_at FROM task_history_old;
+
+DROP TABLE task_history_old;
+
+-- Values are converted to JSON in the form to_jsonb gives on Postgres
+CREATE TRIGGER task_history_insert AFTER INSERT ON tasks BEGIN
+    INSERT INTO task_history (task_id, field, old_value, new_value, reason)
+    SELECT NEW.id, field, NULL, new_value, (SELECT NULLIF(value, '') FROM transaction_settings WHERE name = 'draftsmith.change_reason')
+    FROM (
+        SELECT 'note_id' AS field, json_quote(NEW.note_id) AS new_value
+        UNION ALL SELECT 'status', json_quote(NEW.status)
+        UNION ALL SELECT 'effort_estimate', json_quote(NEW.effort_estimate)
+        UNION ALL SELECT 'actual_effort_override', json_quote(NEW.actual_effort_override)
+        UNION ALL SELECT 'deadline', json_quote(strftime('%Y-%m-%dT%H:%M:%fZ', NEW.deadline))
+        UNION ALL SELECT 'priority', json_quote(NEW.priority)
+        UNION ALL SELECT 'all_day', CASE WHEN NEW.all_day IS NULL THEN 'null' WHEN NEW.all_day THEN 'true' ELSE 'false' END
+        UNION ALL SELECT 'goal_relationship', json_quote(NEW.goal_relationship)
+        UNION ALL SELECT 'repeat_rule', json_quote(NEW.repeat_rule)
+        UNION ALL SELECT 'board_position', json_quote(NEW.board_position)
+    )
+    WHERE new_value <> 'null';
+END;
+
+CREATE TRIGGER task_history_update AFTER UPDATE ON tasks BEGIN
+    INSERT INTO task_history (task_id, field, old_value, new_value, reason)
+    SELECT NEW.id, field, old_value, new_value, (SELECT NULLIF(value, '') FROM transaction_settings WHERE name = 'draftsmith.change_reason')
+    FROM (
+        SELECT 'note_id' AS field, json_quote(OLD.note_id) AS old_value, json_quote(NEW.note_id) AS new_value
+        UNION ALL SELECT 'status', json_quote(OLD.status), json_quote(NEW.status)
+        UNION ALL SELECT 'effort_estimate', json_quote(OLD.effort_estimate), json_quote(NEW.effort_estimate)
+        UNION ALL SELECT 'actual_effort_override', json_quote(OLD.actual_effort_override), json_quote(NEW.actual_effort_override)
+        UNION ALL SELECT 'deadline', json_quote(strftime('%Y-%m-%dT%H:%M:%fZ', OLD.deadline)), json_quote(strftime('%Y-%m-%dT%H:%M:%fZ', NEW.deadline))
+        UNION ALL SELECT 'priority', json_quote(OLD.priority), json_quote(NEW.priority)
+        UNION ALL SELECT 'all_day', CASE WHEN OLD.all_day IS NULL THEN 'null' WHEN OLD.all_day THEN 'true' ELSE 'false' END, CASE WHEN NEW.all_day IS NULL THEN 'null' WHEN NEW.all_day THEN 'true' ELSE 'false' END
+        UNION ALL SELECT 'goal_relationship', json_quote(OLD.goal_relationship), json_quote(NEW.goal_relationship)
+        UNION ALL SELECT 'repeat_rule', json_quote(OLD.repeat_rule), json_quote(NEW.repeat_rule)
+        UNION ALL SELECT 'board_position', json_quote(OLD.board_position), json_quote(NEW.board_position)
+    )
+    WHERE old_value IS NOT new_value;
+END;
@@ -0,0 +1,1502 @@
+//go:build linux || darwin
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"draftsmith/src/client"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/spf13/cobra"
+)
+
+// Notes filesystem
+//
+// mount exposes a server as a FUSE filesystem:
+//
+//	/notes/<title>.md        a note, <title>/ holds the notes under it
+//	/tags/<tag>/<title>.md   the notes with a tag, subtags as directories
+//	/assets/<file>           uploaded files
+//
+// Like the tui it only talks to the HTTP API. A note is saved with
+// updateNote when a file written to is closed, creating, renaming and moving
+// .md files and note directories map to the note and hierarchy endpoints.
+// Other files, such as editor swap files, only live in memory so editors can
+// save the way they usually do.
+
+var mountCmd = &cobra.Command{
+	Use:   "mount DIR",
+	Short: "Mount the notes, tags and assets of a server as a filesystem",
+	Long: `Mount the notes, tags and assets of a running server with FUSE.
+
+  DIR/notes/<title>.md        a note, DIR/notes/<title>/ holds its children
+  DIR/tags/<tag>/<title>.md   the notes with a tag
+  DIR/assets/<file>           uploaded files
+
+Writing a .md file updates the note when the file is closed. Creating,
+renaming, moving and deleting .md files and note directories creates,
+renames, moves and deletes notes. mkdir in DIR/tags creates a tag and
+ln DIR/notes/<title>.md DIR/tags/<tag>/ tags a note. Copying a file into
+DIR/assets uploads it.
+
+Files without the .md extension outside DIR/assets, such as editor swap
+files, are kept in memory only and are lost on unmount.
+
+Unmount with Ctrl-C, or fusermount -u DIR.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		debug, _ := cmd.Flags().GetBool("debug")
+		allowOther, _ := cmd.Flags().GetBool("allow-other")
+		return mountNotes(cliContext(cmd), apiClient(), args[0], debug, allowOther)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mountCmd)
+
+	mountCmd.Flags().Bool("debug", false, "Log every FUSE request")
+	mountCmd.Flags().Bool("allow-other", false, "Allow other users to access the mount")
+}
+
+// renameNoReplace is the renameat2 flag for failing if the target exists
+const renameNoReplace = 0x1
+
+// mountTTL is how long the notes are cached before they are fetched again
+const mountTTL = 2 * time.Second
+
+// mountNotes mounts the server on dir and serves until unmounted
+func mountNotes(ctx context.Context, c *client.Client, dir string, debug, allowOther bool) error {
+	server, err := mountServer(ctx, c, dir, debug, allowOther)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Mounted on %s, press Ctrl-C to unmount\n", dir)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range sig {
+			if err := server.Unmount(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error unmounting %s: %v\n", dir, err)
+				continue
+			}
+			return
+		}
+	}()
+	server.Wait()
+	return nil
+}
+
+// mountServer mounts the server on dir and returns the FUSE server serving
+// it
+func mountServer(ctx context.Context, c *client.Client, dir string, debug, allowOther bool) (*fuse.Server, error) {
+	mfs := &mountFS{
+		client:   c,
+		ctx:      ctx,
+		scratch:  map[string]map[string]*mountScratch{},
+		detached: map[string]map[string]int{},
+		dirs:     map[int]bool{},
+		sizes:    map[int]int{},
+		handles:  map[uint64]map[*mountHandle]bool{},
+	}
+
+	// Fail before mounting if the server can't be reached
+	if _, err := mfs.snapshot(); err != nil {
+		return nil, err
+	}
+
+	timeout := time.Second
+	server, err := fs.Mount(dir, &mountRoot{fs: mfs}, &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:      "draftsmith",
+			Name:        "draftsmith",
+			Debug:       debug,
+			AllowOther:  allowOther,
+			DirectMount: true,
+		},
+		EntryTimeout: &timeout,
+		AttrTimeout:  &timeout,
+		UID:          uint32(os.Getuid()),
+		GID:          uint32(os.Getgid()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error mounting %s: %w", dir, err)
+	}
+	return server, nil
+}
+
+type mountNote struct {
+	ID       int
+	Title    string
+	Content  string
+	Modified time.Time
+	Parent   int
+	Type     string
+	Children []int
+}
+
+type mountTag struct {
+	ID       int
+	Name     string
+	Parent   int
+	Children []int
+	Notes    []int
+}
+
+// mountSnapshot is the state of the server as of loaded
+type mountSnapshot struct {
+	notes    map[int]*mountNote
+	roots    []int
+	tags     map[int]*mountTag
+	tagRoots []int
+	assets   map[int]client.FileInfo
+	loaded   time.Time
+}
+
+// mountScratch is a file that is only kept in memory
+type mountScratch struct {
+	ino      uint64
+	data     []byte
+	modified time.Time
+}
+
+// mountFS is the state shared by the nodes. mu is held for the whole of
+// each operation, so operations are applied one at a time.
+type mountFS struct {
+	client *client.Client
+	ctx    context.Context
+
+	mu       sync.Mutex
+	snap     *mountSnapshot
+	scratch  map[string]map[string]*mountScratch // By directory key and name
+	detached map[string]map[string]int           // Note IDs of .md files renamed away, by directory key and name
+	dirs     map[int]bool                        // Notes given a directory with mkdir
+	sizes    map[int]int                         // Sizes of downloaded assets
+	handles  map[uint64]map[*mountHandle]bool    // Open handles by inode
+	lastIno  uint64
+}
+
+// snapshot returns the cached state, fetching it again once it is stale
+func (m *mountFS) snapshot() (*mountSnapshot, error) {
+	if m.snap != nil && time.Since(m.snap.loaded) < mountTTL {
+		return m.snap, nil
+	}
+
+	s := &mountSnapshot{
+		notes:  map[int]*mountNote{},
+		tags:   map[int]*mountTag{},
+		assets: map[int]client.FileInfo{},
+		loaded: time.Now(),
+	}
+	notes, err := m.client.ListNotes(m.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading notes: %w", err)
+	}
+	for _, n := range notes {
+		modified, _ := time.Parse(time.RFC3339, n.ModifiedAt)
+		s.notes[n.ID] = &mountNote{ID: n.ID, Title: n.Title, Content: n.Content, Modified: modified}
+	}
+
+	tree, err := m.client.NoteTree(m.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading note tree: %w", err)
+	}
+	var walkNotes func(nodes []*client.NoteTree, parent int)
+	walkNotes = func(nodes []*client.NoteTree, parent int) {
+		for _, t := range nodes {
+			n, ok := s.notes[t.ID]
+			if !ok {
+				continue
+			}
+			n.Parent, n.Type = parent, t.Type
+			if parent == 0 {
+				s.roots = append(s.roots, n.ID)
+			} else {
+				s.notes[parent].Children = append(s.notes[parent].Children, n.ID)
+			}
+			walkNotes(t.Children, n.ID)
+		}
+	}
+	walkNotes(tree, 0)
+
+	tags, err := m.client.TagTree(m.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tag tree: %w", err)
+	}
+	var walkTags func(nodes []*client.TagTree, parent int)
+	walkTags = func(nodes []*client.TagTree, parent int) {
+		for _, t := range nodes {
+			tag := &mountTag{ID: t.ID, Name: t.Name, Parent: parent}
+			for _, n := range t.Notes {
+				if _, ok := s.notes[n.ID]; ok {
+					tag.Notes = append(tag.Notes, n.ID)
+				}
+			}
+			s.tags[t.ID] = tag
+			if parent == 0 {
+				s.tagRoots = append(s.tagRoots, t.ID)
+			} else {
+				s.tags[parent].Children = append(s.tags[parent].Children, t.ID)
+			}
+			walkTags(t.Children, t.ID)
+		}
+	}
+	walkTags(tags, 0)
+
+	assets, err := m.client.ListAssets(m.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading assets: %w", err)
+	}
+	for _, a := range assets {
+		s.assets[a.ID] = a
+	}
+
+	m.snap = s
+	return s, nil
+}
+
+// invalidate makes the next operation fetch the state again
+func (m *mountFS) invalidate() {
+	m.snap = nil
+}
+
+// errno logs err and maps it to the closest errno
+func (m *mountFS) errno(err error) syscall.Errno {
+	log.Printf("draftsmith mount: %v", err)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case 400, 422:
+			return syscall.EINVAL
+		case 401, 403:
+			return syscall.EACCES
+		case 404:
+			return syscall.ENOENT
+		case 409:
+			return syscall.EEXIST
+		}
+	}
+	return syscall.EIO
+}
+
+func (m *mountFS) newIno() uint64 {
+	m.lastIno++
+	return mountIno(mountKindScratch, int(m.lastIno))
+}
+
+const (
+	mountKindNoteFile = iota + 1
+	mountKindNoteDir
+	mountKindTagDir
+	mountKindAssetsDir
+	mountKindAsset
+	mountKindScratch
+)
+
+// mountIno is the inode number of an object, a note has the same inode
+// number wherever it appears so the views are hard links of each other
+func mountIno(kind, id int) uint64 {
+	return uint64(kind)<<40 | uint64(id)
+}
+
+func dirAttr(out *fuse.Attr, modified time.Time) {
+	out.Mode = syscall.S_IFDIR | 0755
+	out.Nlink = 2
+	out.SetTimes(nil, &modified, &modified)
+}
+
+func fileAttr(out *fuse.Attr, mode uint32, size int, modified time.Time) {
+	out.Mode = syscall.S_IFREG | mode
+	out.Nlink = 1
+	out.Size = uint64(size)
+	out.SetTimes(nil, &modified, &modified)
+}
+
+// mountHandle is an open file, data is saved when it is flushed if it was
+// written to. edits counts the writes, so a flush only marks the handle
+// clean if nothing was written while it was saving.
+type mountHandle struct {
+	mu      sync.Mutex
+	data    []byte
+	dirty   bool
+	edits   int
+	save    func(data []byte) error
+	release func()
+}
+
+var (
+	_ fs.FileReader   = (*mountHandle)(nil)
+	_ fs.FileWriter   = (*mountHandle)(nil)
+	_ fs.FileFlusher  = (*mountHandle)(nil)
+	_ fs.FileFsyncer  = (*mountHandle)(nil)
+	_ fs.FileReleaser = (*mountHandle)(nil)
+)
+
+func (h *mountHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if off >= int64(len(h.data)) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := off + int64(len(dest))
+	if end > int64(len(h.data)) {
+		end = int64(len(h.data))
+	}
+	return fuse.ReadResultData(h.data[off:end]), 0
+}
+
+func (h *mountHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.save == nil {
+		return 0, syscall.EBADF
+	}
+	if end := off + int64(len(data)); end > int64(len(h.data)) {
+		h.data = append(h.data, make([]byte, end-int64(len(h.data)))...)
+	}
+	copy(h.data[off:], data)
+	h.dirty = true
+	h.edits++
+	return uint32(len(data)), 0
+}
+
+func (h *mountHandle) truncate(size uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if size < uint64(len(h.data)) {
+		h.data = h.data[:size]
+	} else {
+		h.data = append(h.data, make([]byte, size-uint64(len(h.data)))...)
+	}
+	h.dirty = true
+	h.edits++
+}
+
+func (h *mountHandle) size() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.data)
+}
+
+func (h *mountHandle) Flush(ctx context.Context) syscall.Errno {
+	h.mu.Lock()
+	if !h.dirty {
+		h.mu.Unlock()
+		return 0
+	}
+	data, edits := append([]byte(nil), h.data...), h.edits
+	// Saving takes the filesystem lock, which is held around size
+	h.mu.Unlock()
+
+	// A failed save stays dirty, so the next flush or fsync retries it
+	if err := h.save(data); err != nil {
+		var errno syscall.Errno
+		if errors.As(err, &errno) {
+			return errno
+		}
+		return syscall.EIO
+	}
+	h.mu.Lock()
+	if h.edits == edits {
+		h.dirty = false
+	}
+	h.mu.Unlock()
+	return 0
+}
+
+func (h *mountHandle) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	return h.Flush(ctx)
+}
+
+func (h *mountHandle) Release(ctx context.Context) syscall.Errno {
+	if h.release != nil {
+		h.release()
+	}
+	return 0
+}
+
+// setattr truncates the file of a node, through its handle if it is open
+func setattr(f fs.FileHandle, in *fuse.SetAttrIn, truncate func(size uint64) syscall.Errno) syscall.Errno {
+	size, ok := in.GetSize()
+	if !ok {
+		return 0
+	}
+	if h, ok := f.(*mountHandle); ok {
+		h.truncate(size)
+		return 0
+	}
+	return truncate(size)
+}
+
+// track keeps h in handles until it is released, m.mu must be held
+func (m *mountFS) track(ino uint64, h *mountHandle) *mountHandle {
+	if m.handles[ino] == nil {
+		m.handles[ino] = map[*mountHandle]bool{}
+	}
+	m.handles[ino][h] = true
+	h.release = func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.handles[ino], h)
+		if len(m.handles[ino]) == 0 {
+			delete(m.handles, ino)
+		}
+	}
+	return h
+}
+
+// truncateHandles truncates the open handles of a file. open with O_TRUNC
+// truncates without the handle it opens, which would otherwise save the old
+// content back. m.mu must be held.
+func (m *mountFS) truncateHandles(ino uint64, size uint64) {
+	for h := range m.handles[ino] {
+		h.truncate(size)
+	}
+}
+
+// Root
+
+type mountRoot struct {
+	fs.Inode
+	fs *mountFS
+}
+
+var _ fs.NodeOnAdder = (*mountRoot)(nil)
+
+func (r *mountRoot) OnAdd(ctx context.Context) {
+	dir := func(node fs.InodeEmbedder, kind int) *fs.Inode {
+		return r.NewPersistentInode(ctx, node, fs.StableAttr{Mode: syscall.S_IFDIR, Ino: mountIno(kind, 0)})
+	}
+	r.AddChild("notes", dir(&mountNoteDir{fs: r.fs}, mountKindNoteDir), false)
+	r.AddChild("tags", dir(&mountTagDir{fs: r.fs}, mountKindTagDir), false)
+	r.AddChild("assets", dir(&mountAssetsDir{fs: r.fs}, mountKindAssetsDir), false)
+}
+
+func (r *mountRoot) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	dirAttr(&out.Attr, time.Now())
+	return 0
+}
+
+// mountDir is a directory that holds note files, the notes under a note or
+// the notes with a tag
+type mountDir interface {
+	fs.InodeEmbedder
+	key() string
+	noteFiles(s *mountSnapshot) map[string]int
+	createNote(title, content string) (int, error)
+}
+
+// lookupFile finds a note or scratch file in a directory
+func (m *mountFS) lookupFile(ctx context.Context, d mountDir, s *mountSnapshot, name string, out *fuse.EntryOut) (*fs.Inode, bool) {
+	if id, ok := d.noteFiles(s)[name]; ok {
+		return m.noteFileInode(ctx, d.EmbeddedInode(), s, id, out), true
+	}
+	if sc, ok := m.scratch[d.key()][name]; ok {
+		return m.scratchInode(ctx, d.EmbeddedInode(), d.key(), name, sc, out), true
+	}
+	return nil, false
+}
+
+// fileEntries lists the note and scratch files of a directory
+func (m *mountFS) fileEntries(d mountDir, s *mountSnapshot) []fuse.DirEntry {
+	var entries []fuse.DirEntry
+	for name, id := range d.noteFiles(s) {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFREG, Ino: mountIno(mountKindNoteFile, id)})
+	}
+	for name, sc := range m.scratch[d.key()] {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFREG, Ino: sc.ino})
+	}
+	return entries
+}
+
+func sortedStream(entries []fuse.DirEntry) fs.DirStream {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return fs.NewListDirStream(entries)
+}
+
+// create creates a note file, or a scratch file if name isn't a .md file
+func (m *mountFS) create(ctx context.Context, d mountDir, name string, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	s, err := m.snapshot()
+	if err != nil {
+		return nil, nil, 0, m.errno(err)
+	}
+	if _, exists := m.lookupFile(ctx, d, s, name, out); exists {
+		return nil, nil, 0, syscall.EEXIST
+	}
+
+	if !isNoteFile(name) {
+		sc := &mountScratch{ino: m.newIno(), modified: time.Now()}
+		if m.scratch[d.key()] == nil {
+			m.scratch[d.key()] = map[string]*mountScratch{}
+		}
+		m.scratch[d.key()][name] = sc
+		node := m.scratchInode(ctx, d.EmbeddedInode(), d.key(), name, sc, out)
+		return node, m.scratchHandle(d.key(), name, sc, nil), 0, 0
+	}
+
+	// Saving over a note renamed away, as editors do when keeping a backup
+	id, ok := m.detached[d.key()][name]
+	if ok {
+		delete(m.detached[d.key()], name)
+	} else {
+		if id, err = d.createNote(strings.TrimSuffix(name, ".md"), ""); err != nil {
+			return nil, nil, 0, m.errno(err)
+		}
+		m.invalidate()
+		if s, err = m.snapshot(); err != nil {
+			return nil, nil, 0, m.errno(err)
+		}
+	}
+	node := m.noteFileInode(ctx, d.EmbeddedInode(), s, id, out)
+	return node, m.noteHandle(id, nil), 0, 0
+}
+
+// saveAs saves content to the note file name in d, creating it if needed
+func (m *mountFS) saveAs(d mountDir, s *mountSnapshot, name string, content []byte) error {
+	id, ok := d.noteFiles(s)[name]
+	if !ok {
+		id, ok = m.detached[d.key()][name]
+		delete(m.detached[d.key()], name)
+	}
+	if !ok {
+		_, err := d.createNote(strings.TrimSuffix(name, ".md"), string(content))
+		m.invalidate()
+		return err
+	}
+	text := string(content)
+	err := m.client.UpdateNote(m.ctx, id, client.NoteUpdate{Content: &text})
+	m.invalidate()
+	return err
+}
+
+// renameFile renames a note or scratch file between directories of note
+// files. It reports false if name is neither.
+func (m *mountFS) renameFile(src mountDir, name string, dst mountDir, newName string, flags uint32) (syscall.Errno, bool) {
+	s, err := m.snapshot()
+	if err != nil {
+		return m.errno(err), true
+	}
+	if flags&fs.RENAME_EXCHANGE != 0 {
+		return syscall.ENOTSUP, true
+	}
+	noReplace := flags&renameNoReplace != 0
+
+	if sc, ok := m.scratch[src.key()][name]; ok {
+		if !isNoteFile(newName) {
+			if _, exists := m.scratch[dst.key()][newName]; exists && noReplace {
+				return syscall.EEXIST, true
+			}
+			delete(m.scratch[src.key()], name)
+			if m.scratch[dst.key()] == nil {
+				m.scratch[dst.key()] = map[string]*mountScratch{}
+			}
+			m.scratch[dst.key()][newName] = sc
+			return 0, true
+		}
+		// Saving through a temporary file, as many editors do
+		if _, exists := dst.noteFiles(s)[newName]; exists && noReplace {
+			return syscall.EEXIST, true
+		}
+		if err := m.saveAs(dst, s, newName, sc.data); err != nil {
+			return m.errno(err), true
+		}
+		delete(m.scratch[src.key()], name)
+		return 0, true
+	}
+
+	id, ok := src.noteFiles(s)[name]
+	if !ok {
+		return 0, false
+	}
+	if !isNoteFile(newName) {
+		// Keep the note, as the file is usually a backup before saving anew
+		if m.scratch[dst.key()] == nil {
+			m.scratch[dst.key()] = map[string]*mountScratch{}
+		}
+		m.scratch[dst.key()][newName] = &mountScratch{ino: m.newIno(), data: []byte(s.notes[id].Content), modified: time.Now()}
+		if m.detached[src.key()] == nil {
+			m.detached[src.key()] = map[string]int{}
+		}
+		m.detached[src.key()][name] = id
+		return 0, true
+	}
+	if other, exists := dst.noteFiles(s)[newName]; exists && other != id {
+		// Replacing would delete a note, which rename shouldn't do
+		return syscall.EEXIST, true
+	}
+
+	switch dst := dst.(type) {
+	case *mountNoteDir:
+		if err := m.moveNote(s, id, dst.id); err != nil {
+			return m.errno(err), true
+		}
+	default:
+		if dst.key() != src.key() {
+			return syscall.EXDEV, true
+		}
+	}
+	if err := m.renameNote(s, id, newName); err != nil {
+		return m.errno(err), true
+	}
+	return 0, true
+}
+
+// renameNote changes the title of a note to match a new file name
+func (m *mountFS) renameNote(s *mountSnapshot, id int, name string) error {
+	title := strings.TrimSuffix(name, ".md")
+	if fileName(s.notes[id].Title) == title {
+		return nil
+	}
+	err := m.client.UpdateNote(m.ctx, id, client.NoteUpdate{Title: &title})
+	m.invalidate()
+	return err
+}
+
+// moveNote places a note under parent, or at the top level if parent is 0
+func (m *mountFS) moveNote(s *mountSnapshot, id, parent int) error {
+	n := s.notes[id]
+	if n.Parent == parent {
+		return nil
+	}
+	var err error
+	switch {
+	case parent == 0:
+		err = m.client.DeleteNoteHierarchyEntry(m.ctx, id)
+	case n.Parent == 0:
+		err = m.client.AddNoteHierarchyEntry(m.ctx, client.NoteHierarchyEntry{ParentNoteID: parent, ChildNoteID: id, HierarchyType: "subpage"})
+	default:
+		hierarchyType := n.Type
+		if hierarchyType == "" {
+			hierarchyType = "subpage"
+		}
+		err = m.client.UpdateNoteHierarchyEntry(m.ctx, id, client.NoteHierarchyEntry{ParentNoteID: parent, ChildNoteID: id, HierarchyType: hierarchyType})
+	}
+	m.invalidate()
+	return err
+}
+
+// unlinkScratch removes a scratch file, reporting false if there is none
+func (m *mountFS) unlinkScratch(d mountDir, name string) bool {
+	if _, ok := m.scratch[d.key()][name]; !ok {
+		return false
+	}
+	delete(m.scratch[d.key()], name)
+	return true
+}
+
+// Note files
+
+type mountNoteFile struct {
+	fs.Inode
+	fs *mountFS
+	id int
+}
+
+var (
+	_ fs.NodeGetattrer = (*mountNoteFile)(nil)
+	_ fs.NodeSetattrer = (*mountNoteFile)(nil)
+	_ fs.NodeOpener    = (*mountNoteFile)(nil)
+)
+
+func (m *mountFS) noteFileInode(ctx context.Context, parent *fs.Inode, s *mountSnapshot, id int, out *fuse.EntryOut) *fs.Inode {
+	n := s.notes[id]
+	fileAttr(&out.Attr, 0644, len(n.Content), n.Modified)
+	return parent.NewInode(ctx, &mountNoteFile{fs: m, id: id}, fs.StableAttr{Mode: syscall.S_IFREG, Ino: mountIno(mountKindNoteFile, id)})
+}
+
+// noteHandle opens a note with data, saving it with updateNote
+func (m *mountFS) noteHandle(id int, data []byte) *mountHandle {
+	return m.track(mountIno(mountKindNoteFile, id), &mountHandle{data: data, save: func(data []byte) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		content := string(data)
+		err := m.client.UpdateNote(m.ctx, id, client.NoteUpdate{Content: &content})
+		m.invalidate()
+		if err != nil {
+			return m.errno(err)
+		}
+		return nil
+	}})
+}
+
+func (f *mountNoteFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	s, err := f.fs.snapshot()
+	if err != nil {
+		return f.fs.errno(err)
+	}
+	n, ok := s.notes[f.id]
+	if !ok {
+		return syscall.ENOENT
+	}
+	size := len(n.Content)
+	if h, ok := fh.(*mountHandle); ok {
+		size = h.size()
+	}
+	fileAttr(&out.Attr, 0644, size, n.Modified)
+	return 0
+}
+
+func (f *mountNoteFile) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	errno := setattr(fh, in, func(size uint64) syscall.Errno {
+		f.fs.mu.Lock()
+		defer f.fs.mu.Unlock()
+		s, err := f.fs.snapshot()
+		if err != nil {
+			return f.fs.errno(err)
+		}
+		content := []byte(s.notes[f.id].Content)
+		if size > uint64(len(content)) {
+			return syscall.EINVAL
+		}
+		text := string(content[:size])
+		err = f.fs.client.UpdateNote(f.fs.ctx, f.id, client.NoteUpdate{Content: &text})
+		f.fs.invalidate()
+		if err != nil {
+			return f.fs.errno(err)
+		}
+		f.fs.truncateHandles(mountIno(mountKindNoteFile, f.id), size)
+		return 0
+	})
+	if errno != 0 {
+		return errno
+	}
+	return f.Getattr(ctx, fh, out)
+}
+
+func (f *mountNoteFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	s, err := f.fs.snapshot()
+	if err != nil {
+		return nil, 0, f.fs.errno(err)
+	}
+	n, ok := s.notes[f.id]
+	if !ok {
+		return nil, 0, syscall.ENOENT
+	}
+	h := f.fs.noteHandle(f.id, []byte(n.Content))
+	if flags&syscall.O_TRUNC != 0 {
+		h.data, h.dirty = nil, true
+	}
+	return h, 0, 0
+}
+
+// Scratch files
+
+type mountScratchFile struct {
+	fs.Inode
+	fs   *mountFS
+	dir  string
+	name string
+	sc   *mountScratch
+}
+
+var (
+	_ fs.NodeGetattrer = (*mountScratchFile)(nil)
+	_ fs.NodeSetattrer = (*mountScratchFile)(nil)
+	_ fs.NodeOpener    = (*mountScratchFile)(nil)
+)
+
+func (m *mountFS) scratchInode(ctx context.Context, parent *fs.Inode, dir, name string, sc *mountScratch, out *fuse.EntryOut) *fs.Inode {
+	fileAttr(&out.Attr, 0644, len(sc.data), sc.modified)
+	return parent.NewInode(ctx, &mountScratchFile{fs: m, dir: dir, name: name, sc: sc}, fs.StableAttr{Mode: syscall.S_IFREG, Ino: sc.ino})
+}
+
+// scratchHandle opens a scratch file. In the assets directory saving it
+// uploads the file instead.
+func (m *mountFS) scratchHandle(dir, name string, sc *mountScratch, data []byte) *mountHandle {
+	return m.track(sc.ino, &mountHandle{data: data, save: func(data []byte) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		sc.data, sc.modified = data, time.Now()
+		if dir != mountAssetsKey || m.scratch[dir][name] != sc {
+			return nil
+		}
+		_, err := m.client.UploadAsset(m.ctx, name, strings.NewReader(string(data)), "", "")
+		if err != nil {
+			return m.errno(err)
+		}
+		delete(m.scratch[dir], name)
+		m.invalidate()
+		return nil
+	}})
+}
+
+func (f *mountScratchFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	size := len(f.sc.data)
+	if h, ok := fh.(*mountHandle); ok {
+		size = h.size()
+	}
+	fileAttr(&out.Attr, 0644, size, f.sc.modified)
+	return 0
+}
+
+func (f *mountScratchFile) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	errno := setattr(fh, in, func(size uint64) syscall.Errno {
+		f.fs.mu.Lock()
+		defer f.fs.mu.Unlock()
+		if size > uint64(len(f.sc.data)) {
+			f.sc.data = append(f.sc.data, make([]byte, size-uint64(len(f.sc.data)))...)
+		}
+		f.sc.data = f.sc.data[:size]
+		f.fs.truncateHandles(f.sc.ino, size)
+		return 0
+	})
+	if errno != 0 {
+		return errno
+	}
+	return f.Getattr(ctx, fh, out)
+}
+
+func (f *mountScratchFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	h := f.fs.scratchHandle(f.dir, f.name, f.sc, append([]byte(nil), f.sc.data...))
+	if flags&syscall.O_TRUNC != 0 {
+		h.data, h.dirty = nil, true
+	}
+	return h, 0, 0
+}
+
+// Note directories
+
+// mountNoteDir holds the notes under note id, or the top level notes if id
+// is 0
+type mountNoteDir struct {
+	fs.Inode
+	fs *mountFS
+	id int
+}
+
+var (
+	_ fs.NodeLookuper  = (*mountNoteDir)(nil)
+	_ fs.NodeReaddirer = (*mountNoteDir)(nil)
+	_ fs.NodeCreater   = (*mountNoteDir)(nil)
+	_ fs.NodeMkdirer   = (*mountNoteDir)(nil)
+	_ fs.NodeUnlinker  = (*mountNoteDir)(nil)
+	_ fs.NodeRmdirer   = (*mountNoteDir)(nil)
+	_ fs.NodeRenamer   = (*mountNoteDir)(nil)
+)
+
+func (d *mountNoteDir) key() string {
+	return fmt.Sprintf("notes/%d", d.id)
+}
+
+func (d *mountNoteDir) children(s *mountSnapshot) map[string]int {
+	ids := s.roots
+	if d.id != 0 {
+		ids = s.notes[d.id].Children
+	}
+	return fileNames(ids, func(id int) string { return s.notes[id].Title })
+}
+
+func (d *mountNoteDir) noteFiles(s *mountSnapshot) map[string]int {
+	files := map[string]int{}
+	if _, ok := s.notes[d.id]; d.id != 0 && !ok {
+		return files
+	}
+	for name, id := range d.children(s) {
+		name += ".md"
+		if _, detached := d.fs.detached[d.key()][name]; !detached {
+			files[name] = id
+		}
+	}
+	return files
+}
+
+// subdirs are the children that have children of their own or were given
+// a directory with mkdir
+func (d *mountNoteDir) subdirs(s *mountSnapshot) map[string]int {
+	dirs := map[string]int{}
+	if _, ok := s.notes[d.id]; d.id != 0 && !ok {
+		return dirs
+	}
+	for name, id := range d.children(s) {
+		if len(s.notes[id].Children) > 0 || d.fs.dirs[id] {
+			dirs[name] = id
+		}
+	}
+	return dirs
+}
+
+func (d *mountNoteDir) createNote(title, content string) (int, error) {
+	id, err := d.fs.client.CreateNote(d.fs.ctx, client.NewNote{Title: title, Content: content})
+	if err != nil || d.id == 0 {
+		return id, err
+	}
+	err = d.fs.client.AddNoteHierarchyEntry(d.fs.ctx, client.NoteHierarchyEntry{ParentNoteID: d.id, ChildNoteID: id, HierarchyType: "subpage"})
+	return id, err
+}
+
+func (d *mountNoteDir) dirInode(ctx context.Context, s *mountSnapshot, id int, out *fuse.EntryOut) *fs.Inode {
+	dirAttr(&out.Attr, s.notes[id].Modified)
+	return d.NewInode(ctx, &mountNoteDir{fs: d.fs, id: id}, fs.StableAttr{Mode: syscall.S_IFDIR, Ino: mountIno(mountKindNoteDir, id)})
+}
+
+func (d *mountNoteDir) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	modified := s.loaded
+	if n, ok := s.notes[d.id]; ok {
+		modified = n.Modified
+	}
+	dirAttr(&out.Attr, modified)
+	return 0
+}
+
+func (d *mountNoteDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	if node, ok := d.fs.lookupFile(ctx, d, s, name, out); ok {
+		return node, 0
+	}
+	if id, ok := d.subdirs(s)[name]; ok {
+		return d.dirInode(ctx, s, id, out), 0
+	}
+	return nil, syscall.ENOENT
+}
+
+func (d *mountNoteDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	entries := d.fs.fileEntries(d, s)
+	for name, id := range d.subdirs(s) {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFDIR, Ino: mountIno(mountKindNoteDir, id)})
+	}
+	return sortedStream(entries), 0
+}
+
+func (d *mountNoteDir) Create(ctx context.Context, name string, flags, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.fs.create(ctx, d, name, out)
+}
+
+// Mkdir gives the note of that title a directory, creating the note if
+// there is none
+func (d *mountNoteDir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	if _, exists := d.subdirs(s)[name]; exists {
+		return nil, syscall.EEXIST
+	}
+	id, ok := d.children(s)[name]
+	if !ok {
+		if id, err = d.createNote(name, ""); err != nil {
+			return nil, d.fs.errno(err)
+		}
+		d.fs.invalidate()
+		if s, err = d.fs.snapshot(); err != nil {
+			return nil, d.fs.errno(err)
+		}
+	}
+	d.fs.dirs[id] = true
+	return d.dirInode(ctx, s, id, out), 0
+}
+
+func (d *mountNoteDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if d.fs.unlinkScratch(d, name) {
+		return 0
+	}
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	id, ok := d.noteFiles(s)[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	err = d.fs.client.DeleteNote(d.fs.ctx, id)
+	d.fs.invalidate()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	delete(d.fs.dirs, id)
+	return 0
+}
+
+// Rmdir removes the directory of a note without children, the note stays
+func (d *mountNoteDir) Rmdir(ctx context.Context, name string) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	id, ok := d.subdirs(s)[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	if len(s.notes[id].Children) > 0 || len(d.fs.scratch[(&mountNoteDir{id: id}).key()]) > 0 {
+		return syscall.ENOTEMPTY
+	}
+	delete(d.fs.dirs, id)
+	return 0
+}
+
+func (d *mountNoteDir) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+
+	dst, ok := newParent.(mountDir)
+	if !ok {
+		return syscall.EXDEV
+	}
+	if errno, handled := d.fs.renameFile(d, name, dst, newName, flags); handled {
+		return errno
+	}
+
+	// Moving or renaming the directory of a note moves or renames the note
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	id, ok := d.subdirs(s)[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	dstDir, ok := dst.(*mountNoteDir)
+	if !ok {
+		return syscall.EXDEV
+	}
+	if isNoteFile(newName) {
+		return syscall.EINVAL
+	}
+	if other, exists := dstDir.children(s)[newName]; exists && other != id {
+		return syscall.EEXIST
+	}
+	if err := d.fs.moveNote(s, id, dstDir.id); err != nil {
+		return d.fs.errno(err)
+	}
+	if err := d.fs.renameNote(s, id, newName); err != nil {
+		return d.fs.errno(err)
+	}
+	return 0
+}
+
+// Tags
+
+// mountTagDir holds the subtags and notes of tag id, or the top level tags
+// if id is 0
+type mountTagDir struct {
+	fs.Inode
+	fs *mountFS
+	id int
+}
+
+var (
+	_ fs.NodeLookuper  = (*mountTagDir)(nil)
+	_ fs.NodeReaddirer = (*mountTagDir)(nil)
+	_ fs.NodeCreater   = (*mountTagDir)(nil)
+	_ fs.NodeMkdirer   = (*mountTagDir)(nil)
+	_ fs.NodeLinker    = (*mountTagDir)(nil)
+	_ fs.NodeUnlinker  = (*mountTagDir)(nil)
+	_ fs.NodeRmdirer   = (*mountTagDir)(nil)
+	_ fs.NodeRenamer   = (*mountTagDir)(nil)
+)
+
+func (d *mountTagDir) key() string {
+	return fmt.Sprintf("tags/%d", d.id)
+}
+
+func (d *mountTagDir) noteFiles(s *mountSnapshot) map[string]int {
+	files := map[string]int{}
+	tag, ok := s.tags[d.id]
+	if !ok {
+		return files
+	}
+	for name, id := range fileNames(tag.Notes, func(id int) string { return s.notes[id].Title }) {
+		name += ".md"
+		if _, detached := d.fs.detached[d.key()][name]; !detached {
+			files[name] = id
+		}
+	}
+	return files
+}
+
+func (d *mountTagDir) subtags(s *mountSnapshot) map[string]int {
+	ids := s.tagRoots
+	if tag, ok := s.tags[d.id]; ok {
+		ids = tag.Children
+	} else if d.id != 0 {
+		return map[string]int{}
+	}
+	return fileNames(ids, func(id int) string { return s.tags[id].Name })
+}
+
+// createNote creates a top level note with this tag
+func (d *mountTagDir) createNote(title, content string) (int, error) {
+	if d.id == 0 {
+		return 0, syscall.EPERM
+	}
+	id, err := d.fs.client.CreateNote(d.fs.ctx, client.NewNote{Title: title, Content: content})
+	if err != nil {
+		return id, err
+	}
+	return id, d.fs.client.TagNote(d.fs.ctx, id, d.id)
+}
+
+func (d *mountTagDir) dirInode(ctx context.Context, s *mountSnapshot, id int, out *fuse.EntryOut) *fs.Inode {
+	dirAttr(&out.Attr, s.loaded)
+	return d.NewInode(ctx, &mountTagDir{fs: d.fs, id: id}, fs.StableAttr{Mode: syscall.S_IFDIR, Ino: mountIno(mountKindTagDir, id)})
+}
+
+func (d *mountTagDir) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	dirAttr(&out.Attr, time.Now())
+	return 0
+}
+
+func (d *mountTagDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	if node, ok := d.fs.lookupFile(ctx, d, s, name, out); ok {
+		return node, 0
+	}
+	if id, ok := d.subtags(s)[name]; ok {
+		return d.dirInode(ctx, s, id, out), 0
+	}
+	return nil, syscall.ENOENT
+}
+
+func (d *mountTagDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	entries := d.fs.fileEntries(d, s)
+	for name, id := range d.subtags(s) {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFDIR, Ino: mountIno(mountKindTagDir, id)})
+	}
+	return sortedStream(entries), 0
+}
+
+func (d *mountTagDir) Create(ctx context.Context, name string, flags, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	return d.fs.create(ctx, d, name, out)
+}
+
+// Mkdir creates a tag under this one
+func (d *mountTagDir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	id, err := d.fs.client.CreateTag(d.fs.ctx, name)
+	if err == nil && d.id != 0 {
+		err = d.fs.client.AddTagHierarchyEntry(d.fs.ctx, d.id, id)
+	}
+	d.fs.invalidate()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	return d.dirInode(ctx, s, id, out), 0
+}
+
+// Link tags a note
+func (d *mountTagDir) Link(ctx context.Context, target fs.InodeEmbedder, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	note, ok := target.(*mountNoteFile)
+	if !ok || d.id == 0 {
+		return nil, syscall.EPERM
+	}
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	err := d.fs.client.TagNote(d.fs.ctx, note.id, d.id)
+	d.fs.invalidate()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	return d.fs.noteFileInode(ctx, d.EmbeddedInode(), s, note.id, out), 0
+}
+
+// Unlink only removes scratch files, the API can't remove a tag from a
+// note
+func (d *mountTagDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if d.fs.unlinkScratch(d, name) {
+		return 0
+	}
+	return syscall.EPERM
+}
+
+// Rmdir deletes a tag without subtags or notes
+func (d *mountTagDir) Rmdir(ctx context.Context, name string) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	id, ok := d.subtags(s)[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	if tag := s.tags[id]; len(tag.Children) > 0 || len(tag.Notes) > 0 {
+		return syscall.ENOTEMPTY
+	}
+	err = d.fs.client.DeleteTag(d.fs.ctx, id)
+	d.fs.invalidate()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	return 0
+}
+
+// Rename renames and moves tags, and note and scratch files within a tag
+func (d *mountTagDir) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+
+	dst, ok := newParent.(mountDir)
+	if !ok {
+		return syscall.EXDEV
+	}
+	if errno, handled := d.fs.renameFile(d, name, dst, newName, flags); handled {
+		return errno
+	}
+
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	id, ok := d.subtags(s)[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	dstDir, ok := dst.(*mountTagDir)
+	if !ok {
+		return syscall.EXDEV
+	}
+	if other, exists := dstDir.subtags(s)[newName]; exists && other != id {
+		return syscall.EEXIST
+	}
+
+	tag := s.tags[id]
+	switch {
+	case tag.Parent == dstDir.id:
+	case dstDir.id == 0:
+		err = d.fs.client.DeleteTagHierarchyEntry(d.fs.ctx, id)
+	case tag.Parent == 0:
+		err = d.fs.client.AddTagHierarchyEntry(d.fs.ctx, dstDir.id, id)
+	default:
+		err = d.fs.client.UpdateTagHierarchyEntry(d.fs.ctx, id, dstDir.id)
+	}
+	if err == nil && fileName(tag.Name) != newName {
+		err = d.fs.client.RenameTag(d.fs.ctx, id, newName)
+	}
+	d.fs.invalidate()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	return 0
+}
+
+// Assets
+
+const mountAssetsKey = "assets"
+
+type mountAssetsDir struct {
+	fs.Inode
+	fs *mountFS
+}
+
+var (
+	_ fs.NodeLookuper  = (*mountAssetsDir)(nil)
+	_ fs.NodeReaddirer = (*mountAssetsDir)(nil)
+	_ fs.NodeCreater   = (*mountAssetsDir)(nil)
+	_ fs.NodeUnlinker  = (*mountAssetsDir)(nil)
+)
+
+func (d *mountAssetsDir) files(s *mountSnapshot) map[string]int {
+	ids := make([]int, 0, len(s.assets))
+	for id := range s.assets {
+		ids = append(ids, id)
+	}
+	return fileNames(ids, func(id int) string { return filepath.Base(s.assets[id].FileName) })
+}
+
+func (d *mountAssetsDir) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	dirAttr(&out.Attr, time.Now())
+	return 0
+}
+
+func (d *mountAssetsDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	if sc, ok := d.fs.scratch[mountAssetsKey][name]; ok {
+		return d.fs.scratchInode(ctx, d.EmbeddedInode(), mountAssetsKey, name, sc, out), 0
+	}
+	id, ok := d.files(s)[name]
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+	fileAttr(&out.Attr, 0444, d.fs.sizes[id], assetTime(s.assets[id]))
+	return d.NewInode(ctx, &mountAsset{fs: d.fs, id: id}, fs.StableAttr{Mode: syscall.S_IFREG, Ino: mountIno(mountKindAsset, id)}), 0
+}
+
+func (d *mountAssetsDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, d.fs.errno(err)
+	}
+	var entries []fuse.DirEntry
+	for name, id := range d.files(s) {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFREG, Ino: mountIno(mountKindAsset, id)})
+	}
+	for name, sc := range d.fs.scratch[mountAssetsKey] {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: syscall.S_IFREG, Ino: sc.ino})
+	}
+	return sortedStream(entries), 0
+}
+
+// Create starts an upload, which is sent when the file is closed
+func (d *mountAssetsDir) Create(ctx context.Context, name string, flags, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return nil, nil, 0, d.fs.errno(err)
+	}
+	if _, exists := d.files(s)[name]; exists {
+		return nil, nil, 0, syscall.EEXIST
+	}
+	sc := &mountScratch{ino: d.fs.newIno(), modified: time.Now()}
+	if d.fs.scratch[mountAssetsKey] == nil {
+		d.fs.scratch[mountAssetsKey] = map[string]*mountScratch{}
+	}
+	d.fs.scratch[mountAssetsKey][name] = sc
+	node := d.fs.scratchInode(ctx, d.EmbeddedInode(), mountAssetsKey, name, sc, out)
+	h := d.fs.scratchHandle(mountAssetsKey, name, sc, nil)
+	// Upload even if nothing is written
+	h.dirty = true
+	return node, h, 0, 0
+}
+
+func (d *mountAssetsDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	d.fs.mu.Lock()
+	defer d.fs.mu.Unlock()
+	if _, ok := d.fs.scratch[mountAssetsKey][name]; ok {
+		delete(d.fs.scratch[mountAssetsKey], name)
+		return 0
+	}
+	s, err := d.fs.snapshot()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	id, ok := d.files(s)[name]
+	if !ok {
+		return syscall.ENOENT
+	}
+	err = d.fs.client.DeleteAsset(d.fs.ctx, id)
+	d.fs.invalidate()
+	if err != nil {
+		return d.fs.errno(err)
+	}
+	return 0
+}
+
+// mountAsset is an uploaded file, read only as assets can't be updated
+type mountAsset struct {
+	fs.Inode
+	fs *mountFS
+	id int
+}
+
+var (
+	_ fs.NodeGetattrer = (*mountAsset)(nil)
+	_ fs.NodeOpener    = (*mountAsset)(nil)
+)
+
+func assetTime(a client.FileInfo) time.Time {
+	t, _ := time.Parse(time.RFC3339, a.CreatedAt)
+	return t
+}
+
+func (a *mountAsset) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	a.fs.mu.Lock()
+	defer a.fs.mu.Unlock()
+	s, err := a.fs.snapshot()
+	if err != nil {
+		return a.fs.errno(err)
+	}
+	info, ok := s.assets[a.id]
+	if !ok {
+		return syscall.ENOENT
+	}
+	// The size is only known once the asset has been downloaded
+	fileAttr(&out.Attr, 0444, a.fs.sizes[a.id], assetTime(info))
+	return 0
+}
+
+// Open downloads the asset. Reads bypass the page cache, as the size
+// reported before the first download is 0.
+func (a *mountAsset) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		return nil, 0, syscall.EPERM
+	}
+	var buf strings.Builder
+	if err := a.fs.client.DownloadAsset(a.fs.ctx, a.id, &buf); err != nil {
+		a.fs.mu.Lock()
+		defer a.fs.mu.Unlock()
+		return nil, 0, a.fs.errno(err)
+	}
+	a.fs.mu.Lock()
+	a.fs.sizes[a.id] = buf.Len()
+	a.fs.mu.Unlock()
+	return &mountHandle{data: []byte(buf.String())}, fuse.FOPEN_DIRECT_IO, 0
+}
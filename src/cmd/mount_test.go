@@ -0,0 +1,107 @@
+//go:build linux || darwin
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"draftsmith/src/client"
+)
+
+func TestMountHandleFlushRetries(t *testing.T) {
+	var saved []string
+	fail := true
+	h := &mountHandle{save: func(data []byte) error {
+		if fail {
+			return errors.New("server unavailable")
+		}
+		saved = append(saved, string(data))
+		return nil
+	}}
+	h.Write(context.Background(), []byte("draft"), 0)
+
+	if errno := h.Flush(context.Background()); errno != syscall.EIO {
+		t.Fatalf("failed save: got %v, want EIO", errno)
+	}
+	// The data is saved once the server is back, and only once
+	fail = false
+	for i := 0; i < 2; i++ {
+		if errno := h.Fsync(context.Background(), 0); errno != 0 {
+			t.Fatalf("fsync: got %v", errno)
+		}
+	}
+	if fmt.Sprint(saved) != "[draft]" {
+		t.Errorf("saved %q, want the draft once", saved)
+	}
+}
+
+func TestMount(t *testing.T) {
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skipf("no FUSE: %v", err)
+	}
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		var note MessageResponse
+		api.do("POST", "/notes", NewNote{Title: "Mounted", Content: "Before"}, http.StatusCreated, &note)
+
+		dir := t.TempDir()
+		server, err := mountServer(context.Background(), client.New(api.url), dir, false, false)
+		if err != nil {
+			t.Skipf("can't mount: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := server.Unmount(); err != nil {
+				t.Errorf("unmount: %v", err)
+			}
+		})
+
+		// Writing a note file updates the note when it is closed
+		path := filepath.Join(dir, "notes", "Mounted.md")
+		if data, err := os.ReadFile(path); err != nil || string(data) != "Before" {
+			t.Fatalf("reading the note: got %q, %v", data, err)
+		}
+		if err := os.WriteFile(path, []byte("After"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		var got Note
+		api.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil, http.StatusOK, &got)
+		if got.Content != "After" {
+			t.Errorf("note content: got %q, want After", got.Content)
+		}
+
+		// A new .md file is a new note, other files stay in memory
+		if err := os.WriteFile(filepath.Join(dir, "notes", "Created.md"), []byte("New"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "notes", ".Created.md.swp"), []byte("swap"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		swap := filepath.Join(dir, "notes", ".Created.md.swp")
+		if err := os.WriteFile(swap, []byte("s"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if data, err := os.ReadFile(swap); err != nil || string(data) != "s" {
+			t.Errorf("rewritten swap file: got %q, %v", data, err)
+		}
+		var notes []NoteSummary
+		api.do("GET", "/notes/no-content", nil, http.StatusOK, &notes)
+		var created int
+		for _, n := range notes {
+			if n.Title == "Created" {
+				created++
+			}
+			if n.Title == ".Created.md.swp" {
+				t.Errorf("the swap file was saved as note %d", n.ID)
+			}
+		}
+		if created != 1 {
+			t.Errorf("got %d notes titled Created, want one", created)
+		}
+	})
+}
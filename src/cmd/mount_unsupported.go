@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+var mountCmd = &cobra.Command{
+	Use:   "mount DIR",
+	Short: "Mount the notes, tags and assets of a server as a filesystem",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fmt.Errorf("mount needs FUSE, which isn't supported on %s", runtime.GOOS)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mountCmd)
+}
@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Next actions
+//
+// Open, unblocked tasks are ranked by a weighted sum of four factors, each
+// scaled to between 0 and 1:
+//
+//   - urgency: 0 without a deadline or a deadline beyond the horizon,
+//     rising linearly to 1 at the deadline, overdue tasks score 1
+//   - priority: 1 for priority 1 down to 0 for priority 5 (or none)
+//   - goal: 1 for goal_relationship 5 down to 0 for 1 (or none)
+//   - effort: 1/(1+h) where h is the estimated hours still remaining, so
+//     quick tasks rank higher, 0 without an estimate
+//
+// The weights and horizon default to the scoring settings in the config
+// file and can be overridden per request.
+
+var scoringFactors = []string{"urgency", "priority", "goal", "effort"}
+
+// scoringConfig is the weight of each factor and the urgency horizon
+type scoringConfig struct {
+	Weights     map[string]float64
+	HorizonDays float64
+}
+
+// ScoreFactor is one factor's contribution to a task's score
+type ScoreFactor struct {
+	Value  float64 `json:"value"`
+	Weight float64 `json:"weight"`
+	Score  float64 `json:"score"`
+}
+
+// NextTask is a ranked task with the breakdown of its score.
+// RemainingHours is null for tasks without an estimate.
+type NextTask struct {
+	ID               int                    `json:"id"`
+	NoteID           int                    `json:"note_id"`
+	Title            string                 `json:"title"`
+	Status           string                 `json:"status"`
+	Tags             []string               `json:"tags"`
+	Priority         int                    `json:"priority,omitempty"`
+	GoalRelationship int                    `json:"goal_relationship,omitempty"`
+	Deadline         *time.Time             `json:"deadline,omitempty"`
+	RemainingHours   *float64               `json:"remaining_hours"`
+	Score            float64                `json:"score"`
+	Breakdown        map[string]ScoreFactor `json:"breakdown"`
+}
+
+// nextCandidate is an open task as loaded from the database
+type nextCandidate struct {
+	NextTask
+	AllDay bool
+}
+
+// defaultScoringConfig reads the scoring settings
+func defaultScoringConfig() scoringConfig {
+	config := scoringConfig{
+		Weights:     make(map[string]float64),
+		HorizonDays: viper.GetFloat64("scoring.horizon_days"),
+	}
+	for _, factor := range scoringFactors {
+		config.Weights[factor] = viper.GetFloat64("scoring." + factor)
+	}
+	return config
+}
+
+// parseScoringConfig applies the weights (urgency:3,effort:0) and horizon
+// query parameters to the configured scoring
+func parseScoringConfig(r *http.Request) (scoringConfig, error) {
+	config := defaultScoringConfig()
+	q := r.URL.Query()
+
+	if s := q.Get("weights"); s != "" {
+		for _, pair := range strings.Split(s, ",") {
+			parts := strings.SplitN(pair, ":", 2)
+			if len(parts) != 2 {
+				return config, fmt.Errorf("invalid weight %q, expected factor:weight", pair)
+			}
+			if _, ok := config.Weights[parts[0]]; !ok {
+				return config, fmt.Errorf("unknown factor %q, expected one of %s", parts[0], strings.Join(scoringFactors, ", "))
+			}
+			weight, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil {
+				return config, fmt.Errorf("invalid weight for %s", parts[0])
+			}
+			config.Weights[parts[0]] = weight
+		}
+	}
+
+	if s := q.Get("horizon"); s != "" {
+		days, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return config, fmt.Errorf("invalid horizon, expected a number of days")
+		}
+		config.HorizonDays = days
+	}
+	if config.HorizonDays <= 0 {
+		return config, fmt.Errorf("horizon must be positive")
+	}
+	return config, nil
+}
+
+// scoreTask fills in the score and breakdown of a task, all-day deadlines
+// fall due at the end of their day in loc
+func scoreTask(t *nextCandidate, config scoringConfig, now time.Time, loc *time.Location) {
+	values := make(map[string]float64)
+
+	if t.Deadline != nil {
+		due := *t.Deadline
+		if t.AllDay {
+			due = floatingDate(due, loc).AddDate(0, 0, 1)
+		}
+		left := due.Sub(now).Hours() / 24
+		values["urgency"] = math.Max(0, math.Min(1, 1-left/config.HorizonDays))
+	}
+	if t.Priority >= 1 && t.Priority <= 5 {
+		values["priority"] = float64(5-t.Priority) / 4
+	}
+	if t.GoalRelationship >= 1 && t.GoalRelationship <= 5 {
+		values["goal"] = float64(t.GoalRelationship-1) / 4
+	}
+	if t.RemainingHours != nil {
+		values["effort"] = 1 / (1 + *t.RemainingHours)
+	}
+
+	t.Score = 0
+	t.Breakdown = make(map[string]ScoreFactor)
+	for _, factor := range scoringFactors {
+		f := ScoreFactor{
+			Value:  math.Round(values[factor]*1000) / 1000,
+			Weight: config.Weights[factor],
+		}
+		f.Score = math.Round(values[factor]*f.Weight*1000) / 1000
+		t.Score += values[factor] * f.Weight
+		t.Breakdown[factor] = f
+	}
+	t.Score = math.Round(t.Score*1000) / 1000
+}
+
+// loadNextCandidates returns the tasks that are not blocked, along with
+// their inherited tags. Only the given statuses are included, or every open
+// status if none are given.
+func loadNextCandidates(db *sql.DB, g *noteGraph, statuses taskStatusSet, only []string, blockedBy map[int][]int) ([]*nextCandidate, error) {
+	rows, err := db.Query(`
+        SELECT t.id, t.note_id, t.status, COALESCE(t.priority, 0), COALESCE(t.goal_relationship, 0),
+               t.deadline, COALESCE(t.all_day, FALSE), te.effort_estimate, te.actual_effort
+        FROM tasks t
+        JOIN task_efforts te ON te.task_id = t.id
+        ORDER BY t.id
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []*nextCandidate
+	for rows.Next() {
+		t := &nextCandidate{}
+		var deadline sql.NullTime
+		var estimate sql.NullFloat64
+		var actual float64
+		if err := rows.Scan(&t.ID, &t.NoteID, &t.Status, &t.Priority, &t.GoalRelationship,
+			&deadline, &t.AllDay, &estimate, &actual); err != nil {
+			return nil, fmt.Errorf("error scanning task row: %w", err)
+		}
+		if len(only) > 0 && !contains(only, t.Status) || len(only) == 0 && !statuses.IsOpen(t.Status) {
+			continue
+		}
+		if len(blockedBy[t.ID]) > 0 {
+			continue
+		}
+		if deadline.Valid {
+			t.Deadline = &deadline.Time
+		}
+		if estimate.Valid && estimate.Float64 > 0 {
+			remaining := math.Max(0, estimate.Float64-actual)
+			t.RemainingHours = &remaining
+		}
+		t.Title = g.Titles[t.NoteID]
+		t.Tags = g.inheritedTags(t.NoteID)
+		if t.Tags == nil {
+			t.Tags = []string{}
+		}
+		candidates = append(candidates, t)
+	}
+	return candidates, rows.Err()
+}
+
+// rankNextTasks scores the candidates that fit the available minutes (if
+// non-zero) and carry any of the context tags (if given), highest first
+func rankNextTasks(candidates []*nextCandidate, config scoringConfig, minutes float64, tags []string, now time.Time, loc *time.Location) []*NextTask {
+	ranked := []*NextTask{}
+	for _, t := range candidates {
+		if minutes > 0 && (t.RemainingHours == nil || *t.RemainingHours*60 > minutes) {
+			continue
+		}
+		if len(tags) > 0 && !hasAnyTag(t.Tags, tags) {
+			continue
+		}
+		scoreTask(t, config, now, loc)
+		ranked = append(ranked, &t.NextTask)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked
+}
+
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range wanted {
+		if contains(tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func getNextTasks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	config, err := parseScoringConfig(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	var minutes float64
+	if s := q.Get("minutes"); s != "" {
+		minutes, err = strconv.ParseFloat(s, 64)
+		if err != nil || minutes <= 0 {
+			writeError(w, "Invalid minutes, expected a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+	var tags, only []string
+	if s := q.Get("tags"); s != "" {
+		tags = strings.Split(s, ",")
+	}
+	if s := q.Get("status"); s != "" {
+		only = strings.Split(s, ",")
+	}
+	limit := 10
+	if s := q.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			writeError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	graph, err := loadNoteGraph(db)
+	if err != nil {
+		writeServerError(w, "Error loading notes for next tasks", err)
+		return
+	}
+	statuses, _, err := loadTaskStatuses(db)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	_, blockedBy, err := loadTaskDependencies(db)
+	if err != nil {
+		writeServerError(w, "Error loading task dependencies", err)
+		return
+	}
+	candidates, err := loadNextCandidates(db, graph, statuses, only, blockedBy)
+	if err != nil {
+		writeServerError(w, "Error loading tasks for next tasks", err)
+		return
+	}
+
+	ranked := rankNextTasks(candidates, config, minutes, tags, time.Now(), loc)
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ranked)
+}
@@ -0,0 +1,605 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"draftsmith/src/client"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/cobra"
+)
+
+// OpenAPI document
+//
+// apiOperations describes every route registered by newRouter. The OpenAPI
+// 3 document served at /openapi.json is built from it, with the schemas of
+// the request and response types derived from their JSON tags. Running
+// `draftsmith openapi --check` compares the table with the router and the
+// client package and fails if they have drifted apart. The CalDAV routes
+// speak WebDAV rather than JSON and are left out.
+
+// apiParam is a query parameter of an operation
+type apiParam struct {
+	Name        string
+	Type        string // string, integer, number or boolean
+	Description string
+	Required    bool
+}
+
+// apiOperation is a route of the API. Request and Response are values of
+// the body types, nil for none. Text bodies set RequestType or
+// ResponseType to their media type instead.
+type apiOperation struct {
+	Method       string
+	Path         string
+	Tag          string
+	Summary      string
+	Query        []apiParam
+	Request      interface{}
+	RequestType  string
+	Response     interface{}
+	ResponseType string
+	Status       int
+}
+
+// apiUndocumentedPaths are the routes that are not part of the JSON API
+var apiUndocumentedPaths = []string{"/.well-known/caldav", "/caldav", "/caldav/", "/dav", "/dav/"}
+
+// apiPathParamTypes is the type of each path parameter
+var apiPathParamTypes = map[string]string{
+	"id":        "integer",
+	"childId":   "integer",
+	"dependsOn": "integer",
+	"name":      "string",
+	"to":        "string",
+}
+
+var (
+	tzParam       = apiParam{Name: "tz", Type: "string", Description: "Timezone for dates, overrides the X-Timezone header"}
+	fromParam     = apiParam{Name: "from", Type: "string", Description: "Start date (2024-06-01) or RFC 3339 timestamp"}
+	toParam       = apiParam{Name: "to", Type: "string", Description: "End date (inclusive) or RFC 3339 timestamp"}
+	rootParam     = apiParam{Name: "root", Type: "integer", Description: "Only include this note and its descendants"}
+	tagsParam     = apiParam{Name: "tags", Type: "string", Description: "Comma separated tags, any of which must match"}
+	statusesParam = apiParam{Name: "status", Type: "string", Description: "Comma separated statuses"}
+	limitParam    = apiParam{Name: "limit", Type: "integer", Description: "Maximum number of results"}
+	tagParam      = apiParam{Name: "tag", Type: "string", Description: "Only tasks with this tag"}
+)
+
+var apiOperations = []apiOperation{
+	// Notes
+	{Method: "GET", Path: "/notes", Tag: "notes", Summary: "List notes with their content", Response: []Note{}},
+	{Method: "POST", Path: "/notes", Tag: "notes", Summary: "Create a note", Request: NewNote{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/notes/{id}", Tag: "notes", Summary: "Get a note", Response: Note{}},
+	{Method: "PUT", Path: "/notes/{id}", Tag: "notes", Summary: "Update a note", Request: NoteUpdate{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/notes/{id}", Tag: "notes", Summary: "Delete a note", Response: MessageResponse{}},
+	{Method: "GET", Path: "/notes/no-content", Tag: "notes", Summary: "List notes without their content", Response: []NoteSummary{}},
+	{Method: "GET", Path: "/notes/search", Tag: "notes", Summary: "Full text search of notes", Response: []NoteInfo{},
+		Query: []apiParam{{Name: "q", Type: "string", Description: "Search terms", Required: true}}},
+	{Method: "GET", Path: "/notes/tree", Tag: "notes", Summary: "Get the note hierarchy", Response: []*NoteTree{}},
+	{Method: "POST", Path: "/notes/hierarchy", Tag: "notes", Summary: "Add a note to the hierarchy", Request: NoteHierarchyEntry{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/notes/hierarchy/{childId}", Tag: "notes", Summary: "Move a note in the hierarchy", Request: NoteHierarchyEntry{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/notes/hierarchy/{childId}", Tag: "notes", Summary: "Remove a note from the hierarchy", Response: MessageResponse{}},
+	{Method: "POST", Path: "/notes/{id}/tags", Tag: "notes", Summary: "Tag a note", Request: AddTagToNote{}, Response: MessageResponse{}},
+
+	// Tags
+	{Method: "GET", Path: "/tags", Tag: "tags", Summary: "List tags", Response: []Tag{}},
+	{Method: "POST", Path: "/tags", Tag: "tags", Summary: "Create a tag", Request: NewTag{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/tags/{id}", Tag: "tags", Summary: "Rename a tag", Request: UpdateTagRequest{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/tags/{id}", Tag: "tags", Summary: "Delete a tag", Response: MessageResponse{}},
+	{Method: "GET", Path: "/tags/tree", Tag: "tags", Summary: "Get the tag hierarchy with the notes of each tag", Response: []*TagTree{}},
+	{Method: "GET", Path: "/tags/with-notes", Tag: "tags", Summary: "List tags with their notes", Response: []TagWithNotes{}},
+	{Method: "POST", Path: "/tags/hierarchy", Tag: "tags", Summary: "Add a tag to the hierarchy", Request: TagHierarchyEntry{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/tags/hierarchy/{childId}", Tag: "tags", Summary: "Move a tag in the hierarchy", Request: UpdateTagHierarchyEntry{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/tags/hierarchy/{childId}", Tag: "tags", Summary: "Remove a tag from the hierarchy", Response: MessageResponse{}},
+
+	// Categories
+	{Method: "GET", Path: "/categories", Tag: "categories", Summary: "List categories", Response: []Category{}},
+	{Method: "POST", Path: "/categories", Tag: "categories", Summary: "Create a category", Request: NewCategory{}, Response: MessageResponse{}, Status: http.StatusCreated},
+
+	// Tasks
+	{Method: "POST", Path: "/tasks", Tag: "tasks", Summary: "Create a task", Request: NewTask{}, Response: MessageResponse{}, Status: http.StatusCreated,
+		Query: []apiParam{tzParam}},
+	{Method: "PUT", Path: "/tasks/{id}", Tag: "tasks", Summary: "Update a task", Request: UpdateTask{}, Response: TaskUpdateResponse{},
+		Query: []apiParam{tzParam}},
+	{Method: "DELETE", Path: "/tasks/{id}", Tag: "tasks", Summary: "Delete a task", Response: MessageResponse{}},
+	{Method: "GET", Path: "/tasks/details", Tag: "tasks", Summary: "List tasks with their schedules and clocks", Response: []TaskWithDetails{}},
+	{Method: "GET", Path: "/tasks/tree", Tag: "tasks", Summary: "Get the note hierarchy containing tasks", Response: []*NoteTree{}},
+	{Method: "GET", Path: "/tasks/actionable", Tag: "tasks", Summary: "List open tasks that are not blocked", Response: []*TaskWithDetails{}},
+	{Method: "GET", Path: "/tasks/next", Tag: "tasks", Summary: "Rank the next actions", Response: []*NextTask{},
+		Query: []apiParam{
+			{Name: "minutes", Type: "number", Description: "Only tasks that fit in this many minutes"},
+			tagsParam, statusesParam, limitParam, tzParam,
+			{Name: "weights", Type: "string", Description: "Scoring weights such as urgency:3,effort:0"},
+			{Name: "horizon", Type: "number", Description: "Urgency horizon in days"},
+		}},
+	{Method: "GET", Path: "/tasks/{id}/completions", Tag: "tasks", Summary: "List the completions of a recurring task", Response: []TaskCompletion{}},
+	{Method: "GET", Path: "/tasks/{id}/status_changes", Tag: "tasks", Summary: "List the status changes of a task", Response: []TaskStatusChange{}},
+	{Method: "GET", Path: "/tasks/{id}/history", Tag: "tasks", Summary: "List the field changes of a task", Response: []TaskHistoryEntry{},
+		Query: []apiParam{{Name: "field", Type: "string", Description: "Only changes to this field"}}},
+	{Method: "GET", Path: "/tasks/{id}/dependencies", Tag: "tasks", Summary: "List the prerequisites of a task", Response: []TaskDependency{}},
+	{Method: "POST", Path: "/tasks/{id}/dependencies", Tag: "tasks", Summary: "Add a prerequisite to a task", Request: NewTaskDependency{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/tasks/{id}/dependencies/{dependsOn}", Tag: "tasks", Summary: "Remove a prerequisite from a task", Response: MessageResponse{}},
+
+	// Task statuses
+	{Method: "GET", Path: "/task_statuses", Tag: "statuses", Summary: "List task statuses and their transitions", Response: []*TaskStatus{}},
+	{Method: "POST", Path: "/task_statuses", Tag: "statuses", Summary: "Create a task status", Request: NewTaskStatus{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/task_statuses/{name}", Tag: "statuses", Summary: "Update a task status", Request: UpdateTaskStatus{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/task_statuses/{name}", Tag: "statuses", Summary: "Delete a task status", Response: MessageResponse{}},
+	{Method: "POST", Path: "/task_statuses/{name}/transitions", Tag: "statuses", Summary: "Allow a status change", Request: NewStatusTransition{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/task_statuses/{name}/transitions/{to}", Tag: "statuses", Summary: "Disallow a status change", Response: MessageResponse{}},
+
+	// Schedules and clocks
+	{Method: "POST", Path: "/task_schedules", Tag: "schedules", Summary: "Schedule a task", Request: NewTaskSchedule{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/task_schedules/{id}", Tag: "schedules", Summary: "Update a schedule", Request: UpdateTaskSchedule{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/task_schedules/{id}", Tag: "schedules", Summary: "Delete a schedule", Response: MessageResponse{}},
+	{Method: "POST", Path: "/task_clocks", Tag: "clock", Summary: "Add a clock entry", Request: NewTaskClock{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/task_clocks/{id}", Tag: "clock", Summary: "Update a clock entry", Request: UpdateTaskClock{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/task_clocks/{id}", Tag: "clock", Summary: "Delete a clock entry", Response: MessageResponse{}},
+	{Method: "POST", Path: "/tasks/{id}/clock/start", Tag: "clock", Summary: "Start the clock on a task", Response: ClockResponse{}, Status: http.StatusCreated},
+	{Method: "POST", Path: "/tasks/{id}/clock/stop", Tag: "clock", Summary: "Stop the clock on a task", Response: ClockResponse{}},
+	{Method: "GET", Path: "/clock/current", Tag: "clock", Summary: "Get the running clock", Response: RunningClock{}},
+
+	// Planning
+	{Method: "GET", Path: "/agenda", Tag: "planning", Summary: "Get the agenda", Response: Agenda{},
+		Query: []apiParam{fromParam, toParam, tzParam, statusesParam, tagParam, rootParam}},
+	{Method: "GET", Path: "/board", Tag: "planning", Summary: "Get the kanban board", Response: Board{},
+		Query: []apiParam{rootParam, tagsParam}},
+	{Method: "POST", Path: "/board/move", Tag: "planning", Summary: "Move a task on the board", Request: BoardMove{}, Response: TaskUpdateResponse{},
+		Query: []apiParam{tzParam}},
+
+	// Reminders
+	{Method: "GET", Path: "/reminders", Tag: "reminders", Summary: "List sent reminders", Response: []SentReminder{},
+		Query: []apiParam{limitParam, {Name: "task_id", Type: "integer", Description: "Only reminders for this task"}}},
+	{Method: "GET", Path: "/reminders/events", Tag: "reminders", Summary: "Stream reminders as server-sent events", ResponseType: "text/event-stream"},
+	{Method: "GET", Path: "/reminders/rules", Tag: "reminders", Summary: "List reminder rules", Response: []*ReminderRule{}},
+	{Method: "POST", Path: "/reminders/rules", Tag: "reminders", Summary: "Create a reminder rule", Request: NewReminderRule{}, Response: MessageResponse{}, Status: http.StatusCreated},
+	{Method: "PUT", Path: "/reminders/rules/{id}", Tag: "reminders", Summary: "Update a reminder rule", Request: UpdateReminderRule{}, Response: MessageResponse{}},
+	{Method: "DELETE", Path: "/reminders/rules/{id}", Tag: "reminders", Summary: "Delete a reminder rule", Response: MessageResponse{}},
+
+	// Reports
+	{Method: "GET", Path: "/reports/clock", Tag: "reports", Summary: "Report clocked time, as JSON, CSV or an org clocktable", Response: ClockReport{},
+		Query: []apiParam{fromParam, toParam, tzParam,
+			{Name: "group_by", Type: "string", Description: "day, week, tag or note"},
+			{Name: "format", Type: "string", Description: "json, csv or org"}}},
+	{Method: "GET", Path: "/reports/effort", Tag: "reports", Summary: "Report estimated and actual effort", Response: EffortReport{},
+		Query: []apiParam{rootParam, statusesParam}},
+	{Method: "GET", Path: "/reports/cycle_time", Tag: "reports", Summary: "Report the time tasks take between two statuses", Response: CycleTimeReport{},
+		Query: []apiParam{fromParam, toParam, tzParam,
+			{Name: "from_status", Type: "string", Description: "Status the cycle starts in"},
+			{Name: "to_status", Type: "string", Description: "Status the cycle ends in"}}},
+	{Method: "GET", Path: "/reports/deadline_pushbacks", Tag: "reports", Summary: "Report how often deadlines were pushed back", Response: []*DeadlinePushbacks{},
+		Query: []apiParam{fromParam, toParam, tzParam}},
+
+	// Assets
+	{Method: "GET", Path: "/assets", Tag: "assets", Summary: "List assets", Response: []FileInfo{}},
+	{Method: "POST", Path: "/upload", Tag: "assets", Summary: "Upload an asset", RequestType: "multipart/form-data", Response: UploadResponse{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/assets/id", Tag: "assets", Summary: "Find the ID of an asset by file name", Response: AssetIDResponse{},
+		Query: []apiParam{{Name: "filename", Type: "string", Description: "File name of the asset", Required: true}}},
+	{Method: "GET", Path: "/assets/{id}/download", Tag: "assets", Summary: "Download an asset", ResponseType: "application/octet-stream"},
+	{Method: "DELETE", Path: "/assets/{id}", Tag: "assets", Summary: "Delete an asset", Response: MessageResponse{}},
+
+	// Import and export
+	{Method: "POST", Path: "/import/org", Tag: "exchange", Summary: "Import an org document", RequestType: "text/plain", Response: OrgImportResponse{}, Status: http.StatusCreated,
+		Query: []apiParam{{Name: "parent", Type: "integer", Description: "Note to import under"}, tzParam}},
+	{Method: "GET", Path: "/export/org", Tag: "exchange", Summary: "Export notes as an org document", ResponseType: "text/plain",
+		Query: []apiParam{rootParam, tzParam}},
+	{Method: "POST", Path: "/import/ics", Tag: "exchange", Summary: "Import an iCalendar file", RequestType: "text/calendar", Response: CalendarImportResponse{},
+		Query: []apiParam{tzParam}},
+	{Method: "GET", Path: "/calendar.ics", Tag: "exchange", Summary: "Subscribe to the tasks as an iCalendar feed", ResponseType: "text/calendar",
+		Query: []apiParam{statusesParam, rootParam, tagParam}},
+
+	{Method: "GET", Path: "/openapi.json", Tag: "meta", Summary: "Get this document", ResponseType: "application/json"},
+}
+
+// OpenAPIDocument is an OpenAPI 3 document, only the parts used here
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*JSONSchema `json:"schemas"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary"`
+	Tags        []string                    `json:"tags"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIParameter struct {
+	Name        string      `json:"name"`
+	In          string      `json:"in"`
+	Description string      `json:"description,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Schema      *JSONSchema `json:"schema"`
+}
+
+type OpenAPIBody struct {
+	Required bool                     `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMedia `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                   `json:"description"`
+	Content     map[string]*OpenAPIMedia `json:"content,omitempty"`
+}
+
+type OpenAPIMedia struct {
+	Schema *JSONSchema `json:"schema,omitempty"`
+}
+
+// JSONSchema is a schema object of the document
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Nullable             bool                   `json:"nullable,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+// schemaRef is the prefix of references to component schemas
+const schemaRef = "#/components/schemas/"
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	optionalFloatType = reflect.TypeOf(optionalFloat{})
+)
+
+// schemaFor returns the schema of t, named structs are added to schemas
+// and referenced
+func schemaFor(t reflect.Type, schemas map[string]*JSONSchema) *JSONSchema {
+	switch {
+	case t == timeType:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &JSONSchema{}
+	case t == optionalFloatType:
+		return &JSONSchema{Type: "number", Nullable: true}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := schemaFor(t.Elem(), schemas)
+		if s.Ref != "" {
+			return s
+		}
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		if _, ok := schemas[t.Name()]; !ok {
+			schemas[t.Name()] = nil // Placeholder for recursive types
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return &JSONSchema{Ref: schemaRef + t.Name()}
+	}
+	return &JSONSchema{}
+}
+
+// structSchema lists the JSON fields of a struct, fields without omitempty
+// are required
+func structSchema(t reflect.Type, schemas map[string]*JSONSchema) *JSONSchema {
+	s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+	for _, f := range jsonFields(t) {
+		s.Properties[f.Name] = schemaFor(f.Type, schemas)
+		if !f.OmitEmpty && f.Type != optionalFloatType {
+			s.Required = append(s.Required, f.Name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// jsonField is a struct field as encoding/json sees it
+type jsonField struct {
+	Name      string
+	Type      reflect.Type
+	OmitEmpty bool
+}
+
+// jsonFields returns the fields encoding/json would encode, including those
+// of embedded structs
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, jsonFields(ft)...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{Name: name, Type: f.Type, OmitEmpty: strings.Contains(opts, "omitempty")})
+	}
+	return fields
+}
+
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// operationID names an operation after its method and path, e.g.
+// GET /tasks/{id}/history is getTasksIdHistory
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// buildOpenAPI builds the document from apiOperations
+func buildOpenAPI() *OpenAPIDocument {
+	doc := &OpenAPIDocument{
+		OpenAPI:    "3.0.3",
+		Info:       OpenAPIInfo{Title: "Draftsmith", Version: "1.0.0"},
+		Paths:      make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{Schemas: make(map[string]*JSONSchema)},
+	}
+	schemas := doc.Components.Schemas
+	errorSchema := schemaFor(reflect.TypeOf(ErrorResponse{}), schemas)
+
+	for _, op := range apiOperations {
+		o := &OpenAPIOperation{
+			OperationID: operationID(op.Method, op.Path),
+			Summary:     op.Summary,
+			Tags:        []string{op.Tag},
+			Responses:   make(map[string]*OpenAPIResponse),
+		}
+		for _, m := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+			o.Parameters = append(o.Parameters, OpenAPIParameter{
+				Name: m[1], In: "path", Required: true,
+				Schema: &JSONSchema{Type: apiPathParamTypes[m[1]]},
+			})
+		}
+		for _, p := range op.Query {
+			o.Parameters = append(o.Parameters, OpenAPIParameter{
+				Name: p.Name, In: "query", Description: p.Description, Required: p.Required,
+				Schema: &JSONSchema{Type: p.Type},
+			})
+		}
+
+		if op.Request != nil {
+			o.RequestBody = &OpenAPIBody{Required: true, Content: map[string]*OpenAPIMedia{
+				"application/json": {Schema: schemaFor(reflect.TypeOf(op.Request), schemas)},
+			}}
+		} else if op.RequestType != "" {
+			o.RequestBody = &OpenAPIBody{Required: true, Content: map[string]*OpenAPIMedia{
+				op.RequestType: {Schema: &JSONSchema{Type: "string"}},
+			}}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &OpenAPIResponse{Description: http.StatusText(status), Content: make(map[string]*OpenAPIMedia)}
+		if op.Response != nil {
+			success.Content["application/json"] = &OpenAPIMedia{Schema: schemaFor(reflect.TypeOf(op.Response), schemas)}
+		}
+		if op.ResponseType != "" {
+			schemaType := "string"
+			if op.ResponseType == "application/json" {
+				schemaType = "object"
+			}
+			success.Content[op.ResponseType] = &OpenAPIMedia{Schema: &JSONSchema{Type: schemaType}}
+		}
+		o.Responses[fmt.Sprint(status)] = success
+		o.Responses["default"] = &OpenAPIResponse{
+			Description: "Error",
+			Content:     map[string]*OpenAPIMedia{"application/json": {Schema: errorSchema}},
+		}
+
+		if doc.Paths[op.Path] == nil {
+			doc.Paths[op.Path] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[op.Path][strings.ToLower(op.Method)] = o
+	}
+	return doc
+}
+
+func getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildOpenAPI())
+}
+
+// checkRoutes compares the routes of the router with the document and
+// returns the differences
+func checkRoutes(router *mux.Router, doc *OpenAPIDocument) ([]string, error) {
+	var problems []string
+	registered := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		if contains(apiUndocumentedPaths, path) {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("route %s accepts any method", path))
+			return nil
+		}
+		for _, method := range methods {
+			registered[method+" "+path] = true
+			if doc.Paths[path][strings.ToLower(method)] == nil {
+				problems = append(problems, fmt.Sprintf("route %s %s is missing from the OpenAPI document", method, path))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				problems = append(problems, fmt.Sprintf("operation %s %s is not a registered route", strings.ToUpper(method), path))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems, nil
+}
+
+// checkClient compares the endpoints and types of the client package with
+// the document
+func checkClient(doc *OpenAPIDocument) []string {
+	var problems []string
+	for _, endpoint := range client.Endpoints {
+		method, path, _ := strings.Cut(endpoint, " ")
+		if doc.Paths[path][strings.ToLower(method)] == nil {
+			problems = append(problems, fmt.Sprintf("client endpoint %s is not in the OpenAPI document", endpoint))
+		}
+	}
+
+	clientSchemas := make(map[string]*JSONSchema)
+	for name, v := range client.Schemas {
+		schemaFor(reflect.TypeOf(v), clientSchemas)
+		if doc.Components.Schemas[name] == nil {
+			problems = append(problems, fmt.Sprintf("client type %s is not a schema of the OpenAPI document", name))
+		}
+	}
+	for name, s := range clientSchemas {
+		if want := doc.Components.Schemas[name]; want != nil {
+			problems = append(problems, compareSchemas("client type "+name, want, s)...)
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// compareSchemas reports where got differs from want in its properties and
+// their types, nullability, formats and required fields are not compared
+func compareSchemas(where string, want, got *JSONSchema) []string {
+	if want.Ref != got.Ref || want.Type != got.Type {
+		return []string{fmt.Sprintf("%s is %s, the document has %s", where, describeSchema(got), describeSchema(want))}
+	}
+	var problems []string
+	if want.Items != nil && got.Items != nil {
+		problems = append(problems, compareSchemas(where+"[]", want.Items, got.Items)...)
+	}
+	if want.AdditionalProperties != nil && got.AdditionalProperties != nil {
+		problems = append(problems, compareSchemas(where+"{}", want.AdditionalProperties, got.AdditionalProperties)...)
+	}
+	for name, prop := range want.Properties {
+		if got.Properties[name] == nil {
+			problems = append(problems, fmt.Sprintf("%s is missing the field %s", where, name))
+			continue
+		}
+		problems = append(problems, compareSchemas(where+"."+name, prop, got.Properties[name])...)
+	}
+	for name := range got.Properties {
+		if want.Properties[name] == nil {
+			problems = append(problems, fmt.Sprintf("%s has the field %s, which is not in the document", where, name))
+		}
+	}
+	return problems
+}
+
+func describeSchema(s *JSONSchema) string {
+	switch {
+	case s.Ref != "":
+		return strings.TrimPrefix(s.Ref, schemaRef)
+	case s.Type == "":
+		return "any"
+	}
+	return s.Type
+}
+
+var openapiCheck bool
+
+// openapiCmd prints the OpenAPI document or checks it for drift
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Print the OpenAPI document of the REST API",
+	Long: `Print the OpenAPI 3 document that the server serves at /openapi.json.
+
+With --check, compare the document with the routes registered by the
+server and with the client package, and exit with an error listing any
+differences.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		doc := buildOpenAPI()
+		if !openapiCheck {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(doc); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding OpenAPI document: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		problems, err := checkRoutes(newRouter(), doc)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error walking routes: %v\n", err)
+			os.Exit(1)
+		}
+		problems = append(problems, checkClient(doc)...)
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("OpenAPI document, routes and client agree")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(openapiCmd)
+	openapiCmd.Flags().BoolVar(&openapiCheck, "check", false, "Check the document against the routes and the client")
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPIMatchesRoutesAndClient(t *testing.T) {
+	doc := buildOpenAPI()
+	problems, err := checkRoutes(newRouter(), doc)
+	if err != nil {
+		t.Fatalf("checkRoutes: %v", err)
+	}
+	problems = append(problems, checkClient(doc)...)
+	for _, p := range problems {
+		t.Error(p)
+	}
+}
+
+// queryReads finds the query parameters each function of the package reads,
+// directly or through the functions it calls
+type queryReads struct {
+	funcs map[string][]*ast.FuncDecl
+	read  map[string]map[string]bool
+}
+
+func parseQueryReads(t *testing.T) *queryReads {
+	t.Helper()
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qr := &queryReads{funcs: make(map[string][]*ast.FuncDecl), read: make(map[string]map[string]bool)}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok {
+					qr.funcs[fn.Name.Name] = append(qr.funcs[fn.Name.Name], fn)
+				}
+			}
+		}
+	}
+	return qr
+}
+
+// isQuery reports whether e is a call of URL.Query()
+func isQuery(e ast.Expr) bool {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Query" {
+		return false
+	}
+	url, ok := sel.X.(*ast.SelectorExpr)
+	return ok && url.Sel.Name == "URL"
+}
+
+// params returns the query parameters read by the functions named name
+func (qr *queryReads) params(name string) map[string]bool {
+	if read, ok := qr.read[name]; ok {
+		return read
+	}
+	read := make(map[string]bool)
+	qr.read[name] = read // Breaks recursion
+	for _, fn := range qr.funcs[name] {
+		if fn.Body == nil {
+			continue
+		}
+		// Variables holding the query values
+		queries := make(map[string]bool)
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			if assign, ok := n.(*ast.AssignStmt); ok && len(assign.Lhs) == len(assign.Rhs) {
+				for i, rhs := range assign.Rhs {
+					if id, ok := assign.Lhs[i].(*ast.Ident); ok && isQuery(rhs) {
+						queries[id.Name] = true
+					}
+				}
+			}
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			var callee string
+			switch fun := call.Fun.(type) {
+			case *ast.Ident:
+				callee = fun.Name
+			case *ast.SelectorExpr:
+				callee = fun.Sel.Name
+				id, isIdent := fun.X.(*ast.Ident)
+				if fun.Sel.Name == "Get" && len(call.Args) == 1 && (isQuery(fun.X) || isIdent && queries[id.Name]) {
+					if lit, ok := call.Args[0].(*ast.BasicLit); ok {
+						if s, err := strconv.Unquote(lit.Value); err == nil {
+							read[s] = true
+						}
+					}
+				}
+			}
+			if callee != "" && callee != name {
+				for p := range qr.params(callee) {
+					read[p] = true
+				}
+			}
+			return true
+		})
+	}
+	return read
+}
+
+func TestOpenAPIQueryParameters(t *testing.T) {
+	qr := parseQueryReads(t)
+	documented := make(map[string]map[string]bool)
+	for _, op := range apiOperations {
+		params := make(map[string]bool)
+		for _, p := range op.Query {
+			params[p.Name] = true
+		}
+		documented[op.Method+" "+op.Path] = params
+	}
+
+	err := newRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // The CalDAV and WebDAV routes
+		}
+		handler, ok := route.GetHandler().(http.HandlerFunc)
+		if !ok {
+			return nil
+		}
+		name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+		name = name[strings.LastIndex(name, ".")+1:]
+		for _, method := range methods {
+			op := method + " " + path
+			var missing []string
+			for p := range qr.params(name) {
+				if !documented[op][p] {
+					missing = append(missing, p)
+				}
+			}
+			sort.Strings(missing)
+			for _, p := range missing {
+				t.Errorf("%s (%s) reads the query parameter %s, which is not documented", op, name, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
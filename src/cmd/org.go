@@ -0,0 +1,848 @@
+package cmd
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Org mode import and export
+//
+// Headlines map to notes, headline nesting maps to note_hierarchy,
+// TODO keywords, priorities, SCHEDULED and DEADLINE map to tasks and
+// task_schedules, :LOGBOOK: CLOCK lines map to task_clocks and :tags:
+// map to note_tags. The TODO keywords are the task statuses in upper case.
+//
+// Org priorities [#A] through [#E] map to task priorities 1 through 5.
+
+// orgKeywords maps Org TODO keywords to task statuses
+func orgKeywords(statuses taskStatusSet) map[string]string {
+	keywords := make(map[string]string, len(statuses))
+	for name := range statuses {
+		keywords[strings.ToUpper(name)] = name
+	}
+	return keywords
+}
+
+// OrgClock represents a single CLOCK line from a :LOGBOOK: drawer
+type OrgClock struct {
+	ClockIn  time.Time
+	ClockOut *time.Time
+}
+
+// OrgHeadline represents a parsed Org headline and its subtree
+type OrgHeadline struct {
+	Level     int
+	Keyword   string
+	Status    string
+	Priority  int
+	Title     string
+	Tags      []string
+	Body      string
+	Deadline  *time.Time
+	AllDay    bool
+	Scheduled *time.Time
+	// ScheduledEnd is only set when the SCHEDULED timestamp is a range
+	ScheduledEnd *time.Time
+	Effort       *float64
+	// Repeat is the repeater (e.g. +1w) of the DEADLINE or SCHEDULED timestamp
+	Repeat   string
+	Clocks   []OrgClock
+	Children []*OrgHeadline
+}
+
+var (
+	orgHeadlineRe  = regexp.MustCompile(`^(\*+)\s+(.*?)\s*$`)
+	orgPriorityRe  = regexp.MustCompile(`^\[#([A-Ea-e])\]\s*`)
+	orgTagsRe      = regexp.MustCompile(`\s+(:[^\s:]+(?::[^\s:]+)*:)$`)
+	orgPlanningRe  = regexp.MustCompile(`(SCHEDULED|DEADLINE|CLOSED):\s*([<\[][^>\]]+[>\]])`)
+	orgTimestampRe = regexp.MustCompile(`^[<\[](\d{4}-\d{2}-\d{2})(?:\s+[^\d\s>\]]+)?(?:\s+(\d{1,2}:\d{2})(?:-(\d{1,2}:\d{2}))?)?(.*?)[>\]]$`)
+	orgClockRe     = regexp.MustCompile(`^CLOCK:\s*(\[[^\]]+\])(?:--(\[[^\]]+\]))?`)
+	orgPropertyRe  = regexp.MustCompile(`^:([^\s:]+):\s*(.*)$`)
+	orgRepeatRe    = regexp.MustCompile(`\s((?:\.\+|\+\+|\+)\d+[hdwmy])`)
+)
+
+// parseOrgTimestamp parses an active or inactive Org timestamp such as
+// <2024-01-05 Fri 09:00-10:30> in loc, returning the start, the end of a
+// time range (if any) and whether the timestamp carries no time of day. A
+// date without a time starts at midnight in loc.
+func parseOrgTimestamp(ts string, loc *time.Location) (start time.Time, end *time.Time, allDay bool, err error) {
+	m := orgTimestampRe.FindStringSubmatch(strings.TrimSpace(ts))
+	if m == nil {
+		return time.Time{}, nil, false, fmt.Errorf("invalid org timestamp: %s", ts)
+	}
+
+	if m[2] == "" {
+		start, err = time.ParseInLocation("2006-01-02", m[1], loc)
+		return start, nil, true, err
+	}
+
+	start, err = time.ParseInLocation("2006-01-02 15:04", m[1]+" "+m[2], loc)
+	if err != nil {
+		return time.Time{}, nil, false, err
+	}
+	if m[3] != "" {
+		e, err := time.ParseInLocation("2006-01-02 15:04", m[1]+" "+m[3], loc)
+		if err != nil {
+			return time.Time{}, nil, false, err
+		}
+		end = &e
+	}
+	return start, end, false, nil
+}
+
+// formatOrgTimestamp renders t as an Org timestamp in loc, active
+// timestamps use angle brackets and inactive timestamps use square brackets
+func formatOrgTimestamp(t time.Time, end *time.Time, allDay bool, active bool, loc *time.Location) string {
+	open, close := "[", "]"
+	if active {
+		open, close = "<", ">"
+	}
+	t = t.In(loc)
+	s := t.Format("2006-01-02 Mon")
+	if !allDay {
+		s += " " + t.Format("15:04")
+		if end != nil && end.In(loc).Format("2006-01-02") == t.Format("2006-01-02") {
+			s += "-" + end.In(loc).Format("15:04")
+		}
+	}
+	return open + s + close
+}
+
+// withOrgRepeater adds a repeater such as +1w to a formatted timestamp
+func withOrgRepeater(ts, repeat string) string {
+	if repeat == "" {
+		return ts
+	}
+	return ts[:len(ts)-1] + " " + repeat + ts[len(ts)-1:]
+}
+
+// isWholeDay reports whether the span runs from midnight to midnight in
+// loc, which is how date-only SCHEDULED timestamps are imported
+func isWholeDay(start time.Time, end *time.Time, loc *time.Location) bool {
+	start = start.In(loc)
+	return end != nil && start.Format("15:04:05") == "00:00:00" && end.Equal(start.AddDate(0, 0, 1))
+}
+
+// parseOrgEffort parses an Org Effort property (e.g. 1:30 or 2) into hours
+func parseOrgEffort(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if h, m, ok := strings.Cut(s, ":"); ok {
+		hours, err := strconv.Atoi(h)
+		if err != nil {
+			return 0, err
+		}
+		minutes, err := strconv.Atoi(m)
+		if err != nil {
+			return 0, err
+		}
+		return float64(hours) + float64(minutes)/60, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// formatOrgEffort renders hours as an Org duration (e.g. 1:30)
+func formatOrgEffort(hours float64) string {
+	minutes := int(hours*60 + 0.5)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// parseOrg parses an Org document into a forest of headlines, keywords
+// maps the TODO keywords to task statuses and timestamps are read in loc.
+// Any text before the first headline is ignored.
+func parseOrg(r io.Reader, keywords map[string]string, loc *time.Location) ([]*OrgHeadline, error) {
+	var roots []*OrgHeadline
+	var stack []*OrgHeadline
+	var body []string
+	var current *OrgHeadline
+	drawer := ""
+
+	flush := func() {
+		if current != nil {
+			current.Body = strings.Trim(strings.Join(body, "\n"), "\n")
+		}
+		body = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+
+		if m := orgHeadlineRe.FindStringSubmatch(line); m != nil && drawer == "" {
+			flush()
+			h := parseOrgHeadline(len(m[1]), m[2], keywords)
+
+			for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				roots = append(roots, h)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, h)
+			}
+			stack = append(stack, h)
+			current = h
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+
+		// Drawers
+		if drawer != "" {
+			if strings.EqualFold(trimmed, ":END:") {
+				drawer = ""
+				continue
+			}
+			if err := parseOrgDrawerLine(current, drawer, trimmed, loc); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			continue
+		}
+		if trimmed == ":LOGBOOK:" || trimmed == ":PROPERTIES:" {
+			drawer = strings.Trim(trimmed, ":")
+			continue
+		}
+
+		// Planning line
+		if matches := orgPlanningRe.FindAllStringSubmatch(trimmed, -1); matches != nil && len(body) == 0 {
+			for _, pm := range matches {
+				start, end, allDay, err := parseOrgTimestamp(pm[2], loc)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				if rm := orgRepeatRe.FindStringSubmatch(pm[2]); rm != nil && pm[1] != "CLOSED" {
+					current.Repeat = rm[1]
+				}
+				switch pm[1] {
+				case "DEADLINE":
+					// All-day deadlines are floating dates, see timestamps.go
+					if allDay {
+						start = floatingDate(start, time.UTC)
+					}
+					current.Deadline = &start
+					current.AllDay = allDay
+				case "SCHEDULED":
+					current.Scheduled = &start
+					current.ScheduledEnd = end
+					if end == nil && allDay {
+						dayEnd := start.AddDate(0, 0, 1)
+						current.ScheduledEnd = &dayEnd
+					}
+				}
+			}
+			continue
+		}
+
+		// Lines beginning with a star are escaped with a comma on export
+		if strings.HasPrefix(line, ",*") {
+			line = line[1:]
+		}
+		body = append(body, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading org document: %w", err)
+	}
+	flush()
+
+	return roots, nil
+}
+
+// parseOrgHeadline splits the text after the stars into its keyword,
+// priority cookie, title and tags
+func parseOrgHeadline(level int, text string, keywords map[string]string) *OrgHeadline {
+	h := &OrgHeadline{Level: level}
+
+	if m := orgTagsRe.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(text[:len(text)-len(m[0])])
+		for _, tag := range strings.Split(strings.Trim(m[1], ":"), ":") {
+			if tag != "" {
+				h.Tags = append(h.Tags, tag)
+			}
+		}
+	}
+
+	if word, rest, _ := strings.Cut(text, " "); keywords[word] != "" {
+		h.Keyword = word
+		h.Status = keywords[word]
+		text = strings.TrimSpace(rest)
+	}
+
+	if m := orgPriorityRe.FindStringSubmatch(text); m != nil {
+		h.Priority = int(strings.ToUpper(m[1])[0]-'A') + 1
+		text = text[len(m[0]):]
+	}
+
+	h.Title = text
+	return h
+}
+
+// parseOrgDrawerLine handles a single line inside a :LOGBOOK: or
+// :PROPERTIES: drawer, CLOCK timestamps are read in loc
+func parseOrgDrawerLine(h *OrgHeadline, drawer, line string, loc *time.Location) error {
+	switch drawer {
+	case "LOGBOOK":
+		m := orgClockRe.FindStringSubmatch(line)
+		if m == nil {
+			return nil
+		}
+		in, _, _, err := parseOrgTimestamp(m[1], loc)
+		if err != nil {
+			return err
+		}
+		clock := OrgClock{ClockIn: in}
+		if m[2] != "" {
+			out, _, _, err := parseOrgTimestamp(m[2], loc)
+			if err != nil {
+				return err
+			}
+			clock.ClockOut = &out
+		}
+		h.Clocks = append(h.Clocks, clock)
+	case "PROPERTIES":
+		m := orgPropertyRe.FindStringSubmatch(line)
+		if m == nil || !strings.EqualFold(m[1], "Effort") {
+			return nil
+		}
+		effort, err := parseOrgEffort(m[2])
+		if err != nil {
+			return fmt.Errorf("invalid Effort property: %w", err)
+		}
+		h.Effort = &effort
+	}
+	return nil
+}
+
+// importOrgHeadlines inserts the headlines (and their subtrees) as notes,
+// attaching the top level headlines to parentID if it is non-zero.
+// The IDs of all created notes are returned.
+func importOrgHeadlines(tx *sql.Tx, headlines []*OrgHeadline, parentID int) ([]int, error) {
+	var ids []int
+	tagIDs := make(map[string]int)
+
+	var insert func(h *OrgHeadline, parentID int) error
+	insert = func(h *OrgHeadline, parentID int) error {
+		var noteID int
+		err := tx.QueryRow("INSERT INTO notes (title, content) VALUES ($1, $2) RETURNING id",
+			h.Title, h.Body).Scan(&noteID)
+		if err != nil {
+			return fmt.Errorf("error creating note: %w", err)
+		}
+		ids = append(ids, noteID)
+
+		if parentID != 0 {
+			_, err = tx.Exec(`
+                INSERT INTO note_hierarchy (parent_note_id, child_note_id, hierarchy_type)
+                VALUES ($1, $2, 'subpage')
+            `, parentID, noteID)
+			if err != nil {
+				return fmt.Errorf("error adding note hierarchy entry: %w", err)
+			}
+		}
+
+		for _, name := range h.Tags {
+			tagID, err := orgTagID(tx, tagIDs, name)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", noteID, tagID)
+			if err != nil {
+				return fmt.Errorf("error adding tag to note: %w", err)
+			}
+		}
+
+		if h.Keyword != "" {
+			if err := importOrgTask(tx, h, noteID); err != nil {
+				return err
+			}
+		}
+
+		for _, child := range h.Children {
+			if err := insert(child, noteID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, h := range headlines {
+		if err := insert(h, parentID); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// orgTagID returns the ID of the tag with the given name, creating it if necessary
+func orgTagID(tx *sql.Tx, cache map[string]int, name string) (int, error) {
+	if id, ok := cache[name]; ok {
+		return id, nil
+	}
+	var id int
+	err := tx.QueryRow("SELECT id FROM tags WHERE name = $1 ORDER BY id LIMIT 1", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("INSERT INTO tags (name) VALUES ($1) RETURNING id", name).Scan(&id)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error finding or creating tag %q: %w", name, err)
+	}
+	cache[name] = id
+	return id, nil
+}
+
+// importOrgTask creates the task, schedule and clock entries for a headline
+// that carries a TODO keyword
+func importOrgTask(tx *sql.Tx, h *OrgHeadline, noteID int) error {
+	var priority, effort, deadline, repeat interface{}
+	if h.Priority != 0 {
+		priority = h.Priority
+	}
+	if h.Effort != nil {
+		effort = *h.Effort
+	}
+	if h.Deadline != nil {
+		deadline = *h.Deadline
+	}
+	if h.Repeat != "" {
+		repeat = h.Repeat
+	}
+
+	// Actual effort is derived from the imported clock entries
+	var taskID int
+	err := tx.QueryRow(`
+        INSERT INTO tasks (note_id, status, effort_estimate, deadline, priority, all_day, repeat_rule)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id
+    `, noteID, h.Status, effort, deadline, priority, h.AllDay, repeat).Scan(&taskID)
+	if err != nil {
+		return fmt.Errorf("error creating task: %w", err)
+	}
+	if err := recordStatusChange(tx, taskID, "", h.Status); err != nil {
+		return err
+	}
+
+	if h.Scheduled != nil {
+		end := h.ScheduledEnd
+		if end == nil {
+			end = h.Scheduled
+		}
+		_, err = tx.Exec(`
+            INSERT INTO task_schedules (task_id, start_datetime, end_datetime)
+            VALUES ($1, $2, $3)
+        `, taskID, *h.Scheduled, *end)
+		if err != nil {
+			return fmt.Errorf("error creating task schedule: %w", err)
+		}
+	}
+
+	for _, c := range h.Clocks {
+		var clockOut interface{}
+		if c.ClockOut != nil {
+			clockOut = *c.ClockOut
+		}
+		_, err = tx.Exec("INSERT INTO task_clocks (task_id, clock_in, clock_out) VALUES ($1, $2, $3)",
+			taskID, c.ClockIn, clockOut)
+		if err != nil {
+			return fmt.Errorf("error creating task clock entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// orgNote is a note with everything needed to render it as an Org headline
+type orgNote struct {
+	ID       int
+	Title    string
+	Content  string
+	Tags     []string
+	Task     *orgTask
+	Children []*orgNote
+}
+
+type orgTask struct {
+	ID        int
+	Status    string
+	Priority  sql.NullInt64
+	Effort    sql.NullFloat64
+	Deadline  sql.NullTime
+	AllDay    bool
+	Repeat    sql.NullString
+	Schedules [][2]sql.NullTime
+	Clocks    [][2]sql.NullTime
+}
+
+// buildOrgForest loads every note along with its tags and task details,
+// arranged by note_hierarchy and ordered by ID. If rootID is non-zero only
+// that note and its descendants are returned.
+func buildOrgForest(db *sql.DB, rootID int) ([]*orgNote, error) {
+	rows, err := db.Query("SELECT id, title, content FROM notes ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying notes: %w", err)
+	}
+	defer rows.Close()
+
+	var ordered []*orgNote
+	notes := make(map[int]*orgNote)
+	for rows.Next() {
+		n := &orgNote{}
+		if err := rows.Scan(&n.ID, &n.Title, &n.Content); err != nil {
+			return nil, fmt.Errorf("error scanning note row: %w", err)
+		}
+		notes[n.ID] = n
+		ordered = append(ordered, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning note rows: %w", err)
+	}
+
+	rows, err = db.Query(`
+        SELECT nt.note_id, t.name
+        FROM note_tags nt
+        JOIN tags t ON nt.tag_id = t.id
+        ORDER BY t.name
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error querying note tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noteID int
+		var name string
+		if err := rows.Scan(&noteID, &name); err != nil {
+			return nil, fmt.Errorf("error scanning note tag row: %w", err)
+		}
+		if n, ok := notes[noteID]; ok {
+			n.Tags = append(n.Tags, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning note tag rows: %w", err)
+	}
+
+	rows, err = db.Query(`
+        SELECT id, note_id, status, priority, effort_estimate, deadline, COALESCE(all_day, FALSE), repeat_rule
+        FROM tasks
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tasks: %w", err)
+	}
+	defer rows.Close()
+	tasks := make(map[int]*orgTask)
+	for rows.Next() {
+		var noteID int
+		t := &orgTask{}
+		if err := rows.Scan(&t.ID, &noteID, &t.Status, &t.Priority, &t.Effort, &t.Deadline, &t.AllDay, &t.Repeat); err != nil {
+			return nil, fmt.Errorf("error scanning task row: %w", err)
+		}
+		tasks[t.ID] = t
+		if n, ok := notes[noteID]; ok {
+			n.Task = t
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning task rows: %w", err)
+	}
+
+	rows, err = db.Query("SELECT task_id, start_datetime, end_datetime FROM task_schedules ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying task schedules: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID int
+		var span [2]sql.NullTime
+		if err := rows.Scan(&taskID, &span[0], &span[1]); err != nil {
+			return nil, fmt.Errorf("error scanning task schedule row: %w", err)
+		}
+		if t, ok := tasks[taskID]; ok {
+			t.Schedules = append(t.Schedules, span)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning task schedule rows: %w", err)
+	}
+
+	rows, err = db.Query("SELECT task_id, clock_in, clock_out FROM task_clocks ORDER BY clock_in DESC")
+	if err != nil {
+		return nil, fmt.Errorf("error querying task clocks: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var taskID int
+		var span [2]sql.NullTime
+		if err := rows.Scan(&taskID, &span[0], &span[1]); err != nil {
+			return nil, fmt.Errorf("error scanning task clock row: %w", err)
+		}
+		if t, ok := tasks[taskID]; ok {
+			t.Clocks = append(t.Clocks, span)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning task clock rows: %w", err)
+	}
+
+	rows, err = db.Query("SELECT parent_note_id, child_note_id FROM note_hierarchy ORDER BY child_note_id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying note hierarchy: %w", err)
+	}
+	defer rows.Close()
+	isChild := make(map[int]bool)
+	for rows.Next() {
+		var parentID, childID int
+		if err := rows.Scan(&parentID, &childID); err != nil {
+			return nil, fmt.Errorf("error scanning note hierarchy row: %w", err)
+		}
+		parent, child := notes[parentID], notes[childID]
+		if parent != nil && child != nil {
+			parent.Children = append(parent.Children, child)
+			isChild[childID] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning note hierarchy rows: %w", err)
+	}
+
+	if rootID != 0 {
+		root, ok := notes[rootID]
+		if !ok {
+			return nil, sql.ErrNoRows
+		}
+		return []*orgNote{root}, nil
+	}
+
+	var roots []*orgNote
+	for _, n := range ordered {
+		if !isChild[n.ID] {
+			roots = append(roots, n)
+		}
+	}
+	return roots, nil
+}
+
+// writeOrg renders the notes as an Org document with timestamps in loc
+func writeOrg(w io.Writer, notes []*orgNote, loc *time.Location) error {
+	bw := bufio.NewWriter(w)
+
+	var write func(n *orgNote, level int)
+	write = func(n *orgNote, level int) {
+		headline := strings.Repeat("*", level)
+		if n.Task != nil {
+			headline += " " + strings.ToUpper(n.Task.Status)
+			if n.Task.Priority.Valid && n.Task.Priority.Int64 >= 1 && n.Task.Priority.Int64 <= 5 {
+				headline += fmt.Sprintf(" [#%c]", 'A'+rune(n.Task.Priority.Int64-1))
+			}
+		}
+		headline += " " + strings.ReplaceAll(n.Title, "\n", " ")
+		if len(n.Tags) > 0 {
+			tags := make([]string, len(n.Tags))
+			for i, t := range n.Tags {
+				tags[i] = strings.ReplaceAll(t, " ", "_")
+			}
+			headline += " :" + strings.Join(tags, ":") + ":"
+		}
+		fmt.Fprintln(bw, headline)
+
+		if t := n.Task; t != nil {
+			// Org repeaters are attached to the deadline, or the schedule if there is no deadline
+			repeat := ""
+			if t.Repeat.Valid {
+				if rule, err := parseRepeatRule(t.Repeat.String); err == nil && rule.IsOrgRepeater() {
+					repeat = rule.String()
+				}
+			}
+			var planning []string
+			if t.Deadline.Valid {
+				// An all-day deadline is the same date in every timezone
+				deadlineLoc := loc
+				if t.AllDay {
+					deadlineLoc = time.UTC
+				}
+				planning = append(planning, "DEADLINE: "+withOrgRepeater(formatOrgTimestamp(t.Deadline.Time, nil, t.AllDay, true, deadlineLoc), repeat))
+				repeat = ""
+			}
+			for _, s := range t.Schedules {
+				if s[0].Valid {
+					var end *time.Time
+					if s[1].Valid {
+						end = &s[1].Time
+					}
+					// all_day is about the deadline, a schedule is all-day if it spans whole days
+					allDay := isWholeDay(s[0].Time, end, loc)
+					planning = append(planning, "SCHEDULED: "+withOrgRepeater(formatOrgTimestamp(s[0].Time, end, allDay, true, loc), repeat))
+					// Org only supports a single SCHEDULED timestamp per headline
+					break
+				}
+			}
+			if len(planning) > 0 {
+				fmt.Fprintln(bw, strings.Join(planning, " "))
+			}
+			if t.Effort.Valid {
+				fmt.Fprintln(bw, ":PROPERTIES:")
+				fmt.Fprintf(bw, ":Effort: %s\n", formatOrgEffort(t.Effort.Float64))
+				fmt.Fprintln(bw, ":END:")
+			}
+			if len(t.Clocks) > 0 {
+				fmt.Fprintln(bw, ":LOGBOOK:")
+				for _, c := range t.Clocks {
+					if !c[0].Valid {
+						continue
+					}
+					line := "CLOCK: " + formatOrgTimestamp(c[0].Time, nil, false, false, loc)
+					if c[1].Valid {
+						d := c[1].Time.Sub(c[0].Time)
+						line += fmt.Sprintf("--%s => %2d:%02d",
+							formatOrgTimestamp(c[1].Time, nil, false, false, loc),
+							int(d.Hours()), int(d.Minutes())%60)
+					}
+					fmt.Fprintln(bw, line)
+				}
+				fmt.Fprintln(bw, ":END:")
+			}
+		}
+
+		if n.Content != "" {
+			for _, line := range strings.Split(n.Content, "\n") {
+				if strings.HasPrefix(line, "*") {
+					line = "," + line
+				}
+				fmt.Fprintln(bw, line)
+			}
+		}
+
+		for _, child := range n.Children {
+			write(child, level+1)
+		}
+	}
+
+	for _, n := range notes {
+		write(n, 1)
+	}
+	return bw.Flush()
+}
+
+// OrgImportResponse lists the IDs of every note created by an import, each
+// headline before the headlines nested under it
+type OrgImportResponse struct {
+	Message string `json:"message"`
+	IDs     []int  `json:"ids"`
+}
+
+func importOrg(w http.ResponseWriter, r *http.Request) {
+	parentID := 0
+	if p := r.URL.Query().Get("parent"); p != "" {
+		var err error
+		parentID, err = strconv.Atoi(p)
+		if err != nil {
+			writeError(w, "Invalid parent note ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	statuses, _, err := loadTaskStatuses(db)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	headlines, err := parseOrg(r.Body, orgKeywords(statuses), loc)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Invalid org document: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setChangeReason(tx, changeReasonImport); err != nil {
+		writeServerError(w, "Error starting import", err)
+		return
+	}
+
+	if parentID != 0 {
+		var noteExists bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM notes WHERE id = $1)", parentID).Scan(&noteExists)
+		if err != nil {
+			writeServerError(w, "Error checking note existence", err)
+			return
+		}
+		if !noteExists {
+			writeError(w, "Parent note not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	ids, err := importOrgHeadlines(tx, headlines, parentID)
+	if err != nil {
+		writeServerError(w, "Error importing org document", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(OrgImportResponse{
+		Message: "Org document imported successfully",
+		IDs:     ids,
+	})
+}
+
+func exportOrg(w http.ResponseWriter, r *http.Request) {
+	rootID := 0
+	if p := r.URL.Query().Get("root"); p != "" {
+		var err error
+		rootID, err = strconv.Atoi(p)
+		if err != nil {
+			writeError(w, "Invalid root note ID", http.StatusBadRequest)
+			return
+		}
+	}
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	notes, err := buildOrgForest(db, rootID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, "Note not found", http.StatusNotFound)
+			return
+		}
+		writeServerError(w, "Error building org export", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=draftsmith.org")
+	if err := writeOrg(w, notes, loc); err != nil {
+		log.Printf("Error writing org export: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrgTimestampsInLocation(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+
+	start, end, allDay, err := parseOrgTimestamp("<2024-01-05 Fri 09:00-10:30>", sydney)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sydney is UTC+11 in January
+	if want := time.Date(2024, time.January, 4, 22, 0, 0, 0, time.UTC); !start.Equal(want) || allDay {
+		t.Errorf("start %s, all day %v, want %s", start.UTC(), allDay, want)
+	}
+	if end == nil || !end.Equal(time.Date(2024, time.January, 4, 23, 30, 0, 0, time.UTC)) {
+		t.Errorf("end %v, want 23:30 UTC", end)
+	}
+	if got := formatOrgTimestamp(start.UTC(), end, false, true, sydney); got != "<2024-01-05 Fri 09:00-10:30>" {
+		t.Errorf("formatted %s, want <2024-01-05 Fri 09:00-10:30>", got)
+	}
+}
+
+func TestParseOrgDatesInLocation(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+
+	// Daylight saving time ends in Sydney on 2024-04-07, the day is 25 hours long
+	doc := `* TODO Review
+DEADLINE: <2024-04-07 Sun> SCHEDULED: <2024-04-07 Sun>
+:LOGBOOK:
+CLOCK: [2024-04-06 Sat 09:00]--[2024-04-06 Sat 10:00] =>  1:00
+:END:
+`
+	headlines, err := parseOrg(strings.NewReader(doc), map[string]string{"TODO": "todo"}, sydney)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := headlines[0]
+
+	// All-day deadlines are floating dates
+	if want := time.Date(2024, time.April, 7, 0, 0, 0, 0, time.UTC); h.Deadline == nil || !h.Deadline.Equal(want) || !h.AllDay {
+		t.Errorf("deadline %v (all day %v), want %s", h.Deadline, h.AllDay, want)
+	}
+	// A date-only schedule covers the day in the request's timezone
+	dayStart := time.Date(2024, time.April, 7, 0, 0, 0, 0, sydney)
+	if h.Scheduled == nil || !h.Scheduled.Equal(dayStart) {
+		t.Errorf("scheduled %v, want %s", h.Scheduled, dayStart)
+	}
+	if h.ScheduledEnd == nil || h.ScheduledEnd.Sub(*h.Scheduled) != 25*time.Hour {
+		t.Errorf("scheduled end %v, want 25 hours after the start", h.ScheduledEnd)
+	}
+	if len(h.Clocks) != 1 || !h.Clocks[0].ClockIn.Equal(time.Date(2024, time.April, 5, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("clocks %+v, want one starting 22:00 UTC", h.Clocks)
+	}
+
+	// Exported in the same timezone the planning line comes back unchanged
+	note := &orgNote{Title: "Review", Task: &orgTask{
+		Status:    "todo",
+		Deadline:  sql.NullTime{Time: *h.Deadline, Valid: true},
+		AllDay:    true,
+		Schedules: [][2]sql.NullTime{{{Time: *h.Scheduled, Valid: true}, {Time: *h.ScheduledEnd, Valid: true}}},
+	}}
+	var out bytes.Buffer
+	if err := writeOrg(&out, []*orgNote{note}, sydney); err != nil {
+		t.Fatal(err)
+	}
+	if want := "DEADLINE: <2024-04-07 Sun> SCHEDULED: <2024-04-07 Sun>\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("exported\n%s\nwant the planning line %q", out.String(), want)
+	}
+}
+
+func TestOrgRoutes(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		doc := `* Projects :work:
+** TODO [#B] Write report
+DEADLINE: <2030-01-10 Thu> SCHEDULED: <2030-01-08 Tue 09:00-11:00>
+:PROPERTIES:
+:Effort: 1:30
+:END:
+:LOGBOOK:
+CLOCK: [2030-01-07 Mon 10:00]--[2030-01-07 Mon 11:00] =>  1:00
+:END:
+Draft the summary
+,* not a headline
+** DONE Collect data
+`
+		var parent MessageResponse
+		var imported OrgImportResponse
+		api.do("POST", "/notes", NewNote{Title: "Inbox"}, http.StatusCreated, &parent)
+		api.do("POST", fmt.Sprintf("/import/org?parent=%d&tz=Europe/Berlin", parent.ID), doc, http.StatusCreated, &imported)
+		if len(imported.IDs) != 3 {
+			t.Fatalf("imported notes: got %v, want 3", imported.IDs)
+		}
+
+		// Berlin is UTC+1 in January
+		var report TaskWithDetails
+		var tasks []TaskWithDetails
+		api.do("GET", "/tasks/details", nil, http.StatusOK, &tasks)
+		for _, task := range tasks {
+			if task.NoteID == imported.IDs[1] {
+				report = task
+			}
+		}
+		if report.Status != "todo" || report.Priority != 2 || report.EffortEstimate != 1.5 ||
+			report.Deadline != "2030-01-10T00:00:00Z" || !report.AllDay {
+			t.Errorf("imported task: got %+v", report)
+		}
+		if len(report.Schedules) != 1 || report.Schedules[0].StartDatetime != "2030-01-08T08:00:00Z" {
+			t.Errorf("imported schedules: got %+v, want one from 08:00 UTC", report.Schedules)
+		}
+		if len(report.Clocks) != 1 || report.ClockedEffort != 1 {
+			t.Errorf("imported clocks: got %+v, %v hours", report.Clocks, report.ClockedEffort)
+		}
+		var note Note
+		api.do("GET", fmt.Sprintf("/notes/%d", imported.IDs[1]), nil, http.StatusOK, &note)
+		if note.Content != "Draft the summary\n* not a headline" {
+			t.Errorf("imported note: got %q", note.Content)
+		}
+		var history []TaskHistoryEntry
+		api.do("GET", fmt.Sprintf("/tasks/%d/history?field=status", report.ID), nil, http.StatusOK, &history)
+		if len(history) != 1 || history[0].Reason == nil || *history[0].Reason != changeReasonImport {
+			t.Errorf("history of the imported task: got %+v, want one change by the import", history)
+		}
+
+		// Exported in the same timezone the document comes back unchanged
+		if got := api.text("GET", fmt.Sprintf("/export/org?root=%d&tz=Europe/Berlin", imported.IDs[0]), nil, http.StatusOK); got != doc {
+			t.Errorf("export:\n%s\nwant\n%s", got, doc)
+		}
+		export := api.text("GET", "/export/org?tz=Europe/Berlin", nil, http.StatusOK)
+		if !strings.Contains(export, "* Inbox\n** Projects :work:\n*** TODO [#B] Write report\n") {
+			t.Errorf("full export does not nest the import under Inbox:\n%s", export)
+		}
+
+		api.apiError("POST", "/import/org?parent=9999", doc, http.StatusNotFound)
+		api.apiError("POST", "/import/org?parent=inbox", doc, http.StatusBadRequest)
+		api.apiError("POST", "/import/org", "* TODO Broken\nDEADLINE: <2030-13-45 Fri>\n", http.StatusBadRequest)
+		api.apiError("GET", "/export/org?root=9999", nil, http.StatusNotFound)
+		api.apiError("GET", "/export/org?tz=Mars/Olympus", nil, http.StatusBadRequest)
+	})
+}
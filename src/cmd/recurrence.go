@@ -0,0 +1,493 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Recurring tasks
+//
+// A task's repeat_rule is either an Org mode repeater or an iCalendar RRULE:
+//
+//	+1w     shift the deadline by one week
+//	++1m    shift the deadline by whole months until it is in the future
+//	.+1d    shift the deadline to one day after the task was completed
+//	FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH
+//
+// When a recurring task is marked done the completion is logged in
+// task_completions, the deadline and schedules are advanced to the next
+// occurrence and the task is reopened in the initial status (see status.go).
+//
+// Occurrences are computed in the timezone of the request (see
+// timestamps.go), so a daily task at 09:00 stays at 09:00 local time
+// across a daylight saving change and BYDAY names local weekdays. All-day
+// deadlines are floating dates and advance in UTC.
+//
+// Months don't all have the same days. An RRULE skips the instances that
+// fall on a day the month doesn't have, as RFC 5545 requires, so a monthly
+// rule on the 31st runs Jan 31, Mar 31, May 31. Org repeaters overflow into
+// the next month like they do in Org mode, so +1m takes Jan 31 to Mar 3.
+
+var orgRepeaterRe = regexp.MustCompile(`^(\.\+|\+\+|\+)(\d+)([hdwmy])$`)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// RepeatRule is a parsed repeat_rule
+type RepeatRule struct {
+	// Mode is one of "+", "++", ".+" for Org repeaters or "rrule"
+	Mode     string
+	Interval int
+	// Unit is one of h, d, w, m, y
+	Unit  string
+	ByDay []time.Weekday
+	Count int
+	Until time.Time
+}
+
+// parseRepeatRule parses an Org repeater or an RRULE
+func parseRepeatRule(s string) (*RepeatRule, error) {
+	s = strings.TrimSpace(s)
+	if m := orgRepeaterRe.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		if n < 1 {
+			return nil, fmt.Errorf("repeat interval must be at least 1")
+		}
+		return &RepeatRule{Mode: m[1], Interval: n, Unit: m[3]}, nil
+	}
+
+	rule := &RepeatRule{Mode: "rrule", Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(s), "RRULE:"), ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid repeat rule: %s", s)
+		}
+		switch key {
+		case "FREQ":
+			units := map[string]string{"HOURLY": "h", "DAILY": "d", "WEEKLY": "w", "MONTHLY": "m", "YEARLY": "y"}
+			rule.Unit = units[value]
+			if rule.Unit == "" {
+				return nil, fmt.Errorf("unsupported FREQ: %s", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL: %s", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid COUNT: %s", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			t, err := time.Parse("20060102T150405Z", value)
+			if err != nil {
+				t, err = time.Parse("20060102", value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid UNTIL: %s", value)
+			}
+			rule.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := rruleWeekdays[d]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY: %s", d)
+				}
+				rule.ByDay = append(rule.ByDay, wd)
+			}
+		case "WKST":
+		default:
+			return nil, fmt.Errorf("unsupported RRULE part: %s", key)
+		}
+	}
+	if rule.Unit == "" {
+		return nil, fmt.Errorf("invalid repeat rule: %s", s)
+	}
+	if len(rule.ByDay) > 0 && rule.Unit != "w" {
+		return nil, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	return rule, nil
+}
+
+// step shifts t by a single interval
+func (rule *RepeatRule) step(t time.Time) time.Time {
+	n := rule.Interval
+	switch rule.Unit {
+	case "h":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "d":
+		return t.AddDate(0, 0, n)
+	case "w":
+		return t.AddDate(0, 0, 7*n)
+	case "m":
+		return t.AddDate(0, n, 0)
+	default:
+		return t.AddDate(n, 0, 0)
+	}
+}
+
+// stepSkippingInvalid shifts t by whole intervals of months or years
+// until it lands on a day the month has, e.g. from the 31st of January to
+// the 31st of March rather than into the 3rd of March
+func (rule *RepeatRule) stepSkippingInvalid(t time.Time) time.Time {
+	months := rule.Interval
+	if rule.Unit == "y" {
+		months *= 12
+	}
+	// The same month comes round every 12 months and February 29 at least
+	// every eight years, so this ends
+	for k := 1; ; k++ {
+		next := time.Date(t.Year(), t.Month()+time.Month(k*months), t.Day(),
+			t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		if next.Day() == t.Day() {
+			return next
+		}
+	}
+}
+
+// after returns the first occurrence strictly after t, for a series
+// anchored at t
+func (rule *RepeatRule) after(t time.Time) time.Time {
+	if len(rule.ByDay) == 0 {
+		if rule.Unit == "m" || rule.Unit == "y" {
+			return rule.stepSkippingInvalid(t)
+		}
+		return rule.step(t)
+	}
+
+	// Weekly with BYDAY, only weeks that are a multiple of the interval
+	// from the anchor's week count
+	weekStart := func(d time.Time) time.Time {
+		offset := (int(d.Weekday()) + 6) % 7
+		return time.Date(d.Year(), d.Month(), d.Day()-offset, 0, 0, 0, 0, d.Location())
+	}
+	anchorWeek := weekStart(t)
+	for i := 1; i <= 7*rule.Interval+7; i++ {
+		candidate := t.AddDate(0, 0, i)
+		weeks := int(weekStart(candidate).Sub(anchorWeek).Hours()/24+0.5) / 7
+		if weeks%rule.Interval != 0 {
+			continue
+		}
+		for _, wd := range rule.ByDay {
+			if candidate.Weekday() == wd {
+				return candidate
+			}
+		}
+	}
+	return rule.step(t)
+}
+
+// Next returns the next occurrence of a task whose current occurrence is
+// at current and which was completed at completedAt. completions is the
+// number of occurrences already completed, used to honour COUNT. The
+// second return value is false once the series has ended.
+func (rule *RepeatRule) Next(current, completedAt time.Time, completions int) (time.Time, bool) {
+	var next time.Time
+	switch rule.Mode {
+	case "+":
+		next = rule.step(current)
+	case "++":
+		next = rule.step(current)
+		for !next.After(completedAt) {
+			next = rule.step(next)
+		}
+	case ".+":
+		// Keep the time of day, but count from the day of completion
+		from := time.Date(completedAt.Year(), completedAt.Month(), completedAt.Day(),
+			current.Hour(), current.Minute(), current.Second(), 0, current.Location())
+		if rule.Unit == "h" {
+			from = completedAt
+		}
+		next = rule.step(from)
+	default:
+		next = rule.after(current)
+	}
+
+	if rule.Count > 0 && completions >= rule.Count-1 {
+		return time.Time{}, false
+	}
+	if !rule.Until.IsZero() && next.After(rule.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Occurrences returns the occurrences of a series anchored at start that
+// fall within [from, to). Rules that depend on the completion date (.+)
+// only have their anchor as a known occurrence.
+func (rule *RepeatRule) Occurrences(start, from, to time.Time) []time.Time {
+	var out []time.Time
+	t := start
+	for i := 0; !t.After(to) && i < 10000; i++ {
+		if rule.Count > 0 && i >= rule.Count {
+			break
+		}
+		if !rule.Until.IsZero() && t.After(rule.Until) {
+			break
+		}
+		if !t.Before(from) && t.Before(to) {
+			out = append(out, t)
+		}
+		if rule.Mode == ".+" {
+			break
+		}
+		if rule.Mode == "rrule" {
+			t = rule.after(t)
+		} else {
+			t = rule.step(t)
+		}
+	}
+	return out
+}
+
+// RRULE renders the rule as an iCalendar RRULE value
+func (rule *RepeatRule) RRULE() string {
+	freqs := map[string]string{"h": "HOURLY", "d": "DAILY", "w": "WEEKLY", "m": "MONTHLY", "y": "YEARLY"}
+	parts := []string{"FREQ=" + freqs[rule.Unit]}
+	if rule.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", rule.Interval))
+	}
+	if len(rule.ByDay) > 0 {
+		var days []string
+		for _, wd := range rule.ByDay {
+			for name, d := range rruleWeekdays {
+				if d == wd {
+					days = append(days, name)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if rule.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", rule.Count))
+	}
+	if !rule.Until.IsZero() {
+		parts = append(parts, "UNTIL="+rule.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// IsOrgRepeater reports whether the rule can be written as an Org repeater
+func (rule *RepeatRule) IsOrgRepeater() bool {
+	return rule.Mode != "rrule"
+}
+
+// String renders the rule in the form it was given
+func (rule *RepeatRule) String() string {
+	if rule.IsOrgRepeater() {
+		return fmt.Sprintf("%s%d%s", rule.Mode, rule.Interval, rule.Unit)
+	}
+	return rule.RRULE()
+}
+
+// completeTask records the completion of a task that has just moved to a
+// closed status. If the task repeats its deadline and schedules are advanced to the
+// next occurrence in loc and it is reopened in the initial status, in which
+// case the new deadline is returned.
+func completeTask(tx *sql.Tx, statuses taskStatusSet, taskID string, loc *time.Location) (*time.Time, error) {
+	var status string
+	var deadline sql.NullTime
+	var allDay bool
+	var repeatRule sql.NullString
+	err := tx.QueryRow("SELECT status, deadline, COALESCE(all_day, FALSE), repeat_rule FROM tasks WHERE id = $1", taskID).Scan(&status, &deadline, &allDay, &repeatRule)
+	if err != nil {
+		return nil, fmt.Errorf("error querying task: %w", err)
+	}
+
+	var completedAt time.Time
+	err = tx.QueryRow(`
+        INSERT INTO task_completions (task_id, deadline)
+        VALUES ($1, $2)
+        RETURNING completed_at
+    `, taskID, deadline).Scan(&completedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error recording task completion: %w", err)
+	}
+
+	if !repeatRule.Valid || repeatRule.String == "" {
+		return nil, nil
+	}
+	rule, err := parseRepeatRule(repeatRule.String)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repeat rule on task %s: %w", taskID, err)
+	}
+
+	var completions int
+	err = tx.QueryRow("SELECT COUNT(*) FROM task_completions WHERE task_id = $1", taskID).Scan(&completions)
+	if err != nil {
+		return nil, fmt.Errorf("error counting task completions: %w", err)
+	}
+	// The completion we just recorded is the current occurrence
+	completions--
+
+	// Schedules without a deadline are advanced relative to themselves
+	completedAt = completedAt.In(loc)
+	anchor := completedAt
+	if deadline.Valid {
+		anchor = deadline.Time.In(loc)
+		if allDay {
+			anchor = deadline.Time.UTC()
+		}
+	}
+	next, ok := rule.Next(anchor, completedAt, completions)
+	if !ok {
+		return nil, nil
+	}
+
+	if err := setChangeReason(tx, changeReasonRecurrence); err != nil {
+		return nil, err
+	}
+
+	if deadline.Valid {
+		_, err = tx.Exec("UPDATE tasks SET deadline = $1 WHERE id = $2", next, taskID)
+		if err != nil {
+			return nil, fmt.Errorf("error advancing task deadline: %w", err)
+		}
+	}
+
+	rows, err := tx.Query("SELECT id, start_datetime, end_datetime FROM task_schedules WHERE task_id = $1", taskID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying task schedules: %w", err)
+	}
+	type span struct {
+		id         int
+		start, end sql.NullTime
+	}
+	var schedules []span
+	for rows.Next() {
+		var s span
+		if err := rows.Scan(&s.id, &s.start, &s.end); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning task schedule row: %w", err)
+		}
+		schedules = append(schedules, s)
+	}
+	rows.Close()
+
+	for _, s := range schedules {
+		if !s.start.Valid {
+			continue
+		}
+		var start time.Time
+		if deadline.Valid {
+			start = shiftLike(s.start.Time.In(loc), anchor, next)
+		} else if start, ok = rule.Next(s.start.Time.In(loc), completedAt, completions); !ok {
+			continue
+		}
+		var end interface{}
+		if s.end.Valid {
+			if deadline.Valid {
+				end = shiftLike(s.end.Time.In(loc), anchor, next)
+			} else {
+				end = start.Add(s.end.Time.Sub(s.start.Time))
+			}
+		}
+		_, err = tx.Exec("UPDATE task_schedules SET start_datetime = $1, end_datetime = $2 WHERE id = $3",
+			start, end, s.id)
+		if err != nil {
+			return nil, fmt.Errorf("error advancing task schedule: %w", err)
+		}
+	}
+
+	reopened := statuses.Initial()
+	if reopened == "" {
+		return nil, fmt.Errorf("error reopening task %s: there is no open status", taskID)
+	}
+	_, err = tx.Exec("UPDATE tasks SET status = $1, modified_at = CURRENT_TIMESTAMP WHERE id = $2", reopened, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("error reopening task: %w", err)
+	}
+	if err := recordStatusChange(tx, taskID, status, reopened); err != nil {
+		return nil, err
+	}
+
+	if !deadline.Valid {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// shiftLike shifts t as the deadline moved from anchor to next: by the
+// same number of calendar days, keeping its local time of day, plus
+// whatever is left over for hourly rules
+func shiftLike(t, anchor, next time.Time) time.Time {
+	days := int(floatingDate(next, time.UTC).Sub(floatingDate(anchor, time.UTC)).Hours() / 24)
+	return t.AddDate(0, 0, days).Add(next.Sub(anchor.AddDate(0, 0, days)))
+}
+
+// TaskCompletion is a single entry in a task's completion history
+type TaskCompletion struct {
+	ID          int    `json:"id"`
+	CompletedAt string `json:"completed_at"`
+	Deadline    string `json:"deadline"`
+}
+
+func getTaskCompletions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	taskID := vars["id"]
+
+	var taskExists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", taskID).Scan(&taskExists)
+	if err != nil {
+		writeServerError(w, "Error checking task existence", err)
+		return
+	}
+	if !taskExists {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, completed_at, deadline
+        FROM task_completions
+        WHERE task_id = $1
+        ORDER BY completed_at DESC
+    `, taskID)
+	if err != nil {
+		writeServerError(w, "Error querying task completions", err)
+		return
+	}
+	defer rows.Close()
+
+	completions := []TaskCompletion{}
+	for rows.Next() {
+		var c TaskCompletion
+		var completedAt time.Time
+		var deadline sql.NullTime
+		if err := rows.Scan(&c.ID, &completedAt, &deadline); err != nil {
+			writeServerError(w, "Error scanning row", err)
+			return
+		}
+		c.CompletedAt = formatTimestamp(completedAt)
+		if deadline.Valid {
+			c.Deadline = formatTimestamp(deadline.Time)
+		}
+		completions = append(completions, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error after scanning rows", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(completions)
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRepeatRuleNextSkipsMissingDays(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		rule    string
+		current time.Time
+		want    time.Time
+	}{
+		// RRULE instances on days the month doesn't have are skipped
+		{"FREQ=MONTHLY", date(2026, time.January, 31), date(2026, time.March, 31)},
+		{"FREQ=MONTHLY", date(2026, time.March, 31), date(2026, time.May, 31)},
+		{"FREQ=MONTHLY;INTERVAL=6", date(2026, time.August, 31), date(2027, time.August, 31)},
+		{"FREQ=MONTHLY", date(2026, time.January, 15), date(2026, time.February, 15)},
+		{"FREQ=YEARLY", date(2028, time.February, 29), date(2032, time.February, 29)},
+		// Org repeaters overflow into the next month like Org mode
+		{"+1m", date(2026, time.January, 31), date(2026, time.March, 3)},
+		{"+1y", date(2028, time.February, 29), date(2029, time.March, 1)},
+	}
+	for _, tt := range tests {
+		rule, err := parseRepeatRule(tt.rule)
+		if err != nil {
+			t.Fatalf("parseRepeatRule(%q): %v", tt.rule, err)
+		}
+		got, ok := rule.Next(tt.current, tt.current, 0)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s from %s: got %s, %v, want %s", tt.rule, tt.current.Format("2006-01-02"),
+				got.Format("2006-01-02"), ok, tt.want.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestRepeatRuleOccurrencesSkipsMissingDays(t *testing.T) {
+	rule, err := parseRepeatRule("FREQ=MONTHLY;COUNT=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, time.January, 31, 0, 0, 0, 0, time.UTC)
+	got := rule.Occurrences(start, start, start.AddDate(1, 0, 0))
+	want := []string{"2026-01-31", "2026-03-31", "2026-05-31", "2026-07-31"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d occurrences %v, want %v", len(got), got, want)
+	}
+	for i := range want {
+		if got[i].Format("2006-01-02") != want[i] {
+			t.Errorf("occurrence %d: got %s, want %s", i, got[i].Format("2006-01-02"), want[i])
+		}
+	}
+}
+
+func TestRepeatRuleNextInLocation(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	tests := []struct {
+		rule    string
+		current time.Time
+		want    time.Time
+	}{
+		// Daylight saving time starts in Berlin on 2026-03-29, the time of
+		// day stays the same and the interval is 23 hours
+		{"FREQ=DAILY", time.Date(2026, time.March, 28, 9, 0, 0, 0, berlin), time.Date(2026, time.March, 29, 9, 0, 0, 0, berlin)},
+		{"+1w", time.Date(2026, time.March, 25, 9, 0, 0, 0, berlin), time.Date(2026, time.April, 1, 9, 0, 0, 0, berlin)},
+		// Tuesday 00:30 in Berlin is still Monday in UTC
+		{"FREQ=WEEKLY;BYDAY=TU,FR", time.Date(2026, time.March, 3, 0, 30, 0, 0, berlin), time.Date(2026, time.March, 6, 0, 30, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		rule, err := parseRepeatRule(tt.rule)
+		if err != nil {
+			t.Fatalf("parseRepeatRule(%q): %v", tt.rule, err)
+		}
+		got, ok := rule.Next(tt.current, tt.current, 0)
+		if !ok || !got.Equal(tt.want) {
+			t.Errorf("%s from %s: got %s, %v, want %s", tt.rule, tt.current, got, ok, tt.want)
+		}
+	}
+}
+
+func TestCompleteRecurringTaskInLocation(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		tests := []struct {
+			rule, deadline, schedule   string
+			wantDeadline, wantSchedule string
+		}{
+			// 09:00 and 08:00 in Berlin, an hour earlier in UTC once daylight
+			// saving time starts
+			{"FREQ=DAILY", "2026-03-28T08:00:00Z", "2026-03-28T07:00:00Z", "2026-03-29T07:00:00Z", "2026-03-29T06:00:00Z"},
+			// Tuesday 00:30 in Berlin, the next is Friday 00:30 in Berlin
+			{"FREQ=WEEKLY;BYDAY=TU,FR", "2026-03-02T23:30:00Z", "2026-03-02T22:30:00Z", "2026-03-05T23:30:00Z", "2026-03-05T22:30:00Z"},
+		}
+		for _, tt := range tests {
+			id := api.createTask("Take the medicine")
+			path := fmt.Sprintf("/tasks/%d?tz=Europe/Berlin", id)
+			api.do("PUT", path, map[string]interface{}{"deadline": tt.deadline, "repeat_rule": tt.rule}, http.StatusOK, nil)
+			start, _ := time.Parse(time.RFC3339, tt.schedule)
+			api.do("POST", "/task_schedules", NewTaskSchedule{
+				TaskID: id, StartDatetime: tt.schedule, EndDatetime: start.Add(time.Hour).Format(time.RFC3339),
+			}, http.StatusCreated, nil)
+
+			api.do("PUT", path, map[string]interface{}{"status": "done"}, http.StatusOK, nil)
+			task := api.taskDetails(id)
+			if !sameTime(t, task.Deadline, tt.wantDeadline) {
+				t.Errorf("%s: deadline %s, want %s", tt.rule, task.Deadline, tt.wantDeadline)
+			}
+			if len(task.Schedules) != 1 || !sameTime(t, task.Schedules[0].StartDatetime, tt.wantSchedule) {
+				t.Errorf("%s: schedules %+v, want one at %s", tt.rule, task.Schedules, tt.wantSchedule)
+			}
+		}
+	})
+}
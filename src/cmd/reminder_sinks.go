@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Reminder sinks
+//
+// A sink delivers reminders somewhere. The SSE sink is always available,
+// the webhook, mail spool and notify command sinks are enabled by setting
+// reminders.webhook, reminders.mail_spool and reminders.command in the
+// config file.
+
+// reminderSink delivers reminders, a reminder Send fails to deliver is
+// retried
+type reminderSink interface {
+	Name() string
+	Send(reminder *Reminder) error
+}
+
+// configuredReminderSinks returns the sinks enabled in the config, keyed by name
+func configuredReminderSinks() map[string]reminderSink {
+	sinks := map[string]reminderSink{"sse": reminderEvents}
+	if url := viper.GetString("reminders.webhook"); url != "" {
+		sinks["webhook"] = &webhookSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	if path := viper.GetString("reminders.mail_spool"); path != "" {
+		to := viper.GetString("reminders.mail_to")
+		if to == "" {
+			to = os.Getenv("USER")
+		}
+		sinks["mail"] = &mailSpoolSink{path: path, to: to}
+	}
+	if command := viper.GetStringSlice("reminders.command"); len(command) > 0 {
+		sinks["command"] = &commandSink{command: command}
+	}
+	return sinks
+}
+
+// webhookSink POSTs the reminder as JSON
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Name() string { return "webhook" }
+
+func (s *webhookSink) Send(reminder *Reminder) error {
+	body, err := json.Marshal(reminder)
+	if err != nil {
+		return fmt.Errorf("error encoding reminder: %w", err)
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting reminder: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// mailSpoolSink appends the reminder to an mbox file such as /var/mail/$USER
+type mailSpoolSink struct {
+	path string
+	to   string
+	mu   sync.Mutex
+}
+
+func (s *mailSpoolSink) Name() string { return "mail" }
+
+func (s *mailSpoolSink) Send(reminder *Reminder) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening mail spool: %w", err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From draftsmith %s\n", now.Format("Mon Jan _2 15:04:05 2006"))
+	fmt.Fprintf(&msg, "From: draftsmith\n")
+	fmt.Fprintf(&msg, "To: %s\n", s.to)
+	fmt.Fprintf(&msg, "Subject: %s\n", mailSubject(reminder.Summary))
+	fmt.Fprintf(&msg, "Date: %s\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\n\n")
+	// Escape lines that would otherwise start a new message
+	for _, line := range strings.Split(reminder.Body, "\n") {
+		if strings.HasPrefix(line, "From ") {
+			line = ">" + line
+		}
+		msg.WriteString(line + "\n")
+	}
+	msg.WriteString("\n")
+
+	if _, err := f.WriteString(msg.String()); err != nil {
+		return fmt.Errorf("error writing mail spool: %w", err)
+	}
+	return nil
+}
+
+// mailSubject folds the summary onto one line, so a title can't add
+// headers, and encodes anything other than printable ASCII
+func mailSubject(summary string) string {
+	return mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(summary), " "))
+}
+
+// commandSink runs a command such as notify-send with the summary and body
+// appended to its arguments
+type commandSink struct {
+	command []string
+}
+
+func (s *commandSink) Name() string { return "command" }
+
+func (s *commandSink) Send(reminder *Reminder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	args := append(append([]string{}, s.command[1:]...), reminder.Summary, reminder.Body)
+	out, err := exec.CommandContext(ctx, s.command[0], args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("error running %s: %w: %s", s.command[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// reminderBroker is the SSE sink, it passes reminders on to every client
+// connected to /reminders/events
+type reminderBroker struct {
+	mu      sync.Mutex
+	clients map[chan *Reminder]bool
+}
+
+var reminderEvents = &reminderBroker{clients: make(map[chan *Reminder]bool)}
+
+// errNoReminderClients is returned by the SSE sink when no client received
+// the reminder. Events are only for the clients listening at the time, so
+// the reminder is skipped for the sink rather than retried.
+var errNoReminderClients = errors.New("no event client connected")
+
+func (b *reminderBroker) Name() string { return "sse" }
+
+// Send never blocks, clients that fall behind miss reminders. The reminder
+// is delivered if any client received it.
+func (b *reminderBroker) Send(reminder *Reminder) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	received := false
+	for client := range b.clients {
+		select {
+		case client <- reminder:
+			received = true
+		default:
+			log.Printf("Dropping reminder %d for a slow event client", reminder.ID)
+		}
+	}
+	if !received {
+		return errNoReminderClients
+	}
+	return nil
+}
+
+func (b *reminderBroker) subscribe() chan *Reminder {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	client := make(chan *Reminder, 16)
+	b.clients[client] = true
+	return client
+}
+
+func (b *reminderBroker) unsubscribe(client chan *Reminder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, client)
+}
+
+// getReminderEvents streams reminders as server-sent events
+func getReminderEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	client := reminderEvents.subscribe()
+	defer reminderEvents.unsubscribe(client)
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case reminder := <-client:
+			data, err := json.Marshal(reminder)
+			if err != nil {
+				log.Printf("Error encoding reminder: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: reminder\ndata: %s\n\n", reminder.ID, data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMailSpoolSubjectCannotAddHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mbox")
+	sink := &mailSpoolSink{path: path, to: "alice"}
+	for _, summary := range []string{"Due soon: Evil\r\nBcc: mallory@example.com", "Due soon: Evil\nBcc: mallory@example.com"} {
+		if err := sink.Send(&Reminder{Summary: summary, Body: "body"}); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "Bcc:") {
+			t.Errorf("summary added a header: %q", line)
+		}
+	}
+	if !strings.Contains(string(data), "Subject: Due soon: Evil Bcc: mallory@example.com\n") {
+		t.Errorf("subject not folded onto one line:\n%s", data)
+	}
+}
+
+func TestMailSubjectEncodesNonASCII(t *testing.T) {
+	got := mailSubject("Due in 1 day: Café")
+	if got != "=?utf-8?q?Due_in_1_day:_Caf=C3=A9?=" {
+		t.Errorf("mailSubject: got %q", got)
+	}
+}
+
+func TestReminderBrokerUndeliveredWithoutClients(t *testing.T) {
+	broker := &reminderBroker{clients: make(map[chan *Reminder]bool)}
+	reminder := &Reminder{ID: 1}
+	if err := broker.Send(reminder); err != errNoReminderClients {
+		t.Fatalf("Send without clients: got %v, want %v", err, errNoReminderClients)
+	}
+
+	client := broker.subscribe()
+	defer broker.unsubscribe(client)
+	if err := broker.Send(reminder); err != nil {
+		t.Fatalf("Send with a client: %v", err)
+	}
+	if got := <-client; got != reminder {
+		t.Errorf("client received %v, want %v", got, reminder)
+	}
+}
@@ -0,0 +1,579 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+)
+
+// Reminders
+//
+// The scheduler started by serve checks the reminder rules every
+// reminders.interval. A rule fires offset_minutes before the deadline or
+// before the start of each schedule of an open task. Every reminder is
+// claimed in sent_reminders before it is delivered, keyed by rule, task and
+// the deadline or schedule start it is about, so a reminder is sent at most
+// once even across restarts. Sinks that failed to deliver it are retried on
+// later checks until it is older than reminders.catch_up, as are reminders
+// that fell due while the server was down. The SSE sink skips reminders
+// while no client is listening.
+
+const (
+	reminderAnchorDeadline = "deadline"
+	reminderAnchorSchedule = "schedule_start"
+)
+
+var reminderSinkNames = []string{"sse", "webhook", "mail", "command"}
+
+// ReminderRule fires OffsetMinutes before the anchor (negative for after).
+// Sinks lists where reminders are delivered, all configured sinks if empty.
+type ReminderRule struct {
+	ID            int      `json:"id"`
+	Name          string   `json:"name"`
+	Anchor        string   `json:"anchor"`
+	OffsetMinutes int      `json:"offset_minutes"`
+	Sinks         []string `json:"sinks"`
+	Enabled       bool     `json:"enabled"`
+}
+
+// NewReminderRule is the request body for creating a rule, rules are
+// enabled unless Enabled is false
+type NewReminderRule struct {
+	Name          string   `json:"name"`
+	Anchor        string   `json:"anchor"`
+	OffsetMinutes int      `json:"offset_minutes"`
+	Sinks         []string `json:"sinks"`
+	Enabled       *bool    `json:"enabled"`
+}
+
+// UpdateReminderRule is the request body for updating a rule
+type UpdateReminderRule struct {
+	Name          *string   `json:"name,omitempty"`
+	Anchor        *string   `json:"anchor,omitempty"`
+	OffsetMinutes *int      `json:"offset_minutes,omitempty"`
+	Sinks         *[]string `json:"sinks,omitempty"`
+	Enabled       *bool     `json:"enabled,omitempty"`
+}
+
+// Reminder is a reminder being delivered. DueAt is the deadline or
+// schedule start, RemindAt the time the rule fired.
+type Reminder struct {
+	ID         int       `json:"id"`
+	RuleID     int       `json:"rule_id"`
+	TaskID     int       `json:"task_id"`
+	NoteID     int       `json:"note_id"`
+	ScheduleID *int      `json:"schedule_id,omitempty"`
+	Title      string    `json:"title"`
+	Anchor     string    `json:"anchor"`
+	DueAt      time.Time `json:"due_at"`
+	RemindAt   time.Time `json:"remind_at"`
+	Summary    string    `json:"summary"`
+	Body       string    `json:"body"`
+
+	sinks []string
+}
+
+// SentReminder is an entry in the log of sent reminders
+type SentReminder struct {
+	ID          int       `json:"id"`
+	RuleID      int       `json:"rule_id"`
+	TaskID      int       `json:"task_id"`
+	ScheduleID  *int      `json:"schedule_id"`
+	DueAt       time.Time `json:"due_at"`
+	SentAt      time.Time `json:"sent_at"`
+	DeliveredTo []string  `json:"delivered_to"`
+	Error       *string   `json:"error"`
+}
+
+// reminderCandidate is a deadline or schedule start of an open task
+type reminderCandidate struct {
+	TaskID     int
+	NoteID     int
+	Title      string
+	ScheduleID int
+	Anchor     string
+	At         time.Time
+	AllDay     bool
+}
+
+// formatReminderOffset describes a rule offset, e.g. "1 day" or "90 minutes"
+func formatReminderOffset(minutes int) string {
+	if minutes < 0 {
+		minutes = -minutes
+	}
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case minutes%1440 == 0:
+		return plural(minutes/1440, "day")
+	case minutes%60 == 0:
+		return plural(minutes/60, "hour")
+	default:
+		return plural(minutes, "minute")
+	}
+}
+
+// reminderSummary is the one line description of a reminder
+func reminderSummary(c reminderCandidate, offsetMinutes int) string {
+	lead := formatReminderOffset(offsetMinutes)
+	switch {
+	case c.Anchor == reminderAnchorDeadline && offsetMinutes > 0:
+		return fmt.Sprintf("Due in %s: %s", lead, c.Title)
+	case c.Anchor == reminderAnchorDeadline && offsetMinutes < 0:
+		return fmt.Sprintf("Overdue by %s: %s", lead, c.Title)
+	case c.Anchor == reminderAnchorDeadline:
+		return fmt.Sprintf("Due now: %s", c.Title)
+	case offsetMinutes > 0:
+		return fmt.Sprintf("Starts in %s: %s", lead, c.Title)
+	case offsetMinutes < 0:
+		return fmt.Sprintf("Started %s ago: %s", lead, c.Title)
+	default:
+		return fmt.Sprintf("Starting now: %s", c.Title)
+	}
+}
+
+// dueReminders returns the reminders that fell due in the catch up window
+// before now, earliest first. All-day deadlines are due at the start of
+// their day in loc.
+func dueReminders(rules []*ReminderRule, candidates []reminderCandidate, now time.Time, catchUp time.Duration, loc *time.Location) []*Reminder {
+	var due []*Reminder
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		for _, c := range candidates {
+			if c.Anchor != rule.Anchor {
+				continue
+			}
+			at := c.At
+			when := formatAgendaTime(at, c.AllDay, loc)
+			if c.AllDay {
+				at = floatingDate(at, loc)
+			}
+			remindAt := at.Add(-time.Duration(rule.OffsetMinutes) * time.Minute)
+			if remindAt.After(now) || now.Sub(remindAt) > catchUp {
+				continue
+			}
+
+			label := "Deadline"
+			if c.Anchor == reminderAnchorSchedule {
+				label = "Starts"
+			}
+			reminder := &Reminder{
+				RuleID:   rule.ID,
+				TaskID:   c.TaskID,
+				NoteID:   c.NoteID,
+				Title:    c.Title,
+				Anchor:   c.Anchor,
+				DueAt:    at.UTC(),
+				RemindAt: remindAt.UTC(),
+				Summary:  reminderSummary(c, rule.OffsetMinutes),
+				Body:     fmt.Sprintf("%s\n%s: %s\nTask %d, note %d", c.Title, label, when, c.TaskID, c.NoteID),
+				sinks:    rule.Sinks,
+			}
+			if c.ScheduleID != 0 {
+				scheduleID := c.ScheduleID
+				reminder.ScheduleID = &scheduleID
+			}
+			due = append(due, reminder)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].RemindAt.Before(due[j].RemindAt) })
+	return due
+}
+
+// loadReminderRules returns every rule ordered by ID
+func loadReminderRules(db *sql.DB) ([]*ReminderRule, error) {
+	rows, err := db.Query("SELECT id, name, anchor, offset_minutes, sinks, enabled FROM reminder_rules ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying reminder rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*ReminderRule{}
+	for rows.Next() {
+		rule := &ReminderRule{}
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Anchor, &rule.OffsetMinutes, pq.Array(&rule.Sinks), &rule.Enabled); err != nil {
+			return nil, fmt.Errorf("error scanning reminder rule row: %w", err)
+		}
+		if rule.Sinks == nil {
+			rule.Sinks = []string{}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// loadReminderCandidates returns the deadlines and schedule starts of open tasks
+func loadReminderCandidates(db *sql.DB, statuses taskStatusSet) ([]reminderCandidate, error) {
+	rows, err := db.Query(`
+        SELECT t.id, t.note_id, n.title, t.status, 0, CAST($1 AS TEXT), t.deadline, COALESCE(t.all_day, FALSE)
+        FROM tasks t
+        JOIN notes n ON n.id = t.note_id
+        WHERE t.deadline IS NOT NULL
+        UNION ALL
+        SELECT t.id, t.note_id, n.title, t.status, s.id, CAST($2 AS TEXT), s.start_datetime, FALSE
+        FROM task_schedules s
+        JOIN tasks t ON t.id = s.task_id
+        JOIN notes n ON n.id = t.note_id
+        WHERE s.start_datetime IS NOT NULL
+    `, reminderAnchorDeadline, reminderAnchorSchedule)
+	if err != nil {
+		return nil, fmt.Errorf("error querying reminder candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []reminderCandidate
+	for rows.Next() {
+		var c reminderCandidate
+		var status string
+		if err := rows.Scan(&c.TaskID, &c.NoteID, &c.Title, &status, &c.ScheduleID, &c.Anchor, &c.At, &c.AllDay); err != nil {
+			return nil, fmt.Errorf("error scanning reminder candidate row: %w", err)
+		}
+		if statuses.IsOpen(status) {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, rows.Err()
+}
+
+// sendDueReminders claims and delivers the reminders that are due
+func sendDueReminders(sinks map[string]reminderSink, now time.Time, catchUp time.Duration, loc *time.Location) error {
+	rules, err := loadReminderRules(db)
+	if err != nil {
+		return err
+	}
+	statuses, _, err := loadTaskStatuses(db)
+	if err != nil {
+		return err
+	}
+	candidates, err := loadReminderCandidates(db, statuses)
+	if err != nil {
+		return err
+	}
+
+	for _, reminder := range dueReminders(rules, candidates, now, catchUp, loc) {
+		var scheduleID interface{}
+		if reminder.ScheduleID != nil {
+			scheduleID = *reminder.ScheduleID
+		}
+		// A reminder that some sinks failed to deliver is claimed again by
+		// clearing its error, and only sent to those sinks
+		var delivered []string
+		err := db.QueryRow(`
+            INSERT INTO sent_reminders (rule_id, task_id, schedule_id, due_at)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (rule_id, task_id, due_at) DO UPDATE SET error = NULL
+            WHERE sent_reminders.error IS NOT NULL
+            RETURNING id, delivered_to
+        `, reminder.RuleID, reminder.TaskID, scheduleID, reminder.DueAt).Scan(&reminder.ID, pq.Array(&delivered))
+		if err == sql.ErrNoRows {
+			continue // Already sent
+		}
+		if err != nil {
+			return fmt.Errorf("error recording reminder: %w", err)
+		}
+		if delivered == nil {
+			delivered = []string{}
+		}
+
+		names := reminder.sinks
+		if len(names) == 0 {
+			for name := range sinks {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		var errs []string
+		for _, name := range names {
+			if contains(delivered, name) {
+				continue
+			}
+			sink, ok := sinks[name]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: sink not configured", name))
+				continue
+			}
+			err := sink.Send(reminder)
+			if errors.Is(err, errNoReminderClients) {
+				continue // Skipped, not retried
+			}
+			if err != nil {
+				log.Printf("Error sending reminder %d to %s: %v", reminder.ID, name, err)
+				errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			delivered = append(delivered, name)
+		}
+
+		var deliveryError interface{}
+		if len(errs) > 0 {
+			deliveryError = strings.Join(errs, "; ")
+		}
+		_, err = db.Exec("UPDATE sent_reminders SET delivered_to = $1, error = $2 WHERE id = $3",
+			pq.Array(delivered), deliveryError, reminder.ID)
+		if err != nil {
+			return fmt.Errorf("error recording reminder delivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// runReminderScheduler checks for due reminders until the server exits
+func runReminderScheduler() {
+	interval := viper.GetDuration("reminders.interval")
+	catchUp := viper.GetDuration("reminders.catch_up")
+	if interval <= 0 {
+		log.Printf("Reminders disabled, reminders.interval must be positive")
+		return
+	}
+	loc, err := time.LoadLocation(viper.GetString("timezone"))
+	if err != nil {
+		log.Printf("Unknown timezone %q, reminders use UTC", viper.GetString("timezone"))
+		loc = time.UTC
+	}
+	sinks := configuredReminderSinks()
+
+	for {
+		if err := sendDueReminders(sinks, time.Now().UTC(), catchUp, loc); err != nil {
+			log.Printf("Error sending reminders: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// validateReminderRule checks the anchor and sink names of a rule
+func validateReminderRule(anchor string, sinks []string) error {
+	if anchor != reminderAnchorDeadline && anchor != reminderAnchorSchedule {
+		return &fieldError{Field: "anchor", Message: fmt.Sprintf("Anchor must be %s or %s", reminderAnchorDeadline, reminderAnchorSchedule)}
+	}
+	for _, sink := range sinks {
+		if !contains(reminderSinkNames, sink) {
+			return &fieldError{Field: "sinks", Message: fmt.Sprintf("Unknown sink %q, expected one of %s", sink, strings.Join(reminderSinkNames, ", "))}
+		}
+	}
+	return nil
+}
+
+func listReminderRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := loadReminderRules(db)
+	if err != nil {
+		writeServerError(w, "Error loading reminder rules", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func createReminderRule(w http.ResponseWriter, r *http.Request) {
+	var rule NewReminderRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if rule.Name == "" {
+		writeValidationError(w, "name", "Name is required")
+		return
+	}
+	if err := validateReminderRule(rule.Anchor, rule.Sinks); err != nil {
+		writeInputError(w, err)
+		return
+	}
+	enabled := rule.Enabled == nil || *rule.Enabled
+	if rule.Sinks == nil {
+		rule.Sinks = []string{}
+	}
+
+	var ruleID int
+	err := db.QueryRow(`
+        INSERT INTO reminder_rules (name, anchor, offset_minutes, sinks, enabled)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id
+    `, rule.Name, rule.Anchor, rule.OffsetMinutes, pq.Array(rule.Sinks), enabled).Scan(&ruleID)
+	if err != nil {
+		writeServerError(w, "Error creating reminder rule", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Reminder rule created successfully",
+		ID:      ruleID,
+	})
+}
+
+func updateReminderRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, "Invalid reminder rule ID", http.StatusBadRequest)
+		return
+	}
+
+	var update UpdateReminderRule
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var rule ReminderRule
+	err = db.QueryRow("SELECT name, anchor, offset_minutes, sinks, enabled FROM reminder_rules WHERE id = $1", ruleID).
+		Scan(&rule.Name, &rule.Anchor, &rule.OffsetMinutes, pq.Array(&rule.Sinks), &rule.Enabled)
+	if err == sql.ErrNoRows {
+		writeError(w, "Reminder rule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeServerError(w, "Error querying reminder rule", err)
+		return
+	}
+
+	if update.Name != nil {
+		rule.Name = *update.Name
+	}
+	if update.Anchor != nil {
+		rule.Anchor = *update.Anchor
+	}
+	if update.OffsetMinutes != nil {
+		rule.OffsetMinutes = *update.OffsetMinutes
+	}
+	if update.Sinks != nil {
+		rule.Sinks = *update.Sinks
+	}
+	if update.Enabled != nil {
+		rule.Enabled = *update.Enabled
+	}
+	if rule.Name == "" {
+		writeValidationError(w, "name", "Name is required")
+		return
+	}
+	if err := validateReminderRule(rule.Anchor, rule.Sinks); err != nil {
+		writeInputError(w, err)
+		return
+	}
+	if rule.Sinks == nil {
+		rule.Sinks = []string{}
+	}
+
+	_, err = db.Exec(`
+        UPDATE reminder_rules
+        SET name = $1, anchor = $2, offset_minutes = $3, sinks = $4, enabled = $5
+        WHERE id = $6
+    `, rule.Name, rule.Anchor, rule.OffsetMinutes, pq.Array(rule.Sinks), rule.Enabled, ruleID)
+	if err != nil {
+		writeServerError(w, "Error updating reminder rule", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Reminder rule updated successfully"})
+}
+
+func deleteReminderRule(w http.ResponseWriter, r *http.Request) {
+	ruleID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, "Invalid reminder rule ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM reminder_rules WHERE id = $1", ruleID)
+	if err != nil {
+		writeServerError(w, "Error deleting reminder rule", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		writeServerError(w, "Error getting rows affected", err)
+		return
+	}
+	if rowsAffected == 0 {
+		writeError(w, "Reminder rule not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Reminder rule deleted successfully"})
+}
+
+// getSentReminders returns the most recently sent reminders, optionally
+// for a single task
+func getSentReminders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := 50
+	if s := q.Get("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit < 1 {
+			writeError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	taskID := 0
+	if s := q.Get("task_id"); s != "" {
+		var err error
+		taskID, err = strconv.Atoi(s)
+		if err != nil {
+			writeError(w, "Invalid task ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := db.Query(`
+        SELECT id, rule_id, task_id, schedule_id, due_at, sent_at, delivered_to, error
+        FROM sent_reminders
+        WHERE $1 = 0 OR task_id = $1
+        ORDER BY sent_at DESC, id DESC
+        LIMIT $2
+    `, taskID, limit)
+	if err != nil {
+		writeServerError(w, "Error querying sent reminders", err)
+		return
+	}
+	defer rows.Close()
+
+	reminders := []SentReminder{}
+	for rows.Next() {
+		var s SentReminder
+		var scheduleID sql.NullInt64
+		var deliveryError sql.NullString
+		if err := rows.Scan(&s.ID, &s.RuleID, &s.TaskID, &scheduleID, &s.DueAt, &s.SentAt, pq.Array(&s.DeliveredTo), &deliveryError); err != nil {
+			writeServerError(w, "Error scanning sent reminder row", err)
+			return
+		}
+		if scheduleID.Valid {
+			id := int(scheduleID.Int64)
+			s.ScheduleID = &id
+		}
+		if deliveryError.Valid {
+			s.Error = &deliveryError.String
+		}
+		if s.DeliveredTo == nil {
+			s.DeliveredTo = []string{}
+		}
+		reminders = append(reminders, s)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error after scanning rows", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reminders)
+}
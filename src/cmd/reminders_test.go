@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDueReminders(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	now := time.Date(2026, time.March, 9, 23, 20, 0, 0, time.UTC)
+	rules := []*ReminderRule{
+		{ID: 1, Anchor: reminderAnchorDeadline, OffsetMinutes: 1440, Enabled: true},
+		{ID: 2, Anchor: reminderAnchorSchedule, OffsetMinutes: 0, Enabled: true},
+		{ID: 3, Anchor: reminderAnchorDeadline, OffsetMinutes: 0, Enabled: false},
+	}
+	candidates := []reminderCandidate{
+		{TaskID: 1, Anchor: reminderAnchorDeadline, At: now.Add(24*time.Hour - 10*time.Minute)},
+		{TaskID: 2, Anchor: reminderAnchorDeadline, At: now.Add(48 * time.Hour)},
+		{TaskID: 3, ScheduleID: 30, Anchor: reminderAnchorSchedule, At: now.Add(-2 * time.Hour)},
+		{TaskID: 4, ScheduleID: 40, Anchor: reminderAnchorSchedule, At: now.Add(-30 * time.Minute)},
+		// Due at midnight in Berlin, 23:00 UTC the day before
+		{TaskID: 5, Anchor: reminderAnchorDeadline, At: time.Date(2026, time.March, 11, 0, 0, 0, 0, time.UTC), AllDay: true},
+		// Only the disabled rule would fire
+		{TaskID: 6, Anchor: reminderAnchorDeadline, At: now.Add(-5 * time.Minute)},
+	}
+
+	due := dueReminders(rules, candidates, now, time.Hour, berlin)
+	var got []string
+	for _, r := range due {
+		got = append(got, fmt.Sprintf("task %d rule %d at %s", r.TaskID, r.RuleID, r.RemindAt.Format(time.RFC3339)))
+	}
+	want := []string{
+		"task 4 rule 2 at 2026-03-09T22:50:00Z",
+		"task 5 rule 1 at 2026-03-09T23:00:00Z",
+		"task 1 rule 1 at 2026-03-09T23:10:00Z",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("due reminders:\n got %v\nwant %v", got, want)
+	}
+	if due[0].ScheduleID == nil || *due[0].ScheduleID != 40 {
+		t.Errorf("schedule reminder: got schedule %v, want 40", due[0].ScheduleID)
+	}
+	if !due[1].DueAt.Equal(time.Date(2026, time.March, 10, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("all-day reminder: due at %s, want midnight in Berlin", due[1].DueAt)
+	}
+}
+
+// recordingSink records the reminders it is sent, failing while err is set
+type recordingSink struct {
+	err  error
+	sent []int
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Send(reminder *Reminder) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, reminder.TaskID)
+	return nil
+}
+
+func TestSendDueRemindersOnce(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Renew passport")
+		deadline := time.Date(2026, time.March, 10, 12, 0, 0, 0, time.UTC)
+		api.do("PUT", fmt.Sprintf("/tasks/%d", id), map[string]string{"deadline": deadline.Format(time.RFC3339)}, http.StatusOK, nil)
+		// Five minutes after the default rule fires a day before
+		now := deadline.Add(-24*time.Hour + 5*time.Minute)
+
+		// Each round is a server start with its own sinks, the SSE sink has
+		// no clients
+		send := func(webhook *recordingSink) {
+			t.Helper()
+			sinks := map[string]reminderSink{
+				"sse":     &reminderBroker{clients: make(map[chan *Reminder]bool)},
+				"webhook": webhook,
+			}
+			if err := sendDueReminders(sinks, now, time.Hour, time.UTC); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sent := func() SentReminder {
+			t.Helper()
+			var reminders []SentReminder
+			api.do("GET", fmt.Sprintf("/reminders?task_id=%d", id), nil, http.StatusOK, &reminders)
+			if len(reminders) != 1 {
+				t.Fatalf("sent reminders: got %+v, want one", reminders)
+			}
+			return reminders[0]
+		}
+
+		failing := &recordingSink{err: errors.New("connection refused")}
+		send(failing)
+		if s := sent(); s.Error == nil || len(s.DeliveredTo) != 0 {
+			t.Errorf("after a failed delivery: got delivered to %v, error %v", s.DeliveredTo, s.Error)
+		}
+
+		// The failed sink is retried after a restart, the SSE sink without
+		// clients is skipped rather than failing
+		webhook := &recordingSink{}
+		send(webhook)
+		if len(webhook.sent) != 1 {
+			t.Errorf("retry: webhook sent %v, want one reminder", webhook.sent)
+		}
+		if s := sent(); s.Error != nil || len(s.DeliveredTo) != 1 || s.DeliveredTo[0] != "webhook" {
+			t.Errorf("after the retry: got delivered to %v, error %v", s.DeliveredTo, s.Error)
+		}
+
+		// Once delivered the claim keeps it from being sent again
+		again := &recordingSink{}
+		send(again)
+		if len(again.sent) != 0 {
+			t.Errorf("after a restart: webhook sent %v again", again.sent)
+		}
+	})
+}
+
+func TestReminderRuleRoutes(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		rule := func(id int) *ReminderRule {
+			t.Helper()
+			var rules []*ReminderRule
+			api.do("GET", "/reminders/rules", nil, http.StatusOK, &rules)
+			for _, r := range rules {
+				if r.ID == id {
+					return r
+				}
+			}
+			return nil
+		}
+
+		var created MessageResponse
+		api.do("POST", "/reminders/rules", NewReminderRule{
+			Name: "Morning of", Anchor: reminderAnchorSchedule, OffsetMinutes: 90, Sinks: []string{"webhook", "mail"},
+		}, http.StatusCreated, &created)
+		if r := rule(created.ID); r == nil || r.Anchor != reminderAnchorSchedule || r.OffsetMinutes != 90 ||
+			fmt.Sprint(r.Sinks) != "[webhook mail]" || !r.Enabled {
+			t.Fatalf("created rule: got %+v", r)
+		}
+
+		// Only the fields given are changed
+		path := fmt.Sprintf("/reminders/rules/%d", created.ID)
+		enabled, sinks := false, []string{}
+		api.do("PUT", path, UpdateReminderRule{Enabled: &enabled, Sinks: &sinks}, http.StatusOK, nil)
+		if r := rule(created.ID); r == nil || r.Name != "Morning of" || r.OffsetMinutes != 90 || len(r.Sinks) != 0 || r.Enabled {
+			t.Errorf("updated rule: got %+v", r)
+		}
+
+		if e := api.apiError("POST", "/reminders/rules", NewReminderRule{Name: "Later", Anchor: "start"}, http.StatusUnprocessableEntity); len(e.Details) != 1 || e.Details[0].Field != "anchor" {
+			t.Errorf("invalid anchor: got details %+v", e.Details)
+		}
+		pager := []string{"pager"}
+		if e := api.apiError("PUT", path, UpdateReminderRule{Sinks: &pager}, http.StatusUnprocessableEntity); len(e.Details) != 1 || e.Details[0].Field != "sinks" {
+			t.Errorf("unknown sink: got details %+v", e.Details)
+		}
+		api.apiError("POST", "/reminders/rules", NewReminderRule{Anchor: reminderAnchorDeadline}, http.StatusUnprocessableEntity)
+
+		api.do("DELETE", path, nil, http.StatusOK, nil)
+		if r := rule(created.ID); r != nil {
+			t.Errorf("deleted rule is listed: %+v", r)
+		}
+		api.apiError("DELETE", path, nil, http.StatusNotFound)
+		api.apiError("PUT", path, UpdateReminderRule{Enabled: &enabled}, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,583 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Clock reports
+//
+// Clock intervals are clipped to the requested range and grouped by day,
+// ISO week, tag or top level note. Within each group time is attributed to
+// the note of the clocked task and rolled up to its ancestors through
+// note_hierarchy, so a project note shows the time spent on all of its
+// subtasks. A running clock counts up to the current time.
+
+const untaggedGroup = "(untagged)"
+
+// ClockReport is the total clocked time in a range, split into groups
+type ClockReport struct {
+	From    string              `json:"from"`
+	To      string              `json:"to"`
+	GroupBy string              `json:"group_by"`
+	Seconds int64               `json:"seconds"`
+	Hours   float64             `json:"hours"`
+	Groups  []*ClockReportGroup `json:"groups"`
+}
+
+// ClockReportGroup is the clocked time for a day, week, tag or top level note
+type ClockReportGroup struct {
+	Key     string             `json:"key"`
+	Label   string             `json:"label"`
+	Seconds int64              `json:"seconds"`
+	Hours   float64            `json:"hours"`
+	Notes   []*ClockReportNote `json:"notes"`
+
+	start time.Time // Start of the day or week
+}
+
+// ClockReportNote is a note in a report group. OwnSeconds is the time
+// clocked on the note's own task, Seconds includes its descendants.
+type ClockReportNote struct {
+	NoteID     int                `json:"note_id"`
+	Title      string             `json:"title"`
+	OwnSeconds int64              `json:"own_seconds"`
+	Seconds    int64              `json:"seconds"`
+	Hours      float64            `json:"hours"`
+	Children   []*ClockReportNote `json:"children,omitempty"`
+}
+
+// clockInterval is a clocked interval already clipped to the report range
+type clockInterval struct {
+	NoteID int
+	Start  time.Time
+	End    time.Time
+}
+
+// parseReportTime parses a date (2024-06-01) or an RFC 3339 timestamp,
+// dates are taken as midnight in loc
+func parseReportTime(s string, loc *time.Location) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, true, nil
+	}
+	t, err = time.Parse(time.RFC3339, s)
+	return t.In(loc), false, err
+}
+
+// parseReportRange reads the from and to query parameters. A date given
+// for to includes that whole day. The range defaults to the last 7 days.
+func parseReportRange(r *http.Request, loc *time.Location) (from, to time.Time, err error) {
+	q := r.URL.Query()
+
+	to = time.Now().In(loc)
+	if s := q.Get("to"); s != "" {
+		t, dateOnly, err := parseReportTime(s, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to time, expected YYYY-MM-DD or RFC 3339")
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	from = to.AddDate(0, 0, -7)
+	if s := q.Get("from"); s != "" {
+		t, _, err := parseReportTime(s, loc)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from time, expected YYYY-MM-DD or RFC 3339")
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// loadClockIntervals returns the clocked intervals overlapping the range,
+// clipped to it
+func loadClockIntervals(db *sql.DB, from, to time.Time) ([]clockInterval, error) {
+	now := time.Now().UTC()
+	rows, err := db.Query(`
+        SELECT t.note_id, tc.clock_in, COALESCE(tc.clock_out, $3)
+        FROM task_clocks tc
+        JOIN tasks t ON t.id = tc.task_id
+        WHERE tc.clock_in < $2 AND COALESCE(tc.clock_out, $3) > $1
+        ORDER BY tc.clock_in
+    `, from, to, now)
+	if err != nil {
+		return nil, fmt.Errorf("error querying task clocks: %w", err)
+	}
+	defer rows.Close()
+
+	var intervals []clockInterval
+	for rows.Next() {
+		var c clockInterval
+		if err := rows.Scan(&c.NoteID, &c.Start, &c.End); err != nil {
+			return nil, fmt.Errorf("error scanning task clock row: %w", err)
+		}
+		if c.Start.Before(from) {
+			c.Start = from
+		}
+		if c.End.After(to) {
+			c.End = to
+		}
+		if c.End.After(c.Start) {
+			intervals = append(intervals, c)
+		}
+	}
+	return intervals, rows.Err()
+}
+
+// splitByDay splits an interval at each midnight in loc
+func splitByDay(c clockInterval, loc *time.Location) []clockInterval {
+	var parts []clockInterval
+	for c.Start.Before(c.End) {
+		y, m, d := c.Start.In(loc).Date()
+		midnight := time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		part := c
+		if midnight.Before(c.End) {
+			part.End = midnight
+		}
+		parts = append(parts, part)
+		c.Start = part.End
+	}
+	return parts
+}
+
+// weekStart returns the Monday starting the ISO week of t, in t's location
+func weekStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(y, m, d-offset, 0, 0, 0, 0, t.Location())
+}
+
+// noteGraph holds note titles, parents and tags for rolling up report entries
+type noteGraph struct {
+	Titles  map[int]string
+	Parents map[int]int
+	Tags    map[int][]string
+}
+
+func loadNoteGraph(db *sql.DB) (*noteGraph, error) {
+	g := &noteGraph{
+		Titles:  make(map[int]string),
+		Parents: make(map[int]int),
+		Tags:    make(map[int][]string),
+	}
+
+	rows, err := db.Query("SELECT id, title FROM notes")
+	if err != nil {
+		return nil, fmt.Errorf("error querying notes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			return nil, fmt.Errorf("error scanning note row: %w", err)
+		}
+		g.Titles[id] = title
+	}
+
+	rows, err = db.Query("SELECT parent_note_id, child_note_id FROM note_hierarchy")
+	if err != nil {
+		return nil, fmt.Errorf("error querying note hierarchy: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var parentID, childID int
+		if err := rows.Scan(&parentID, &childID); err != nil {
+			return nil, fmt.Errorf("error scanning note hierarchy row: %w", err)
+		}
+		g.Parents[childID] = parentID
+	}
+
+	rows, err = db.Query(`
+        SELECT nt.note_id, t.name
+        FROM note_tags nt
+        JOIN tags t ON nt.tag_id = t.id
+        ORDER BY t.name
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("error querying note tags: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noteID int
+		var name string
+		if err := rows.Scan(&noteID, &name); err != nil {
+			return nil, fmt.Errorf("error scanning note tag row: %w", err)
+		}
+		g.Tags[noteID] = append(g.Tags[noteID], name)
+	}
+
+	return g, rows.Err()
+}
+
+// ancestry returns the note followed by its ancestors, nearest first
+func (g *noteGraph) ancestry(noteID int) []int {
+	path := []int{noteID}
+	seen := map[int]bool{noteID: true}
+	for {
+		parentID, ok := g.Parents[path[len(path)-1]]
+		if !ok || seen[parentID] {
+			return path
+		}
+		seen[parentID] = true
+		path = append(path, parentID)
+	}
+}
+
+// inheritedTags returns the tags of the note and its ancestors
+func (g *noteGraph) inheritedTags(noteID int) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, id := range g.ancestry(noteID) {
+		for _, tag := range g.Tags[id] {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+func roundHours(seconds int64) float64 {
+	return math.Round(float64(seconds)/36) / 100
+}
+
+// buildClockReport groups the intervals and rolls the time up the note
+// hierarchy, days and weeks start at midnight in loc
+func buildClockReport(g *noteGraph, intervals []clockInterval, groupBy string, loc *time.Location) []*ClockReportGroup {
+	type groupAcc struct {
+		group *ClockReportGroup
+		sort  string
+		own   map[int]int64
+	}
+	groups := make(map[string]*groupAcc)
+	add := func(key, label, sortKey string, start time.Time, noteID int, seconds int64) {
+		acc, ok := groups[key]
+		if !ok {
+			acc = &groupAcc{
+				group: &ClockReportGroup{Key: key, Label: label, start: start},
+				sort:  sortKey,
+				own:   make(map[int]int64),
+			}
+			groups[key] = acc
+		}
+		acc.own[noteID] += seconds
+	}
+
+	for _, c := range intervals {
+		switch groupBy {
+		case "day", "week":
+			for _, part := range splitByDay(c, loc) {
+				seconds := int64(part.End.Sub(part.Start).Seconds())
+				partStart := part.Start.In(loc)
+				if groupBy == "day" {
+					day := partStart.Format("2006-01-02")
+					start := floatingDate(partStart, loc)
+					add(day, partStart.Format("Monday 2 January 2006"), day, start, c.NoteID, seconds)
+				} else {
+					start := weekStart(partStart)
+					year, week := start.ISOWeek()
+					key := fmt.Sprintf("%d-W%02d", year, week)
+					add(key, "Week of "+start.Format("2 January 2006"), start.Format("2006-01-02"), start, c.NoteID, seconds)
+				}
+			}
+		case "tag":
+			seconds := int64(c.End.Sub(c.Start).Seconds())
+			tags := g.inheritedTags(c.NoteID)
+			if len(tags) == 0 {
+				tags = []string{untaggedGroup}
+			}
+			for _, tag := range tags {
+				sortKey := "0" + tag
+				if tag == untaggedGroup {
+					sortKey = "1"
+				}
+				add(tag, tag, sortKey, time.Time{}, c.NoteID, seconds)
+			}
+		default:
+			path := g.ancestry(c.NoteID)
+			rootID := path[len(path)-1]
+			add(strconv.Itoa(rootID), g.Titles[rootID], fmt.Sprintf("%012d", rootID), time.Time{}, c.NoteID, int64(c.End.Sub(c.Start).Seconds()))
+		}
+	}
+
+	var result []*groupAcc
+	for _, acc := range groups {
+		nodes := make(map[int]*ClockReportNote)
+		var roots []*ClockReportNote
+		for noteID, seconds := range acc.own {
+			var child *ClockReportNote
+			for _, id := range g.ancestry(noteID) {
+				node, exists := nodes[id]
+				if !exists {
+					node = &ClockReportNote{NoteID: id, Title: g.Titles[id]}
+					nodes[id] = node
+				}
+				if id == noteID {
+					node.OwnSeconds += seconds
+				}
+				if child != nil {
+					node.Children = append(node.Children, child)
+				}
+				if exists {
+					child = nil
+					break
+				}
+				child = node
+			}
+			if child != nil {
+				roots = append(roots, child)
+			}
+		}
+
+		var total func(n *ClockReportNote) int64
+		total = func(n *ClockReportNote) int64 {
+			sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].NoteID < n.Children[j].NoteID })
+			n.Seconds = n.OwnSeconds
+			for _, c := range n.Children {
+				n.Seconds += total(c)
+			}
+			n.Hours = roundHours(n.Seconds)
+			return n.Seconds
+		}
+		sort.Slice(roots, func(i, j int) bool { return roots[i].NoteID < roots[j].NoteID })
+		for _, root := range roots {
+			acc.group.Seconds += total(root)
+		}
+		acc.group.Hours = roundHours(acc.group.Seconds)
+		acc.group.Notes = roots
+		result = append(result, acc)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].sort < result[j].sort })
+	report := make([]*ClockReportGroup, len(result))
+	for i, acc := range result {
+		report[i] = acc.group
+	}
+	return report
+}
+
+// walkReportNotes visits the notes depth first with their level (1 for roots)
+func walkReportNotes(notes []*ClockReportNote, level int, visit func(n *ClockReportNote, level int)) {
+	for _, n := range notes {
+		visit(n, level)
+		walkReportNotes(n.Children, level+1, visit)
+	}
+}
+
+func writeClockReportCSV(w io.Writer, report *ClockReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group", "note_id", "level", "title", "own_seconds", "seconds", "hours"})
+	for _, group := range report.Groups {
+		walkReportNotes(group.Notes, 1, func(n *ClockReportNote, level int) {
+			cw.Write([]string{
+				group.Key,
+				strconv.Itoa(n.NoteID),
+				strconv.Itoa(level),
+				n.Title,
+				strconv.FormatInt(n.OwnSeconds, 10),
+				strconv.FormatInt(n.Seconds, 10),
+				strconv.FormatFloat(n.Hours, 'f', 2, 64),
+			})
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeClockTable renders the report like an Org clocktable dynamic block,
+// one table per group unless the report is grouped by note, with the
+// timestamps in loc
+func writeClockTable(w io.Writer, report *ClockReport, from, to time.Time, loc *time.Location) error {
+	orgDuration := func(seconds int64) string {
+		return formatOrgEffort(float64(seconds) / 3600)
+	}
+
+	step := ""
+	switch report.GroupBy {
+	case "day", "week":
+		step = " :step " + report.GroupBy
+	}
+	fmt.Fprintf(w, "#+BEGIN: clocktable :scope file :tstart \"%s\" :tend \"%s\"%s\n",
+		formatOrgTimestamp(from, nil, false, true, loc), formatOrgTimestamp(to, nil, false, true, loc), step)
+	fmt.Fprintf(w, "#+CAPTION: Clock summary at %s\n", formatOrgTimestamp(time.Now(), nil, false, false, loc))
+
+	table := func(groups []*ClockReportGroup) {
+		maxLevel := 1
+		var seconds int64
+		for _, group := range groups {
+			seconds += group.Seconds
+			walkReportNotes(group.Notes, 1, func(n *ClockReportNote, level int) {
+				if level > maxLevel {
+					maxLevel = level
+				}
+			})
+		}
+
+		row := func(cells ...string) []string {
+			r := make([]string, maxLevel+1)
+			copy(r, cells)
+			return r
+		}
+		header := row("Headline", "Time")
+		rows := [][]string{header, nil, row("*Total time*", "*"+orgDuration(seconds)+"*"), nil}
+		for _, group := range groups {
+			walkReportNotes(group.Notes, 1, func(n *ClockReportNote, level int) {
+				headline := n.Title
+				if level > 1 {
+					headline = `\_` + strings.Repeat(" ", 2*(level-1)) + headline
+				}
+				r := row(strings.ReplaceAll(headline, "|", `\vert{}`))
+				r[level] = orgDuration(n.Seconds)
+				rows = append(rows, r)
+			})
+		}
+		writeOrgTable(w, rows)
+	}
+
+	if report.GroupBy == "note" {
+		table(report.Groups)
+	} else {
+		for i, group := range report.Groups {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			switch report.GroupBy {
+			case "day":
+				fmt.Fprintf(w, "Daily report: %s\n", formatOrgTimestamp(group.start, nil, true, false, loc))
+			case "week":
+				fmt.Fprintf(w, "Weekly report starting on: %s\n", formatOrgTimestamp(group.start, nil, true, false, loc))
+			default:
+				fmt.Fprintf(w, "Tag: %s\n", group.Label)
+			}
+			table([]*ClockReportGroup{group})
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "#+END:")
+	return err
+}
+
+// writeOrgTable writes an aligned Org table, nil rows are horizontal rules
+func writeOrgTable(w io.Writer, rows [][]string) {
+	var widths []int
+	for _, r := range rows {
+		for i, cell := range r {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	for _, r := range rows {
+		if r == nil {
+			rule := make([]string, len(widths))
+			for i, width := range widths {
+				rule[i] = strings.Repeat("-", width+2)
+			}
+			fmt.Fprintf(w, "|%s|\n", strings.Join(rule, "+"))
+			continue
+		}
+		cells := make([]string, len(widths))
+		for i, width := range widths {
+			cell := ""
+			if i < len(r) {
+				cell = r[i]
+			}
+			cells[i] = " " + cell + strings.Repeat(" ", width-utf8.RuneCountInString(cell)) + " "
+		}
+		fmt.Fprintf(w, "|%s|\n", strings.Join(cells, "|"))
+	}
+}
+
+func getClockReport(w http.ResponseWriter, r *http.Request) {
+	loc, err := requestLocation(r)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	from, to, err := parseReportRange(r, loc)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "note"
+	}
+	switch groupBy {
+	case "day", "week", "tag", "note":
+	default:
+		writeError(w, "Invalid group_by, expected day, week, tag or note", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "json", "csv", "org":
+	default:
+		writeError(w, "Invalid format, expected json, csv or org", http.StatusBadRequest)
+		return
+	}
+
+	graph, err := loadNoteGraph(db)
+	if err != nil {
+		writeServerError(w, "Error loading notes for clock report", err)
+		return
+	}
+	intervals, err := loadClockIntervals(db, from, to)
+	if err != nil {
+		writeServerError(w, "Error loading clocks for clock report", err)
+		return
+	}
+
+	report := &ClockReport{
+		From:    formatTimestamp(from),
+		To:      formatTimestamp(to),
+		GroupBy: groupBy,
+		Groups:  buildClockReport(graph, intervals, groupBy, loc),
+	}
+	for _, c := range intervals {
+		report.Seconds += int64(c.End.Sub(c.Start).Seconds())
+	}
+	report.Hours = roundHours(report.Seconds)
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", "attachment; filename=clock-report.csv")
+		err = writeClockReportCSV(w, report)
+	case "org":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = writeClockTable(w, report, from, to, loc)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(report)
+	}
+	if err != nil {
+		log.Printf("Error writing clock report: %v", err)
+	}
+}
@@ -57,20 +57,40 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.src.yaml)")
 	rootCmd.PersistentFlags().String("token", "secret", "The token to use for authentication")
 	rootCmd.PersistentFlags().Int("port", 37238, "The port to run the server on")
+	rootCmd.PersistentFlags().String("db_driver", "postgres", "The Database Driver, postgres or sqlite")
+	rootCmd.PersistentFlags().String("db_path", "", "The SQLite Database File (default <db_name>.db)")
 	rootCmd.PersistentFlags().Int("db_port", 5432, "The Database Port")
 	rootCmd.PersistentFlags().String("db_host", "localhost", "The Database Host")
 	rootCmd.PersistentFlags().String("db_user", "postgres", "The Database User")
 	rootCmd.PersistentFlags().String("db_pass", "postgres", "The Database Password")
 	rootCmd.PersistentFlags().String("db_name", "draftsmith", "The Database Name")
+	rootCmd.PersistentFlags().String("timezone", "UTC", "The timezone used for agenda days (e.g. Australia/Sydney)")
+	rootCmd.PersistentFlags().String("server", "", "URL of the server for the cli and tui (default http://localhost:<port>)")
 
 	// Register with viper
 	viper.BindPFlag("token", rootCmd.PersistentFlags().Lookup("token"))
 	viper.BindPFlag("port", rootCmd.PersistentFlags().Lookup("port"))
+	viper.BindPFlag("db_driver", rootCmd.PersistentFlags().Lookup("db_driver"))
+	viper.BindPFlag("db_path", rootCmd.PersistentFlags().Lookup("db_path"))
 	viper.BindPFlag("db_port", rootCmd.PersistentFlags().Lookup("db_port"))
 	viper.BindPFlag("db_host", rootCmd.PersistentFlags().Lookup("db_host"))
 	viper.BindPFlag("db_user", rootCmd.PersistentFlags().Lookup("db_user"))
 	viper.BindPFlag("db_pass", rootCmd.PersistentFlags().Lookup("db_pass"))
 	viper.BindPFlag("db_name", rootCmd.PersistentFlags().Lookup("db_name"))
+	viper.BindPFlag("timezone", rootCmd.PersistentFlags().Lookup("timezone"))
+	viper.BindPFlag("server", rootCmd.PersistentFlags().Lookup("server"))
+
+	// Weights of the next action scoring, see next.go
+	viper.SetDefault("scoring.urgency", 3)
+	viper.SetDefault("scoring.priority", 2)
+	viper.SetDefault("scoring.goal", 1)
+	viper.SetDefault("scoring.effort", 0.5)
+	viper.SetDefault("scoring.horizon_days", 14)
+
+	// Reminder scheduler, see reminders.go
+	viper.SetDefault("reminders.enabled", true)
+	viper.SetDefault("reminders.interval", "1m")
+	viper.SetDefault("reminders.catch_up", "24h")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
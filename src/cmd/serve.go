@@ -8,11 +8,14 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	utils "draftsmith/src/utils"
+
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 	"github.com/spf13/cobra"
@@ -43,7 +46,6 @@ func cleanupOrphanedFiles() error {
     }
 
     // Walk through the uploads directory
-    uploadsDir := "uploads"
     err = filepath.Walk(uploadsDir, func(path string, info os.FileInfo, err error) error {
         if err != nil {
             return err
@@ -80,6 +82,14 @@ type Note struct {
 	Modified_at string `json:"modified_at"`
 }
 
+// NoteSummary is a note without its content
+type NoteSummary struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	CreatedAt  string `json:"created_at"`
+	ModifiedAt string `json:"modified_at"`
+}
+
 // NoteUpdate represents the structure for updating a note
 type NoteUpdate struct {
 	Title   *string `json:"title,omitempty"`
@@ -114,6 +124,11 @@ type TagHierarchyEntry struct {
 	ChildTagID  int `json:"child_tag_id"`
 }
 
+// UpdateTagHierarchyEntry is the request body for moving a tag to a new parent
+type UpdateTagHierarchyEntry struct {
+	ParentTagID int `json:"parent_tag_id"`
+}
+
 // NoteInfo represents basic note information
 type NoteInfo struct {
 	ID    int    `json:"id"`
@@ -142,11 +157,21 @@ type FileInfo struct {
     CreatedAt   string `json:"created_at"`
 }
 
+type AssetIDResponse struct {
+    ID int `json:"id"`
+}
+
+type UploadResponse struct {
+    Message  string `json:"message"`
+    Filename string `json:"filename"`
+    ID       int    `json:"id"`
+}
+
 func listFiles(w http.ResponseWriter, r *http.Request) {
     // Query to get all files from the database
     rows, err := db.Query(`
         SELECT id,
-               SUBSTRING(location FROM '[^/]+$') as file_name,
+               location,
                asset_type,
                description,
                created_at
@@ -154,8 +179,7 @@ func listFiles(w http.ResponseWriter, r *http.Request) {
         ORDER BY created_at DESC
     `)
     if err != nil {
-        log.Printf("Error querying assets: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeServerError(w, "Error querying assets", err)
         return
     }
     defer rows.Close()
@@ -163,20 +187,20 @@ func listFiles(w http.ResponseWriter, r *http.Request) {
     var files []FileInfo
     for rows.Next() {
         var file FileInfo
+        var location string
         var createdAt time.Time
-        err := rows.Scan(&file.ID, &file.FileName, &file.AssetType, &file.Description, &createdAt)
+        err := rows.Scan(&file.ID, &location, &file.AssetType, &file.Description, &createdAt)
         if err != nil {
-            log.Printf("Error scanning row: %v", err)
-            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            writeServerError(w, "Error scanning row", err)
             return
         }
-        file.CreatedAt = createdAt.Format(time.RFC3339)
+        file.FileName = path.Base(location)
+        file.CreatedAt = formatTimestamp(createdAt)
         files = append(files, file)
     }
 
     if err := rows.Err(); err != nil {
-        log.Printf("Error after scanning rows: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeServerError(w, "Error after scanning rows", err)
         return
     }
 
@@ -187,30 +211,42 @@ func listFiles(w http.ResponseWriter, r *http.Request) {
 func getAssetIDByFilename(w http.ResponseWriter, r *http.Request) {
     filename := r.URL.Query().Get("filename")
     if filename == "" {
-        http.Error(w, "Filename query parameter is required", http.StatusBadRequest)
+        writeError(w, "Filename query parameter is required", http.StatusBadRequest)
         return
     }
 
-    var assetID int
-    err := db.QueryRow(`
-        SELECT id 
-        FROM assets 
-        WHERE SUBSTRING(location FROM '[^/]+$') = $1 
-        LIMIT 1
-    `, filename).Scan(&assetID)
-
+    rows, err := db.Query("SELECT id, location FROM assets ORDER BY id")
     if err != nil {
-        if err == sql.ErrNoRows {
-            http.Error(w, "File not found", http.StatusNotFound)
-        } else {
-            log.Printf("Error querying asset: %v", err)
-            http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeServerError(w, "Error querying asset", err)
+        return
+    }
+    defer rows.Close()
+
+    assetID := 0
+    for rows.Next() {
+        var id int
+        var location string
+        if err := rows.Scan(&id, &location); err != nil {
+            writeServerError(w, "Error scanning row", err)
+            return
         }
+        if path.Base(location) == filename {
+            assetID = id
+            break
+        }
+    }
+    if err := rows.Err(); err != nil {
+        writeServerError(w, "Error after scanning rows", err)
+        return
+    }
+
+    if assetID == 0 {
+        writeError(w, "File not found", http.StatusNotFound)
         return
     }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(map[string]int{"id": assetID})
+    json.NewEncoder(w).Encode(AssetIDResponse{ID: assetID})
 }
 
 // NoteTree represents a note and its children in a tree structure
@@ -235,41 +271,55 @@ type UpdateTagRequest struct {
 
 // NewTask represents the structure for creating a new task
 type NewTask struct {
-	NoteID           int     `json:"note_id"`
-	Status           string  `json:"status"`
-	EffortEstimate   float64 `json:"effort_estimate"`
-	ActualEffort     float64 `json:"actual_effort"`
-	Deadline         string  `json:"deadline"`
-	Priority         int     `json:"priority"`
-	AllDay           bool    `json:"all_day"`
-	GoalRelationship int     `json:"goal_relationship"`
-}
-
-// UpdateTask represents the structure for updating an existing task
+	NoteID               int      `json:"note_id"`
+	Status               string   `json:"status"`
+	EffortEstimate       float64  `json:"effort_estimate"`
+	ActualEffortOverride *float64 `json:"actual_effort_override,omitempty"`
+	Deadline             string   `json:"deadline"`
+	Priority             int      `json:"priority"`
+	AllDay               bool     `json:"all_day"`
+	GoalRelationship     int      `json:"goal_relationship"`
+	RepeatRule           string   `json:"repeat_rule,omitempty"`
+}
+
+// UpdateTask represents the structure for updating an existing task.
+// Setting actual_effort_override to null removes the override so that the
+// actual effort is derived from the clock entries again.
 type UpdateTask struct {
-	Status           *string  `json:"status,omitempty"`
-	EffortEstimate   *float64 `json:"effort_estimate,omitempty"`
-	ActualEffort     *float64 `json:"actual_effort,omitempty"`
-	Deadline         *string  `json:"deadline,omitempty"`
-	Priority         *int     `json:"priority,omitempty"`
-	AllDay           *bool    `json:"all_day,omitempty"`
-	GoalRelationship *int     `json:"goal_relationship,omitempty"`
-}
-
+	Status               *string       `json:"status,omitempty"`
+	EffortEstimate       *float64      `json:"effort_estimate,omitempty"`
+	ActualEffortOverride optionalFloat `json:"actual_effort_override"`
+	Deadline             *string       `json:"deadline,omitempty"`
+	Priority             *int          `json:"priority,omitempty"`
+	AllDay               *bool         `json:"all_day,omitempty"`
+	GoalRelationship     *int          `json:"goal_relationship,omitempty"`
+	RepeatRule           *string       `json:"repeat_rule,omitempty"`
+}
+
+// TaskWithDetails is a task with its schedules and clocks. ActualEffort is
+// the manual override if set, otherwise the clocked time, and EffortVariance
+// is the actual minus the estimated effort (nil without an estimate).
+// BlockedBy lists the prerequisites in DependsOn that are not done yet.
 type TaskWithDetails struct {
-	ID               int            `json:"id"`
-	NoteID           int            `json:"note_id"`
-	Status           string         `json:"status"`
-	EffortEstimate   float64        `json:"effort_estimate"`
-	ActualEffort     float64        `json:"actual_effort"`
-	Deadline         string         `json:"deadline"`
-	Priority         int            `json:"priority"`
-	AllDay           bool           `json:"all_day"`
-	GoalRelationship int            `json:"goal_relationship"`
-	CreatedAt        string         `json:"created_at"`
-	ModifiedAt       string         `json:"modified_at"`
-	Schedules        []TaskSchedule `json:"schedules"`
-	Clocks           []TaskClock    `json:"clocks"`
+	ID                   int            `json:"id"`
+	NoteID               int            `json:"note_id"`
+	Status               string         `json:"status"`
+	EffortEstimate       float64        `json:"effort_estimate"`
+	ActualEffort         float64        `json:"actual_effort"`
+	ClockedEffort        float64        `json:"clocked_effort"`
+	ActualEffortOverride *float64       `json:"actual_effort_override"`
+	EffortVariance       *float64       `json:"effort_variance"`
+	Deadline             string         `json:"deadline"`
+	Priority             int            `json:"priority"`
+	AllDay               bool           `json:"all_day"`
+	GoalRelationship     int            `json:"goal_relationship"`
+	RepeatRule           string         `json:"repeat_rule"`
+	CreatedAt            string         `json:"created_at"`
+	ModifiedAt           string         `json:"modified_at"`
+	Schedules            []TaskSchedule `json:"schedules"`
+	Clocks               []TaskClock    `json:"clocks"`
+	DependsOn            []int          `json:"depends_on"`
+	BlockedBy            []int          `json:"blocked_by"`
 }
 
 type TaskSchedule struct {
@@ -314,44 +364,47 @@ type TaskTreeNode struct {
 func searchNotes(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
-		http.Error(w, "Query parameter 'q' is required", http.StatusBadRequest)
+		writeError(w, "Query parameter 'q' is required", http.StatusBadRequest)
 		return
 	}
 
-	rows, err := db.Query(`
+	search := `
         SELECT id, title
         FROM notes
         WHERE to_tsvector('english', title || ' ' || content) @@ plainto_tsquery('english', $1)
         ORDER BY ts_rank(to_tsvector('english', title || ' ' || content), plainto_tsquery('english', $1)) DESC
-    `, query)
+    `
+	if usingSQLite() {
+		search = `
+            SELECT n.id, n.title
+            FROM notes_fts
+            JOIN notes n ON n.id = notes_fts.rowid
+            WHERE notes_fts MATCH $1
+            ORDER BY rank
+        `
+		query = ftsQuery(query)
+	}
+
+	rows, err := db.Query(search, query)
 	if err != nil {
-		log.Printf("Error querying database: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying database", err)
 		return
 	}
 	defer rows.Close()
 
-	var notes []struct {
-		ID    int    `json:"id"`
-		Title string `json:"title"`
-	}
+	var notes []NoteInfo
 
 	for rows.Next() {
-		var note struct {
-			ID    int    `json:"id"`
-			Title string `json:"title"`
-		}
+		var note NoteInfo
 		if err := rows.Scan(&note.ID, &note.Title); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
 		notes = append(notes, note)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error after scanning rows: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error after scanning rows", err)
 		return
 	}
 
@@ -392,21 +445,12 @@ func init() {
 }
 
 func serve() {
-	// Get database connection details from viper
-	dbHost := viper.GetString("db_host")
-	dbPort := viper.GetInt("db_port")
-	dbUser := viper.GetString("db_user")
-	dbPass := viper.GetString("db_pass")
 	dbName := viper.GetString("db_name")
 	port := viper.GetInt("port")
 
-	// Create the database connection string
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPass, dbName)
-
 	// Open database connection
 	var err error
-	db, err = sql.Open("postgres", connStr)
+	db, err = utils.Get_db(dbName)
 	if err != nil {
 		log.Fatalf("Error opening database connection: %v", err)
 	}
@@ -417,8 +461,41 @@ func serve() {
 	if err != nil {
 		log.Fatalf("Error connecting to the database: %v", err)
 	}
+	if err := checkSchemaVersion(db); err != nil {
+		log.Fatalf("Error checking the database: %v", err)
+	}
+
+	r := newRouter()
+
+	portStr := fmt.Sprintf(":%d", port)
+	fmt.Printf("Server is running on http://localhost%s\n", portStr)
+
+	// Start a goroutine to periodically clean up orphaned files
+	go func() {
+		for {
+			if err := cleanupOrphanedFiles(); err != nil {
+				log.Printf("Error cleaning up orphaned files: %v", err)
+			}
+			// Wait for 24 hours before the next cleanup
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+
+	// Start the reminder scheduler
+	if viper.GetBool("reminders.enabled") {
+		go runReminderScheduler()
+	}
+
+	log.Fatal(http.ListenAndServe(portStr, r))
+}
 
+// newRouter registers every route of the API, the OpenAPI document in
+// openapi.go must describe each of them
+func newRouter() *mux.Router {
 	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.NotFoundHandler = requestIDMiddleware(http.HandlerFunc(notFoundHandler))
+	r.MethodNotAllowedHandler = requestIDMiddleware(http.HandlerFunc(methodNotAllowedHandler))
 	r.HandleFunc("/notes", getNoteTitles).Methods("GET")
 	r.HandleFunc("/notes/{id}", updateNote).Methods("PUT")
 	r.HandleFunc("/notes", createNote).Methods("POST")
@@ -435,6 +512,8 @@ func serve() {
 	r.HandleFunc("/tags/with-notes", getTagsWithNotes).Methods("GET")
 	r.HandleFunc("/notes/no-content", getNoteTitlesAndIDs).Methods("GET")
 	r.HandleFunc("/notes/search", searchNotes).Methods("GET")
+	// After the fixed /notes/... routes so they take precedence
+	r.HandleFunc("/notes/{id}", getNote).Methods("GET")
 	r.HandleFunc("/tags/{id}", updateTag).Methods("PUT")
 	r.HandleFunc("/tags/{id}", deleteTag).Methods("DELETE")
 	r.HandleFunc("/tags/hierarchy/{childId}", deleteTagHierarchyEntry).Methods("DELETE")
@@ -445,6 +524,36 @@ func serve() {
 	r.HandleFunc("/tasks/{id}", updateTask).Methods("PUT")
 	r.HandleFunc("/tasks/{id}", deleteTask).Methods("DELETE")
 	r.HandleFunc("/tasks/details", getTasksWithDetails).Methods("GET")
+	r.HandleFunc("/tasks/{id}/completions", getTaskCompletions).Methods("GET")
+	r.HandleFunc("/tasks/{id}/clock/start", startClock).Methods("POST")
+	r.HandleFunc("/tasks/{id}/clock/stop", stopClock).Methods("POST")
+	r.HandleFunc("/tasks/{id}/dependencies", getTaskDependencies).Methods("GET")
+	r.HandleFunc("/tasks/{id}/dependencies", addTaskDependency).Methods("POST")
+	r.HandleFunc("/tasks/{id}/dependencies/{dependsOn}", removeTaskDependency).Methods("DELETE")
+	r.HandleFunc("/tasks/actionable", getActionableTasks).Methods("GET")
+	r.HandleFunc("/tasks/next", getNextTasks).Methods("GET")
+	r.HandleFunc("/tasks/{id}/status_changes", getTaskStatusChanges).Methods("GET")
+	r.HandleFunc("/tasks/{id}/history", getTaskHistory).Methods("GET")
+	r.HandleFunc("/task_statuses", listTaskStatuses).Methods("GET")
+	r.HandleFunc("/task_statuses", createTaskStatus).Methods("POST")
+	r.HandleFunc("/task_statuses/{name}", updateTaskStatus).Methods("PUT")
+	r.HandleFunc("/task_statuses/{name}", deleteTaskStatus).Methods("DELETE")
+	r.HandleFunc("/task_statuses/{name}/transitions", addTaskStatusTransition).Methods("POST")
+	r.HandleFunc("/task_statuses/{name}/transitions/{to}", removeTaskStatusTransition).Methods("DELETE")
+	r.HandleFunc("/clock/current", getCurrentClock).Methods("GET")
+	r.HandleFunc("/board", getBoard).Methods("GET")
+	r.HandleFunc("/board/move", moveBoardTask).Methods("POST")
+	r.HandleFunc("/reminders", getSentReminders).Methods("GET")
+	r.HandleFunc("/reminders/events", getReminderEvents).Methods("GET")
+	r.HandleFunc("/reminders/rules", listReminderRules).Methods("GET")
+	r.HandleFunc("/reminders/rules", createReminderRule).Methods("POST")
+	r.HandleFunc("/reminders/rules/{id}", updateReminderRule).Methods("PUT")
+	r.HandleFunc("/reminders/rules/{id}", deleteReminderRule).Methods("DELETE")
+	r.HandleFunc("/agenda", getAgenda).Methods("GET")
+	r.HandleFunc("/reports/clock", getClockReport).Methods("GET")
+	r.HandleFunc("/reports/effort", getEffortReport).Methods("GET")
+	r.HandleFunc("/reports/cycle_time", getCycleTimeReport).Methods("GET")
+	r.HandleFunc("/reports/deadline_pushbacks", getDeadlinePushbackReport).Methods("GET")
 	r.HandleFunc("/task_schedules", createTaskSchedule).Methods("POST")
 	r.HandleFunc("/task_clocks", createTaskClock).Methods("POST")
 	r.HandleFunc("/task_schedules/{id}", updateTaskSchedule).Methods("PUT")
@@ -457,29 +566,50 @@ func serve() {
 	r.HandleFunc("/assets/{id}/download", downloadFile).Methods("GET")
 	r.HandleFunc("/assets", listFiles).Methods("GET")
 	r.HandleFunc("/assets/id", getAssetIDByFilename).Methods("GET")
+	r.HandleFunc("/import/org", importOrg).Methods("POST")
+	r.HandleFunc("/export/org", exportOrg).Methods("GET")
+	r.HandleFunc("/calendar.ics", getCalendar).Methods("GET")
+	r.HandleFunc("/import/ics", importICS).Methods("POST")
+	r.HandleFunc("/openapi.json", getOpenAPI).Methods("GET")
+	r.HandleFunc("/.well-known/caldav", caldavWellKnown)
+	r.PathPrefix("/caldav/").HandlerFunc(caldavHandler)
+	r.HandleFunc("/caldav", caldavHandler)
+	r.PathPrefix("/dav/").HandlerFunc(davHandler)
+	r.HandleFunc("/dav", davHandler)
 
-	portStr := fmt.Sprintf(":%d", port)
-	fmt.Printf("Server is running on http://localhost%s\n", portStr)
+	return r
+}
 
-	// Start a goroutine to periodically clean up orphaned files
-	go func() {
-		for {
-			if err := cleanupOrphanedFiles(); err != nil {
-				log.Printf("Error cleaning up orphaned files: %v", err)
-			}
-			// Wait for 24 hours before the next cleanup
-			time.Sleep(24 * time.Hour)
-		}
-	}()
+func getNote(w http.ResponseWriter, r *http.Request) {
+	noteID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
 
-	log.Fatal(http.ListenAndServe(portStr, r))
+	var n Note
+	var createdAt, modifiedAt sql.NullTime
+	err = db.QueryRow("SELECT id, title, content, created_at, modified_at FROM notes WHERE id = $1", noteID).
+		Scan(&n.ID, &n.Title, &n.Content, &createdAt, &modifiedAt)
+	if err == sql.ErrNoRows {
+		writeError(w, "Note not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeServerError(w, "Error querying note", err)
+		return
+	}
+	n.Created_at = formatNullTimestamp(createdAt)
+	n.Modified_at = formatNullTimestamp(modifiedAt)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n)
 }
 
 func getNoteTitles(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query("SELECT id, title, content, created_at, modified_at FROM notes")
 	if err != nil {
-		log.Printf("Error querying database: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying database", err)
 		return
 	}
 	defer rows.Close()
@@ -487,17 +617,18 @@ func getNoteTitles(w http.ResponseWriter, r *http.Request) {
 	var notes []Note
 	for rows.Next() {
 		var n Note
-		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &n.Created_at, &n.Modified_at); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		var createdAt, modifiedAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &createdAt, &modifiedAt); err != nil {
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
+		n.Created_at = formatNullTimestamp(createdAt)
+		n.Modified_at = formatNullTimestamp(modifiedAt)
 		notes = append(notes, n)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error after scanning rows: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error after scanning rows", err)
 		return
 	}
 
@@ -512,7 +643,7 @@ func updateNote(w http.ResponseWriter, r *http.Request) {
 	var update NoteUpdate
 	err := json.NewDecoder(r.Body).Decode(&update)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -539,32 +670,30 @@ func updateNote(w http.ResponseWriter, r *http.Request) {
 	// Execute the query
 	result, err := db.Exec(query, args...)
 	if err != nil {
-		log.Printf("Error updating note: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error updating note", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Note not found", http.StatusNotFound)
+		writeError(w, "Note not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Note updated successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Note updated successfully"})
 }
 
 func createNote(w http.ResponseWriter, r *http.Request) {
 	var newNote NewNote
 	err := json.NewDecoder(r.Body).Decode(&newNote)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -572,15 +701,14 @@ func createNote(w http.ResponseWriter, r *http.Request) {
 	err = db.QueryRow("INSERT INTO notes (title, content) VALUES ($1, $2) RETURNING id",
 		newNote.Title, newNote.Content).Scan(&noteID)
 	if err != nil {
-		log.Printf("Error creating note: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error creating note", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Note created successfully",
-		"id":      noteID,
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Note created successfully",
+		ID:      noteID,
 	})
 }
 
@@ -588,8 +716,7 @@ func getTagTree(w http.ResponseWriter, r *http.Request) {
 	// First, get all tags
 	rows, err := db.Query("SELECT id, name FROM tags")
 	if err != nil {
-		log.Printf("Error querying tags: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying tags", err)
 		return
 	}
 	defer rows.Close()
@@ -599,8 +726,7 @@ func getTagTree(w http.ResponseWriter, r *http.Request) {
 		var id int
 		var name string
 		if err := rows.Scan(&id, &name); err != nil {
-			log.Printf("Error scanning tag row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning tag row", err)
 			return
 		}
 		tagMap[id] = &TagTree{ID: id, Name: name}
@@ -609,8 +735,7 @@ func getTagTree(w http.ResponseWriter, r *http.Request) {
 	// Get the tag hierarchy
 	rows, err = db.Query("SELECT parent_tag_id, child_tag_id FROM tag_hierarchy")
 	if err != nil {
-		log.Printf("Error querying tag hierarchy: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying tag hierarchy", err)
 		return
 	}
 	defer rows.Close()
@@ -618,8 +743,7 @@ func getTagTree(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var parentID, childID int
 		if err := rows.Scan(&parentID, &childID); err != nil {
-			log.Printf("Error scanning tag hierarchy row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning tag hierarchy row", err)
 			return
 		}
 		parent := tagMap[parentID]
@@ -634,8 +758,7 @@ func getTagTree(w http.ResponseWriter, r *http.Request) {
         JOIN notes n ON nt.note_id = n.id
     `)
 	if err != nil {
-		log.Printf("Error querying notes for tags: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying notes for tags", err)
 		return
 	}
 	defer rows.Close()
@@ -644,8 +767,7 @@ func getTagTree(w http.ResponseWriter, r *http.Request) {
 		var tagID, noteID int
 		var noteTitle string
 		if err := rows.Scan(&tagID, &noteID, &noteTitle); err != nil {
-			log.Printf("Error scanning note info row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning note info row", err)
 			return
 		}
 		if tag, ok := tagMap[tagID]; ok {
@@ -681,21 +803,20 @@ func addNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	var entry NoteHierarchyEntry
 	err := json.NewDecoder(r.Body).Decode(&entry)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Validate hierarchy_type
 	if entry.HierarchyType != "page" && entry.HierarchyType != "block" && entry.HierarchyType != "subpage" {
-		http.Error(w, "Invalid hierarchy_type. Must be 'page', 'block', or 'subpage'", http.StatusBadRequest)
+		writeValidationError(w, "hierarchy_type", "Invalid hierarchy_type. Must be 'page', 'block', or 'subpage'")
 		return
 	}
 
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error starting transaction", err)
 		return
 	}
 	defer tx.Rollback()
@@ -703,8 +824,7 @@ func addNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Fetch all existing hierarchies
 	rows, err := tx.Query("SELECT parent_note_id, child_note_id FROM note_hierarchy")
 	if err != nil {
-		log.Printf("Error fetching note hierarchies: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error fetching note hierarchies", err)
 		return
 	}
 	defer rows.Close()
@@ -713,8 +833,7 @@ func addNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var parent, child int
 		if err := rows.Scan(&parent, &child); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
 		parents = append(parents, parent)
@@ -727,7 +846,7 @@ func addNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 
 	// Check for cycles
 	if detectCycle(parents, children) {
-		http.Error(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
+		writeError(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
 		return
 	}
 
@@ -740,30 +859,27 @@ func addNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
     `, entry.ParentNoteID, entry.ChildNoteID, entry.HierarchyType).Scan(&entryID)
 
 	if err != nil {
-		log.Printf("Error adding note hierarchy entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error adding note hierarchy entry", err)
 		return
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Note hierarchy entry added successfully",
-		"id":      entryID,
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Note hierarchy entry added successfully",
+		ID:      entryID,
 	})
 }
 
 func listTags(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query("SELECT id, name FROM tags ORDER BY name")
 	if err != nil {
-		log.Printf("Error querying tags: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying tags", err)
 		return
 	}
 	defer rows.Close()
@@ -772,16 +888,14 @@ func listTags(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var t Tag
 		if err := rows.Scan(&t.ID, &t.Name); err != nil {
-			log.Printf("Error scanning tag row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning tag row", err)
 			return
 		}
 		tags = append(tags, t)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error after scanning tag rows: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error after scanning tag rows", err)
 		return
 	}
 
@@ -793,22 +907,21 @@ func createTag(w http.ResponseWriter, r *http.Request) {
 	var newTag NewTag
 	err := json.NewDecoder(r.Body).Decode(&newTag)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	var tagID int
 	err = db.QueryRow("INSERT INTO tags (name) VALUES ($1) RETURNING id", newTag.Name).Scan(&tagID)
 	if err != nil {
-		log.Printf("Error creating tag: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error creating tag", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Tag created successfully",
-		"id":      tagID,
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Tag created successfully",
+		ID:      tagID,
 	})
 }
 
@@ -817,7 +930,7 @@ func addTagToNote(w http.ResponseWriter, r *http.Request) {
     noteID, err := strconv.Atoi(vars["id"])
     if err != nil {
         log.Printf("Invalid note ID: %v", err)
-        http.Error(w, "Invalid note ID", http.StatusBadRequest)
+        writeError(w, "Invalid note ID", http.StatusBadRequest)
         return
     }
 
@@ -825,7 +938,7 @@ func addTagToNote(w http.ResponseWriter, r *http.Request) {
     err = json.NewDecoder(r.Body).Decode(&addTag)
     if err != nil {
         log.Printf("Invalid request body: %v", err)
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
+        writeError(w, "Invalid request body", http.StatusBadRequest)
         return
     }
 
@@ -835,13 +948,12 @@ func addTagToNote(w http.ResponseWriter, r *http.Request) {
     var noteExists bool
     err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM notes WHERE id = $1)", noteID).Scan(&noteExists)
     if err != nil {
-        log.Printf("Error checking note existence: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeServerError(w, "Error checking note existence", err)
         return
     }
     if !noteExists {
         log.Printf("Note %d not found", noteID)
-        http.Error(w, "Note not found", http.StatusNotFound)
+        writeError(w, "Note not found", http.StatusNotFound)
         return
     }
 
@@ -849,34 +961,31 @@ func addTagToNote(w http.ResponseWriter, r *http.Request) {
     var tagExists bool
     err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM tags WHERE id = $1)", addTag.TagID).Scan(&tagExists)
     if err != nil {
-        log.Printf("Error checking tag existence: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeServerError(w, "Error checking tag existence", err)
         return
     }
     if !tagExists {
         log.Printf("Tag %d not found", addTag.TagID)
-        http.Error(w, "Tag not found", http.StatusNotFound)
+        writeError(w, "Tag not found", http.StatusNotFound)
         return
     }
 
     // Insert the new relationship
     _, err = db.Exec("INSERT INTO note_tags (note_id, tag_id) VALUES ($1, $2)", noteID, addTag.TagID)
     if err != nil {
-        log.Printf("Error adding tag to note: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
+        writeServerError(w, "Error adding tag to note", err)
         return
     }
 
     log.Printf("Successfully added tag %d to note %d", addTag.TagID, noteID)
     w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "Tag added to note successfully"})
+    json.NewEncoder(w).Encode(MessageResponse{Message: "Tag added to note successfully"})
 }
 
 func listCategories(w http.ResponseWriter, r *http.Request) {
 	rows, err := db.Query("SELECT id, name FROM categories ORDER BY name")
 	if err != nil {
-		log.Printf("Error querying categories: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying categories", err)
 		return
 	}
 	defer rows.Close()
@@ -885,16 +994,14 @@ func listCategories(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var c Category
 		if err := rows.Scan(&c.ID, &c.Name); err != nil {
-			log.Printf("Error scanning category row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning category row", err)
 			return
 		}
 		categories = append(categories, c)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error after scanning category rows: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error after scanning category rows", err)
 		return
 	}
 
@@ -906,29 +1013,27 @@ func createCategory(w http.ResponseWriter, r *http.Request) {
 	var newCategory NewCategory
 	err := json.NewDecoder(r.Body).Decode(&newCategory)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	var categoryID int
 	err = db.QueryRow("INSERT INTO categories (name) VALUES ($1) RETURNING id", newCategory.Name).Scan(&categoryID)
 	if err != nil {
-		log.Printf("Error creating category: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error creating category", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Category created successfully",
-		"id":      categoryID,
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Category created successfully",
+		ID:      categoryID,
 	})
 }
 func getNoteTree(w http.ResponseWriter, r *http.Request) {
 	rootNotes, err := buildNoteTree(db)
 	if err != nil {
-		log.Printf("Error building note tree: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error building note tree", err)
 		return
 	}
 
@@ -946,8 +1051,7 @@ func getTagsWithNotes(w http.ResponseWriter, r *http.Request) {
         ORDER BY t.name, n.title
     `)
 	if err != nil {
-		log.Printf("Error querying tags and notes: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying tags and notes", err)
 		return
 	}
 	defer rows.Close()
@@ -960,8 +1064,7 @@ func getTagsWithNotes(w http.ResponseWriter, r *http.Request) {
 		var noteTitle sql.NullString
 
 		if err := rows.Scan(&tagID, &tagName, &noteID, &noteTitle); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
 
@@ -977,8 +1080,7 @@ func getTagsWithNotes(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Error after scanning rows: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error after scanning rows", err)
 		return
 	}
 
@@ -995,43 +1097,35 @@ func getTagsWithNotes(w http.ResponseWriter, r *http.Request) {
 func getNoteTitlesAndIDs(w http.ResponseWriter, r *http.Request) {
 	// I couldn't get arguments to work so I'm just going to hardcode the route.
 
-	type Note struct {
-		ID         int    `json:"id"`
-		Title      string `json:"title"`
-		CreatedAt  string `json:"created_at"`
-		ModifiedAt string `json:"modified_at"`
-	}
-
 	rows, err := db.Query("SELECT id, title, created_at, modified_at FROM notes ORDER BY id")
 	if err != nil {
-		log.Printf("Error querying database: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error querying database", err)
 		return
 	}
 	defer rows.Close()
 
-	var notes []Note
+	var notes []NoteSummary
 
 	for rows.Next() {
-		var note Note
-		if err := rows.Scan(&note.ID, &note.Title, &note.CreatedAt, &note.ModifiedAt); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		var note NoteSummary
+		var createdAt, modifiedAt sql.NullTime
+		if err := rows.Scan(&note.ID, &note.Title, &createdAt, &modifiedAt); err != nil {
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
+		note.CreatedAt = formatNullTimestamp(createdAt)
+		note.ModifiedAt = formatNullTimestamp(modifiedAt)
 		notes = append(notes, note)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Printf("Row iteration error: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Row iteration error", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(notes); err != nil {
-		log.Printf("Error encoding JSON response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error encoding JSON response", err)
 	}
 }
 
@@ -1042,36 +1136,34 @@ func updateTag(w http.ResponseWriter, r *http.Request) {
 	var req UpdateTagRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	if req.Name == "" {
-		http.Error(w, "Tag name cannot be empty", http.StatusBadRequest)
+		writeValidationError(w, "name", "Tag name cannot be empty")
 		return
 	}
 
 	result, err := db.Exec("UPDATE tags SET name = $1 WHERE id = $2", req.Name, tagID)
 	if err != nil {
-		log.Printf("Error updating tag: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error updating tag", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Tag not found", http.StatusNotFound)
+		writeError(w, "Tag not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Tag updated successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Tag updated successfully"})
 }
 
 func deleteTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
@@ -1081,25 +1173,23 @@ func deleteTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Execute the delete query
 	result, err := db.Exec("DELETE FROM tag_hierarchy WHERE child_tag_id = $1", childTagID)
 	if err != nil {
-		log.Printf("Error deleting tag hierarchy entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting tag hierarchy entry", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Tag hierarchy entry not found", http.StatusNotFound)
+		writeError(w, "Tag hierarchy entry not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Tag hierarchy entry deleted successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Tag hierarchy entry deleted successfully"})
 }
 
 func deleteNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
@@ -1109,25 +1199,23 @@ func deleteNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Execute the delete query
 	result, err := db.Exec("DELETE FROM note_hierarchy WHERE child_note_id = $1", childNoteID)
 	if err != nil {
-		log.Printf("Error deleting note hierarchy entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting note hierarchy entry", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Note hierarchy entry not found", http.StatusNotFound)
+		writeError(w, "Note hierarchy entry not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Note hierarchy entry deleted successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Note hierarchy entry deleted successfully"})
 }
 
 func updateNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
@@ -1137,21 +1225,20 @@ func updateNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	var entry NoteHierarchyEntry
 	err := json.NewDecoder(r.Body).Decode(&entry)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Validate hierarchy_type
 	if entry.HierarchyType != "page" && entry.HierarchyType != "block" && entry.HierarchyType != "subpage" {
-		http.Error(w, "Invalid hierarchy_type. Must be 'page', 'block', or 'subpage'", http.StatusBadRequest)
+		writeValidationError(w, "hierarchy_type", "Invalid hierarchy_type. Must be 'page', 'block', or 'subpage'")
 		return
 	}
 
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error starting transaction", err)
 		return
 	}
 	defer tx.Rollback()
@@ -1159,8 +1246,7 @@ func updateNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Fetch all existing hierarchies
 	rows, err := tx.Query("SELECT parent_note_id, child_note_id FROM note_hierarchy")
 	if err != nil {
-		log.Printf("Error fetching note hierarchies: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error fetching note hierarchies", err)
 		return
 	}
 	defer rows.Close()
@@ -1169,8 +1255,7 @@ func updateNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var parent, child int
 		if err := rows.Scan(&parent, &child); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
 		parents = append(parents, parent)
@@ -1180,7 +1265,7 @@ func updateNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Add the new relationship to check
 	childID, err := strconv.Atoi(childNoteID)
 	if err != nil {
-		http.Error(w, "Invalid child note ID", http.StatusBadRequest)
+		writeError(w, "Invalid child note ID", http.StatusBadRequest)
 		return
 	}
 	parents = append(parents, entry.ParentNoteID)
@@ -1188,7 +1273,7 @@ func updateNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 
 	// Check for cycles
 	if detectCycle(parents, children) {
-		http.Error(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
+		writeError(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
 		return
 	}
 
@@ -1200,52 +1285,46 @@ func updateNoteHierarchyEntry(w http.ResponseWriter, r *http.Request) {
     `, entry.ParentNoteID, entry.HierarchyType, childNoteID)
 
 	if err != nil {
-		log.Printf("Error updating note hierarchy entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error updating note hierarchy entry", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Note hierarchy entry not found", http.StatusNotFound)
+		writeError(w, "Note hierarchy entry not found", http.StatusNotFound)
 		return
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Note hierarchy entry updated successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Note hierarchy entry updated successfully"})
 }
 
 func updateTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	childTagID := vars["childId"]
 
-	var entry struct {
-		ParentTagID int `json:"parent_tag_id"`
-	}
+	var entry UpdateTagHierarchyEntry
 	err := json.NewDecoder(r.Body).Decode(&entry)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error starting transaction", err)
 		return
 	}
 	defer tx.Rollback()
@@ -1253,8 +1332,7 @@ func updateTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Fetch all existing hierarchies
 	rows, err := tx.Query("SELECT parent_tag_id, child_tag_id FROM tag_hierarchy")
 	if err != nil {
-		log.Printf("Error fetching tag hierarchies: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error fetching tag hierarchies", err)
 		return
 	}
 	defer rows.Close()
@@ -1263,8 +1341,7 @@ func updateTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var parent, child int
 		if err := rows.Scan(&parent, &child); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
 		parents = append(parents, parent)
@@ -1274,7 +1351,7 @@ func updateTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Add the new relationship to check
 	childID, err := strconv.Atoi(childTagID)
 	if err != nil {
-		http.Error(w, "Invalid child tag ID", http.StatusBadRequest)
+		writeError(w, "Invalid child tag ID", http.StatusBadRequest)
 		return
 	}
 	parents = append(parents, entry.ParentTagID)
@@ -1282,7 +1359,7 @@ func updateTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 
 	// Check for cycles
 	if detectCycle(parents, children) {
-		http.Error(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
+		writeError(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
 		return
 	}
 
@@ -1294,78 +1371,162 @@ func updateTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
     `, entry.ParentTagID, childTagID)
 
 	if err != nil {
-		log.Printf("Error updating tag hierarchy entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error updating tag hierarchy entry", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Tag hierarchy entry not found", http.StatusNotFound)
+		writeError(w, "Tag hierarchy entry not found", http.StatusNotFound)
 		return
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Tag hierarchy entry updated successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Tag hierarchy entry updated successfully"})
 }
 
-func createTask(w http.ResponseWriter, r *http.Request) {
-	var newTask NewTask
-	err := json.NewDecoder(r.Body).Decode(&newTask)
+// decodeTaskRequest decodes the body of a task request into v. The actual
+// effort is derived from the clock entries, the actual_effort sent by older
+// clients is a deprecated alias of actual_effort_override, which wins if
+// both are set.
+func decodeTaskRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return false
 	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	if effort, ok := fields["actual_effort"]; ok {
+		if _, ok := fields["actual_effort_override"]; !ok {
+			fields["actual_effort_override"] = effort
+		}
+		delete(fields, "actual_effort")
+		if body, err = json.Marshal(fields); err != nil {
+			writeError(w, "Invalid request body", http.StatusBadRequest)
+			return false
+		}
+	}
+	if json.Unmarshal(body, v) != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
 
-	// Validate the status
-	validStatuses := []string{"todo", "done", "wait", "hold", "idea", "kill", "proj", "event"}
-	if !contains(validStatuses, newTask.Status) {
-		http.Error(w, "Invalid status", http.StatusBadRequest)
+func createTask(w http.ResponseWriter, r *http.Request) {
+	var newTask NewTask
+	if !decodeTaskRequest(w, r, &newTask) {
 		return
 	}
 
 	// Validate the priority
 	if newTask.Priority < 1 || newTask.Priority > 5 {
-		http.Error(w, "Priority must be between 1 and 5", http.StatusBadRequest)
+		writeValidationError(w, "priority", "Priority must be between 1 and 5")
 		return
 	}
 
 	// Validate the goal relationship
 	if newTask.GoalRelationship < 1 || newTask.GoalRelationship > 5 {
-		http.Error(w, "Goal relationship must be between 1 and 5", http.StatusBadRequest)
+		writeValidationError(w, "goal_relationship", "Goal relationship must be between 1 and 5")
+		return
+	}
+
+	if newTask.ActualEffortOverride != nil && *newTask.ActualEffortOverride < 0 {
+		writeValidationError(w, "actual_effort_override", "Actual effort override must not be negative")
+		return
+	}
+
+	// Validate the deadline, all-day deadlines are dates in the request timezone
+	var deadline interface{}
+	if newTask.Deadline != "" {
+		loc, err := requestLocation(r)
+		if err != nil {
+			writeInputError(w, err)
+			return
+		}
+		t, err := parseDeadline(newTask.Deadline, newTask.AllDay, loc)
+		if err != nil {
+			writeInputError(w, err)
+			return
+		}
+		deadline = t
+	}
+
+	// Validate the repeat rule
+	var repeatRule interface{}
+	if newTask.RepeatRule != "" {
+		rule, err := parseRepeatRule(newTask.RepeatRule)
+		if err != nil {
+			writeValidationError(w, "repeat_rule", fmt.Sprintf("Invalid repeat rule: %v", err))
+			return
+		}
+		repeatRule = rule.String()
+	}
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Validate the status
+	statuses, _, err := loadTaskStatuses(tx)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	if newTask.Status == "" {
+		newTask.Status = statuses.Initial()
+	}
+	if _, ok := statuses[newTask.Status]; !ok {
+		writeValidationError(w, "status", "Invalid status")
 		return
 	}
 
 	var taskID int
-	err = db.QueryRow(`
-        INSERT INTO tasks (note_id, status, effort_estimate, actual_effort, deadline, priority, all_day, goal_relationship)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	err = tx.QueryRow(`
+        INSERT INTO tasks (note_id, status, effort_estimate, actual_effort_override, deadline, priority, all_day, goal_relationship, repeat_rule)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
         RETURNING id
-    `, newTask.NoteID, newTask.Status, newTask.EffortEstimate, newTask.ActualEffort, newTask.Deadline, newTask.Priority, newTask.AllDay, newTask.GoalRelationship).Scan(&taskID)
+    `, newTask.NoteID, newTask.Status, newTask.EffortEstimate, newTask.ActualEffortOverride, deadline, newTask.Priority, newTask.AllDay, newTask.GoalRelationship, repeatRule).Scan(&taskID)
 
 	if err != nil {
-		log.Printf("Error creating task: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error creating task", err)
+		return
+	}
+
+	if err := recordStatusChange(tx, taskID, "", newTask.Status); err != nil {
+		writeServerError(w, "Error creating task", err)
+		return
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Task created successfully",
-		"id":      taskID,
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Task created successfully",
+		ID:      taskID,
 	})
 }
 
@@ -1374,9 +1535,34 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 	taskID := vars["id"]
 
 	var update UpdateTask
-	err := json.NewDecoder(r.Body).Decode(&update)
+	if !decodeTaskRequest(w, r, &update) {
+		return
+	}
+	loc, err := requestLocation(r)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeInputError(w, err)
+		return
+	}
+
+	// Start a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Get the current status to detect the task being completed, and
+	// whether the task is all-day to interpret a new deadline
+	var previousStatus string
+	var allDay bool
+	err = tx.QueryRow("SELECT status, COALESCE(all_day, FALSE) FROM tasks WHERE id = $1"+forUpdate(), taskID).Scan(&previousStatus, &allDay)
+	if err == sql.ErrNoRows {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeServerError(w, "Error querying task", err)
 		return
 	}
 
@@ -1385,13 +1571,9 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 	var args []interface{}
 	var argIndex int = 1
 
-	// Validate and add fields to update
+	// Validate and add fields to update, the status is validated against
+	// the task_statuses workflow below
 	if update.Status != nil {
-		validStatuses := []string{"todo", "done", "wait", "hold", "idea", "kill", "proj", "event"}
-		if !contains(validStatuses, *update.Status) {
-			http.Error(w, "Invalid status", http.StatusBadRequest)
-			return
-		}
 		query += fmt.Sprintf(", status = $%d", argIndex)
 		args = append(args, *update.Status)
 		argIndex++
@@ -1403,21 +1585,38 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 		argIndex++
 	}
 
-	if update.ActualEffort != nil {
-		query += fmt.Sprintf(", actual_effort = $%d", argIndex)
-		args = append(args, *update.ActualEffort)
+	if update.ActualEffortOverride.Set {
+		if v := update.ActualEffortOverride.Value; v != nil && *v < 0 {
+			writeValidationError(w, "actual_effort_override", "Actual effort override must not be negative")
+			return
+		}
+		query += fmt.Sprintf(", actual_effort_override = $%d", argIndex)
+		args = append(args, update.ActualEffortOverride.Value)
 		argIndex++
 	}
 
 	if update.Deadline != nil {
+		// An empty deadline removes it
+		var deadline interface{}
+		if *update.Deadline != "" {
+			if update.AllDay != nil {
+				allDay = *update.AllDay
+			}
+			t, err := parseDeadline(*update.Deadline, allDay, loc)
+			if err != nil {
+				writeInputError(w, err)
+				return
+			}
+			deadline = t
+		}
 		query += fmt.Sprintf(", deadline = $%d", argIndex)
-		args = append(args, *update.Deadline)
+		args = append(args, deadline)
 		argIndex++
 	}
 
 	if update.Priority != nil {
 		if *update.Priority < 1 || *update.Priority > 5 {
-			http.Error(w, "Priority must be between 1 and 5", http.StatusBadRequest)
+			writeValidationError(w, "priority", "Priority must be between 1 and 5")
 			return
 		}
 		query += fmt.Sprintf(", priority = $%d", argIndex)
@@ -1433,7 +1632,7 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 
 	if update.GoalRelationship != nil {
 		if *update.GoalRelationship < 1 || *update.GoalRelationship > 5 {
-			http.Error(w, "Goal relationship must be between 1 and 5", http.StatusBadRequest)
+			writeValidationError(w, "goal_relationship", "Goal relationship must be between 1 and 5")
 			return
 		}
 		query += fmt.Sprintf(", goal_relationship = $%d", argIndex)
@@ -1441,31 +1640,77 @@ func updateTask(w http.ResponseWriter, r *http.Request) {
 		argIndex++
 	}
 
+	if update.RepeatRule != nil {
+		// An empty rule stops the task repeating
+		var repeatRule interface{}
+		if *update.RepeatRule != "" {
+			rule, err := parseRepeatRule(*update.RepeatRule)
+			if err != nil {
+				writeValidationError(w, "repeat_rule", fmt.Sprintf("Invalid repeat rule: %v", err))
+				return
+			}
+			repeatRule = rule.String()
+		}
+		query += fmt.Sprintf(", repeat_rule = $%d", argIndex)
+		args = append(args, repeatRule)
+		argIndex++
+	}
+
 	query += fmt.Sprintf(" WHERE id = $%d", argIndex)
 	args = append(args, taskID)
 
+	statuses, _, err := loadTaskStatuses(tx)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	if update.Status != nil {
+		if err := statuses.checkStatusChange(previousStatus, *update.Status); err != nil {
+			writeInputError(w, err)
+			return
+		}
+	}
+
 	// Execute the query
-	result, err := db.Exec(query, args...)
+	result, err := tx.Exec(query, args...)
 	if err != nil {
-		log.Printf("Error updating task: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error updating task", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Task not found", http.StatusNotFound)
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	// Log the status change, completions and advance recurring tasks
+	var nextDeadline *time.Time
+	if update.Status != nil {
+		nextDeadline, err = finishStatusChange(tx, statuses, taskID, previousStatus, *update.Status, loc)
+		if err != nil {
+			writeServerError(w, "Error completing task", err)
+			return
+		}
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
+	response := TaskUpdateResponse{Message: "Task updated successfully"}
+	if nextDeadline != nil {
+		response.NextDeadline = formatTimestamp(*nextDeadline)
+	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task updated successfully"})
+	json.NewEncoder(w).Encode(response)
 }
 
 func deleteTask(w http.ResponseWriter, r *http.Request) {
@@ -1475,8 +1720,7 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error starting transaction", err)
 		return
 	}
 	defer tx.Rollback()
@@ -1484,40 +1728,36 @@ func deleteTask(w http.ResponseWriter, r *http.Request) {
 	// Delete the task
 	result, err := tx.Exec("DELETE FROM tasks WHERE id = $1", taskID)
 	if err != nil {
-		log.Printf("Error deleting task: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting task", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Task not found", http.StatusNotFound)
+		writeError(w, "Task not found", http.StatusNotFound)
 		return
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task deleted successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task deleted successfully"})
 }
 
 func getTasksWithDetails(w http.ResponseWriter, r *http.Request) {
     tasks, err := buildTasksWithDetails(db)
 
 	if err != nil {
-		log.Printf("Error building task list: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error building task list", err)
 		return
 	}
 
@@ -1529,17 +1769,31 @@ func createTaskSchedule(w http.ResponseWriter, r *http.Request) {
 	var newSchedule NewTaskSchedule
 	err := json.NewDecoder(r.Body).Decode(&newSchedule)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Validate the input
 	if newSchedule.TaskID == 0 {
-		http.Error(w, "Task ID is required", http.StatusBadRequest)
+		writeValidationError(w, "task_id", "Task ID is required")
 		return
 	}
 	if newSchedule.StartDatetime == "" || newSchedule.EndDatetime == "" {
-		http.Error(w, "Start and end datetimes are required", http.StatusBadRequest)
+		writeError(w, "Start and end datetimes are required", http.StatusBadRequest)
+		return
+	}
+	start, err := parseTimestamp("start_datetime", newSchedule.StartDatetime)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	end, err := parseTimestamp("end_datetime", newSchedule.EndDatetime)
+	if err != nil {
+		writeInputError(w, err)
+		return
+	}
+	if end.Before(start) {
+		writeValidationError(w, "end_datetime", "End datetime must not be before start datetime")
 		return
 	}
 
@@ -1549,18 +1803,17 @@ func createTaskSchedule(w http.ResponseWriter, r *http.Request) {
         INSERT INTO task_schedules (task_id, start_datetime, end_datetime)
         VALUES ($1, $2, $3)
         RETURNING id
-    `, newSchedule.TaskID, newSchedule.StartDatetime, newSchedule.EndDatetime).Scan(&scheduleID)
+    `, newSchedule.TaskID, start, end).Scan(&scheduleID)
 
 	if err != nil {
-		log.Printf("Error creating task schedule: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error creating task schedule", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Task schedule created successfully",
-		"id":      scheduleID,
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Task schedule created successfully",
+		ID:      scheduleID,
 	})
 }
 
@@ -1569,17 +1822,22 @@ func createTaskClock(w http.ResponseWriter, r *http.Request) {
 	var err error
 	err = json.NewDecoder(r.Body).Decode(&newClock)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Validate the input
 	if newClock.TaskID == 0 {
-		http.Error(w, "Task ID is required", http.StatusBadRequest)
+		writeValidationError(w, "task_id", "Task ID is required")
 		return
 	}
 	if newClock.ClockIn == "" {
-		http.Error(w, "Clock in time is required", http.StatusBadRequest)
+		writeValidationError(w, "clock_in", "Clock in time is required")
+		return
+	}
+	clockIn, err := parseTimestamp("clock_in", newClock.ClockIn)
+	if err != nil {
+		writeInputError(w, err)
 		return
 	}
 
@@ -1590,25 +1848,38 @@ func createTaskClock(w http.ResponseWriter, r *http.Request) {
             INSERT INTO task_clocks (task_id, clock_in)
             VALUES ($1, $2)
             RETURNING id
-        `, newClock.TaskID, newClock.ClockIn).Scan(&clockID)
+        `, newClock.TaskID, clockIn).Scan(&clockID)
 	} else {
+		var clockOut time.Time
+		clockOut, err = parseTimestamp("clock_out", newClock.ClockOut)
+		if err != nil {
+			writeInputError(w, err)
+			return
+		}
 		err = db.QueryRow(`
             INSERT INTO task_clocks (task_id, clock_in, clock_out)
             VALUES ($1, $2, $3)
             RETURNING id
-        `, newClock.TaskID, newClock.ClockIn, newClock.ClockOut).Scan(&clockID)
+        `, newClock.TaskID, clockIn, clockOut).Scan(&clockID)
 	}
 
 	if err != nil {
-		log.Printf("Error creating task clock entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		if isPGError(err, pgExclusionViolation) {
+			writeError(w, "Clock entry overlaps an existing entry", http.StatusConflict)
+			return
+		}
+		if isPGError(err, pgCheckViolation) {
+			writeValidationError(w, "clock_out", "Clock out time must not be before clock in time")
+			return
+		}
+		writeServerError(w, "Error creating task clock entry", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Task clock entry created successfully",
-		"id":      clockID,
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Task clock entry created successfully",
+		ID:      clockID,
 	})
 }
 
@@ -1619,7 +1890,7 @@ func updateTaskSchedule(w http.ResponseWriter, r *http.Request) {
 	var update UpdateTaskSchedule
 	err := json.NewDecoder(r.Body).Decode(&update)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -1629,17 +1900,27 @@ func updateTaskSchedule(w http.ResponseWriter, r *http.Request) {
 	var setFields []string
 
 	if update.StartDatetime != "" {
-		args = append(args, update.StartDatetime)
+		start, err := parseTimestamp("start_datetime", update.StartDatetime)
+		if err != nil {
+			writeInputError(w, err)
+			return
+		}
+		args = append(args, start)
 		setFields = append(setFields, fmt.Sprintf("start_datetime = $%d", len(args)))
 	}
 
 	if update.EndDatetime != "" {
-		args = append(args, update.EndDatetime)
+		end, err := parseTimestamp("end_datetime", update.EndDatetime)
+		if err != nil {
+			writeInputError(w, err)
+			return
+		}
+		args = append(args, end)
 		setFields = append(setFields, fmt.Sprintf("end_datetime = $%d", len(args)))
 	}
 
 	if len(setFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+		writeError(w, "No fields to update", http.StatusBadRequest)
 		return
 	}
 
@@ -1650,25 +1931,27 @@ func updateTaskSchedule(w http.ResponseWriter, r *http.Request) {
 	// Execute the query
 	result, err := db.Exec(query, args...)
 	if err != nil {
-		log.Printf("Error updating task schedule: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		if isPGError(err, pgCheckViolation) {
+			writeValidationError(w, "end_datetime", "End datetime must not be before start datetime")
+			return
+		}
+		writeServerError(w, "Error updating task schedule", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Task schedule not found", http.StatusNotFound)
+		writeError(w, "Task schedule not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task schedule updated successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task schedule updated successfully"})
 }
 
 func deleteTaskSchedule(w http.ResponseWriter, r *http.Request) {
@@ -1678,25 +1961,23 @@ func deleteTaskSchedule(w http.ResponseWriter, r *http.Request) {
 	// Execute the delete query
 	result, err := db.Exec("DELETE FROM task_schedules WHERE id = $1", scheduleID)
 	if err != nil {
-		log.Printf("Error deleting task schedule: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting task schedule", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Task schedule not found", http.StatusNotFound)
+		writeError(w, "Task schedule not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task schedule deleted successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task schedule deleted successfully"})
 }
 
 func deleteTaskClock(w http.ResponseWriter, r *http.Request) {
@@ -1706,25 +1987,23 @@ func deleteTaskClock(w http.ResponseWriter, r *http.Request) {
 	// Execute the delete query
 	result, err := db.Exec("DELETE FROM task_clocks WHERE id = $1", clockID)
 	if err != nil {
-		log.Printf("Error deleting task clock entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting task clock entry", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Task clock entry not found", http.StatusNotFound)
+		writeError(w, "Task clock entry not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task clock entry deleted successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task clock entry deleted successfully"})
 }
 
 func updateTaskClock(w http.ResponseWriter, r *http.Request) {
@@ -1734,7 +2013,7 @@ func updateTaskClock(w http.ResponseWriter, r *http.Request) {
 	var update UpdateTaskClock
 	err := json.NewDecoder(r.Body).Decode(&update)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
@@ -1744,17 +2023,27 @@ func updateTaskClock(w http.ResponseWriter, r *http.Request) {
 	var setFields []string
 
 	if update.ClockIn != "" {
-		args = append(args, update.ClockIn)
+		clockIn, err := parseTimestamp("clock_in", update.ClockIn)
+		if err != nil {
+			writeInputError(w, err)
+			return
+		}
+		args = append(args, clockIn)
 		setFields = append(setFields, fmt.Sprintf("clock_in = $%d", len(args)))
 	}
 
 	if update.ClockOut != "" {
-		args = append(args, update.ClockOut)
+		clockOut, err := parseTimestamp("clock_out", update.ClockOut)
+		if err != nil {
+			writeInputError(w, err)
+			return
+		}
+		args = append(args, clockOut)
 		setFields = append(setFields, fmt.Sprintf("clock_out = $%d", len(args)))
 	}
 
 	if len(setFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+		writeError(w, "No fields to update", http.StatusBadRequest)
 		return
 	}
 
@@ -1765,41 +2054,45 @@ func updateTaskClock(w http.ResponseWriter, r *http.Request) {
 	// Execute the query
 	result, err := db.Exec(query, args...)
 	if err != nil {
-		log.Printf("Error updating task clock: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		if isPGError(err, pgExclusionViolation) {
+			writeError(w, "Clock entry overlaps an existing entry", http.StatusConflict)
+			return
+		}
+		if isPGError(err, pgCheckViolation) {
+			writeValidationError(w, "clock_out", "Clock out time must not be before clock in time")
+			return
+		}
+		writeServerError(w, "Error updating task clock", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Task clock entry not found", http.StatusNotFound)
+		writeError(w, "Task clock entry not found", http.StatusNotFound)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task clock entry updated successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task clock entry updated successfully"})
 }
 
 func getTasksWithDetailsAsTree(w http.ResponseWriter, r *http.Request) {
 	// Get the flat list of tasks
 	tasks, err := buildTasksWithDetails(db)
 	if err != nil {
-		log.Printf("Error building task list: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error building task list", err)
 		return
 	}
 
 	// Get the note tree
 	noteHierarchy, err := buildNoteTree(db)
 	if err != nil {
-		log.Printf("Error building note tree: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error building note tree", err)
 		return
 	}
 
@@ -1815,8 +2108,7 @@ func getTasksWithDetailsAsTree(w http.ResponseWriter, r *http.Request) {
 	// Respond with the filtered note tree
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(filteredNotes); err != nil {
-		log.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error encoding response", err)
 		return
 	}
 }
@@ -1873,8 +2165,7 @@ func deleteTag(w http.ResponseWriter, r *http.Request) {
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error starting transaction", err)
 		return
 	}
 	defer tx.Rollback()
@@ -1882,132 +2173,130 @@ func deleteTag(w http.ResponseWriter, r *http.Request) {
 	// Delete related entries in note_tags
 	_, err = tx.Exec("DELETE FROM note_tags WHERE tag_id = $1", tagID)
 	if err != nil {
-		log.Printf("Error deleting from note_tags: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting from note_tags", err)
 		return
 	}
 
 	// Delete related entries in tag_hierarchy
 	_, err = tx.Exec("DELETE FROM tag_hierarchy WHERE parent_tag_id = $1 OR child_tag_id = $1", tagID)
 	if err != nil {
-		log.Printf("Error deleting from tag_hierarchy: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting from tag_hierarchy", err)
 		return
 	}
 
 	// Delete the tag
 	result, err := tx.Exec("DELETE FROM tags WHERE id = $1", tagID)
 	if err != nil {
-		log.Printf("Error deleting tag: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error deleting tag", err)
 		return
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error getting rows affected", err)
 		return
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Tag not found", http.StatusNotFound)
+		writeError(w, "Tag not found", http.StatusNotFound)
 		return
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Tag deleted successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Tag deleted successfully"})
 }
 
 func deleteNote(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	noteID := vars["id"]
+	noteID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, "Invalid note ID", http.StatusBadRequest)
+		return
+	}
+
+	found, err := deleteNoteByID(noteID)
+	if err != nil {
+		writeServerError(w, "Error deleting note", err)
+		return
+	}
+	if !found {
+		writeError(w, "Note not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Note deleted successfully"})
+}
 
+// deleteNoteByID deletes a note with its tags, categories and hierarchy
+// entries, its children become top level notes. It reports false if there
+// is no such note.
+func deleteNoteByID(noteID int) (bool, error) {
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return false, fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
 
 	// Delete related entries in note_tags
 	_, err = tx.Exec("DELETE FROM note_tags WHERE note_id = $1", noteID)
 	if err != nil {
-		log.Printf("Error deleting from note_tags: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return false, fmt.Errorf("error deleting from note_tags: %w", err)
 	}
 
 	// Delete related entries in note_categories
 	_, err = tx.Exec("DELETE FROM note_categories WHERE note_id = $1", noteID)
 	if err != nil {
-		log.Printf("Error deleting from note_categories: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return false, fmt.Errorf("error deleting from note_categories: %w", err)
 	}
 
 	// Delete related entries in note_hierarchy
 	_, err = tx.Exec("DELETE FROM note_hierarchy WHERE parent_note_id = $1 OR child_note_id = $1", noteID)
 	if err != nil {
-		log.Printf("Error deleting from note_hierarchy: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return false, fmt.Errorf("error deleting from note_hierarchy: %w", err)
 	}
 
 	// Delete the note
 	result, err := tx.Exec("DELETE FROM notes WHERE id = $1", noteID)
 	if err != nil {
-		log.Printf("Error deleting note: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return false, fmt.Errorf("error deleting note: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return false, fmt.Errorf("error getting rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		http.Error(w, "Note not found", http.StatusNotFound)
-		return
+		return false, nil
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return false, fmt.Errorf("error committing transaction: %w", err)
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Note deleted successfully"})
+	return true, nil
 }
 
 
 func buildTasksWithDetails(db *sql.DB) ([]*TaskWithDetails, error) {
-	// Query to get tasks with their schedules and clocks
+	// Schedules and clocks are queried separately, joining both to the
+	// tasks would repeat each schedule for every clock
 	query := `
         SELECT
-            t.id, t.note_id, t.status, t.effort_estimate, t.actual_effort,
+            t.id, t.note_id, t.status, t.effort_estimate,
+            te.actual_effort, te.clocked_effort, te.actual_effort_override,
             t.deadline, t.priority, t.all_day, t.goal_relationship,
-            t.created_at, t.modified_at,
-            ts.id, ts.start_datetime, ts.end_datetime,
-            tc.id, tc.clock_in, tc.clock_out
+            COALESCE(t.repeat_rule, ''), t.created_at, t.modified_at
         FROM tasks t
-        LEFT JOIN task_schedules ts ON t.id = ts.task_id
-        LEFT JOIN task_clocks tc ON t.id = tc.task_id
-        ORDER BY t.id, ts.id, tc.id
+        JOIN task_efforts te ON te.task_id = t.id
+        ORDER BY t.id
     `
 	rows, err := db.Query(query)
 	if err != nil {
@@ -2018,52 +2307,102 @@ func buildTasksWithDetails(db *sql.DB) ([]*TaskWithDetails, error) {
 	tasksMap := make(map[int]*TaskWithDetails)
 
 	for rows.Next() {
-		var task TaskWithDetails
-		var schedule TaskSchedule
-		var clock TaskClock
-		var scheduleID, clockID sql.NullInt64
-		var startDatetime, endDatetime, clockIn, clockOut sql.NullString
+		task := &TaskWithDetails{}
+		var createdAt, modifiedAt sql.NullTime
+		// Tasks created by the importers may leave these unset
+		var effortEstimate, actualEffortOverride sql.NullFloat64
+		var deadline sql.NullTime
+		var priority, goalRelationship sql.NullInt64
+		var allDay sql.NullBool
 
 		err := rows.Scan(
-			&task.ID, &task.NoteID, &task.Status, &task.EffortEstimate, &task.ActualEffort,
-			&task.Deadline, &task.Priority, &task.AllDay, &task.GoalRelationship,
-			&task.CreatedAt, &task.ModifiedAt,
-			&scheduleID, &startDatetime, &endDatetime,
-			&clockID, &clockIn, &clockOut,
+			&task.ID, &task.NoteID, &task.Status, &effortEstimate,
+			&task.ActualEffort, &task.ClockedEffort, &actualEffortOverride,
+			&deadline, &priority, &allDay, &goalRelationship,
+			&task.RepeatRule, &createdAt, &modifiedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
-
-		if existingTask, ok := tasksMap[task.ID]; ok {
-			task = *existingTask
-		} else {
-			tasksMap[task.ID] = &task
+		task.EffortEstimate = effortEstimate.Float64
+		if actualEffortOverride.Valid {
+			task.ActualEffortOverride = &actualEffortOverride.Float64
 		}
+		if effortEstimate.Valid && effortEstimate.Float64 > 0 {
+			variance := task.ActualEffort - effortEstimate.Float64
+			task.EffortVariance = &variance
+		}
+		task.Deadline = formatNullTimestamp(deadline)
+		task.CreatedAt = formatNullTimestamp(createdAt)
+		task.ModifiedAt = formatNullTimestamp(modifiedAt)
+		task.Priority = int(priority.Int64)
+		task.AllDay = allDay.Bool
+		task.GoalRelationship = int(goalRelationship.Int64)
+		tasksMap[task.ID] = task
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning rows: %w", err)
+	}
 
-		if scheduleID.Valid {
-			schedule.ID = int(scheduleID.Int64)
-			schedule.StartDatetime = startDatetime.String
-			schedule.EndDatetime = endDatetime.String
+	rows, err = db.Query("SELECT id, task_id, start_datetime, end_datetime FROM task_schedules ORDER BY task_id, id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying task schedules: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var schedule TaskSchedule
+		var taskID int
+		var startDatetime, endDatetime sql.NullTime
+		if err := rows.Scan(&schedule.ID, &taskID, &startDatetime, &endDatetime); err != nil {
+			return nil, fmt.Errorf("error scanning task schedule row: %w", err)
+		}
+		if task, ok := tasksMap[taskID]; ok {
+			schedule.StartDatetime = formatNullTimestamp(startDatetime)
+			schedule.EndDatetime = formatNullTimestamp(endDatetime)
 			task.Schedules = append(task.Schedules, schedule)
 		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning task schedule rows: %w", err)
+	}
 
-		if clockID.Valid {
-			clock.ID = int(clockID.Int64)
-			clock.ClockIn = clockIn.String
-			clock.ClockOut = clockOut.String
+	rows, err = db.Query("SELECT id, task_id, clock_in, clock_out FROM task_clocks ORDER BY task_id, id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying task clocks: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var clock TaskClock
+		var taskID int
+		var clockIn, clockOut sql.NullTime
+		if err := rows.Scan(&clock.ID, &taskID, &clockIn, &clockOut); err != nil {
+			return nil, fmt.Errorf("error scanning task clock row: %w", err)
+		}
+		if task, ok := tasksMap[taskID]; ok {
+			clock.ClockIn = formatNullTimestamp(clockIn)
+			clock.ClockOut = formatNullTimestamp(clockOut)
 			task.Clocks = append(task.Clocks, clock)
 		}
-
-		tasksMap[task.ID] = &task
 	}
-
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error after scanning rows: %w", err)
+		return nil, fmt.Errorf("error after scanning task clock rows: %w", err)
+	}
+
+	dependsOn, blockedBy, err := loadTaskDependencies(db)
+	if err != nil {
+		return nil, err
 	}
 
 	tasks := make([]*TaskWithDetails, 0, len(tasksMap))
 	for _, task := range tasksMap {
+		task.DependsOn = dependsOn[task.ID]
+		if task.DependsOn == nil {
+			task.DependsOn = []int{}
+		}
+		task.BlockedBy = blockedBy[task.ID]
+		if task.BlockedBy == nil {
+			task.BlockedBy = []int{}
+		}
 		tasks = append(tasks, task)
 	}
 
@@ -2178,21 +2517,17 @@ func detectCycle(parents, children []int) bool {
 }
 
 func addTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
-	var entry struct {
-		ParentTagID int `json:"parent_tag_id"`
-		ChildTagID  int `json:"child_tag_id"`
-	}
+	var entry TagHierarchyEntry
 	err := json.NewDecoder(r.Body).Decode(&entry)
 	if err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		writeError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
 	// Start a transaction
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("Error starting transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error starting transaction", err)
 		return
 	}
 	defer tx.Rollback()
@@ -2200,8 +2535,7 @@ func addTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	// Fetch all existing hierarchies
 	rows, err := tx.Query("SELECT parent_tag_id, child_tag_id FROM tag_hierarchy")
 	if err != nil {
-		log.Printf("Error fetching tag hierarchies: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error fetching tag hierarchies", err)
 		return
 	}
 	defer rows.Close()
@@ -2210,8 +2544,7 @@ func addTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var parent, child int
 		if err := rows.Scan(&parent, &child); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			writeServerError(w, "Error scanning row", err)
 			return
 		}
 		parents = append(parents, parent)
@@ -2224,7 +2557,7 @@ func addTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
 
 	// Check for cycles
 	if detectCycle(parents, children) {
-		http.Error(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
+		writeError(w, "Operation would create a cycle in the hierarchy", http.StatusBadRequest)
 		return
 	}
 
@@ -2235,69 +2568,75 @@ func addTagHierarchyEntry(w http.ResponseWriter, r *http.Request) {
     `, entry.ParentTagID, entry.ChildTagID)
 
 	if err != nil {
-		log.Printf("Error inserting tag hierarchy entry: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error inserting tag hierarchy entry", err)
 		return
 	}
 
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error committing transaction: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		writeServerError(w, "Error committing transaction", err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Tag hierarchy entry added successfully"})
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Tag hierarchy entry added successfully"})
+}
+
+// uploadsDir is where uploaded files are stored, relative to the working
+// directory of the server
+const uploadsDir = "uploads"
+
+// uniqueUploadName returns filename, with a counter added before the
+// extension if a file of that name is already stored
+func uniqueUploadName(filename string) string {
+    extension := filepath.Ext(filename)
+    nameWithoutExt := filename[:len(filename)-len(extension)]
+    counter := 1
+    for {
+        if _, err := os.Stat(filepath.Join(uploadsDir, filename)); os.IsNotExist(err) {
+            return filename
+        }
+        filename = fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, extension)
+        counter++
+    }
 }
 
 func uploadFile(w http.ResponseWriter, r *http.Request) {
     // Parse the multipart form
     err := r.ParseMultipartForm(10 << 29) // 5 GB max (Bitshifting 10*2**29)
     if err != nil {
-        http.Error(w, "Unable to parse form", http.StatusBadRequest)
+        writeError(w, "Unable to parse form", http.StatusBadRequest)
         return
     }
 
     // Get the file from the form
     file, header, err := r.FormFile("file")
     if err != nil {
-        http.Error(w, "Error retrieving file", http.StatusBadRequest)
+        writeError(w, "Error retrieving file", http.StatusBadRequest)
         return
     }
     defer file.Close()
 
     // Create the uploads directory if it doesn't exist
-    uploadsDir := "uploads"
     if err := os.MkdirAll(uploadsDir, os.ModePerm); err != nil {
-        http.Error(w, "Unable to create upload directory", http.StatusInternalServerError)
+        writeError(w, "Unable to create upload directory", http.StatusInternalServerError)
         return
     }
 
     // Generate a unique filename
-    filename := header.Filename
-    extension := filepath.Ext(filename)
-    nameWithoutExt := filename[:len(filename)-len(extension)]
-    counter := 1
-    for {
-        if _, err := os.Stat(filepath.Join(uploadsDir, filename)); os.IsNotExist(err) {
-            break
-        }
-        filename = fmt.Sprintf("%s_%d%s", nameWithoutExt, counter, extension)
-        counter++
-    }
+    filename := uniqueUploadName(header.Filename)
 
     // Create a new file in the uploads directory
     dst, err := os.Create(filepath.Join(uploadsDir, filename))
     if err != nil {
-        http.Error(w, "Error creating destination file", http.StatusInternalServerError)
+        writeError(w, "Error creating destination file", http.StatusInternalServerError)
         return
     }
     defer dst.Close()
 
     // Copy the uploaded file to the destination file
     if _, err := io.Copy(dst, file); err != nil {
-        http.Error(w, "Error copying file", http.StatusInternalServerError)
+        writeError(w, "Error copying file", http.StatusInternalServerError)
         return
     }
 
@@ -2314,80 +2653,86 @@ func uploadFile(w http.ResponseWriter, r *http.Request) {
     `, assetType, filepath.Join(uploadsDir, filename), description).Scan(&id)
 
     if err != nil {
-        http.Error(w, "Error saving to database", http.StatusInternalServerError)
+        writeServerError(w, "Error saving asset", err)
         return
     }
 
     // Respond with the created status and return the generated ID and filename
     w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(map[string]interface{}{
-        "message": "File uploaded successfully",
-        "filename": filename,
-        "id": id,
+    json.NewEncoder(w).Encode(UploadResponse{
+        Message:  "File uploaded successfully",
+        Filename: filename,
+        ID:       id,
     })
 }
 
 
 func deleteFile(w http.ResponseWriter, r *http.Request) {
     // Get the asset ID from the URL parameters
-    vars := mux.Vars(r)
-    assetID := vars["id"]
+    assetID, err := strconv.Atoi(mux.Vars(r)["id"])
+    if err != nil {
+        writeError(w, "Invalid asset ID", http.StatusBadRequest)
+        return
+    }
 
+    found, err := deleteAssetByID(assetID)
+    if err != nil {
+        writeServerError(w, "Error deleting asset", err)
+        return
+    }
+    if !found {
+        writeError(w, "Asset not found", http.StatusNotFound)
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    json.NewEncoder(w).Encode(MessageResponse{Message: "File deleted successfully"})
+}
+
+// deleteAssetByID deletes an asset and its file, reporting false if there
+// is no such asset
+func deleteAssetByID(assetID int) (bool, error) {
     // Start a transaction
     tx, err := db.Begin()
     if err != nil {
-        log.Printf("Error starting transaction: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
-        return
+        return false, fmt.Errorf("error starting transaction: %w", err)
     }
     defer tx.Rollback()
 
     // Get the file location from the database
     var fileLocation string
     err = tx.QueryRow("SELECT location FROM assets WHERE id = $1", assetID).Scan(&fileLocation)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
     if err != nil {
-        if err == sql.ErrNoRows {
-            http.Error(w, "Asset not found", http.StatusNotFound)
-        } else {
-            log.Printf("Error querying asset: %v", err)
-            http.Error(w, "Internal server error", http.StatusInternalServerError)
-        }
-        return
+        return false, fmt.Errorf("error querying asset: %w", err)
     }
 
     // Check if the file exists
     if _, err := os.Stat(fileLocation); os.IsNotExist(err) {
         log.Printf("File does not exist: %s", fileLocation)
-        // This endpoint is called specifically for deletion
+        // This is called specifically for deletion
         // So if the file doesn't exist, we can consider it deleted
         // Shouldn't lead to data loss as the user is trying to delete it
     } else {
         // Attempt to remove the file
-        err = os.Remove(fileLocation)
-        if err != nil {
-            log.Printf("Error deleting file: %v", err)
-            http.Error(w, "Error deleting file", http.StatusInternalServerError)
-            return
+        if err := os.Remove(fileLocation); err != nil {
+            return false, fmt.Errorf("error deleting file: %w", err)
         }
     }
 
     // Delete the asset record from the database
     _, err = tx.Exec("DELETE FROM assets WHERE id = $1", assetID)
     if err != nil {
-        log.Printf("Error deleting asset record: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
-        return
+        return false, fmt.Errorf("error deleting asset record: %w", err)
     }
 
     // Commit the transaction
     if err := tx.Commit(); err != nil {
-        log.Printf("Error committing transaction: %v", err)
-        http.Error(w, "Internal server error", http.StatusInternalServerError)
-        return
+        return false, fmt.Errorf("error committing transaction: %w", err)
     }
-
-    w.WriteHeader(http.StatusOK)
-    json.NewEncoder(w).Encode(map[string]string{"message": "File deleted successfully"})
+    return true, nil
 }
 
 func downloadFile(w http.ResponseWriter, r *http.Request) {
@@ -2395,23 +2740,23 @@ func downloadFile(w http.ResponseWriter, r *http.Request) {
     assetID := vars["id"]
 
     // Get the file location and MIME type from the database
-    var fileLocation, mimeType, fileName string
-    err := db.QueryRow("SELECT location, asset_type, SUBSTRING(location FROM '[^/]+$') as filename FROM assets WHERE id = $1", assetID).Scan(&fileLocation, &mimeType, &fileName)
+    var fileLocation, mimeType string
+    err := db.QueryRow("SELECT location, asset_type FROM assets WHERE id = $1", assetID).Scan(&fileLocation, &mimeType)
     if err != nil {
         if err == sql.ErrNoRows {
-            http.Error(w, "Asset not found", http.StatusNotFound)
+            writeError(w, "Asset not found", http.StatusNotFound)
         } else {
-            log.Printf("Error querying asset: %v", err)
-            http.Error(w, "Internal server error", http.StatusInternalServerError)
+            writeServerError(w, "Error querying asset", err)
         }
         return
     }
+    fileName := path.Base(fileLocation)
 
     // Open the file
     file, err := os.Open(fileLocation)
     if err != nil {
         log.Printf("Error opening file: %v", err)
-        http.Error(w, "Error opening file", http.StatusInternalServerError)
+        writeError(w, "Error opening file", http.StatusInternalServerError)
         return
     }
     defer file.Close()
@@ -2420,7 +2765,7 @@ func downloadFile(w http.ResponseWriter, r *http.Request) {
     stat, err := file.Stat()
     if err != nil {
         log.Printf("Error getting file stats: %v", err)
-        http.Error(w, "Error reading file", http.StatusInternalServerError)
+        writeError(w, "Error reading file", http.StatusInternalServerError)
         return
     }
 
@@ -2485,7 +2830,7 @@ func downloadFile(w http.ResponseWriter, r *http.Request) {
     _, err = io.Copy(w, file)
     if err != nil {
         log.Printf("Error streaming file: %v", err)
-        http.Error(w, "Error streaming file", http.StatusInternalServerError)
+        writeError(w, "Error streaming file", http.StatusInternalServerError)
         return
     }
 }
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestGetNoteRoute checks the routing of GET /notes/{id}, the requests are
+// rejected before the database is queried
+func TestGetNoteRoute(t *testing.T) {
+	router := newRouter()
+	tests := []struct {
+		path    string
+		message string
+	}{
+		{"/notes/abc", "Invalid note ID"},
+		// The fixed /notes/... routes are not shadowed by /notes/{id}
+		{"/notes/search", "Query parameter 'q' is required"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", tt.path, rec.Code, http.StatusBadRequest)
+			continue
+		}
+		var body ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Errorf("GET %s: decoding the error: %v", tt.path, err)
+			continue
+		}
+		if body.Error.Message != tt.message {
+			t.Errorf("GET %s: message %q, want %q", tt.path, body.Error.Message, tt.message)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"strings"
+	"unicode"
+
+	utils "draftsmith/src/utils"
+)
+
+// SQLite storage
+//
+// With --db_driver sqlite the notes are kept in a single SQLite file rather
+// than in Postgres, see draftsmith_sqlite.sql for the schema and
+// src/utils/sqlite.go for the driver. The handlers share their queries
+// between the two, the few that need a Postgres feature check usingSQLite
+// and use the SQLite equivalent.
+
+// usingSQLite reports whether the database is SQLite rather than Postgres
+func usingSQLite() bool {
+	return utils.Db_driver() == utils.SQLite
+}
+
+// forUpdate locks the selected rows until the end of the transaction. It is
+// empty on SQLite, where a transaction holds the write lock from the start.
+func forUpdate() string {
+	if usingSQLite() {
+		return ""
+	}
+	return " FOR UPDATE"
+}
+
+// ftsQuery turns free text into an FTS5 query matching every word, as
+// plainto_tsquery does on Postgres. Without words it is the empty phrase,
+// which matches nothing.
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return `""`
+	}
+	for i, word := range words {
+		words[i] = `"` + word + `"`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,557 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Task status workflows
+//
+// Task statuses live in the task_statuses table rather than a CHECK
+// constraint. Each status belongs to a category (open, closed or cancelled)
+// that the rest of the API uses instead of particular status names, and
+// task_status_transitions lists which status changes updateTask accepts.
+// The status flagged initial, or else the first open one, is given to new
+// tasks without a status and to recurring tasks reopened after completion.
+// Every status change is recorded in task_status_changes.
+
+const (
+	statusOpen      = "open"
+	statusClosed    = "closed"
+	statusCancelled = "cancelled"
+)
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// TaskStatus is a task state along with the states it may move to
+type TaskStatus struct {
+	Name        string   `json:"name"`
+	Category    string   `json:"category"`
+	Position    int      `json:"position"`
+	Description string   `json:"description"`
+	Initial     bool     `json:"initial"`
+	Transitions []string `json:"transitions"`
+}
+
+// NewTaskStatus is the request body for creating a status. Transitions
+// lists the statuses it may move to, TransitionsFrom the statuses that
+// may move to it.
+type NewTaskStatus struct {
+	Name            string   `json:"name"`
+	Category        string   `json:"category"`
+	Position        int      `json:"position"`
+	Description     string   `json:"description"`
+	Initial         bool     `json:"initial"`
+	Transitions     []string `json:"transitions"`
+	TransitionsFrom []string `json:"transitions_from"`
+}
+
+// UpdateTaskStatus is the request body for updating a status
+type UpdateTaskStatus struct {
+	Category    *string `json:"category,omitempty"`
+	Position    *int    `json:"position,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Initial     *bool   `json:"initial,omitempty"`
+}
+
+// NewStatusTransition is the request body for allowing a status change
+type NewStatusTransition struct {
+	To string `json:"to"`
+}
+
+// TaskStatusChange is a single entry in a task's status log
+type TaskStatusChange struct {
+	ID         int     `json:"id"`
+	FromStatus *string `json:"from_status"`
+	ToStatus   string  `json:"to_status"`
+	ChangedAt  string  `json:"changed_at"`
+}
+
+// taskStatusSet maps status names to their definitions
+type taskStatusSet map[string]*TaskStatus
+
+// loadTaskStatuses returns every status with its allowed transitions
+func loadTaskStatuses(q queryer) (taskStatusSet, []*TaskStatus, error) {
+	rows, err := q.Query("SELECT name, category, position, COALESCE(description, ''), initial FROM task_statuses ORDER BY position, name")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying task statuses: %w", err)
+	}
+	defer rows.Close()
+
+	set := make(taskStatusSet)
+	var ordered []*TaskStatus
+	for rows.Next() {
+		s := &TaskStatus{Transitions: []string{}}
+		if err := rows.Scan(&s.Name, &s.Category, &s.Position, &s.Description, &s.Initial); err != nil {
+			return nil, nil, fmt.Errorf("error scanning task status row: %w", err)
+		}
+		set[s.Name] = s
+		ordered = append(ordered, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error after scanning task status rows: %w", err)
+	}
+
+	rows, err = q.Query(`
+        SELECT tr.from_status, tr.to_status
+        FROM task_status_transitions tr
+        JOIN task_statuses s ON s.name = tr.to_status
+        ORDER BY s.position, s.name
+    `)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying task status transitions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var from, to string
+		if err := rows.Scan(&from, &to); err != nil {
+			return nil, nil, fmt.Errorf("error scanning task status transition row: %w", err)
+		}
+		if s, ok := set[from]; ok {
+			s.Transitions = append(s.Transitions, to)
+		}
+	}
+	return set, ordered, rows.Err()
+}
+
+// Category returns the category of a status, unknown statuses are open
+func (set taskStatusSet) Category(name string) string {
+	if s, ok := set[name]; ok {
+		return s.Category
+	}
+	return statusOpen
+}
+
+// First returns the first status of a category in display order, or ""
+// if the category has none
+func (set taskStatusSet) First(category string) string {
+	var first *TaskStatus
+	for _, s := range set {
+		if s.Category != category {
+			continue
+		}
+		if first == nil || s.Position < first.Position || (s.Position == first.Position && s.Name < first.Name) {
+			first = s
+		}
+	}
+	if first == nil {
+		return ""
+	}
+	return first.Name
+}
+
+// Initial returns the status new and reopened tasks are given, the status
+// flagged initial or else the first open status
+func (set taskStatusSet) Initial() string {
+	for _, s := range set {
+		if s.Initial {
+			return s.Name
+		}
+	}
+	return set.First(statusOpen)
+}
+
+// IsOpen reports whether tasks in the status still need doing
+func (set taskStatusSet) IsOpen(name string) bool {
+	return set.Category(name) == statusOpen
+}
+
+// CanTransition reports whether a task may move from one status to another
+func (set taskStatusSet) CanTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	s, ok := set[from]
+	if !ok {
+		return true
+	}
+	return contains(s.Transitions, to)
+}
+
+// TaskUpdateResponse is the body of a successful task update, NextDeadline
+// is set when completing a recurring task moved its deadline
+type TaskUpdateResponse struct {
+	Message      string `json:"message"`
+	NextDeadline string `json:"next_deadline,omitempty"`
+}
+
+// checkStatusChange validates moving a task from its current status to a
+// new one, the error is meant for the client
+func (set taskStatusSet) checkStatusChange(from, to string) error {
+	if _, ok := set[to]; !ok {
+		return &fieldError{Field: "status", Message: "Invalid status"}
+	}
+	if !set.CanTransition(from, to) {
+		return &fieldError{Field: "status", Message: fmt.Sprintf("Status cannot change from %s to %s", from, to)}
+	}
+	return nil
+}
+
+// finishStatusChange runs after a task's status has been updated from one
+// status to another. It logs the change and, if the task has just been
+// closed, records the completion and advances recurring tasks in loc,
+// returning the next deadline if there is one.
+func finishStatusChange(tx *sql.Tx, statuses taskStatusSet, taskID string, from, to string, loc *time.Location) (*time.Time, error) {
+	if from == to {
+		return nil, nil
+	}
+	if err := recordStatusChange(tx, taskID, from, to); err != nil {
+		return nil, err
+	}
+	if statuses.Category(to) == statusClosed && statuses.Category(from) != statusClosed {
+		return completeTask(tx, statuses, taskID, loc)
+	}
+	return nil, nil
+}
+
+// recordStatusChange adds an entry to the task's status log, from is empty
+// for a newly created task
+func recordStatusChange(q queryer, taskID interface{}, from, to string) error {
+	var fromStatus interface{}
+	if from != "" {
+		fromStatus = from
+	}
+	_, err := q.Exec(`
+        INSERT INTO task_status_changes (task_id, from_status, to_status)
+        VALUES ($1, $2, $3)
+    `, taskID, fromStatus, to)
+	if err != nil {
+		return fmt.Errorf("error recording status change: %w", err)
+	}
+	return nil
+}
+
+func validStatusCategory(category string) bool {
+	return category == statusOpen || category == statusClosed || category == statusCancelled
+}
+
+func listTaskStatuses(w http.ResponseWriter, r *http.Request) {
+	_, statuses, err := loadTaskStatuses(db)
+	if err != nil {
+		writeServerError(w, "Error loading task statuses", err)
+		return
+	}
+	if statuses == nil {
+		statuses = []*TaskStatus{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func createTaskStatus(w http.ResponseWriter, r *http.Request) {
+	var status NewTaskStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	status.Name = strings.TrimSpace(status.Name)
+	if status.Name == "" {
+		writeValidationError(w, "name", "Status name is required")
+		return
+	}
+	if !validStatusCategory(status.Category) {
+		writeValidationError(w, "category", "Invalid category. Must be 'open', 'closed', or 'cancelled'")
+		return
+	}
+	if status.Initial && status.Category != statusOpen {
+		writeValidationError(w, "initial", "Only an open status can be initial")
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if status.Initial {
+		if _, err := tx.Exec("UPDATE task_statuses SET initial = FALSE WHERE initial"); err != nil {
+			writeServerError(w, "Error updating the initial status", err)
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+        INSERT INTO task_statuses (name, category, position, description, initial)
+        VALUES ($1, $2, $3, $4, $5)
+    `, status.Name, status.Category, status.Position, status.Description, status.Initial)
+	if err != nil {
+		if isPGError(err, pgUniqueViolation) {
+			writeError(w, "Status already exists", http.StatusConflict)
+			return
+		}
+		writeServerError(w, "Error creating task status", err)
+		return
+	}
+
+	for _, to := range status.Transitions {
+		if err := insertStatusTransition(tx, status.Name, to); err != nil {
+			writeTransitionError(w, err)
+			return
+		}
+	}
+	for _, from := range status.TransitionsFrom {
+		if err := insertStatusTransition(tx, from, status.Name); err != nil {
+			writeTransitionError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MessageResponse{
+		Message: "Task status created successfully",
+		Name:    status.Name,
+	})
+}
+
+func updateTaskStatus(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var update UpdateTaskStatus
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	query := "UPDATE task_statuses SET name = name"
+	var args []interface{}
+	argIndex := 1
+
+	if update.Category != nil {
+		if !validStatusCategory(*update.Category) {
+			writeValidationError(w, "category", "Invalid category. Must be 'open', 'closed', or 'cancelled'")
+			return
+		}
+		query += fmt.Sprintf(", category = $%d", argIndex)
+		args = append(args, *update.Category)
+		argIndex++
+	}
+
+	if update.Position != nil {
+		query += fmt.Sprintf(", position = $%d", argIndex)
+		args = append(args, *update.Position)
+		argIndex++
+	}
+
+	if update.Description != nil {
+		query += fmt.Sprintf(", description = $%d", argIndex)
+		args = append(args, *update.Description)
+		argIndex++
+	}
+
+	if update.Initial != nil {
+		query += fmt.Sprintf(", initial = $%d", argIndex)
+		args = append(args, *update.Initial)
+		argIndex++
+	}
+
+	query += fmt.Sprintf(" WHERE name = $%d", argIndex)
+	args = append(args, name)
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeServerError(w, "Error starting transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	// Only one status is initial
+	if update.Initial != nil && *update.Initial {
+		if _, err := tx.Exec("UPDATE task_statuses SET initial = FALSE WHERE initial AND name <> $1", name); err != nil {
+			writeServerError(w, "Error updating the initial status", err)
+			return
+		}
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		if isPGError(err, pgCheckViolation) {
+			writeValidationError(w, "initial", "Only an open status can be initial")
+			return
+		}
+		writeServerError(w, "Error updating task status", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		writeServerError(w, "Error getting rows affected", err)
+		return
+	}
+	if rowsAffected == 0 {
+		writeError(w, "Status not found", http.StatusNotFound)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeServerError(w, "Error committing transaction", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task status updated successfully"})
+}
+
+func deleteTaskStatus(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	result, err := db.Exec("DELETE FROM task_statuses WHERE name = $1", name)
+	if err != nil {
+		if isPGError(err, pgForeignKeyViolation) {
+			writeError(w, "Status is in use by tasks", http.StatusConflict)
+			return
+		}
+		writeServerError(w, "Error deleting task status", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		writeServerError(w, "Error getting rows affected", err)
+		return
+	}
+	if rowsAffected == 0 {
+		writeError(w, "Status not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Task status deleted successfully"})
+}
+
+// errUnknownStatus is returned when a transition refers to a missing status
+var errUnknownStatus = errors.New("unknown status")
+
+func insertStatusTransition(q queryer, from, to string) error {
+	if from == to {
+		return nil
+	}
+	_, err := q.Exec(`
+        INSERT INTO task_status_transitions (from_status, to_status)
+        VALUES ($1, $2)
+        ON CONFLICT DO NOTHING
+    `, from, to)
+	if isPGError(err, pgForeignKeyViolation) {
+		return errUnknownStatus
+	}
+	return err
+}
+
+func writeTransitionError(w http.ResponseWriter, err error) {
+	if err == errUnknownStatus {
+		writeError(w, "Status not found", http.StatusNotFound)
+		return
+	}
+	writeServerError(w, "Error adding status transition", err)
+}
+
+func addTaskStatusTransition(w http.ResponseWriter, r *http.Request) {
+	from := mux.Vars(r)["name"]
+
+	var body NewStatusTransition
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.To == "" {
+		writeError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := insertStatusTransition(db, from, body.To); err != nil {
+		writeTransitionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Status transition added successfully"})
+}
+
+func removeTaskStatusTransition(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	result, err := db.Exec("DELETE FROM task_status_transitions WHERE from_status = $1 AND to_status = $2", vars["name"], vars["to"])
+	if err != nil {
+		writeServerError(w, "Error removing status transition", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		writeServerError(w, "Error getting rows affected", err)
+		return
+	}
+	if rowsAffected == 0 {
+		writeError(w, "Status transition not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(MessageResponse{Message: "Status transition removed successfully"})
+}
+
+func getTaskStatusChanges(w http.ResponseWriter, r *http.Request) {
+	taskID := mux.Vars(r)["id"]
+
+	var taskExists bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)", taskID).Scan(&taskExists)
+	if err != nil {
+		writeServerError(w, "Error checking task existence", err)
+		return
+	}
+	if !taskExists {
+		writeError(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	rows, err := db.Query(`
+        SELECT id, from_status, to_status, changed_at
+        FROM task_status_changes
+        WHERE task_id = $1
+        ORDER BY changed_at, id
+    `, taskID)
+	if err != nil {
+		writeServerError(w, "Error querying status changes", err)
+		return
+	}
+	defer rows.Close()
+
+	changes := []TaskStatusChange{}
+	for rows.Next() {
+		var c TaskStatusChange
+		var from sql.NullString
+		var changedAt time.Time
+		if err := rows.Scan(&c.ID, &from, &c.ToStatus, &changedAt); err != nil {
+			writeServerError(w, "Error scanning status change row", err)
+			return
+		}
+		if from.Valid {
+			c.FromStatus = &from.String
+		}
+		c.ChangedAt = formatTimestamp(changedAt)
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		writeServerError(w, "Error after scanning rows", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
@@ -0,0 +1,690 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"draftsmith/src/client"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// Git sync
+//
+// sync mirrors the notes of a server into a git working tree, one file per
+// note at notes/<id>.md with the title and place in the hierarchy as front
+// matter. Like mount it only talks to the HTTP API.
+//
+// The database is treated as a branch of its own. Each run exports the
+// notes on top of the commit last synced with the database (kept in
+// refs/draftsmith/synced) and merges that commit into the current branch,
+// then merges the remote branch. Whatever the merged tree changes relative
+// to the database is applied through the API, so edits made in git, on
+// either side of a merge, reach the database and conflicts are left to git.
+
+// syncedRef is the last commit whose notes match the database
+const syncedRef = "refs/draftsmith/synced"
+
+// syncConflictMarker matches the start of a conflict left by git merge
+var syncConflictMarker = regexp.MustCompile(`(?m)^<<<<<<< `)
+
+// syncNotesDir holds the notes in the working tree
+const syncNotesDir = "notes"
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Mirror the notes of a server into a git repository",
+	Long: `Mirror the notes of a running server into a git working tree as Markdown
+files with front matter, commit the changes and merge commits made
+elsewhere back into the database.
+
+  DIR/notes/<id>.md   a note
+
+---
+id: 12
+title: Ideas
+parent: 3
+type: subpage
+---
+The content of the note
+
+Edit, add (without an id) or delete files in DIR/notes, commit them or not,
+and run sync again to apply them. Conflicts between the database, the
+working tree and the remote are left as a merge in progress for git to
+resolve.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Errors from git and the API are not usage errors
+		cmd.SilenceUsage = true
+	},
+}
+
+var syncInitCmd = &cobra.Command{
+	Use:   "init DIR",
+	Short: "Create a sync repository, cloning the remote if it has notes",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remote, _ := cmd.Flags().GetString("remote")
+		branch, _ := cmd.Flags().GetString("branch")
+		return initSyncRepo(args[0], remote, branch)
+	},
+}
+
+var syncRunCmd = &cobra.Command{
+	Use:   "run DIR",
+	Short: "Sync the notes with the repository and its remote",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		interval, _ := cmd.Flags().GetDuration("interval")
+		noPush, _ := cmd.Flags().GetBool("no-push")
+		repo := &syncRepo{dir: args[0], push: !noPush}
+		ctx := cliContext(cmd)
+		c := apiClient()
+		if interval <= 0 {
+			return repo.sync(ctx, c)
+		}
+
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := repo.sync(ctx, c); err != nil {
+				log.Printf("Sync failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	},
+}
+
+var syncLogCmd = &cobra.Command{
+	Use:   "log DIR ID",
+	Short: "Show the history of a note",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID("note", args[1])
+		if err != nil {
+			return err
+		}
+		patch, _ := cmd.Flags().GetBool("patch")
+		gitArgs := []string{"-C", args[0], "log", "--follow"}
+		if patch {
+			gitArgs = append(gitArgs, "--patch")
+		}
+		gitArgs = append(gitArgs, "--", syncNotePath(id))
+		git := exec.Command("git", gitArgs...)
+		git.Stdout, git.Stderr = cmd.OutOrStdout(), cmd.ErrOrStderr()
+		return git.Run()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.AddCommand(syncInitCmd, syncRunCmd, syncLogCmd)
+
+	syncInitCmd.Flags().String("remote", "", "URL of the remote to push to and pull from, e.g. a bare repository")
+	syncInitCmd.Flags().String("branch", "main", "Branch to sync")
+	syncRunCmd.Flags().Duration("interval", 0, "Keep syncing at this interval until interrupted")
+	syncRunCmd.Flags().Bool("no-push", false, "Merge the remote but don't push to it")
+	syncLogCmd.Flags().BoolP("patch", "p", false, "Show the changes of each commit")
+}
+
+// syncFrontMatter is the front matter of a note file, ID is 0 for notes
+// created in git
+type syncFrontMatter struct {
+	ID     int    `yaml:"id,omitempty"`
+	Title  string `yaml:"title"`
+	Parent int    `yaml:"parent,omitempty"`
+	Type   string `yaml:"type,omitempty"`
+}
+
+// syncNote is a note as it is stored in the repository
+type syncNote struct {
+	syncFrontMatter
+	Content string
+}
+
+func syncNotePath(id int) string {
+	return path.Join(syncNotesDir, strconv.Itoa(id)+".md")
+}
+
+func renderSyncNote(n *syncNote) ([]byte, error) {
+	front, err := yaml.Marshal(n.syncFrontMatter)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(front)
+	buf.WriteString("---\n")
+	buf.WriteString(n.Content)
+	return buf.Bytes(), nil
+}
+
+// parseSyncNote reads a note file, a file without front matter is all
+// content and named after the file
+func parseSyncNote(name string, data []byte) (*syncNote, error) {
+	n := &syncNote{}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		end := strings.Index(rest, "\n---\n")
+		if end < 0 {
+			return nil, errors.New("front matter is not terminated by ---")
+		}
+		if err := yaml.Unmarshal([]byte(rest[:end+1]), &n.syncFrontMatter); err != nil {
+			return nil, fmt.Errorf("invalid front matter: %w", err)
+		}
+		text = rest[end+len("\n---\n"):]
+	}
+	n.Content = text
+	if n.Title == "" {
+		n.Title = strings.TrimSuffix(path.Base(name), ".md")
+	}
+	return n, nil
+}
+
+// loadSyncNotes fetches every note with its place in the hierarchy
+func loadSyncNotes(ctx context.Context, c *client.Client) (map[int]*syncNote, error) {
+	notes, err := c.ListNotes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.NoteTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]*syncNote, len(notes))
+	for _, n := range notes {
+		byID[n.ID] = &syncNote{syncFrontMatter{ID: n.ID, Title: n.Title}, n.Content}
+	}
+	var place func(parent int, nodes []*client.NoteTree)
+	place = func(parent int, nodes []*client.NoteTree) {
+		for _, node := range nodes {
+			if n, ok := byID[node.ID]; ok && parent != 0 {
+				n.Parent, n.Type = parent, node.Type
+			}
+			place(node.ID, node.Children)
+		}
+	}
+	place(0, tree)
+	return byID, nil
+}
+
+// syncRepo is a sync working tree
+type syncRepo struct {
+	dir  string
+	push bool
+}
+
+// git runs a git command in the repository and returns its output
+func (s *syncRepo) git(args ...string) (string, error) {
+	return s.gitEnv(nil, "", args...)
+}
+
+// gitEnv runs git with extra environment variables and stdin
+func (s *syncRepo) gitEnv(env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", s.dir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, msg)
+	}
+	return stdout.String(), nil
+}
+
+// rev resolves a revision to a commit, "" if it doesn't exist
+func (s *syncRepo) rev(revision string) string {
+	out, err := s.git("rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(out)
+}
+
+// branch is the checked out branch
+func (s *syncRepo) branch() (string, error) {
+	out, err := s.git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// emptyTree is the ID of the tree without files
+func (s *syncRepo) emptyTree() (string, error) {
+	out, err := s.git("hash-object", "-t", "tree", "--stdin")
+	return strings.TrimSpace(out), err
+}
+
+func (s *syncRepo) hasRemote() bool {
+	_, err := s.git("remote", "get-url", "origin")
+	return err == nil
+}
+
+func initSyncRepo(dir, remote, branch string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	s := &syncRepo{dir: dir}
+	if _, err := s.git("init", "--initial-branch", branch); err != nil {
+		return err
+	}
+	// Commits need an identity, keep the user's if they have one
+	if _, err := s.git("config", "user.email"); err != nil {
+		if _, err := s.git("config", "user.name", "Draftsmith"); err != nil {
+			return err
+		}
+		if _, err := s.git("config", "user.email", "draftsmith@localhost"); err != nil {
+			return err
+		}
+	}
+	if remote == "" {
+		return nil
+	}
+
+	if _, err := s.git("remote", "add", "origin", remote); err != nil {
+		return err
+	}
+	if _, err := s.git("fetch", "origin"); err != nil {
+		return err
+	}
+	// The notes of an existing repository are imported by the first run
+	if s.rev("refs/remotes/origin/"+branch) != "" {
+		if _, err := s.git("reset", "--hard", "origin/"+branch); err != nil {
+			return err
+		}
+	}
+	_, err := s.git("config", "branch."+branch+".remote", "origin")
+	if err == nil {
+		_, err = s.git("config", "branch."+branch+".merge", "refs/heads/"+branch)
+	}
+	return err
+}
+
+// sync runs one round: commit working tree edits, merge the database and
+// the remote, apply the result to the database and push
+func (s *syncRepo) sync(ctx context.Context, c *client.Client) error {
+	branch, err := s.branch()
+	if err != nil {
+		return err
+	}
+	if err := s.commitWorkingTree(); err != nil {
+		return err
+	}
+
+	if err := s.mergeDatabase(ctx, c); err != nil {
+		return err
+	}
+	if s.hasRemote() {
+		if _, err := s.git("fetch", "origin"); err != nil {
+			return err
+		}
+		if remote := s.rev("refs/remotes/origin/" + branch); remote != "" {
+			if err := s.merge(remote, "origin/"+branch); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.importNotes(ctx, c); err != nil {
+		return err
+	}
+	// Notes created in git got their IDs, write them back
+	if err := s.mergeDatabase(ctx, c); err != nil {
+		return err
+	}
+
+	if s.push && s.hasRemote() && s.rev("HEAD") != "" {
+		if _, err := s.git("push", "origin", "HEAD:refs/heads/"+branch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitWorkingTree commits edits made in the working tree, including the
+// resolution of a merge left by an earlier run
+func (s *syncRepo) commitWorkingTree() error {
+	// Conflicted files count as resolved once the markers are gone, or
+	// once the file is deleted
+	out, err := s.git("diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return err
+	}
+	var unresolved []string
+	for _, file := range strings.Fields(out) {
+		data, err := os.ReadFile(filepath.Join(s.dir, file))
+		if err == nil && syncConflictMarker.Match(data) {
+			unresolved = append(unresolved, file)
+		}
+	}
+	if len(unresolved) > 0 {
+		return fmt.Errorf("unresolved conflicts in %s:\n%s", s.dir, strings.Join(unresolved, "\n"))
+	}
+
+	merging := s.rev("MERGE_HEAD") != ""
+	if _, err := s.git("add", "--all"); err != nil {
+		return err
+	}
+	status, err := s.git("status", "--porcelain")
+	if err != nil {
+		return err
+	}
+	switch {
+	case merging:
+		_, err = s.git("commit", "--no-edit", "--cleanup=strip")
+	case strings.TrimSpace(status) != "":
+		_, err = s.git("commit", "--message", "Edit notes in the working tree")
+	}
+	return err
+}
+
+// merge merges a commit into the current branch. A conflict is left for
+// the user to resolve.
+func (s *syncRepo) merge(commit, name string) error {
+	if s.rev("HEAD") == "" {
+		_, err := s.git("reset", "--hard", commit)
+		return err
+	}
+	_, err := s.git("merge", "--no-edit", "--allow-unrelated-histories", "--message", "Merge "+name, commit)
+	if err == nil {
+		return nil
+	}
+	conflicts, _ := s.git("diff", "--name-only", "--diff-filter=U")
+	if strings.TrimSpace(conflicts) == "" {
+		return err
+	}
+	return fmt.Errorf("conflicts merging %s, resolve them in %s and sync again:\n%s",
+		name, s.dir, strings.TrimSpace(conflicts))
+}
+
+// mergeDatabase commits the notes of the database on top of the synced
+// commit, if they changed, and merges them into the current branch
+func (s *syncRepo) mergeDatabase(ctx context.Context, c *client.Client) error {
+	notes, err := loadSyncNotes(ctx, c)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.MkdirTemp("", "draftsmith-sync-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Mkdir(filepath.Join(tmp, syncNotesDir), 0o755); err != nil {
+		return err
+	}
+	for id, n := range notes {
+		data, err := renderSyncNote(n)
+		if err != nil {
+			return fmt.Errorf("error rendering note %d: %w", id, err)
+		}
+		if err := os.WriteFile(filepath.Join(tmp, syncNotePath(id)), data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	// Build the tree in a separate index so the working tree and the
+	// files outside notes/ are left alone
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+	base := s.rev(syncedRef)
+	if base != "" {
+		if _, err := s.gitEnv(env, "", "read-tree", base); err != nil {
+			return err
+		}
+	}
+	absTmp, err := filepath.Abs(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := s.gitEnv(env, "", "--work-tree", absTmp, "add", "--all", "--", syncNotesDir); err != nil {
+		return err
+	}
+	out, err := s.gitEnv(env, "", "write-tree")
+	if err != nil {
+		return err
+	}
+	tree := strings.TrimSpace(out)
+
+	if base != "" {
+		baseTree, err := s.git("rev-parse", base+"^{tree}")
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(baseTree) == tree {
+			return nil
+		}
+	}
+	args := []string{"commit-tree", tree}
+	from := base
+	if base != "" {
+		args = append(args, "-p", base)
+	} else if from, err = s.emptyTree(); err != nil {
+		return err
+	}
+	changes, err := s.git("diff", "--name-status", "--no-renames", from, tree)
+	if err != nil {
+		return err
+	}
+	message := "Update notes from the database\n\n" + describeSyncChanges(changes, notes)
+	out, err = s.gitEnv(nil, message, args...)
+	if err != nil {
+		return err
+	}
+	commit := strings.TrimSpace(out)
+	if _, err := s.git("update-ref", syncedRef, commit); err != nil {
+		return err
+	}
+	return s.merge(commit, "the database")
+}
+
+// describeSyncChanges lists the notes changed by git diff --name-status
+func describeSyncChanges(changes string, notes map[int]*syncNote) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(changes), "\n") {
+		status, file, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		label := file
+		if id, err := strconv.Atoi(strings.TrimSuffix(path.Base(file), ".md")); err == nil {
+			label = strconv.Itoa(id)
+			if n, ok := notes[id]; ok && status != "D" {
+				label += ": " + n.Title
+			}
+		}
+		switch status {
+		case "A":
+			lines = append(lines, "Add "+label)
+		case "D":
+			lines = append(lines, "Delete "+label)
+		default:
+			lines = append(lines, "Update "+label)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// importNotes applies the notes of HEAD that differ from the synced commit
+// to the database. Files that can't be applied are logged and skipped, the
+// next export puts the database version back.
+func (s *syncRepo) importNotes(ctx context.Context, c *client.Client) error {
+	head, base := s.rev("HEAD"), s.rev(syncedRef)
+	if head == "" || head == base {
+		return nil
+	}
+	diffBase := base
+	if diffBase == "" {
+		var err error
+		if diffBase, err = s.emptyTree(); err != nil {
+			return err
+		}
+	}
+	out, err := s.git("diff", "--name-status", "--no-renames", diffBase, head, "--", syncNotesDir)
+	if err != nil {
+		return err
+	}
+
+	notes, err := loadSyncNotes(ctx, c)
+	if err != nil {
+		return err
+	}
+	// Deletions first, then contents, then the hierarchy once every note
+	// exists. Notes missing from the database get new IDs, parents given
+	// by their old ID are mapped to the new one.
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	sort.SliceStable(lines, func(i, j int) bool {
+		return strings.HasPrefix(lines[i], "D") && !strings.HasPrefix(lines[j], "D")
+	})
+	type imported struct {
+		file    string
+		note    *syncNote
+		current *syncNote
+	}
+	var files []imported
+	newIDs := make(map[int]int)
+	for _, line := range lines {
+		status, file, ok := strings.Cut(line, "\t")
+		if !ok || path.Ext(file) != ".md" {
+			continue
+		}
+		if status == "D" {
+			err = s.importDeletion(ctx, c, base, file, notes)
+		} else {
+			var n, current *syncNote
+			if n, current, err = s.importFile(ctx, c, head, file, notes); err == nil {
+				files = append(files, imported{file, n, current})
+				if n.ID != 0 && n.ID != current.ID {
+					newIDs[n.ID] = current.ID
+				}
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Printf("Skipping %s: %v", file, err)
+		}
+	}
+	for _, f := range files {
+		if id, ok := newIDs[f.note.Parent]; ok {
+			f.note.Parent = id
+		}
+		if err := placeSyncNote(ctx, c, f.note, f.current); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			log.Printf("Skipping the place of %s in the hierarchy: %v", f.file, err)
+		}
+	}
+
+	_, err = s.git("update-ref", syncedRef, head)
+	return err
+}
+
+func (s *syncRepo) importDeletion(ctx context.Context, c *client.Client, base, file string, notes map[int]*syncNote) error {
+	data, err := s.git("show", base+":"+file)
+	if err != nil {
+		return err
+	}
+	n, err := parseSyncNote(file, []byte(data))
+	if err != nil {
+		return err
+	}
+	if _, ok := notes[n.ID]; !ok {
+		return nil
+	}
+	if err := c.DeleteNote(ctx, n.ID); err != nil && !client.IsNotFound(err) {
+		return err
+	}
+	delete(notes, n.ID)
+	return nil
+}
+
+// importFile creates or updates the note of a file, returning the note in
+// the file and in the database
+func (s *syncRepo) importFile(ctx context.Context, c *client.Client, head, file string, notes map[int]*syncNote) (*syncNote, *syncNote, error) {
+	data, err := s.git("show", head+":"+file)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := parseSyncNote(file, []byte(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, ok := notes[n.ID]
+	if !ok {
+		// New in git, or deleted from the database since it was exported
+		id, err := c.CreateNote(ctx, client.NewNote{Title: n.Title, Content: n.Content})
+		if err != nil {
+			return nil, nil, err
+		}
+		current = &syncNote{syncFrontMatter{ID: id, Title: n.Title}, n.Content}
+		notes[id] = current
+	}
+
+	var update client.NoteUpdate
+	if n.Title != current.Title {
+		update.Title = &n.Title
+	}
+	if n.Content != current.Content {
+		update.Content = &n.Content
+	}
+	if update.Title != nil || update.Content != nil {
+		if err := c.UpdateNote(ctx, current.ID, update); err != nil {
+			return nil, nil, err
+		}
+		current.Title, current.Content = n.Title, n.Content
+	}
+	return n, current, nil
+}
+
+// placeSyncNote moves the note current to the parent given in its file n
+func placeSyncNote(ctx context.Context, c *client.Client, n, current *syncNote) error {
+	if n.Type == "" {
+		n.Type = "subpage"
+	}
+	if n.Parent == current.Parent && (n.Parent == 0 || n.Type == current.Type) {
+		return nil
+	}
+	entry := client.NoteHierarchyEntry{ParentNoteID: n.Parent, ChildNoteID: current.ID, HierarchyType: n.Type}
+	var err error
+	switch {
+	case n.Parent == 0:
+		err = c.DeleteNoteHierarchyEntry(ctx, current.ID)
+	case current.Parent == 0:
+		err = c.AddNoteHierarchyEntry(ctx, entry)
+	default:
+		err = c.UpdateNoteHierarchyEntry(ctx, current.ID, entry)
+	}
+	if err != nil {
+		return fmt.Errorf("error moving note %d under %d: %w", current.ID, n.Parent, err)
+	}
+	current.Parent, current.Type = n.Parent, n.Type
+	return nil
+}
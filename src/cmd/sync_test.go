@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"draftsmith/src/client"
+)
+
+// syncFile reads a note file of a sync working tree
+func syncFile(t *testing.T, dir string, id int) *syncNote {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, syncNotePath(id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := parseSyncNote(syncNotePath(id), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// writeSyncFile writes a note file into a sync working tree
+func writeSyncFile(t *testing.T, dir, name string, n *syncNote) {
+	t.Helper()
+	data, err := renderSyncNote(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, syncNotesDir, name), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncTwoWorkingCopies(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skipf("no git: %v", err)
+	}
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		ctx, c := context.Background(), client.New(api.url)
+		root := t.TempDir()
+		remote := filepath.Join(root, "remote.git")
+		if out, err := exec.Command("git", "init", "--bare", "--initial-branch", "main", remote).CombinedOutput(); err != nil {
+			t.Fatalf("git init --bare: %v: %s", err, out)
+		}
+		var note MessageResponse
+		api.do("POST", "/notes", NewNote{Title: "Plan", Content: "Draft\n"}, http.StatusCreated, &note)
+		content := func() string {
+			t.Helper()
+			var n Note
+			api.do("GET", fmt.Sprintf("/notes/%d", note.ID), nil, http.StatusOK, &n)
+			return n.Content
+		}
+
+		// The first working copy pushes the notes, the second clones them
+		var repos []*syncRepo
+		for _, name := range []string{"first", "second"} {
+			dir := filepath.Join(root, name)
+			if err := initSyncRepo(dir, remote, "main"); err != nil {
+				t.Fatal(err)
+			}
+			repo := &syncRepo{dir: dir, push: true}
+			if err := repo.sync(ctx, c); err != nil {
+				t.Fatalf("first sync of %s: %v", name, err)
+			}
+			repos = append(repos, repo)
+		}
+		first, second := repos[0], repos[1]
+		if n := syncFile(t, second.dir, note.ID); n.Title != "Plan" || n.Content != "Draft\n" {
+			t.Fatalf("cloned note: got %+v", n)
+		}
+
+		// An edit in the first working copy conflicts with one made through
+		// the API meanwhile, the conflict is left for git to resolve
+		writeSyncFile(t, first.dir, fmt.Sprintf("%d.md", note.ID), &syncNote{syncFrontMatter{ID: note.ID, Title: "Plan"}, "Git edit\n"})
+		api.do("PUT", fmt.Sprintf("/notes/%d", note.ID), map[string]string{"content": "API edit\n"}, http.StatusOK, nil)
+		err := first.sync(ctx, c)
+		if err == nil || !strings.Contains(err.Error(), "conflicts merging the database") || !strings.Contains(err.Error(), syncNotePath(note.ID)) {
+			t.Fatalf("conflicting sync: got error %v", err)
+		}
+		if got := content(); got != "API edit\n" {
+			t.Errorf("after the conflict: got %q", got)
+		}
+		if err := first.sync(ctx, c); err == nil || !strings.Contains(err.Error(), "unresolved conflicts") {
+			t.Errorf("sync with the conflict unresolved: got error %v", err)
+		}
+
+		// Once resolved it syncs, and a note added without an ID gets one
+		writeSyncFile(t, first.dir, fmt.Sprintf("%d.md", note.ID), &syncNote{syncFrontMatter{ID: note.ID, Title: "Plan"}, "Both edits\n"})
+		writeSyncFile(t, first.dir, "Ideas.md", &syncNote{syncFrontMatter{Title: "Ideas", Parent: note.ID, Type: "subpage"}, "More\n"})
+		if err := first.sync(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if got := content(); got != "Both edits\n" {
+			t.Errorf("after resolving: got %q", got)
+		}
+		var tree []*NoteTree
+		api.do("GET", "/notes/tree", nil, http.StatusOK, &tree)
+		var ideas int
+		var find func(nodes []*NoteTree, parent int)
+		find = func(nodes []*NoteTree, parent int) {
+			for _, n := range nodes {
+				if n.Title == "Ideas" && parent == note.ID {
+					ideas = n.ID
+				}
+				find(n.Children, n.ID)
+			}
+		}
+		find(tree, 0)
+		if ideas == 0 {
+			t.Fatalf("the note added in git is not under %d:\n%+v", note.ID, tree)
+		}
+
+		// The second picks up both from the remote
+		if err := second.sync(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if n := syncFile(t, second.dir, note.ID); n.Content != "Both edits\n" {
+			t.Errorf("second working copy: got %q", n.Content)
+		}
+		if n := syncFile(t, second.dir, ideas); n.Title != "Ideas" || n.Parent != note.ID {
+			t.Errorf("second working copy: got the added note %+v", n)
+		}
+		for _, repo := range repos {
+			if _, err := os.Stat(filepath.Join(repo.dir, syncNotesDir, "Ideas.md")); !os.IsNotExist(err) {
+				t.Errorf("%s: the file of the added note was not renamed to its ID: %v", repo.dir, err)
+			}
+		}
+
+		// And its edits reach the first through the database and the remote
+		writeSyncFile(t, second.dir, fmt.Sprintf("%d.md", ideas), &syncNote{syncFrontMatter{ID: ideas, Title: "Ideas", Parent: note.ID, Type: "subpage"}, "Even more\n"})
+		if err := second.sync(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if err := first.sync(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		if n := syncFile(t, first.dir, ideas); n.Content != "Even more\n" {
+			t.Errorf("first working copy: got %q", n.Content)
+		}
+	})
+}
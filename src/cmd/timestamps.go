@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Timestamps
+//
+// Timestamps are stored as TIMESTAMPTZ and the server's database session
+// runs in UTC. Every timestamp accepted by the API must be RFC 3339 and
+// every timestamp returned is RFC 3339 in UTC. All-day deadlines are
+// floating dates, stored as midnight UTC of their date and shown on that
+// date in every timezone.
+//
+// The timezone used to interpret dates (all-day deadlines, date ranges of
+// reports and the agenda) comes from the tz query parameter, then the
+// X-Timezone header and finally the timezone setting.
+
+const timezoneHeader = "X-Timezone"
+
+// requestLocation returns the timezone of the request
+func requestLocation(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		name = r.Header.Get(timezoneHeader)
+	}
+	if name == "" {
+		name = viper.GetString("timezone")
+	}
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// parseTimestamp parses an RFC 3339 timestamp, field names the input in
+// the error
+func parseTimestamp(field, s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, &fieldError{Field: field, Message: fmt.Sprintf("Invalid %s, expected an RFC 3339 timestamp such as 2024-06-01T09:00:00Z", field)}
+	}
+	return t.UTC(), nil
+}
+
+// parseDeadline parses a deadline. All-day deadlines may also be given as
+// a date (2024-06-01), a timestamp is reduced to its date in loc.
+func parseDeadline(s string, allDay bool, loc *time.Location) (time.Time, error) {
+	if allDay {
+		if d, err := time.Parse("2006-01-02", s); err == nil {
+			return d, nil
+		}
+	}
+	t, err := parseTimestamp("deadline", s)
+	if err != nil {
+		if allDay {
+			return t, &fieldError{Field: "deadline", Message: "Invalid deadline, expected a date such as 2024-06-01 or an RFC 3339 timestamp"}
+		}
+		return t, err
+	}
+	if allDay {
+		return floatingDate(t.In(loc), time.UTC), nil
+	}
+	return t, nil
+}
+
+// formatTimestamp formats a timestamp for the API
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatNullTimestamp formats a nullable timestamp, NULL becomes ""
+func formatNullTimestamp(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return formatTimestamp(t.Time)
+}
@@ -0,0 +1,732 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"draftsmith/src/client"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Terminal UI
+//
+// The tui shows the note tree, the tag tree and the agenda of a server in
+// panes. Like the cli subcommands it only talks to the HTTP API, so it
+// works against remote servers. Requests are made off the UI goroutine and
+// their results applied with QueueUpdateDraw.
+
+const tuiKeys = `Keys:
+  Tab, Shift-Tab  Move between panes
+  j, k, arrows    Move within a pane
+  Space           Expand or collapse
+  Enter, e        Edit the selected note in $EDITOR
+  /               Find a note by title, Ctrl-S searches the content
+  t               Toggle the task status between open and done
+  c               Start or stop the clock on the task
+  r               Refresh
+  ?               Help
+  q               Quit`
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse and edit notes, tags and tasks in a terminal UI",
+	Long: `An interactive terminal UI for a running server.
+
+The panes show the note hierarchy, the tag tree with the notes under each
+tag, the agenda and a preview of the selected note.
+
+` + tuiKeys,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+		days, _ := cmd.Flags().GetInt("days")
+		if days < 1 {
+			return fmt.Errorf("--days must be at least 1")
+		}
+		return newTUI(apiClient(), days).run(cliContext(cmd))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+
+	tuiCmd.Flags().Int("days", 7, "Number of days shown in the agenda")
+}
+
+// tuiRef is the reference of a tree node, a tag node has only TagID
+type tuiRef struct {
+	NoteID int
+	TaskID int
+	TagID  int
+}
+
+// tuiData is everything shown by the panes, loaded in one go on refresh
+type tuiData struct {
+	notes    []*client.NoteTree
+	tags     []*client.TagTree
+	agenda   *client.Agenda
+	tasks    map[int]client.TaskWithDetails // By task ID
+	byNote   map[int]int                    // Task ID by note ID
+	statuses []client.TaskStatus
+	clock    *client.RunningClock
+	loadedAt time.Time
+}
+
+type tui struct {
+	client *client.Client
+	ctx    context.Context
+	days   int
+	loc    *time.Location
+
+	app     *tview.Application
+	pages   *tview.Pages
+	notes   *tview.TreeView
+	tags    *tview.TreeView
+	agenda  *tview.TreeView
+	preview *tview.TextView
+	status  *tview.TextView
+	panes   []*tview.TreeView
+
+	data      *tuiData
+	collapsed map[tuiRef]bool
+	previewID int
+	message   string
+	failed    bool
+}
+
+func newTUI(c *client.Client, days int) *tui {
+	t := &tui{
+		client:    c,
+		days:      days,
+		loc:       time.Local,
+		app:       tview.NewApplication(),
+		pages:     tview.NewPages(),
+		preview:   tview.NewTextView(),
+		status:    tview.NewTextView().SetDynamicColors(true),
+		collapsed: map[tuiRef]bool{},
+	}
+	if c.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			t.loc = loc
+		}
+	}
+
+	t.notes = t.newTree("Notes")
+	t.tags = t.newTree("Tags")
+	t.agenda = t.newTree("Agenda")
+	t.panes = []*tview.TreeView{t.notes, t.tags, t.agenda}
+	t.preview.SetWrap(true).SetWordWrap(true).SetBorder(true).SetTitle(" Preview ")
+
+	left := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.notes, 0, 2, true).
+		AddItem(t.tags, 0, 1, false)
+	right := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.agenda, 0, 1, false).
+		AddItem(t.preview, 0, 1, false)
+	main := tview.NewFlex().
+		AddItem(left, 0, 1, true).
+		AddItem(right, 0, 1, false)
+	layout := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(main, 0, 1, true).
+		AddItem(t.status, 1, 0, false)
+	t.pages.AddPage("main", layout, true, true)
+	t.app.SetRoot(t.pages, true).SetFocus(t.notes)
+	return t
+}
+
+// newTree creates a pane with a hidden root
+func (t *tui) newTree(title string) *tview.TreeView {
+	tree := tview.NewTreeView().SetRoot(tview.NewTreeNode(title)).SetTopLevel(1)
+	tree.SetBorder(true).SetTitle(" " + title + " ")
+	tree.SetChangedFunc(t.selected)
+	tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		if ref, ok := node.GetReference().(tuiRef); ok && ref.NoteID != 0 {
+			t.edit(ref.NoteID)
+			return
+		}
+		t.toggleExpanded(node)
+	})
+	tree.SetInputCapture(t.keys)
+	tree.SetFocusFunc(func() {
+		tree.SetBorderColor(tcell.ColorYellow)
+		if node := tree.GetCurrentNode(); node != nil {
+			t.selected(node)
+		}
+	})
+	tree.SetBlurFunc(func() { tree.SetBorderColor(tview.Styles.BorderColor) })
+	return tree
+}
+
+// run loads the data and runs the UI until it is quit
+func (t *tui) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	t.ctx = ctx
+
+	// Fail before taking over the terminal if the server can't be reached
+	data, err := t.load()
+	if err != nil {
+		return err
+	}
+	t.apply(data)
+	t.setMessage("Press ? for help", nil)
+
+	// Keep the elapsed time of a running clock current
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.app.QueueUpdateDraw(t.drawStatus)
+			}
+		}
+	}()
+
+	return t.app.Run()
+}
+
+// load fetches everything the panes show
+func (t *tui) load() (*tuiData, error) {
+	d := &tuiData{tasks: map[int]client.TaskWithDetails{}, byNote: map[int]int{}, loadedAt: time.Now()}
+	var err error
+	if d.notes, err = t.client.NoteTree(t.ctx); err != nil {
+		return nil, fmt.Errorf("error loading notes: %w", err)
+	}
+	if d.tags, err = t.client.TagTree(t.ctx); err != nil {
+		return nil, fmt.Errorf("error loading tags: %w", err)
+	}
+	today := time.Now().In(t.loc)
+	from := today.Format("2006-01-02")
+	to := today.AddDate(0, 0, t.days-1).Format("2006-01-02")
+	if d.agenda, err = t.client.Agenda(t.ctx, from, to); err != nil {
+		return nil, fmt.Errorf("error loading agenda: %w", err)
+	}
+	tasks, err := t.client.ListTasks(t.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading tasks: %w", err)
+	}
+	for _, task := range tasks {
+		d.tasks[task.ID] = task
+		d.byNote[task.NoteID] = task.ID
+	}
+	if d.statuses, err = t.client.ListTaskStatuses(t.ctx); err != nil {
+		return nil, fmt.Errorf("error loading task statuses: %w", err)
+	}
+	if d.clock, err = t.client.CurrentClock(t.ctx); err != nil {
+		return nil, fmt.Errorf("error loading clock: %w", err)
+	}
+	return d, nil
+}
+
+// refresh reloads the panes in the background and then shows message
+func (t *tui) refresh(message string) {
+	go func() {
+		data, err := t.load()
+		t.app.QueueUpdateDraw(func() {
+			if err != nil {
+				t.setMessage("", err)
+				return
+			}
+			t.apply(data)
+			t.previewID = 0
+			if node := t.currentTree().GetCurrentNode(); node != nil {
+				t.selected(node)
+			}
+			t.setMessage(message, nil)
+		})
+	}()
+}
+
+// background runs f off the UI goroutine, shows its message and refreshes
+func (t *tui) background(f func() (string, error)) {
+	go func() {
+		message, err := f()
+		if err != nil {
+			t.app.QueueUpdateDraw(func() { t.setMessage("", err) })
+			return
+		}
+		t.refresh(message)
+	}()
+}
+
+// apply rebuilds the panes from data, keeping the selection of each
+func (t *tui) apply(data *tuiData) {
+	t.data = data
+
+	t.rebuild(t.notes, func(root *tview.TreeNode) {
+		for _, n := range data.notes {
+			t.addNote(root, n)
+		}
+	})
+
+	t.rebuild(t.tags, func(root *tview.TreeNode) {
+		for _, tag := range data.tags {
+			t.addTag(root, tag)
+		}
+	})
+
+	t.rebuild(t.agenda, func(root *tview.TreeNode) {
+		for _, day := range data.agenda.Days {
+			t.addDay(root, day)
+		}
+	})
+
+	t.drawStatus()
+}
+
+// rebuild replaces the nodes of tree and selects the node that was
+// selected before, or the first one
+func (t *tui) rebuild(tree *tview.TreeView, build func(root *tview.TreeNode)) {
+	var current tuiRef
+	if node := tree.GetCurrentNode(); node != nil {
+		current, _ = node.GetReference().(tuiRef)
+	}
+	root := tree.GetRoot().ClearChildren()
+	build(root)
+
+	var first, found *tview.TreeNode
+	root.Walk(func(node, parent *tview.TreeNode) bool {
+		if node == root || found != nil {
+			return found == nil
+		}
+		ref, ok := node.GetReference().(tuiRef)
+		if !ok {
+			return true
+		}
+		if first == nil {
+			first = node
+		}
+		if ref == current {
+			found = node
+		}
+		return node.IsExpanded()
+	})
+	if found == nil {
+		found = first
+	}
+	tree.SetCurrentNode(found)
+}
+
+// node creates a node, expanded unless it was collapsed before
+func (t *tui) node(text string, ref tuiRef) *tview.TreeNode {
+	return tview.NewTreeNode(text).SetReference(ref).SetExpanded(!t.collapsed[ref])
+}
+
+func (t *tui) addNote(parent *tview.TreeNode, n *client.NoteTree) {
+	ref := tuiRef{NoteID: n.ID, TaskID: t.data.byNote[n.ID]}
+	node := t.node(t.noteLabel(ref, n.Title), ref)
+	parent.AddChild(node)
+	for _, child := range n.Children {
+		t.addNote(node, child)
+	}
+}
+
+func (t *tui) addTag(parent *tview.TreeNode, tag *client.TagTree) {
+	node := t.node("[blue]#"+tview.Escape(tag.Name)+"[-]", tuiRef{TagID: tag.ID})
+	parent.AddChild(node)
+	for _, child := range tag.Children {
+		t.addTag(node, child)
+	}
+	for _, n := range tag.Notes {
+		ref := tuiRef{NoteID: n.ID, TaskID: t.data.byNote[n.ID]}
+		node.AddChild(t.node(t.noteLabel(ref, n.Title), ref))
+	}
+}
+
+func (t *tui) addDay(parent *tview.TreeNode, day *client.AgendaDay) {
+	header := fmt.Sprintf("[::b]%s %s[::-]", day.Weekday, day.Date)
+	if day.ClockedSeconds > 0 {
+		header += fmt.Sprintf(" [gray](%s clocked)[-]", time.Duration(day.ClockedSeconds)*time.Second)
+	}
+	node := tview.NewTreeNode(header).SetSelectable(false)
+	parent.AddChild(node)
+
+	item := func(prefix string, it client.AgendaItem) {
+		ref := tuiRef{NoteID: it.NoteID, TaskID: it.TaskID}
+		node.AddChild(tview.NewTreeNode(prefix + " " + t.noteLabel(ref, it.Title)).SetReference(ref))
+	}
+	for _, it := range day.Overdue {
+		item(fmt.Sprintf("[red]overdue %dd[-]", it.DaysOverdue), it)
+	}
+	for _, it := range day.Scheduled {
+		when := "all day"
+		if !it.AllDay {
+			when = agendaClockTime(it.Start, t.loc) + "-" + agendaClockTime(it.End, t.loc)
+		}
+		item(when, it)
+	}
+	for _, it := range day.Deadlines {
+		when := "due"
+		if !it.AllDay {
+			when += " " + agendaClockTime(it.Deadline, t.loc)
+		}
+		item("[orange]"+when+"[-]", it)
+	}
+	for _, j := range day.Journal {
+		node.AddChild(tview.NewTreeNode("journal " + tview.Escape(j.Title)).SetReference(tuiRef{NoteID: j.NoteID}))
+	}
+}
+
+// agendaClockTime formats the time of day of an RFC 3339 timestamp
+func agendaClockTime(s string, loc *time.Location) string {
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return s
+	}
+	return ts.In(loc).Format("15:04")
+}
+
+// noteLabel is the title of a note, after the status of its task if any
+func (t *tui) noteLabel(ref tuiRef, title string) string {
+	label := tview.Escape(title)
+	task, ok := t.data.tasks[ref.TaskID]
+	if !ok {
+		return label
+	}
+	color := "yellow"
+	switch t.data.category(task.Status) {
+	case statusClosed:
+		color = "green"
+	case statusCancelled:
+		color = "gray"
+	}
+	if t.data.clock.Running && t.data.clock.TaskID == task.ID {
+		label = "[::b]" + label + "[::-] [red]●[-]"
+	}
+	return fmt.Sprintf("[%s]%s[-] %s", color, tview.Escape(strings.ToUpper(task.Status)), label)
+}
+
+// category is the category of a status, unknown statuses are open
+func (d *tuiData) category(name string) string {
+	for _, s := range d.statuses {
+		if s.Name == name {
+			return s.Category
+		}
+	}
+	return statusOpen
+}
+
+// currentTree is the focused pane, or the notes if a dialog has focus
+func (t *tui) currentTree() *tview.TreeView {
+	for _, p := range t.panes {
+		if p.HasFocus() {
+			return p
+		}
+	}
+	return t.notes
+}
+
+// current is the reference of the selected node of the focused pane
+func (t *tui) current() (tuiRef, bool) {
+	node := t.currentTree().GetCurrentNode()
+	if node == nil {
+		return tuiRef{}, false
+	}
+	ref, ok := node.GetReference().(tuiRef)
+	return ref, ok
+}
+
+func (t *tui) keys(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		t.focusPane(1)
+		return nil
+	case tcell.KeyBacktab:
+		t.focusPane(-1)
+		return nil
+	case tcell.KeyRune:
+	default:
+		return event
+	}
+
+	ref, _ := t.current()
+	switch event.Rune() {
+	case 'q':
+		t.app.Stop()
+	case '?':
+		t.showHelp()
+	case '/':
+		t.showFinder()
+	case 'r':
+		t.setMessage("Refreshing...", nil)
+		t.refresh("Refreshed")
+	case ' ':
+		if node := t.currentTree().GetCurrentNode(); node != nil {
+			t.toggleExpanded(node)
+		}
+	case 'e':
+		if ref.NoteID == 0 {
+			t.setMessage("Select a note to edit", nil)
+			break
+		}
+		t.edit(ref.NoteID)
+	case 't':
+		if ref.TaskID == 0 {
+			t.setMessage("The selected note is not a task", nil)
+			break
+		}
+		t.toggleStatus(ref.TaskID)
+	case 'c':
+		if ref.TaskID == 0 {
+			t.setMessage("The selected note is not a task", nil)
+			break
+		}
+		t.toggleClock(ref.TaskID)
+	default:
+		return event
+	}
+	return nil
+}
+
+func (t *tui) focusPane(offset int) {
+	i := 0
+	for j, p := range t.panes {
+		if p.HasFocus() {
+			i = j
+		}
+	}
+	i = (i + offset + len(t.panes)) % len(t.panes)
+	t.app.SetFocus(t.panes[i])
+}
+
+func (t *tui) toggleExpanded(node *tview.TreeNode) {
+	if len(node.GetChildren()) == 0 {
+		return
+	}
+	node.SetExpanded(!node.IsExpanded())
+	if ref, ok := node.GetReference().(tuiRef); ok {
+		t.collapsed[ref] = !node.IsExpanded()
+	}
+}
+
+// selected shows the note of a node in the preview
+func (t *tui) selected(node *tview.TreeNode) {
+	ref, ok := node.GetReference().(tuiRef)
+	if !ok || ref.NoteID == 0 || ref.NoteID == t.previewID {
+		return
+	}
+	id := ref.NoteID
+	t.previewID = id
+	go func() {
+		note, err := t.client.GetNote(t.ctx, id)
+		t.app.QueueUpdateDraw(func() {
+			if t.previewID != id {
+				// Another note was selected in the meantime
+				return
+			}
+			if err != nil {
+				t.preview.SetTitle(" Preview ")
+				t.preview.SetText("")
+				t.setMessage("", err)
+				return
+			}
+			t.preview.SetTitle(" " + tview.Escape(note.Title) + " ")
+			t.preview.SetText(t.taskSummary(ref.TaskID) + note.Content).ScrollToBeginning()
+		})
+	}()
+}
+
+// taskSummary describes a task above the content in the preview
+func (t *tui) taskSummary(taskID int) string {
+	task, ok := t.data.tasks[taskID]
+	if !ok {
+		return ""
+	}
+	parts := []string{fmt.Sprintf("Task %d: %s", task.ID, task.Status)}
+	if task.Deadline != "" {
+		parts = append(parts, "due "+task.Deadline)
+	}
+	if task.Priority != 0 {
+		parts = append(parts, fmt.Sprintf("priority %d", task.Priority))
+	}
+	if task.EffortEstimate > 0 || task.ClockedEffort > 0 {
+		parts = append(parts, fmt.Sprintf("%sh of %sh", formatHours(task.ClockedEffort), formatHours(task.EffortEstimate)))
+	}
+	return strings.Join(parts, ", ") + "\n\n"
+}
+
+// edit opens a note in the editor, suspending the UI, and saves it if it
+// changed
+func (t *tui) edit(noteID int) {
+	note, err := t.client.GetNote(t.ctx, noteID)
+	if err != nil {
+		t.setMessage("", err)
+		return
+	}
+	var content string
+	t.app.Suspend(func() {
+		content, err = editText(note.Content, "draftsmith-*.md")
+	})
+	if err != nil {
+		t.setMessage("", err)
+		return
+	}
+	if content == note.Content {
+		t.setMessage("No changes", nil)
+		return
+	}
+	t.background(func() (string, error) {
+		err := t.client.UpdateNote(t.ctx, noteID, client.NoteUpdate{Content: &content})
+		return fmt.Sprintf("Saved %q", note.Title), err
+	})
+}
+
+// toggleStatus moves an open task to a closed status and a closed or
+// cancelled one back to an open status, as far as transitions allow
+func (t *tui) toggleStatus(taskID int) {
+	data := t.data
+	task, ok := data.tasks[taskID]
+	if !ok {
+		t.setMessage("Task not found, try refreshing", nil)
+		return
+	}
+	t.background(func() (string, error) { return t.changeStatus(data, task) })
+}
+
+// changeStatus toggles the status of task and describes the change
+func (t *tui) changeStatus(data *tuiData, task client.TaskWithDetails) (string, error) {
+	to, err := t.toggleTarget(data, task)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.client.UpdateTask(t.ctx, task.ID, client.UpdateTask{Status: &to})
+	if err != nil {
+		return "", err
+	}
+	message := fmt.Sprintf("Task %d: %s → %s", task.ID, task.Status, to)
+	if resp.NextDeadline != "" {
+		message += ", next due " + resp.NextDeadline
+	}
+	return message, nil
+}
+
+// toggleTarget picks the status a task toggles to. Reopening returns the
+// task to the open status it was in before it was closed.
+func (t *tui) toggleTarget(data *tuiData, task client.TaskWithDetails) (string, error) {
+	var from *client.TaskStatus
+	for i := range data.statuses {
+		if data.statuses[i].Name == task.Status {
+			from = &data.statuses[i]
+		}
+	}
+	allowed := func(to string) bool {
+		return from == nil || contains(from.Transitions, to)
+	}
+
+	if data.category(task.Status) == statusOpen {
+		for _, s := range data.statuses {
+			if s.Category == statusClosed && allowed(s.Name) {
+				return s.Name, nil
+			}
+		}
+		return "", fmt.Errorf("%s can't move to a closed status", task.Status)
+	}
+
+	changes, err := t.client.TaskStatusChanges(t.ctx, task.ID)
+	if err != nil {
+		return "", err
+	}
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		if c.ToStatus == task.Status && c.FromStatus != nil &&
+			data.category(*c.FromStatus) == statusOpen && allowed(*c.FromStatus) {
+			return *c.FromStatus, nil
+		}
+	}
+	for _, s := range data.statuses {
+		if s.Category == statusOpen && allowed(s.Name) {
+			return s.Name, nil
+		}
+	}
+	return "", fmt.Errorf("%s can't move to an open status", task.Status)
+}
+
+// toggleClock stops the clock on a task if it is running and starts it
+// otherwise
+func (t *tui) toggleClock(taskID int) {
+	running := t.data.clock.Running && t.data.clock.TaskID == taskID
+	t.background(func() (string, error) { return t.switchClock(taskID, running) })
+}
+
+// switchClock stops the clock on a task if running and starts it otherwise,
+// and describes what it did
+func (t *tui) switchClock(taskID int, running bool) (string, error) {
+	if running {
+		if _, err := t.client.StopClock(t.ctx, taskID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Clocked out of task %d", taskID), nil
+	}
+	resp, err := t.client.StartClock(t.ctx, taskID)
+	if err != nil {
+		return "", err
+	}
+	message := fmt.Sprintf("Clocked in to task %d", taskID)
+	if resp.StoppedID != 0 {
+		message += fmt.Sprintf(", stopped clock %d", resp.StoppedID)
+	}
+	return message, nil
+}
+
+// setMessage shows a message, or err, in the status bar
+func (t *tui) setMessage(message string, err error) {
+	t.message, t.failed = message, err != nil
+	if err != nil {
+		t.message = err.Error()
+	}
+	t.drawStatus()
+}
+
+// drawStatus shows the message and the running clock
+func (t *tui) drawStatus() {
+	text := tview.Escape(t.message)
+	if t.failed {
+		text = "[red]" + text + "[-]"
+	}
+	if clock := t.data.clock; clock != nil && clock.Running {
+		elapsed := time.Duration(clock.ElapsedSeconds)*time.Second + time.Since(t.data.loadedAt)
+		text += fmt.Sprintf("  [red]●[-] %s %s", tview.Escape(clock.Title), elapsed.Truncate(time.Minute))
+	}
+	server := viper.GetString("server")
+	if server == "" {
+		server = fmt.Sprintf("localhost:%d", viper.GetInt("port"))
+	}
+	t.status.SetText(text + "  [gray]" + tview.Escape(server) + "[-]")
+}
+
+// modal centres p over the panes
+func modal(p tview.Primitive, width, height int) tview.Primitive {
+	return tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(p, height, 1, true).
+			AddItem(nil, 0, 1, false), width, 1, true).
+		AddItem(nil, 0, 1, false)
+}
+
+func (t *tui) showHelp() {
+	back := t.currentTree()
+	help := tview.NewTextView().SetText(tuiKeys)
+	help.SetBorder(true).SetTitle(" Help ")
+	help.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEscape || event.Key() == tcell.KeyEnter ||
+			event.Rune() == 'q' || event.Rune() == '?' {
+			t.pages.RemovePage("help")
+			t.app.SetFocus(back)
+			return nil
+		}
+		return event
+	})
+	t.pages.AddPage("help", modal(help, 70, 14), true, true)
+	t.app.SetFocus(help)
+}
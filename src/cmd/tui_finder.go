@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"draftsmith/src/client"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Fuzzy finder
+//
+// The finder narrows the titles of all notes as you type. Ctrl-S replaces
+// them with the results of a full text search on the server for what was
+// typed, which can then be narrowed the same way.
+
+// fuzzyScore reports whether the letters of pattern appear in order in s,
+// ignoring case and spaces in pattern, and scores the match. Consecutive
+// letters and letters at the start of a word score higher.
+func fuzzyScore(pattern, s string) (int, bool) {
+	var p []rune
+	for _, r := range strings.ToLower(pattern) {
+		if !unicode.IsSpace(r) {
+			p = append(p, r)
+		}
+	}
+	if len(p) == 0 {
+		return 0, true
+	}
+
+	text := []rune(strings.ToLower(s))
+	score, pi, last := 0, 0, -2
+	for i, r := range text {
+		if pi == len(p) {
+			break
+		}
+		if r != p[pi] {
+			continue
+		}
+		score++
+		if last == i-1 {
+			score += 5
+		}
+		if i == 0 || !unicode.IsLetter(text[i-1]) && !unicode.IsDigit(text[i-1]) {
+			score += 8
+		}
+		last = i
+		pi++
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+	return score, true
+}
+
+// fuzzyFilter returns the notes whose titles match pattern, best first
+func fuzzyFilter(pattern string, notes []client.NoteInfo) []client.NoteInfo {
+	type match struct {
+		note  client.NoteInfo
+		score int
+	}
+	var matches []match
+	for _, n := range notes {
+		if score, ok := fuzzyScore(pattern, n.Title); ok {
+			matches = append(matches, match{n, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return len(matches[i].note.Title) < len(matches[j].note.Title)
+	})
+
+	result := make([]client.NoteInfo, len(matches))
+	for i, m := range matches {
+		result[i] = m.note
+	}
+	return result
+}
+
+// showFinder opens the finder over the titles of all notes
+func (t *tui) showFinder() {
+	summaries, err := t.client.ListNoteSummaries(t.ctx)
+	if err != nil {
+		t.setMessage("", err)
+		return
+	}
+	candidates := make([]client.NoteInfo, len(summaries))
+	for i, n := range summaries {
+		candidates[i] = client.NoteInfo{ID: n.ID, Title: n.Title}
+	}
+
+	back := t.currentTree()
+	input := tview.NewInputField().SetLabel("Title: ").SetFieldBackgroundColor(tcell.ColorDefault)
+	list := tview.NewList().ShowSecondaryText(false).SetHighlightFullLine(true)
+	var shown []client.NoteInfo
+
+	filter := func(pattern string) {
+		shown = fuzzyFilter(pattern, candidates)
+		list.Clear()
+		for _, n := range shown {
+			list.AddItem(tview.Escape(n.Title), "", 0, nil)
+		}
+	}
+	closeFinder := func() {
+		t.pages.RemovePage("finder")
+		t.app.SetFocus(back)
+	}
+
+	input.SetChangedFunc(filter)
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEscape:
+			closeFinder()
+		case tcell.KeyEnter:
+			if len(shown) == 0 {
+				return nil
+			}
+			closeFinder()
+			t.jumpTo(shown[list.GetCurrentItem()].ID)
+		case tcell.KeyDown, tcell.KeyCtrlN:
+			if i := list.GetCurrentItem(); i < list.GetItemCount()-1 {
+				list.SetCurrentItem(i + 1)
+			}
+		case tcell.KeyUp, tcell.KeyCtrlP:
+			if i := list.GetCurrentItem(); i > 0 {
+				list.SetCurrentItem(i - 1)
+			}
+		case tcell.KeyCtrlS:
+			query := strings.TrimSpace(input.GetText())
+			if query == "" {
+				return nil
+			}
+			results, err := t.client.SearchNotes(t.ctx, query)
+			if err != nil {
+				t.setMessage("", err)
+				return nil
+			}
+			candidates = results
+			input.SetLabel(fmt.Sprintf("Search %q: ", query))
+			input.SetText("")
+			filter("")
+		default:
+			return event
+		}
+		return nil
+	})
+
+	finder := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(input, 1, 0, true).
+		AddItem(list, 0, 1, false)
+	finder.SetBorder(true).SetTitle(" Find (Ctrl-S searches content) ")
+	filter("")
+
+	t.pages.AddPage("finder", modal(finder, 80, 20), true, true)
+	t.app.SetFocus(input)
+}
+
+// jumpTo selects a note in the notes pane, expanding its parents
+func (t *tui) jumpTo(noteID int) {
+	var target *tview.TreeNode
+	t.notes.GetRoot().Walk(func(node, parent *tview.TreeNode) bool {
+		if ref, ok := node.GetReference().(tuiRef); ok && ref.NoteID == noteID {
+			target = node
+		}
+		return target == nil
+	})
+	if target == nil {
+		// Created since the last refresh
+		t.previewID = 0
+		t.selected(tview.NewTreeNode("").SetReference(tuiRef{NoteID: noteID}))
+		return
+	}
+	for _, node := range t.notes.GetPath(target) {
+		node.SetExpanded(true)
+		if ref, ok := node.GetReference().(tuiRef); ok {
+			delete(t.collapsed, ref)
+		}
+	}
+	t.notes.SetCurrentNode(target)
+	t.app.SetFocus(t.notes)
+	t.selected(target)
+}
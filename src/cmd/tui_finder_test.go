@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+
+	"draftsmith/src/client"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		ok         bool
+	}{
+		{"", "Anything", true},
+		{"wkr", "Weekly review", true},
+		{"WEEKLY REV", "weekly review", true},
+		{"rw", "Weekly review", true},
+		{"rvw", "Weekly", false},
+		{"yw", "Weekly", false}, // Letters out of order
+	} {
+		if _, ok := fuzzyScore(tc.pattern, tc.s); ok != tc.ok {
+			t.Errorf("fuzzyScore(%q, %q): got match %v, want %v", tc.pattern, tc.s, ok, tc.ok)
+		}
+	}
+
+	// Each pair lists the better match first
+	for _, tc := range []struct {
+		pattern, better, worse string
+	}{
+		{"rev", "Review notes", "Tax return review"},      // At the start
+		{"rev", "Tax review", "Carver overview"},          // At the start of a word
+		{"rev", "Preview", "Driver eval"},                 // Consecutive letters
+		{"wr", "Weekly review", "Write down the weekend"}, // Both letters at word starts
+	} {
+		better, _ := fuzzyScore(tc.pattern, tc.better)
+		worse, _ := fuzzyScore(tc.pattern, tc.worse)
+		if better <= worse {
+			t.Errorf("%q: %q scored %d, %q scored %d", tc.pattern, tc.better, better, tc.worse, worse)
+		}
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	var notes []client.NoteInfo
+	for i, title := range []string{"Grocery list", "Garden plan", "Reading list", "Gardening", "Travel"} {
+		notes = append(notes, client.NoteInfo{ID: i + 1, Title: title})
+	}
+
+	titles := func(pattern string) string {
+		var got []string
+		for _, n := range fuzzyFilter(pattern, notes) {
+			got = append(got, n.Title)
+		}
+		return fmt.Sprint(got)
+	}
+	// Equal scores put the shorter title first, and otherwise keep the order
+	if got, want := titles("gard"), "[Gardening Garden plan]"; got != want {
+		t.Errorf("gard: got %s, want %s", got, want)
+	}
+	if got, want := titles("list"), "[Grocery list Reading list]"; got != want {
+		t.Errorf("list: got %s, want %s", got, want)
+	}
+	if got, want := titles("gl"), "[Grocery list Garden plan Reading list]"; got != want {
+		t.Errorf("gl: got %s, want %s", got, want)
+	}
+	if got := titles("zzz"); got != "[]" {
+		t.Errorf("zzz: got %s, want no notes", got)
+	}
+	if got := titles(""); got != "[Travel Gardening Garden plan Grocery list Reading list]" {
+		t.Errorf("empty pattern: got %s, want every note, shortest first", got)
+	}
+}
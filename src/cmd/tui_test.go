@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"draftsmith/src/client"
+)
+
+// testTUI is the TUI of the test server with its data loaded, without a
+// screen
+func (api *testAPI) testTUI() *tui {
+	api.t.Helper()
+	t := newTUI(client.New(api.url), 7)
+	t.ctx = context.Background()
+	api.reloadTUI(t)
+	return t
+}
+
+// reloadTUI loads the data of t as a refresh would
+func (api *testAPI) reloadTUI(t *tui) {
+	api.t.Helper()
+	data, err := t.load()
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	t.data = data
+}
+
+func TestTUIToggleStatus(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		id := api.createTask("Call the plumber")
+		api.do("PUT", fmt.Sprintf("/tasks/%d", id), map[string]string{"status": "wait"}, http.StatusOK, nil)
+		ui := api.testTUI()
+
+		toggle := func() string {
+			t.Helper()
+			message, err := ui.changeStatus(ui.data, ui.data.tasks[id])
+			if err != nil {
+				t.Fatal(err)
+			}
+			api.reloadTUI(ui)
+			return message
+		}
+		// Closed, then reopened in the status it was closed from rather
+		// than the initial one
+		if got, want := toggle(), fmt.Sprintf("Task %d: wait → done", id); got != want {
+			t.Errorf("closing: got %q, want %q", got, want)
+		}
+		if got, want := toggle(), fmt.Sprintf("Task %d: done → wait", id); got != want {
+			t.Errorf("reopening: got %q, want %q", got, want)
+		}
+
+		// Only closed statuses the transitions allow are picked
+		api.do("DELETE", "/task_statuses/wait/transitions/done", nil, http.StatusOK, nil)
+		api.reloadTUI(ui)
+		if _, err := ui.changeStatus(ui.data, ui.data.tasks[id]); err == nil || err.Error() != "wait can't move to a closed status" {
+			t.Errorf("closing without a transition: got error %v", err)
+		}
+		if status := api.taskDetails(id).Status; status != "wait" {
+			t.Errorf("status after the failed toggle: got %s, want wait", status)
+		}
+	})
+}
+
+func TestTUIToggleClock(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		first, second := api.createTask("Review"), api.createTask("Write")
+		ui := api.testTUI()
+
+		toggle := func(taskID int) string {
+			t.Helper()
+			running := ui.data.clock.Running && ui.data.clock.TaskID == taskID
+			message, err := ui.switchClock(taskID, running)
+			if err != nil {
+				t.Fatal(err)
+			}
+			api.reloadTUI(ui)
+			return message
+		}
+		if got, want := toggle(first), fmt.Sprintf("Clocked in to task %d", first); got != want {
+			t.Errorf("clocking in: got %q, want %q", got, want)
+		}
+		// Clocking in to another task stops the running clock
+		if got := toggle(second); !strings.HasPrefix(got, fmt.Sprintf("Clocked in to task %d, stopped clock ", second)) {
+			t.Errorf("switching tasks: got %q", got)
+		}
+		if clock := ui.data.clock; !clock.Running || clock.TaskID != second {
+			t.Errorf("running clock: got %+v, want task %d", clock, second)
+		}
+		if got, want := toggle(second), fmt.Sprintf("Clocked out of task %d", second); got != want {
+			t.Errorf("clocking out: got %q, want %q", got, want)
+		}
+		if ui.data.clock.Running {
+			t.Errorf("running clock: got %+v, want none", ui.data.clock)
+		}
+		if clocks := api.taskDetails(first).Clocks; len(clocks) != 1 || clocks[0].ClockOut == "" {
+			t.Errorf("clocks of the first task: got %+v, want one stopped", clocks)
+		}
+	})
+}
@@ -0,0 +1,1154 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebDAV (RFC 4918) access to notes and assets
+//
+// /dav/notes/ holds the notes as Markdown files laid out by note_hierarchy:
+// <title>.md is a note and <title>/ holds the notes under it. /dav/assets/
+// holds the uploaded files. Names are chosen as in filenames.go, so paths
+// match those of mount. Write locks (class 2) are kept in memory and a
+// write to a locked resource must submit the lock token in the If header,
+// ETags and If-Match guard against overwriting changes made elsewhere.
+
+const (
+	davRoot   = "/dav/"
+	davPrefix = "/dav"
+
+	// davMaxLockTimeout caps the lifetime of a lock, clients refresh locks
+	// they hold for longer
+	davMaxLockTimeout = time.Hour
+)
+
+type davNote struct {
+	ID       int
+	Title    string
+	Content  string
+	Created  time.Time
+	Modified time.Time
+	Parent   int
+	Children []int
+}
+
+type davAsset struct {
+	ID       int
+	Location string
+	Created  time.Time
+}
+
+// davTree is every note and asset at the time of a request
+type davTree struct {
+	notes  map[int]*davNote
+	roots  []int
+	assets map[int]*davAsset
+}
+
+// davWriteLock is a write lock on a path and, if Deep, everything under it
+type davWriteLock struct {
+	Token   string
+	Path    string
+	Href    string
+	Deep    bool
+	Shared  bool
+	Owner   string
+	Timeout time.Duration
+	Expires time.Time
+}
+
+// davState is shared by all WebDAV requests. Reads hold it for reading and
+// writes for writing, so each write sees the tree it changes.
+var davState = struct {
+	sync.RWMutex
+	collections map[int]bool             // Notes without children given a collection with MKCOL
+	locks       map[string]*davWriteLock // By token
+}{
+	collections: make(map[int]bool),
+	locks:       make(map[string]*davWriteLock),
+}
+
+func loadDAVTree(db *sql.DB) (*davTree, error) {
+	t := &davTree{notes: make(map[int]*davNote), assets: make(map[int]*davAsset)}
+
+	rows, err := db.Query("SELECT id, title, content, created_at, modified_at FROM notes")
+	if err != nil {
+		return nil, fmt.Errorf("error querying notes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		n := &davNote{}
+		var createdAt, modifiedAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.Title, &n.Content, &createdAt, &modifiedAt); err != nil {
+			return nil, fmt.Errorf("error scanning note row: %w", err)
+		}
+		n.Created, n.Modified = createdAt.Time, modifiedAt.Time
+		t.notes[n.ID] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning note rows: %w", err)
+	}
+
+	rows, err = db.Query("SELECT parent_note_id, child_note_id FROM note_hierarchy")
+	if err != nil {
+		return nil, fmt.Errorf("error querying note hierarchy: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var parentID, childID int
+		if err := rows.Scan(&parentID, &childID); err != nil {
+			return nil, fmt.Errorf("error scanning note hierarchy row: %w", err)
+		}
+		parent, child := t.notes[parentID], t.notes[childID]
+		if parent != nil && child != nil {
+			child.Parent = parentID
+			parent.Children = append(parent.Children, childID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning note hierarchy rows: %w", err)
+	}
+	for id, n := range t.notes {
+		if n.Parent == 0 {
+			t.roots = append(t.roots, id)
+		}
+	}
+
+	rows, err = db.Query("SELECT id, location, created_at FROM assets")
+	if err != nil {
+		return nil, fmt.Errorf("error querying assets: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a := &davAsset{}
+		if err := rows.Scan(&a.ID, &a.Location, &a.Created); err != nil {
+			return nil, fmt.Errorf("error scanning asset row: %w", err)
+		}
+		t.assets[a.ID] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error after scanning asset rows: %w", err)
+	}
+
+	return t, nil
+}
+
+func (t *davTree) title(id int) string {
+	return t.notes[id].Title
+}
+
+// children are the notes in the collection of note parent, or the top level
+// notes if parent is 0
+func (t *davTree) children(parent int) []int {
+	if parent == 0 {
+		return t.roots
+	}
+	return t.notes[parent].Children
+}
+
+// noteFiles names the notes in the collection of parent
+func (t *davTree) noteFiles(parent int) map[string]int {
+	files := make(map[string]int)
+	for name, id := range fileNames(t.children(parent), t.title) {
+		files[name+".md"] = id
+	}
+	return files
+}
+
+// noteCollections names the notes in the collection of parent that have a
+// collection of their own
+func (t *davTree) noteCollections(parent int) map[string]int {
+	collections := make(map[string]int)
+	for name, id := range fileNames(t.children(parent), t.title) {
+		if len(t.notes[id].Children) > 0 || davState.collections[id] {
+			collections[name] = id
+		}
+	}
+	return collections
+}
+
+func (t *davTree) assetFiles() map[string]int {
+	ids := make([]int, 0, len(t.assets))
+	for id := range t.assets {
+		ids = append(ids, id)
+	}
+	return fileNames(ids, func(id int) string { return filepath.Base(t.assets[id].Location) })
+}
+
+// descendants returns the notes under id, deepest first
+func (t *davTree) descendants(id int) []int {
+	var ids []int
+	for _, child := range t.notes[id].Children {
+		ids = append(ids, t.descendants(child)...)
+		ids = append(ids, child)
+	}
+	return ids
+}
+
+type davKind int
+
+const (
+	davMissing davKind = iota
+	davRootCollection
+	davNoteCollection
+	davNoteFile
+	davAssetCollection
+	davAssetFile
+)
+
+// davResource is what a path refers to. A missing resource has In set to
+// the kind of collection that would hold it.
+type davResource struct {
+	Kind   davKind
+	In     davKind
+	Path   string // Cleaned, without a trailing slash
+	Name   string
+	ID     int // The note or asset, 0 for /dav/notes/
+	Parent int // The note collection holding a note or missing resource
+}
+
+func (res *davResource) IsCollection() bool {
+	return res.Kind == davRootCollection || res.Kind == davNoteCollection || res.Kind == davAssetCollection
+}
+
+func (res *davResource) Href() string {
+	segments := strings.Split(res.Path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	href := strings.Join(segments, "/")
+	if res.IsCollection() {
+		href += "/"
+	}
+	return href
+}
+
+func (res *davResource) child(kind davKind, name string, id int) *davResource {
+	return &davResource{Kind: kind, Path: res.Path + "/" + name, Name: name, ID: id, Parent: res.ID}
+}
+
+// resolve finds the resource at p, ok is false if there is no collection
+// that could hold it
+func (t *davTree) resolve(p string) (res *davResource, ok bool) {
+	p = path.Clean("/" + p)
+	if p != davPrefix && !strings.HasPrefix(p, davRoot) {
+		return nil, false
+	}
+	segments := strings.Split(strings.TrimPrefix(p, davPrefix), "/")[1:]
+	res = &davResource{Kind: davRootCollection, Path: p}
+	if len(segments) == 0 {
+		return res, true
+	}
+	res.Name = segments[len(segments)-1]
+
+	switch segments[0] {
+	case "notes":
+		res.Kind = davNoteCollection
+		for i, name := range segments[1:] {
+			if res.Kind != davNoteCollection {
+				return nil, false
+			}
+			last := i == len(segments)-2
+			res.Parent = res.ID
+			if id, ok := t.noteFiles(res.Parent)[name]; ok && last {
+				res.Kind, res.ID = davNoteFile, id
+			} else if id, ok := t.noteCollections(res.Parent)[name]; ok {
+				res.ID = id
+			} else if last {
+				res.Kind, res.In, res.ID = davMissing, davNoteCollection, 0
+			} else {
+				return nil, false
+			}
+		}
+	case "assets":
+		res.Kind = davAssetCollection
+		switch len(segments) {
+		case 1:
+		case 2:
+			if id, ok := t.assetFiles()[res.Name]; ok {
+				res.Kind, res.ID = davAssetFile, id
+			} else {
+				res.Kind, res.In = davMissing, davAssetCollection
+			}
+		default:
+			return nil, false
+		}
+	default:
+		if len(segments) > 1 {
+			return nil, false
+		}
+		res.Kind, res.In = davMissing, davRootCollection
+	}
+	return res, true
+}
+
+// members lists the resources in a collection
+func (t *davTree) members(res *davResource) []*davResource {
+	var members []*davResource
+	switch res.Kind {
+	case davRootCollection:
+		members = append(members, res.child(davNoteCollection, "notes", 0), res.child(davAssetCollection, "assets", 0))
+	case davNoteCollection:
+		for name, id := range t.noteFiles(res.ID) {
+			members = append(members, res.child(davNoteFile, name, id))
+		}
+		for name, id := range t.noteCollections(res.ID) {
+			members = append(members, res.child(davNoteCollection, name, id))
+		}
+	case davAssetCollection:
+		for name, id := range t.assetFiles() {
+			members = append(members, res.child(davAssetFile, name, id))
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+func noteETag(n *davNote) string {
+	sum := sha1.Sum([]byte(n.Content))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func assetETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// etag is the ETag of an existing file, "" for collections, missing
+// resources and assets whose file is gone
+func (t *davTree) etag(res *davResource) string {
+	switch res.Kind {
+	case davNoteFile:
+		return noteETag(t.notes[res.ID])
+	case davAssetFile:
+		if info, err := os.Stat(t.assets[res.ID].Location); err == nil {
+			return assetETag(info)
+		}
+	}
+	return ""
+}
+
+func davTime(t time.Time) string {
+	return t.UTC().Format(http.TimeFormat)
+}
+
+const davSupportedLock = "<d:lockentry><d:lockscope><d:exclusive/></d:lockscope><d:locktype><d:write/></d:locktype></d:lockentry>" +
+	"<d:lockentry><d:lockscope><d:shared/></d:lockscope><d:locktype><d:write/></d:locktype></d:lockentry>"
+
+// props are the live properties of an existing resource
+func (t *davTree) props(res *davResource) map[xml.Name]string {
+	displayName := res.Name
+	if res.Kind == davRootCollection {
+		displayName = "Draftsmith"
+	}
+	var discovery strings.Builder
+	for _, l := range davLocksOn(res.Path, false) {
+		discovery.WriteString(davActiveLock(l))
+	}
+	props := map[xml.Name]string{
+		davName(nsDAV, "displayname"):   davEscape(displayName),
+		davName(nsDAV, "supportedlock"): davSupportedLock,
+		davName(nsDAV, "lockdiscovery"): discovery.String(),
+		davName(nsDAV, "resourcetype"):  "",
+	}
+
+	switch res.Kind {
+	case davRootCollection, davAssetCollection:
+		props[davName(nsDAV, "resourcetype")] = "<d:collection/>"
+	case davNoteCollection:
+		props[davName(nsDAV, "resourcetype")] = "<d:collection/>"
+		if n, ok := t.notes[res.ID]; ok {
+			props[davName(nsDAV, "getlastmodified")] = davTime(n.Modified)
+			props[davName(nsDAV, "creationdate")] = n.Created.UTC().Format(time.RFC3339)
+		}
+	case davNoteFile:
+		n := t.notes[res.ID]
+		props[davName(nsDAV, "getcontenttype")] = "text/markdown; charset=utf-8"
+		props[davName(nsDAV, "getcontentlength")] = strconv.Itoa(len(n.Content))
+		props[davName(nsDAV, "getetag")] = davEscape(noteETag(n))
+		props[davName(nsDAV, "getlastmodified")] = davTime(n.Modified)
+		props[davName(nsDAV, "creationdate")] = n.Created.UTC().Format(time.RFC3339)
+	case davAssetFile:
+		a := t.assets[res.ID]
+		contentType := mime.TypeByExtension(filepath.Ext(res.Name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		props[davName(nsDAV, "getcontenttype")] = davEscape(contentType)
+		props[davName(nsDAV, "creationdate")] = a.Created.UTC().Format(time.RFC3339)
+		if info, err := os.Stat(a.Location); err == nil {
+			props[davName(nsDAV, "getcontentlength")] = strconv.FormatInt(info.Size(), 10)
+			props[davName(nsDAV, "getetag")] = davEscape(assetETag(info))
+			props[davName(nsDAV, "getlastmodified")] = davTime(info.ModTime())
+		}
+	}
+	return props
+}
+
+func davHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 2")
+
+	// A PUT body is spooled before taking the lock, so a slow upload
+	// doesn't hold up every other request
+	var spool *os.File
+	if r.Method == "PUT" {
+		var err error
+		if spool, err = spoolDAVBody(r.Body); err != nil {
+			log.Printf("Error spooling WebDAV upload: %v", err)
+			http.Error(w, "Error reading body", http.StatusBadRequest)
+			return
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+	}
+
+	switch r.Method {
+	case "OPTIONS", "PROPFIND", "GET", "HEAD":
+		davState.RLock()
+		defer davState.RUnlock()
+	default:
+		davState.Lock()
+		defer davState.Unlock()
+	}
+
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, MKCOL, MOVE, LOCK, UNLOCK")
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+	case "PROPFIND":
+		davPropfind(w, r)
+	case "GET", "HEAD":
+		davGet(w, r)
+	case "PUT":
+		davPut(w, r, spool)
+	case "DELETE":
+		davDelete(w, r)
+	case "MKCOL":
+		davMkcol(w, r)
+	case "MOVE":
+		davMove(w, r)
+	case "LOCK":
+		davLock(w, r)
+	case "UNLOCK":
+		davUnlock(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// davServerError logs err and responds with 500
+func davServerError(w http.ResponseWriter, context string, err error) {
+	log.Printf("%s: %v", context, err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// davLoad loads the tree and resolves the request path, responding with an
+// error and returning nil if it can't. With existing the resource must
+// exist, otherwise only its collection.
+func davLoad(w http.ResponseWriter, r *http.Request, existing bool) (*davTree, *davResource) {
+	tree, err := loadDAVTree(db)
+	if err != nil {
+		davServerError(w, "Error loading WebDAV tree", err)
+		return nil, nil
+	}
+	res, ok := tree.resolve(r.URL.Path)
+	switch {
+	case existing && (!ok || res.Kind == davMissing):
+		http.Error(w, "Not found", http.StatusNotFound)
+		return nil, nil
+	case !ok:
+		http.Error(w, "Parent collection does not exist", http.StatusConflict)
+		return nil, nil
+	}
+	return tree, res
+}
+
+func davPropfind(w http.ResponseWriter, r *http.Request) {
+	req, err := parseDAVRequest(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid PROPFIND body", http.StatusBadRequest)
+		return
+	}
+	requested := req.Props
+	if req.AllProp {
+		requested = nil
+	}
+
+	tree, res := davLoad(w, r, true)
+	if res == nil {
+		return
+	}
+
+	out := newDAVPropWriter()
+	out.Response(res.Href(), requested, tree.props(res))
+	// Depth infinity is answered like depth 1
+	if r.Header.Get("Depth") != "0" {
+		for _, member := range tree.members(res) {
+			out.Response(member.Href(), requested, tree.props(member))
+		}
+	}
+	out.Flush(w)
+}
+
+func davGet(w http.ResponseWriter, r *http.Request) {
+	tree, res := davLoad(w, r, true)
+	if res == nil {
+		return
+	}
+
+	switch res.Kind {
+	case davNoteFile:
+		n := tree.notes[res.ID]
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("ETag", noteETag(n))
+		http.ServeContent(w, r, res.Name, n.Modified, strings.NewReader(n.Content))
+	case davAssetFile:
+		f, err := os.Open(tree.assets[res.ID].Location)
+		if err != nil {
+			davServerError(w, "Error opening asset", err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			davServerError(w, "Error reading asset", err)
+			return
+		}
+		w.Header().Set("ETag", assetETag(info))
+		http.ServeContent(w, r, res.Name, info.ModTime(), f)
+	default:
+		http.Error(w, "Collections have no content, use PROPFIND", http.StatusMethodNotAllowed)
+	}
+}
+
+// davWritable checks the locks and ETag preconditions of a write to res,
+// responding with an error and returning false if it must not go ahead
+func davWritable(w http.ResponseWriter, r *http.Request, tree *davTree, res *davResource, deep bool) bool {
+	if davLocked(r, res.Path, deep) {
+		http.Error(w, "Locked", http.StatusLocked)
+		return false
+	}
+	if !checkETagPreconditions(r, tree.etag(res)) {
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// spoolDAVBody writes body to a temporary file in the uploads directory,
+// where an asset can be renamed into place from
+func spoolDAVBody(body io.Reader) (*os.File, error) {
+	if err := os.MkdirAll(uploadsDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("error creating upload directory: %w", err)
+	}
+	f, err := os.CreateTemp(uploadsDir, ".dav-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temporary file: %w", err)
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// davPut saves the body spooled by davHandler
+func davPut(w http.ResponseWriter, r *http.Request, body *os.File) {
+	tree, res := davLoad(w, r, false)
+	if res == nil {
+		return
+	}
+	if !davWritable(w, r, tree, res, false) {
+		return
+	}
+
+	switch {
+	case res.Kind == davNoteFile || res.Kind == davMissing && res.In == davNoteCollection:
+		if !isNoteFile(res.Name) || strings.HasPrefix(res.Name, ".") {
+			http.Error(w, "Notes must be named <title>.md", http.StatusForbidden)
+			return
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			davServerError(w, "Error reading spooled body", err)
+			return
+		}
+		if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+			http.Error(w, "Notes must be UTF-8 text", http.StatusUnsupportedMediaType)
+			return
+		}
+		content := string(data)
+
+		if res.Kind == davNoteFile {
+			_, err = db.Exec("UPDATE notes SET content = $1, modified_at = CURRENT_TIMESTAMP WHERE id = $2", content, res.ID)
+		} else {
+			_, err = createDAVNote(strings.TrimSuffix(res.Name, ".md"), content, res.Parent)
+		}
+		if err != nil {
+			davServerError(w, "Error saving note", err)
+			return
+		}
+		w.Header().Set("ETag", noteETag(&davNote{Content: content}))
+
+	case res.Kind == davAssetFile || res.Kind == davMissing && res.In == davAssetCollection:
+		if strings.HasPrefix(res.Name, ".") {
+			http.Error(w, "Hidden files can't be uploaded", http.StatusForbidden)
+			return
+		}
+		location := ""
+		if res.Kind == davAssetFile {
+			location = tree.assets[res.ID].Location
+		}
+		location, err := storeDAVAsset(res.Name, location, body)
+		if err != nil {
+			davServerError(w, "Error saving asset", err)
+			return
+		}
+		if info, err := os.Stat(location); err == nil {
+			w.Header().Set("ETag", assetETag(info))
+		}
+
+	case res.IsCollection():
+		http.Error(w, "Cannot PUT a collection", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.Error(w, "Files can only be created in "+davRoot+"notes/ and "+davRoot+"assets/", http.StatusForbidden)
+		return
+	}
+
+	if res.Kind == davMissing {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// createDAVNote creates a note under parent, or at the top level if parent
+// is 0
+func createDAVNote(title, content string, parent int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow("INSERT INTO notes (title, content) VALUES ($1, $2) RETURNING id", title, content).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error creating note: %w", err)
+	}
+	if parent != 0 {
+		_, err = tx.Exec(`
+            INSERT INTO note_hierarchy (parent_note_id, child_note_id, hierarchy_type)
+            VALUES ($1, $2, 'subpage')
+        `, parent, id)
+		if err != nil {
+			return 0, fmt.Errorf("error adding note hierarchy entry: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return id, nil
+}
+
+// storeDAVAsset moves the spooled upload tmp to the file at location,
+// replacing it, or to a new asset named name if location is "". It returns
+// the location written. As tmp is written in full first a failed upload
+// leaves the old contents in place.
+func storeDAVAsset(name, location string, tmp *os.File) (string, error) {
+	if location != "" {
+		if err := os.Rename(tmp.Name(), location); err != nil {
+			return "", fmt.Errorf("error replacing file: %w", err)
+		}
+		return location, nil
+	}
+
+	location = filepath.Join(uploadsDir, uniqueUploadName(name))
+	if err := os.Rename(tmp.Name(), location); err != nil {
+		return "", fmt.Errorf("error storing file: %w", err)
+	}
+	_, err := db.Exec(`
+        INSERT INTO assets (asset_type, location, description)
+        VALUES ('', $1, '')
+    `, location)
+	if err != nil {
+		os.Remove(location)
+		return "", fmt.Errorf("error saving asset: %w", err)
+	}
+	return location, nil
+}
+
+func davDelete(w http.ResponseWriter, r *http.Request) {
+	tree, res := davLoad(w, r, true)
+	if res == nil {
+		return
+	}
+	if !davWritable(w, r, tree, res, true) {
+		return
+	}
+
+	var err error
+	switch {
+	case res.Kind == davNoteFile:
+		_, err = deleteNoteByID(res.ID)
+	case res.Kind == davNoteCollection && res.ID != 0:
+		// The collection holds the notes under the note, which keeps its file
+		for _, id := range tree.descendants(res.ID) {
+			if _, err = deleteNoteByID(id); err != nil {
+				break
+			}
+		}
+		delete(davState.collections, res.ID)
+	case res.Kind == davAssetFile:
+		_, err = deleteAssetByID(res.ID)
+	default:
+		http.Error(w, "Cannot delete "+res.Href(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		davServerError(w, "Error deleting WebDAV resource", err)
+		return
+	}
+
+	davRemoveLocks(res.Path)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// davMkcol gives a note a collection, creating an empty note if there is
+// none of that name
+func davMkcol(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > 0 {
+		http.Error(w, "MKCOL bodies are not supported", http.StatusUnsupportedMediaType)
+		return
+	}
+	tree, res := davLoad(w, r, false)
+	if res == nil {
+		return
+	}
+	if res.Kind != davMissing {
+		http.Error(w, "Already exists", http.StatusMethodNotAllowed)
+		return
+	}
+	if res.In != davNoteCollection || strings.HasPrefix(res.Name, ".") {
+		http.Error(w, "Collections can only be created in "+davRoot+"notes/", http.StatusForbidden)
+		return
+	}
+	if davLocked(r, res.Path, false) {
+		http.Error(w, "Locked", http.StatusLocked)
+		return
+	}
+
+	id, ok := fileNames(tree.children(res.Parent), tree.title)[res.Name]
+	if !ok {
+		var err error
+		if id, err = createDAVNote(res.Name, "", res.Parent); err != nil {
+			davServerError(w, "Error creating note", err)
+			return
+		}
+	}
+	davState.collections[id] = true
+	w.WriteHeader(http.StatusCreated)
+}
+
+func davMove(w http.ResponseWriter, r *http.Request) {
+	destination, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || destination.Path == "" {
+		http.Error(w, "Invalid Destination header", http.StatusBadRequest)
+		return
+	}
+
+	tree, src := davLoad(w, r, true)
+	if src == nil {
+		return
+	}
+	dst, ok := tree.resolve(destination.Path)
+	if !ok {
+		http.Error(w, "Destination collection does not exist", http.StatusConflict)
+		return
+	}
+	if dst.Path == src.Path {
+		http.Error(w, "Source and destination are the same", http.StatusForbidden)
+		return
+	}
+	if !davWritable(w, r, tree, src, true) {
+		return
+	}
+	if davLocked(r, dst.Path, true) {
+		http.Error(w, "Locked", http.StatusLocked)
+		return
+	}
+	existed := dst.Kind != davMissing
+	if existed && r.Header.Get("Overwrite") == "F" {
+		http.Error(w, "Destination exists", http.StatusPreconditionFailed)
+		return
+	}
+
+	switch {
+	case src.Kind == davNoteFile &&
+		(dst.Kind == davNoteFile || dst.Kind == davMissing && dst.In == davNoteCollection) &&
+		isNoteFile(dst.Name) && !strings.HasPrefix(dst.Name, "."):
+		if dst.Kind == davNoteFile && dst.ID != src.ID {
+			if _, err = deleteNoteByID(dst.ID); err != nil {
+				break
+			}
+		}
+		err = moveDAVNote(tree, src.ID, strings.TrimSuffix(src.Name, ".md"), dst.Parent, strings.TrimSuffix(dst.Name, ".md"))
+
+	case src.Kind == davNoteCollection && src.ID != 0 &&
+		dst.Kind == davMissing && dst.In == davNoteCollection && !strings.HasPrefix(dst.Name, "."):
+		err = moveDAVNote(tree, src.ID, src.Name, dst.Parent, dst.Name)
+
+	case src.Kind == davAssetFile &&
+		(dst.Kind == davAssetFile || dst.Kind == davMissing && dst.In == davAssetCollection) &&
+		!strings.HasPrefix(dst.Name, "."):
+		if dst.Kind == davAssetFile && dst.ID != src.ID {
+			if _, err = deleteAssetByID(dst.ID); err != nil {
+				break
+			}
+		}
+		err = renameDAVAsset(tree.assets[src.ID], dst.Name)
+
+	default:
+		http.Error(w, "Cannot move "+src.Href()+" to "+dst.Href(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, errHierarchyCycle) {
+		http.Error(w, "Cannot move a note under itself", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		davServerError(w, "Error moving WebDAV resource", err)
+		return
+	}
+
+	// Locks stay with the path rather than follow the resource
+	davRemoveLocks(src.Path)
+	if existed {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+var errHierarchyCycle = errors.New("operation would create a cycle in the hierarchy")
+
+// moveDAVNote moves a note under parent and, if the name changed, sets its
+// title to the new name. Keeping the name keeps the title, which may differ
+// from the name as in "a/b" shown as "a-b".
+func moveDAVNote(tree *davTree, id int, oldName string, parent int, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if tree.notes[id].Parent != parent {
+		if err := setNoteParent(tx, id, parent); err != nil {
+			return err
+		}
+	}
+	if name != oldName {
+		_, err := tx.Exec("UPDATE notes SET title = $1, modified_at = CURRENT_TIMESTAMP WHERE id = $2", name, id)
+		if err != nil {
+			return fmt.Errorf("error renaming note: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// setNoteParent places a note under parent, or at the top level if parent
+// is 0, keeping the hierarchy type of an existing entry
+func setNoteParent(tx *sql.Tx, noteID, parent int) error {
+	if parent == 0 {
+		if _, err := tx.Exec("DELETE FROM note_hierarchy WHERE child_note_id = $1", noteID); err != nil {
+			return fmt.Errorf("error deleting note hierarchy entry: %w", err)
+		}
+		return nil
+	}
+
+	rows, err := tx.Query("SELECT parent_note_id, child_note_id FROM note_hierarchy WHERE child_note_id <> $1", noteID)
+	if err != nil {
+		return fmt.Errorf("error fetching note hierarchies: %w", err)
+	}
+	defer rows.Close()
+	var parents, children []int
+	for rows.Next() {
+		var p, c int
+		if err := rows.Scan(&p, &c); err != nil {
+			return fmt.Errorf("error scanning note hierarchy row: %w", err)
+		}
+		parents = append(parents, p)
+		children = append(children, c)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error after scanning note hierarchy rows: %w", err)
+	}
+	if detectCycle(append(parents, parent), append(children, noteID)) {
+		return errHierarchyCycle
+	}
+
+	result, err := tx.Exec("UPDATE note_hierarchy SET parent_note_id = $1 WHERE child_note_id = $2", parent, noteID)
+	if err != nil {
+		return fmt.Errorf("error updating note hierarchy entry: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	} else if n > 0 {
+		return nil
+	}
+	_, err = tx.Exec(`
+        INSERT INTO note_hierarchy (parent_note_id, child_note_id, hierarchy_type)
+        VALUES ($1, $2, 'subpage')
+    `, parent, noteID)
+	if err != nil {
+		return fmt.Errorf("error adding note hierarchy entry: %w", err)
+	}
+	return nil
+}
+
+// renameDAVAsset stores the file of an asset under a new name
+func renameDAVAsset(a *davAsset, name string) error {
+	location := filepath.Join(uploadsDir, uniqueUploadName(name))
+	if err := os.Rename(a.Location, location); err != nil {
+		return fmt.Errorf("error renaming file: %w", err)
+	}
+	if _, err := db.Exec("UPDATE assets SET location = $1 WHERE id = $2", location, a.ID); err != nil {
+		os.Rename(location, a.Location)
+		return fmt.Errorf("error updating asset location: %w", err)
+	}
+	return nil
+}
+
+// Locks
+
+// covers reports whether l applies to p
+func (l *davWriteLock) covers(p string) bool {
+	return l.Path == p || l.Deep && strings.HasPrefix(p, l.Path+"/")
+}
+
+// davLocksOn returns the unexpired locks that apply to p and, if deep,
+// those on anything under p
+func davLocksOn(p string, deep bool) []*davWriteLock {
+	now := time.Now()
+	var locks []*davWriteLock
+	for _, l := range davState.locks {
+		if now.After(l.Expires) {
+			continue
+		}
+		if l.covers(p) || deep && strings.HasPrefix(l.Path, p+"/") {
+			locks = append(locks, l)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Token < locks[j].Token })
+	return locks
+}
+
+var davTokenPattern = regexp.MustCompile(`<(opaquelocktoken:[^>]+)>`)
+
+// davSubmittedTokens are the lock tokens in the If header of r
+func davSubmittedTokens(r *http.Request) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, m := range davTokenPattern.FindAllStringSubmatch(r.Header.Get("If"), -1) {
+		tokens[m[1]] = true
+	}
+	return tokens
+}
+
+// davLocked reports whether r may not write p (or, if deep, anything under
+// p) because it doesn't submit a token for each locked path
+func davLocked(r *http.Request, p string, deep bool) bool {
+	submitted := davSubmittedTokens(r)
+	unlocked := make(map[string]bool)
+	locked := make(map[string]bool)
+	for _, l := range davLocksOn(p, deep) {
+		locked[l.Path] = true
+		if submitted[l.Token] {
+			unlocked[l.Path] = true
+		}
+	}
+	return len(unlocked) < len(locked)
+}
+
+// davRemoveLocks drops the locks on p and under it, and expired locks
+func davRemoveLocks(p string) {
+	now := time.Now()
+	for token, l := range davState.locks {
+		if l.Path == p || strings.HasPrefix(l.Path, p+"/") || now.After(l.Expires) {
+			delete(davState.locks, token)
+		}
+	}
+}
+
+// davLockTimeout picks the first usable timeout of a Timeout header
+func davLockTimeout(header string) time.Duration {
+	for _, part := range strings.Split(header, ",") {
+		seconds, ok := strings.CutPrefix(strings.TrimSpace(part), "Second-")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(seconds); err == nil && n > 0 && time.Duration(n)*time.Second < davMaxLockTimeout {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return davMaxLockTimeout
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("opaquelocktoken:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func davActiveLock(l *davWriteLock) string {
+	scope, depth := "<d:exclusive/>", "0"
+	if l.Shared {
+		scope = "<d:shared/>"
+	}
+	if l.Deep {
+		depth = "infinity"
+	}
+	owner := ""
+	if l.Owner != "" {
+		owner = "<d:owner><d:href>" + davEscape(l.Owner) + "</d:href></d:owner>"
+	}
+	return fmt.Sprintf("<d:activelock><d:locktype><d:write/></d:locktype><d:lockscope>%s</d:lockscope>"+
+		"<d:depth>%s</d:depth>%s<d:timeout>Second-%d</d:timeout>"+
+		"<d:locktoken><d:href>%s</d:href></d:locktoken><d:lockroot><d:href>%s</d:href></d:lockroot></d:activelock>",
+		scope, depth, owner, int(l.Timeout.Seconds()), davEscape(l.Token), davEscape(l.Href))
+}
+
+func writeLockDiscovery(w http.ResponseWriter, status int, l *davWriteLock) {
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `%s<d:prop xmlns:d="%s"><d:lockdiscovery>%s</d:lockdiscovery></d:prop>`, xml.Header, nsDAV, davActiveLock(l))
+}
+
+// davLockInfo is the body of a LOCK request, the owner is kept as text
+type davLockInfo struct {
+	Scope struct {
+		Exclusive *struct{} `xml:"exclusive"`
+		Shared    *struct{} `xml:"shared"`
+	} `xml:"lockscope"`
+	Owner struct {
+		Href string `xml:"href"`
+		Text string `xml:",chardata"`
+	} `xml:"owner"`
+}
+
+// davLock takes or refreshes a write lock. Unmapped paths can be locked so
+// a client can lock a file before creating it.
+func davLock(w http.ResponseWriter, r *http.Request) {
+	_, res := davLoad(w, r, false)
+	if res == nil {
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading body", http.StatusBadRequest)
+		return
+	}
+	timeout := davLockTimeout(r.Header.Get("Timeout"))
+
+	// Without a body a lock given in the If header is refreshed
+	if len(bytes.TrimSpace(body)) == 0 {
+		for token := range davSubmittedTokens(r) {
+			if l, ok := davState.locks[token]; ok && l.covers(res.Path) && time.Now().Before(l.Expires) {
+				l.Timeout, l.Expires = timeout, time.Now().Add(timeout)
+				writeLockDiscovery(w, http.StatusOK, l)
+				return
+			}
+		}
+		http.Error(w, "No lock to refresh", http.StatusPreconditionFailed)
+		return
+	}
+
+	var info davLockInfo
+	if err := xml.Unmarshal(body, &info); err != nil {
+		http.Error(w, "Invalid LOCK body", http.StatusBadRequest)
+		return
+	}
+	shared := info.Scope.Shared != nil
+	deep := r.Header.Get("Depth") != "0"
+	for _, l := range davLocksOn(res.Path, deep) {
+		if !shared || !l.Shared {
+			http.Error(w, "Locked", http.StatusLocked)
+			return
+		}
+	}
+
+	token, err := newLockToken()
+	if err != nil {
+		davServerError(w, "Error generating lock token", err)
+		return
+	}
+	owner := strings.TrimSpace(info.Owner.Href)
+	if owner == "" {
+		owner = strings.TrimSpace(info.Owner.Text)
+	}
+	for t, l := range davState.locks {
+		if time.Now().After(l.Expires) {
+			delete(davState.locks, t)
+		}
+	}
+	l := &davWriteLock{
+		Token:   token,
+		Path:    res.Path,
+		Href:    res.Href(),
+		Deep:    deep,
+		Shared:  shared,
+		Owner:   owner,
+		Timeout: timeout,
+		Expires: time.Now().Add(timeout),
+	}
+	davState.locks[token] = l
+
+	w.Header().Set("Lock-Token", "<"+token+">")
+	writeLockDiscovery(w, http.StatusOK, l)
+}
+
+func davUnlock(w http.ResponseWriter, r *http.Request) {
+	token := strings.Trim(strings.TrimSpace(r.Header.Get("Lock-Token")), "<>")
+	l, ok := davState.locks[token]
+	if !ok || !l.covers(path.Clean(r.URL.Path)) {
+		http.Error(w, "No such lock on this resource", http.StatusConflict)
+		return
+	}
+	delete(davState.locks, token)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dav sends a WebDAV request and returns the response with its body read,
+// it fails the test unless the response has the wanted status
+func (api *testAPI) dav(method, path, body string, header http.Header, want int) (*http.Response, string) {
+	api.t.Helper()
+	resp := api.request(method, path, body, header)
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != want {
+		api.t.Fatalf("%s %s: got %d, want %d: %s", method, path, resp.StatusCode, want, data)
+	}
+	return resp, string(data)
+}
+
+// resetDAVState forgets the locks and collections of earlier tests
+func resetDAVState(t *testing.T) {
+	davState.Lock()
+	defer davState.Unlock()
+	davState.locks = make(map[string]*davWriteLock)
+	davState.collections = make(map[int]bool)
+}
+
+func TestWebDAVPutAndPropfind(t *testing.T) {
+	chdirTemp(t)
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		resetDAVState(t)
+
+		resp, _ := api.dav("PUT", "/dav/notes/Shopping.md", "Milk", nil, http.StatusCreated)
+		etag := resp.Header.Get("ETag")
+		if _, got := api.dav("GET", "/dav/notes/Shopping.md", "", nil, http.StatusOK); got != "Milk" {
+			t.Errorf("GET after PUT: got %q", got)
+		}
+
+		// If-Match guards against overwriting a change made elsewhere
+		api.dav("PUT", "/dav/notes/Shopping.md", "Milk and eggs", http.Header{"If-Match": {etag}}, http.StatusNoContent)
+		api.dav("PUT", "/dav/notes/Shopping.md", "Bread", http.Header{"If-Match": {etag}}, http.StatusPreconditionFailed)
+		api.dav("PUT", "/dav/notes/Shopping.bin", "\x00", nil, http.StatusForbidden)
+		api.dav("PUT", "/dav/notes/Missing/Shopping.md", "Milk", nil, http.StatusConflict)
+
+		api.dav("PUT", "/dav/assets/diagram.txt", "boxes", nil, http.StatusCreated)
+		if _, got := api.dav("GET", "/dav/assets/diagram.txt", "", nil, http.StatusOK); got != "boxes" {
+			t.Errorf("GET asset: got %q", got)
+		}
+		api.dav("PUT", "/dav/assets/diagram.txt", "boxes and arrows", nil, http.StatusNoContent)
+		if _, got := api.dav("GET", "/dav/assets/diagram.txt", "", nil, http.StatusOK); got != "boxes and arrows" {
+			t.Errorf("GET replaced asset: got %q", got)
+		}
+		// The spooled bodies are gone
+		if entries, err := os.ReadDir(uploadsDir); err == nil {
+			for _, e := range entries {
+				if strings.HasPrefix(e.Name(), ".dav-") {
+					t.Errorf("left behind %s", e.Name())
+				}
+			}
+		}
+
+		_, body := api.dav("PROPFIND", "/dav/notes/", "", http.Header{"Depth": {"1"}}, http.StatusMultiStatus)
+		if !strings.Contains(body, "<d:href>/dav/notes/Shopping.md</d:href>") {
+			t.Errorf("PROPFIND depth 1 does not list the note:\n%s", body)
+		}
+		_, body = api.dav("PROPFIND", "/dav/notes/", "", http.Header{"Depth": {"0"}}, http.StatusMultiStatus)
+		if strings.Contains(body, "Shopping.md") {
+			t.Errorf("PROPFIND depth 0 lists the members:\n%s", body)
+		}
+		api.dav("PROPFIND", "/dav/notes/Nothing.md", "", nil, http.StatusNotFound)
+	})
+}
+
+func TestWebDAVLockAndMove(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		resetDAVState(t)
+		api.dav("PUT", "/dav/notes/Draft.md", "First", nil, http.StatusCreated)
+
+		lockBody := `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>tester</D:owner></D:lockinfo>`
+		resp, _ := api.dav("LOCK", "/dav/notes/Draft.md", lockBody, http.Header{"Depth": {"0"}}, http.StatusOK)
+		token := strings.Trim(resp.Header.Get("Lock-Token"), "<>")
+		if token == "" {
+			t.Fatal("LOCK returned no token")
+		}
+		api.dav("LOCK", "/dav/notes/Draft.md", lockBody, http.Header{"Depth": {"0"}}, http.StatusLocked)
+
+		// Writes need the token
+		withToken := http.Header{"If": {"(<" + token + ">)"}}
+		api.dav("PUT", "/dav/notes/Draft.md", "Second", nil, http.StatusLocked)
+		api.dav("PUT", "/dav/notes/Draft.md", "Second", withToken, http.StatusNoContent)
+		move := http.Header{"Destination": {api.url + "/dav/notes/Final.md"}}
+		api.dav("MOVE", "/dav/notes/Draft.md", "", move, http.StatusLocked)
+		api.dav("UNLOCK", "/dav/notes/Draft.md", "", http.Header{"Lock-Token": {"<" + token + ">"}}, http.StatusNoContent)
+
+		// Renaming the file renames the note
+		api.dav("MOVE", "/dav/notes/Draft.md", "", move, http.StatusCreated)
+		api.dav("GET", "/dav/notes/Draft.md", "", nil, http.StatusNotFound)
+		if _, got := api.dav("GET", "/dav/notes/Final.md", "", nil, http.StatusOK); got != "Second" {
+			t.Errorf("GET after MOVE: got %q", got)
+		}
+
+		// Moving into a collection makes it a child note
+		api.dav("MKCOL", "/dav/notes/Project", "", nil, http.StatusCreated)
+		into := http.Header{"Destination": {api.url + "/dav/notes/Project/Final.md"}}
+		api.dav("MOVE", "/dav/notes/Final.md", "", into, http.StatusCreated)
+		api.dav("GET", "/dav/notes/Project/Final.md", "", nil, http.StatusOK)
+		api.dav("PUT", "/dav/notes/Other.md", "", nil, http.StatusCreated)
+		over := http.Header{"Destination": {api.url + "/dav/notes/Other.md"}, "Overwrite": {"F"}}
+		api.dav("MOVE", "/dav/notes/Project/Final.md", "", over, http.StatusPreconditionFailed)
+	})
+}
+
+func TestWebDAVSlowPutDoesNotBlock(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, api *testAPI) {
+		resetDAVState(t)
+
+		// An upload that hasn't finished sending its body
+		body, writer := io.Pipe()
+		done := make(chan int)
+		go func() {
+			req, _ := http.NewRequest("PUT", api.url+"/dav/notes/Slow.md", body)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				done <- 0
+				return
+			}
+			resp.Body.Close()
+			done <- resp.StatusCode
+		}()
+		writer.Write([]byte("Part one, "))
+
+		// Other requests, writes included, go ahead meanwhile
+		finished := make(chan [2]int)
+		go func() {
+			put := api.request("PUT", "/dav/notes/Quick.md", "Done", nil)
+			put.Body.Close()
+			propfind := api.request("PROPFIND", "/dav/notes/", "", http.Header{"Depth": {"1"}})
+			propfind.Body.Close()
+			finished <- [2]int{put.StatusCode, propfind.StatusCode}
+		}()
+		select {
+		case status := <-finished:
+			if status != [2]int{http.StatusCreated, http.StatusMultiStatus} {
+				t.Errorf("PUT and PROPFIND during the upload: got %v", status)
+			}
+		case <-time.After(5 * time.Second):
+			writer.CloseWithError(errors.New("timed out"))
+			<-done
+			<-finished
+			t.Fatal("requests waited for the upload to finish")
+		}
+
+		writer.Write([]byte("part two"))
+		writer.Close()
+		if status := <-done; status != http.StatusCreated {
+			t.Fatalf("slow PUT: got %d, want 201", status)
+		}
+		if _, got := api.dav("GET", "/dav/notes/Slow.md", "", nil, http.StatusOK); got != "Part one, part two" {
+			t.Errorf("GET after the slow PUT: got %q", got)
+		}
+	})
+}
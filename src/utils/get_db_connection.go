@@ -3,16 +3,52 @@ package cmd
 import (
 	"database/sql"
 	_ "embed"
+	"errors"
 	"fmt"
-	"log"
+	"os"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/spf13/viper"
 )
 
-// Opens a new connection to the specified PostgreSQL database.
+// Supported database drivers (--db_driver)
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Db_driver returns the configured database driver, Postgres by default
+func Db_driver() string {
+	if driver := viper.GetString("db_driver"); driver != "" {
+		return driver
+	}
+	return Postgres
+}
+
+// Sqlite_path returns the file of the SQLite database, --db_path or the
+// database name with a .db extension
+func Sqlite_path(dbName string) string {
+	if path := viper.GetString("db_path"); path != "" {
+		return path
+	}
+	return dbName + ".db"
+}
+
+// Opens a new connection to the specified database.
 // using the connection details from the parent command
-func Get_db(dbName string) *sql.DB {
+func Get_db(dbName string) (*sql.DB, error) {
+	switch Db_driver() {
+	case Postgres:
+	case SQLite:
+		db, err := Open_sqlite(Sqlite_path(dbName))
+		if err != nil {
+			return nil, fmt.Errorf("error opening database connection: %w", err)
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown db_driver %q, expected %s or %s", Db_driver(), Postgres, SQLite)
+	}
+
 	dbHost := viper.GetString("db_host")
 	dbPort := viper.GetInt("db_port")
 	dbUser := viper.GetString("db_user")
@@ -20,50 +56,77 @@ func Get_db(dbName string) *sql.DB {
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 
 		dbHost, dbPort, dbUser, dbPass, dbName)
+	// Timestamps are read back in UTC, all-day deadlines rely on this
+	connStr += " timezone=UTC"
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		log.Fatalf("Error opening database connection: %v", err)
+		return nil, fmt.Errorf("error opening database connection: %w", err)
 	}
-	return db
+	return db, nil
 }
 
-// Drop the specified database
+// Drop the specified database if it exists
 // This assumes there are no active connections to the database
-// and that the database exists
 // Also assumes there is a postgres database to connect to
-func Drop_db() {
-	fmt.Println("Dropping database...")
-
-	dbName := "draftsmith"
+func Drop_db(dbName string) error {
+	if Db_driver() == SQLite {
+		path := Sqlite_path(dbName)
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("error dropping database %s: %w", path, err)
+			}
+		}
+		return nil
+	}
 
 	// Connect to the default database
-	db := Get_db("postgres")
+	db, err := Get_db("postgres")
+	if err != nil {
+		return err
+	}
 	defer db.Close()
 
 	// Drop the specified database
-	stmt := fmt.Sprintf("DROP DATABASE IF EXISTS %s", dbName)
-	_, err := db.Exec(stmt)
-	if err != nil {
-		log.Fatalf("Error dropping database: %v", err)
+	stmt := fmt.Sprintf("DROP DATABASE IF EXISTS %s", pq.QuoteIdentifier(dbName))
+	if _, err := db.Exec(stmt); err != nil {
+		return fmt.Errorf("error dropping database %s: %w", dbName, err)
 	}
-
-	fmt.Println("Database dropped successfully")
+	return nil
 }
 
-// Create the new database (called "draftsmith")
-// This assumes the database does not already exist
+// Create the specified database unless it already exists, reporting
+// whether it was created
 // Also assumes there is a postgres database to connect to
-func Create_db() {
-	dbName := "draftsmith"
+func Create_db(dbName string) (bool, error) {
+	if Db_driver() == SQLite {
+		// The file is created when it is first opened
+		_, err := os.Stat(Sqlite_path(dbName))
+		if errors.Is(err, os.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
 
 	// Connect to the default database
-	db := Get_db("postgres")
+	db, err := Get_db("postgres")
+	if err != nil {
+		return false, err
+	}
 	defer db.Close()
 
-	// Create the new database
-	stmt := fmt.Sprintf("CREATE DATABASE %s", dbName)
-	_, err := db.Exec(stmt)
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", dbName).Scan(&exists)
 	if err != nil {
-		log.Fatalf("Error creating database: %v", err)
+		return false, fmt.Errorf("error checking for database %s: %w", dbName, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	// Create the new database
+	stmt := fmt.Sprintf("CREATE DATABASE %s", pq.QuoteIdentifier(dbName))
+	if _, err := db.Exec(stmt); err != nil {
+		return false, fmt.Errorf("error creating database %s: %w", dbName, err)
 	}
+	return true, nil
 }
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// SQLite support
+//
+// The queries are written for Postgres and run largely unchanged on
+// SQLite. The driver registered here wraps the modernc SQLite driver to
+// hide the differences that can't be seen in the SQL:
+//
+//   - Times are written in UTC in a single format, so that they sort and
+//     compare correctly as text, and are read back in UTC like the
+//     Postgres connection (which sets timezone=UTC).
+//   - Timestamps computed by expressions, e.g. MAX(clock_out) or
+//     COALESCE(clock_out, $1), have no declared type so the driver returns
+//     them as strings. They are parsed back into times.
+//   - Postgres' transaction-local settings, set_config(name, value, true),
+//     are kept in the transaction_settings table, which is emptied when a
+//     transaction commits. Triggers read them from there.
+//   - SQLite reports a foreign key violation the same way whether the
+//     record referred to is missing or the record deleted is still referred
+//     to. Violations by a DELETE are returned as SQLiteReferencedError.
+
+const sqliteDriverName = "draftsmith-sqlite"
+
+// TransactionSettingsTable holds the settings of the open transaction
+const TransactionSettingsTable = "transaction_settings"
+
+func init() {
+	sql.Register(sqliteDriverName, sqliteDriver{})
+}
+
+// Open_sqlite opens the SQLite database at path, creating the file if it
+// doesn't exist
+func Open_sqlite(path string) (*sql.DB, error) {
+	q := url.Values{}
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "busy_timeout(10000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Set("_time_format", "sqlite")
+	// Transactions take the write lock when they start, which stands in
+	// for the row locks (SELECT ... FOR UPDATE) taken on Postgres
+	q.Set("_txlock", "immediate")
+
+	escape := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+	return sql.Open(sqliteDriverName, "file:"+escape.Replace(path)+"?"+q.Encode())
+}
+
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(name string) (driver.Conn, error) {
+	c, err := (&sqlite.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	conn := &sqliteConn{c.(sqliteDriverConn)}
+	_, err = conn.ExecContext(context.Background(),
+		"CREATE TABLE IF NOT EXISTS "+TransactionSettingsTable+" (name TEXT PRIMARY KEY, value TEXT)", nil)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// sqliteDriverConn is implemented by the modernc driver's connections
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type sqliteConn struct {
+	sqliteDriverConn
+}
+
+// CheckNamedValue converts arguments as database/sql would, times are
+// converted to UTC
+func (c *sqliteConn) CheckNamedValue(nv *driver.NamedValue) error {
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	if t, ok := v.(time.Time); ok {
+		v = t.UTC()
+	}
+	nv.Value = v
+	return nil
+}
+
+func (c *sqliteConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.sqliteDriverConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteTx{Tx: tx, conn: c}, nil
+}
+
+func (c *sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.sqliteDriverConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStmt{Stmt: s, query: query}, nil
+}
+
+func (c *sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.sqliteDriverConn.ExecContext(ctx, query, args)
+	return result, sqliteExecError(query, err)
+}
+
+func (c *sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.sqliteDriverConn.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return newSqliteRows(rows), nil
+}
+
+// sqliteTx empties the transaction settings before committing
+type sqliteTx struct {
+	driver.Tx
+	conn *sqliteConn
+}
+
+func (t *sqliteTx) Commit() error {
+	_, err := t.conn.ExecContext(context.Background(), "DELETE FROM "+TransactionSettingsTable, nil)
+	if err != nil {
+		t.Tx.Rollback()
+		return err
+	}
+	return t.Tx.Commit()
+}
+
+type sqliteStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *sqliteStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	result, err := s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+	return result, sqliteExecError(s.query, err)
+}
+
+// sqliteConstraintForeignKey is the extended result code of a foreign key
+// violation
+const sqliteConstraintForeignKey = 787
+
+// SQLiteReferencedError is a foreign key violation caused by deleting a
+// record that other records still refer to
+type SQLiteReferencedError struct {
+	Err *sqlite.Error
+}
+
+func (e *SQLiteReferencedError) Error() string { return e.Err.Error() }
+func (e *SQLiteReferencedError) Unwrap() error { return e.Err }
+
+// sqliteExecError tells foreign key violations by a DELETE apart, a DELETE
+// can't refer to a missing record
+func sqliteExecError(query string, err error) error {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code() != sqliteConstraintForeignKey {
+		return err
+	}
+	if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "DELETE") {
+		return &SQLiteReferencedError{Err: sqliteErr}
+	}
+	return err
+}
+
+func (s *sqliteStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	return newSqliteRows(rows), nil
+}
+
+// sqliteTimestamp matches the times written by the driver and by
+// CURRENT_TIMESTAMP, and those formatted by strftime in the schema
+var sqliteTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// sqliteRows reads times back in UTC
+type sqliteRows struct {
+	driver.Rows
+	declTypes []string
+}
+
+func newSqliteRows(rows driver.Rows) *sqliteRows {
+	r := &sqliteRows{Rows: rows}
+	if typed, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		for i := range rows.Columns() {
+			r.declTypes = append(r.declTypes, typed.ColumnTypeDatabaseTypeName(i))
+		}
+	}
+	return r
+}
+
+func (r *sqliteRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+	for i, v := range dest {
+		switch v := v.(type) {
+		case time.Time:
+			dest[i] = v.UTC()
+		case string:
+			// Columns without a declared type are expressions
+			if i < len(r.declTypes) && r.declTypes[i] == "" && sqliteTimestamp.MatchString(v) {
+				if t, ok := parseSqliteTime(v); ok {
+					dest[i] = t
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *sqliteRows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.declTypes) {
+		return r.declTypes[index]
+	}
+	return ""
+}
+
+func parseSqliteTime(s string) (time.Time, bool) {
+	for _, layout := range sqliteTimeFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}